@@ -1,22 +1,166 @@
+/*
+ * Author: Lewis Maitland
+ *
+ * Copyright (c) 2019 Lewis Maitland
+ */
+
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"go-brunel/internal/pkg/shared/remote"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
 	"gopkg.in/yaml.v2"
 )
 
-func main() {
-	c, err := remote.GenerateCredentials()
+const certUsage = `usage: cert <command> [flags]
+
+commands:
+  init-ca        generate a new certificate authority
+  issue-runner   issue client credentials for a runner
+  issue-server   issue server credentials for the RPC endpoint
+  revoke         revoke a runner certificate
+`
+
+func loadAuthority(file string) (*remote.Authority, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading certificate authority")
+	}
+	authority := remote.Authority{}
+	return &authority, errors.Wrap(yaml.Unmarshal(b, &authority), "error decoding certificate authority")
+}
+
+func printYaml(v interface{}) error {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "error encoding yaml")
+	}
+	fmt.Print(string(b))
+	return nil
+}
+
+func initCA(args []string) error {
+	flags := pflag.NewFlagSet("init-ca", pflag.ExitOnError)
+	caFile := flags.String("ca", "ca.yaml", "file to write the certificate authority to")
+	force := flags.Bool("force", false, "overwrite an existing certificate authority")
+	_ = flags.Parse(args)
+
+	if _, err := os.Stat(*caFile); err == nil && !*force {
+		return fmt.Errorf("certificate authority '%s' already exists, use --force to overwrite it", *caFile)
+	}
+
+	authority, err := remote.GenerateAuthority()
+	if err != nil {
+		return err
+	}
+
+	b, err := yaml.Marshal(authority)
+	if err != nil {
+		return errors.Wrap(err, "error encoding yaml")
+	}
+	if err := ioutil.WriteFile(*caFile, b, 0600); err != nil {
+		return errors.Wrap(err, "error writing certificate authority")
+	}
+	log.Printf("certificate authority written to %s, keep this file secret\n", *caFile)
+	return nil
+}
+
+func issueRunner(args []string) error {
+	flags := pflag.NewFlagSet("issue-runner", pflag.ExitOnError)
+	caFile := flags.String("ca", "ca.yaml", "certificate authority file")
+	name := flags.String("name", "", "unique name of the runner")
+	_ = flags.Parse(args)
+
+	authority, err := loadAuthority(*caFile)
 	if err != nil {
-		println(err)
+		return err
 	}
-	b := bytes.Buffer{}
 
-	err = yaml.NewEncoder(&b).Encode(c)
+	credentials, err := authority.IssueRunner(*name)
 	if err != nil {
-		println(fmt.Errorf("error encoding yaml: %v", err))
+		return err
+	}
+	return printYaml(credentials)
+}
+
+func issueServer(args []string) error {
+	flags := pflag.NewFlagSet("issue-server", pflag.ExitOnError)
+	caFile := flags.String("ca", "ca.yaml", "certificate authority file")
+	hosts := flags.StringSlice("hosts", nil, "comma separated host names or IP addresses runners use to reach the server")
+	_ = flags.Parse(args)
+
+	authority, err := loadAuthority(*caFile)
+	if err != nil {
+		return err
+	}
+
+	credentials, err := authority.IssueServer(*hosts)
+	if err != nil {
+		return err
+	}
+	return printYaml(credentials)
+}
+
+func revoke(args []string) error {
+	flags := pflag.NewFlagSet("revoke", pflag.ExitOnError)
+	listFile := flags.String("revocation-list", "revoked.yaml", "revocation list file, this should match remote.revocation-list on the server")
+	certFile := flags.String("cert", "", "PEM encoded certificate to revoke")
+	serial := flags.String("serial", "", "hex serial number of the certificate to revoke")
+	_ = flags.Parse(args)
+
+	list, err := remote.LoadRevocationList(*listFile)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *certFile != "":
+		b, err := ioutil.ReadFile(*certFile)
+		if err != nil {
+			return errors.Wrap(err, "error reading certificate")
+		}
+		if err := list.Revoke(string(b)); err != nil {
+			return err
+		}
+	case *serial != "":
+		s, ok := new(big.Int).SetString(strings.TrimPrefix(*serial, "0x"), 16)
+		if !ok {
+			return fmt.Errorf("invalid serial number '%s'", *serial)
+		}
+		list.RevokeSerial(s, "")
+	default:
+		return errors.New("either --cert or --serial must be specified")
+	}
+
+	if err := list.Save(*listFile); err != nil {
+		return err
+	}
+	log.Printf("revocation list %s updated\n", *listFile)
+	return nil
+}
+
+func main() {
+	commands := map[string]func(args []string) error{
+		"init-ca":      initCA,
+		"issue-runner": issueRunner,
+		"issue-server": issueServer,
+		"revoke":       revoke,
+	}
+
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		fmt.Print(certUsage)
+		os.Exit(2)
+	}
+
+	if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+		log.Fatal(err)
 	}
-	println(b.String())
 }
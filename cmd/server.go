@@ -7,27 +7,56 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"go-brunel/internal/pkg/server"
 	"go-brunel/internal/pkg/server/endpoint/api/container"
 	"go-brunel/internal/pkg/server/endpoint/api/environment"
 	"go-brunel/internal/pkg/server/endpoint/api/hook"
 	"go-brunel/internal/pkg/server/endpoint/api/job"
+	"go-brunel/internal/pkg/server/endpoint/api/notification"
 	"go-brunel/internal/pkg/server/endpoint/api/repository"
+	"go-brunel/internal/pkg/server/endpoint/api/runner"
+	"go-brunel/internal/pkg/server/endpoint/api/search"
 	"go-brunel/internal/pkg/server/endpoint/api/user"
 	"go-brunel/internal/pkg/server/endpoint/remote"
+	"go-brunel/internal/pkg/server/retention"
+	"go-brunel/internal/pkg/server/scheduler"
+	logsearch "go-brunel/internal/pkg/server/search"
 	"go-brunel/internal/pkg/server/security"
+	"go-brunel/internal/pkg/server/stream"
+	"go-brunel/internal/pkg/server/sweeper"
+	"go-brunel/internal/pkg/shared/vcs"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+const migrateUsage = `usage: server migrate [flags]
+
+Applies the pending database migrations, the server also applies them when it starts.
+
+flags:
+`
+
+// shutdownTimeout is how long requests in progress are given to finish when the server is stopped
+const shutdownTimeout = 30 * time.Second
+
+const migrateLogsUsage = `usage: server migrate-logs
+
+Moves the container logs kept in the mongo database to the configured log storage.
+`
+
 func FileServer(router *chi.Mux) {
 	root := "./web"
 	fs := http.FileServer(http.Dir(root))
@@ -68,6 +97,51 @@ func loadServerConfig() (error, server.Config) {
 	return conf.Unmarshal(&serverConfig), serverConfig
 }
 
+// migrate applies or with --dry-run lists the pending database migrations
+func migrate(serverConfig server.Config, args []string) error {
+	flags := pflag.NewFlagSet("migrate", pflag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "list the pending migrations without applying them")
+	flags.Usage = func() {
+		fmt.Print(migrateUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	migrations, err := serverConfig.Migrate(*dryRun)
+	if err != nil {
+		return err
+	}
+
+	if len(migrations) == 0 {
+		fmt.Println("no pending migrations")
+	}
+	for _, migration := range migrations {
+		if *dryRun {
+			fmt.Printf("pending %d: %s\n", migration.Version, migration.Description)
+		} else {
+			fmt.Printf("applied %d: %s\n", migration.Version, migration.Description)
+		}
+	}
+	return nil
+}
+
+// migrateLogs moves container logs out of the database
+func migrateLogs(serverConfig server.Config, args []string) error {
+	flags := pflag.NewFlagSet("migrate-logs", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Print(migrateLogsUsage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	migrated, err := serverConfig.MigrateLogs()
+	fmt.Printf("migrated the logs of %d containers\n", migrated)
+	return err
+}
+
 func main() {
 	err, serverConfig := loadServerConfig()
 	if err != nil {
@@ -79,6 +153,21 @@ func main() {
 		log.Fatal(err)
 	}
 
+	commands := map[string]func(serverConfig server.Config, args []string) error{
+		"migrate":      migrate,
+		"migrate-logs": migrateLogs,
+	}
+	if len(os.Args) > 1 && commands[os.Args[1]] != nil {
+		if err := commands[os.Args[1]](serverConfig, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if _, err := serverConfig.Migrate(false); err != nil {
+		log.Fatal(err)
+	}
+
 	jobStore, err := serverConfig.GetJobStore()
 	if err != nil {
 		log.Fatal(err)
@@ -114,6 +203,26 @@ func main() {
 		log.Fatal(err)
 	}
 
+	enrollmentTokenStore, err := serverConfig.GetEnrollmentTokenStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	notificationDeliveryStore, err := serverConfig.GetNotificationDeliveryStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokenStore, err := serverConfig.GetTokenStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scheduleStore, err := serverConfig.GetScheduleStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	notifier, err := serverConfig.GetNotifier()
 	if err != nil {
 		log.Fatal(err)
@@ -124,6 +233,17 @@ func main() {
 		log.Fatal(err)
 	}
 
+	var enrollment *remote.Enrollment
+	if serverConfig.Remote.Authority != nil {
+		enrollment = &remote.Enrollment{
+			Authority:            serverConfig.Remote.Authority,
+			EnrollmentTokenStore: enrollmentTokenStore,
+		}
+	}
+
+	// Job changes received from runners are published on the bus for the streaming endpoints
+	bus := &stream.Bus{}
+
 	err = remote.Server(
 		jobStore,
 		logStore,
@@ -132,14 +252,52 @@ func main() {
 		environmentStore,
 		stageStore,
 		notifier,
+		bus,
+		enrollment,
 		*serverConfig.Remote.Credentials,
+		serverConfig.Remote.RevocationList,
 		serverConfig.Remote.Listen,
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	jwtSerializer := serverConfig.GetJWTSerializer()
+	gitResolver := &vcs.GitResolver{}
+
+	(&scheduler.Scheduler{
+		JobStore:        jobStore,
+		RepositoryStore: repositoryStore,
+		ScheduleStore:   scheduleStore,
+		Resolver:        gitResolver,
+		Notify:          notifier,
+	}).Start(context.Background(), time.Minute)
+
+	(&sweeper.Sweeper{
+		JobStore:        jobStore,
+		RepositoryStore: repositoryStore,
+		Notify:          notifier,
+	}).Start(context.Background(), time.Minute)
+
+	purger := &retention.Purger{
+		JobStore:        jobStore,
+		RepositoryStore: repositoryStore,
+		ContainerStore:  containerStore,
+		LogStore:        logStore,
+	}
+	purger.Start(context.Background(), time.Hour)
+
+	searcher := &logsearch.Searcher{
+		JobStore:        jobStore,
+		RepositoryStore: repositoryStore,
+		ContainerStore:  containerStore,
+		LogStore:        logStore,
+	}
+
+	// Personal tokens are accepted wherever the JWTs issued when signing in are
+	jwtSerializer := security.NewPersonalTokenSerializer(
+		serverConfig.GetJWTSerializer(),
+		user.PersonalTokenAuthenticator(tokenStore, userStore),
+	)
 
 	router := chi.NewRouter()
 	router.Use(
@@ -156,12 +314,15 @@ func main() {
 				security.Middleware("keymatch_model.conf", "routes.csv", jwtSerializer),
 				middleware.Recoverer,
 			)
-			r.Mount("/hook", hook.Routes(serverConfig.WebHook, jobStore, repositoryStore, notifier))
+			r.Mount("/hook", hook.Routes(serverConfig.WebHook, jobStore, repositoryStore, notifier, gitResolver))
 			r.Mount("/environment", environment.Routes(environmentStore))
-			r.Mount("/repository", repository.Routes(repositoryStore, jobStore))
-			r.Mount("/job", job.Routes(jobStore, logStore, stageStore, containerStore, repositoryStore, jwtSerializer))
-			r.Mount("/container", container.Routes(logStore, containerStore, jwtSerializer))
-			r.Mount("/user", user.Routes(serverConfig.DefaultAdminUser, userStore, oauths, jwtSerializer))
+			r.Mount("/repository", repository.Routes(repositoryStore, jobStore, environmentStore, gitResolver, notifier, jwtSerializer, purger))
+			r.Mount("/job", job.Routes(jobStore, logStore, stageStore, containerStore, repositoryStore, jwtSerializer, bus))
+			r.Mount("/container", container.Routes(logStore, containerStore, jwtSerializer, bus))
+			r.Mount("/search", search.Routes(searcher))
+			r.Mount("/runner", runner.Routes(enrollmentTokenStore, jwtSerializer))
+			r.Mount("/notification", notification.Routes(notificationDeliveryStore))
+			r.Mount("/user", user.Routes(serverConfig.DefaultAdminUser, userStore, tokenStore, oauths, jwtSerializer))
 		})
 
 	FileServer(router)
@@ -174,6 +335,25 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
-	log.Infof("listening for http connections on: '%s'", serverConfig.Listen)
-	log.Fatal(http.ListenAndServe(serverConfig.Listen, router))
+	httpServer := &http.Server{Addr: serverConfig.Listen, Handler: router}
+	go func() {
+		log.Infof("listening for http connections on: '%s'", serverConfig.Listen)
+		if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Container log lines are buffered before they are written, so they are flushed before the server exits
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	log.Info("received ", <-signals, ", shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Error("error shutting down http server: ", err)
+	}
+	if err := serverConfig.FlushLogs(); err != nil {
+		log.Error(err)
+	}
 }
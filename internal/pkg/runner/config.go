@@ -12,6 +12,10 @@ import (
 	"go-brunel/internal/pkg/runner/vcs"
 	"go-brunel/internal/pkg/shared"
 	credentials "go-brunel/internal/pkg/shared/remote"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"os"
 )
 
 type Config struct {
@@ -27,9 +31,19 @@ type Config struct {
 	Remote *struct {
 		Endpoint    string
 		Credentials *credentials.Credentials
+
+		// EnrollmentToken is exchanged for a client certificate on first connect when no certificate is configured
+		EnrollmentToken string `mapstructure:"enrollment-token"`
+
+		// CredentialsFile is where credentials received during enrollment are stored
+		CredentialsFile string `mapstructure:"credentials-file"`
 	}
 }
 
+const (
+	defaultCredentialsFile = "runner-credentials.yaml"
+)
+
 func (config *Config) Valid() error {
 
 	if config.Remote != nil && config.Remote.Credentials == nil {
@@ -107,9 +121,65 @@ func (config *Config) runtimeFactory() (runtime.Factory, error) {
 	}, nil
 }
 
+// credentials resolves the client credentials for connecting to the remote server. When no client certificate is
+// configured the credentials stored by a previous enrollment are used, failing that the enrollment token is exchanged
+// for new credentials which are stored for next time.
+func (config *Config) credentials() (*credentials.Credentials, error) {
+	c := config.Remote.Credentials
+	if c.Cert != "" && c.Key != "" {
+		return c, nil
+	}
+
+	file := config.Remote.CredentialsFile
+	if file == "" {
+		file = defaultCredentialsFile
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err == nil {
+		stored := credentials.Credentials{}
+		if err := yaml.Unmarshal(b, &stored); err != nil {
+			return nil, errors.Wrap(err, "error decoding stored credentials")
+		}
+		config.Remote.Credentials = &stored
+		return &stored, nil
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "error reading stored credentials")
+	}
+
+	if config.Remote.EnrollmentToken == "" {
+		return nil, errors.New("no remote.credentials.cert or remote.enrollment-token has been supplied")
+	}
+	if c.CA == "" {
+		return nil, errors.New("remote.credentials.ca must be supplied when enrolling")
+	}
+
+	log.Println("enrolling runner with remote server")
+	enrolled, err := remote.Enroll(c.CA, config.Remote.Endpoint, config.Remote.EnrollmentToken)
+	if err != nil {
+		return nil, errors.Wrap(err, "error enrolling runner")
+	}
+
+	b, err = yaml.Marshal(enrolled)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding enrolled credentials")
+	}
+	if err := ioutil.WriteFile(file, b, 0600); err != nil {
+		return nil, errors.Wrap(err, "error storing enrolled credentials")
+	}
+	log.Println("enrolled credentials stored in ", file)
+
+	config.Remote.Credentials = enrolled
+	return enrolled, nil
+}
+
 func (config *Config) remote() (remote.Remote, error) {
 	if config.Remote != nil {
-		return remote.NewRPCClient(*config.Remote.Credentials, config.Remote.Endpoint)
+		c, err := config.credentials()
+		if err != nil {
+			return nil, err
+		}
+		return remote.NewRPCClient(*c, config.Remote.Endpoint)
 	}
 	return nil, nil
 }
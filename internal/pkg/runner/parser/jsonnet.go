@@ -11,6 +11,7 @@ import (
 	"go-brunel/internal/pkg/runner/trigger"
 	"go-brunel/internal/pkg/runner/vcs"
 	"go-brunel/internal/pkg/shared"
+	"go-brunel/internal/pkg/shared/util"
 	"io"
 	"io/ioutil"
 	"os"
@@ -29,6 +30,14 @@ type sharedLibrary struct {
 	File       string
 }
 
+// pullRequest is the representation of a pull request exposed to jsonnet as brunel.build.pullRequest
+type pullRequest struct {
+	Number       int64  `json:"number"`
+	SourceBranch string `json:"sourceBranch"`
+	TargetBranch string `json:"targetBranch"`
+	Author       string `json:"author"`
+}
+
 type JsonnetParser struct {
 	Event               trigger.Event
 	EnvironmentProvider environment.Provider
@@ -180,6 +189,18 @@ func (parser *JsonnetParser) parseToJSON(workingDir string, lib sharedLibrary, s
 		Params: ast.Identifiers{"string"},
 	})
 
+	vm.NativeFunction(&jsonnet.NativeFunction{
+		Func: func(args []interface{}) (interface{}, error) {
+			// When the changed files are not known we assume everything has changed
+			if parser.Event.Job.ChangedFiles == nil {
+				return true, nil
+			}
+			return util.MatchAnyGlob([]string{args[0].(string)}, parser.Event.Job.ChangedFiles)
+		},
+		Name:   "changed",
+		Params: ast.Identifiers{"string"},
+	})
+
 	vm.NativeFunction(&jsonnet.NativeFunction{
 		Func: func(args []interface{}) (interface{}, error) {
 			dd, ee := regexp.Match(args[0].(string), []byte(args[1].(string)))
@@ -189,19 +210,69 @@ func (parser *JsonnetParser) parseToJSON(workingDir string, lib sharedLibrary, s
 		Params: ast.Identifiers{"string", "string"},
 	})
 
+	// JSON is valid jsonnet so parameters can be embedded directly into our library
+	parameters := parser.Event.Job.Parameters
+	if parameters == nil {
+		parameters = map[string]string{}
+	}
+	parametersJSON, err := json.Marshal(parameters)
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding job parameters")
+	}
+
+	// Jobs not started by a pull request have a null pullRequest
+	var pr *pullRequest
+	if p := parser.Event.Job.PullRequest; p != nil {
+		pr = &pullRequest{
+			Number:       p.Number,
+			SourceBranch: p.SourceBranch,
+			TargetBranch: p.TargetBranch,
+			Author:       p.Author,
+		}
+	}
+	pullRequestJSON, err := json.Marshal(pr)
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding job pull request")
+	}
+
+	changedFilesJSON, err := json.Marshal(parser.Event.Job.ChangedFiles)
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding job changed files")
+	}
+
+	branchJSON, err := json.Marshal(parser.Event.Job.Commit.Branch)
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding job branch")
+	}
+
+	revisionJSON, err := json.Marshal(parser.Event.Job.Commit.Revision)
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding job revision")
+	}
+
 	library := fmt.Sprintf(`
 local brunel = {
     shared(config):: std.parseJson(std.native('shared')(std.toString(config))),
     match(regex, string):: std.native('match')(regex, string),
+    changed(glob):: std.native('changed')(glob),
 	environment: {
     	variable(name):: std.native('environment_variable')(name)
 	},
 	build: {
-		branch: '%s',
-		revision: '%s'
-	}
+		branch: %s,
+		revision: %s,
+		pullRequest: %s,
+		changedFiles: %s
+	},
+	parameters: %s
 };
-`, parser.Event.Job.Commit.Branch, parser.Event.Job.Commit.Revision)
+`,
+		branchJSON,
+		revisionJSON,
+		pullRequestJSON,
+		changedFilesJSON,
+		parametersJSON,
+	)
 
 	js, err := vm.EvaluateSnippet(lib.File, library+string(snippet))
 	if err != nil {
@@ -99,6 +99,85 @@ func TestJsonnetParser_Parse(t *testing.T) {
 			},
 		},
 
+		// Tests that job parameters are available
+		{
+			files: map[string]string{
+				".brunel.jsonnet": `
+{
+    stages: [
+		{
+			name: brunel.parameters.TARGET,
+			when: std.objectHas(brunel.parameters, 'MISSING')
+		},
+    ]
+}`,
+			},
+			expect: func(t *testing.T, spec *shared.Spec, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				test.ExpectString(t, "staging", string(spec.Stages[0].ID))
+				if spec.Stages[0].When == nil || *spec.Stages[0].When != false {
+					t.Fatal("expected missing parameter to be absent")
+				}
+			},
+		},
+
+		// Tests that pull request information is available
+		{
+			files: map[string]string{
+				".brunel.jsonnet": `
+{
+    stages: [
+		{
+			name: brunel.build.pullRequest.sourceBranch + '-' + brunel.build.pullRequest.targetBranch,
+			when: brunel.build.pullRequest.number == 12 && brunel.build.pullRequest.author == 'author'
+		},
+    ]
+}`,
+			},
+			expect: func(t *testing.T, spec *shared.Spec, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				test.ExpectString(t, "feature-master", string(spec.Stages[0].ID))
+				if spec.Stages[0].When == nil || *spec.Stages[0].When != true {
+					t.Fatal("expected pull request number and author to match")
+				}
+			},
+		},
+
+		// Tests that changed files are available
+		{
+			files: map[string]string{
+				".brunel.jsonnet": `
+{
+    stages: [
+		{
+			name: brunel.build.changedFiles[0],
+			when: brunel.changed('services/api/**')
+		},
+		{
+			name: 'web',
+			when: brunel.changed('services/web/**')
+		},
+    ]
+}`,
+			},
+			expect: func(t *testing.T, spec *shared.Spec, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				test.ExpectString(t, "services/api/main.go", string(spec.Stages[0].ID))
+				if spec.Stages[0].When == nil || *spec.Stages[0].When != true {
+					t.Fatal("expected api files to have changed")
+				}
+				if spec.Stages[1].When == nil || *spec.Stages[1].When != false {
+					t.Fatal("expected web files not to have changed")
+				}
+			},
+		},
+
 		// Tests that we can read a file, load local shared library and read values from our environment in both the library and local file
 		{
 			env: map[string]string{
@@ -376,6 +455,16 @@ local shared = brunel.shared({
 								Branch:   "branch",
 								Revision: "revision",
 							},
+							Parameters: map[string]string{
+								"TARGET": "staging",
+							},
+							PullRequest: &shared.PullRequest{
+								Number:       12,
+								SourceBranch: "feature",
+								TargetBranch: "master",
+								Author:       "author",
+							},
+							ChangedFiles: []string{"services/api/main.go", "README.md"},
 						},
 						JobState: nil,
 						WorkDir:  testWorkSpaceDir,
@@ -0,0 +1,41 @@
+package remote
+
+import (
+	"crypto/tls"
+	"go-brunel/internal/pkg/shared/remote"
+	"net/rpc"
+
+	"github.com/pkg/errors"
+)
+
+// Enroll exchanges a single use enrollment token for client credentials signed by the servers certificate authority.
+// The certificate authority is used to verify the server, as we have no client certificate of our own yet.
+func Enroll(ca string, endpoint string, token string) (*remote.Credentials, error) {
+	key, publicKey, err := remote.GenerateRunnerKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating runner key")
+	}
+
+	tlsConfig, err := (&remote.Credentials{CA: ca}).EnrollmentConfig(endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating TLS configuration for enrolling with RPC endpoint")
+	}
+
+	conn, err := tls.Dial("tcp", endpoint, tlsConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "error dialing RPC endpoint")
+	}
+	client := rpc.NewClient(conn)
+	defer client.Close()
+
+	var reply remote.EnrollResponse
+	if err := client.Call("Enrollment.Enroll", &remote.EnrollRequest{Token: token, PublicKey: publicKey}, &reply); err != nil {
+		return nil, rpcError(err)
+	}
+
+	return &remote.Credentials{
+		CA:   reply.CA,
+		Cert: reply.Cert,
+		Key:  key,
+	}, nil
+}
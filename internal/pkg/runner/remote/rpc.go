@@ -17,7 +17,7 @@ func rpcError(err error) error {
 }
 
 func NewRPCClient(credentials remote.Credentials, endpoint string) (Remote, error) {
-	tlsConfig, err := credentials.ClientConfig()
+	tlsConfig, err := credentials.ClientConfig(endpoint)
 	if err != nil {
 		return nil, errors.Wrap(err, "error generating TLS configuration for connecting to RPC endpoint")
 	}
@@ -4,12 +4,21 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"strings"
 )
 
 type GitVCS struct {
 }
 
+// isRequestRef checks if a branch is the ref of a pull or merge request rather than a branch or tag
+func isRequestRef(branch string) bool {
+	return strings.HasPrefix(branch, "refs/") &&
+		!strings.HasPrefix(branch, "refs/heads/") &&
+		!strings.HasPrefix(branch, "refs/tags/")
+}
+
 func (s *GitVCS) Clone(options Options) error {
 	if _, err := fmt.Fprintf(
 		options.Progress,
@@ -33,6 +42,19 @@ func (s *GitVCS) Clone(options Options) error {
 		)
 	}
 
+	// Pull and merge request refs, such as refs/pull/1/head, are not fetched when cloning
+	if isRequestRef(options.Branch) {
+		refSpec := config.RefSpec(fmt.Sprintf("+%s:%s", options.Branch, options.Branch))
+		err := repo.Fetch(&git.FetchOptions{
+			RemoteName: options.Branch,
+			RefSpecs:   []config.RefSpec{refSpec},
+			Progress:   options.Progress,
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return errors.Wrap(err, fmt.Sprintf("error fetching %s from repository %s", options.Branch, options.RepositoryURL))
+		}
+	}
+
 	if options.Revision == "" {
 		return nil
 	}
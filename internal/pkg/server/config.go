@@ -1,7 +1,10 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"github.com/dgrijalva/jwt-go"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/providers/github"
 	"github.com/markbates/goth/providers/gitlab"
@@ -9,14 +12,30 @@ import (
 	"go-brunel/internal/pkg/server/notify"
 	"go-brunel/internal/pkg/server/security"
 	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/store/bolt"
+	"go-brunel/internal/pkg/server/store/chunk"
+	"go-brunel/internal/pkg/server/store/memory"
 	"go-brunel/internal/pkg/server/store/mongo"
+	"go-brunel/internal/pkg/server/store/postgres"
 	"go-brunel/internal/pkg/shared"
 	"go-brunel/internal/pkg/shared/remote"
+	"go.etcd.io/bbolt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type RemoteConfiguration struct {
 	Listen      string
 	Credentials *remote.Credentials
+
+	// Authority is the certificate authority used for signing runner certificates during enrollment.
+	// Runner enrollment is disabled when this is not configured.
+	Authority *remote.Authority
+
+	// RevocationList is the path of the file listing revoked runner certificates, see the cert revoke command
+	RevocationList string `mapstructure:"revocation-list"`
 }
 
 type JwtConfiguration struct {
@@ -30,14 +49,62 @@ type OAuthConfiguration struct {
 }
 
 type WebHookConfiguration struct {
-	GitLabSecret string `mapstructure:"gitlab-secret"`
-	GitHubSecret string `mapstructure:"github-secret"`
+	GitLabSecret          string `mapstructure:"gitlab-secret"`
+	GitHubSecret          string `mapstructure:"github-secret"`
+	GiteaSecret           string `mapstructure:"gitea-secret"`
+	BitbucketServerSecret string `mapstructure:"bitbucket-server-secret"`
+
+	// Generic hooks are received on /api/hook/generic/{name}, keyed by name
+	Generic map[string]GenericWebHookConfiguration
+}
+
+// GenericWebHookConfiguration maps fields of an arbitrary JSON payload to a job using JSONPath expressions,
+// for example '$.repository.url'. When Project or Name are empty they are taken from the repository URL.
+type GenericWebHookConfiguration struct {
+	// Secret is used to validate the HMAC SHA256 signature in the X-Brunel-Signature header
+	Secret string
+
+	Repository string
+	Project    string
+	Name       string
+	Branch     string
+	Revision   string
+	Author     string
+}
+
+// NotificationConfiguration sends notifications to several notifiers, each route selecting the jobs it receives
+type NotificationConfiguration struct {
+	// QueueSize is the number of notifications that can wait for delivery, per route
+	QueueSize int `mapstructure:"queue-size"`
+	Routes    []NotificationRouteConfiguration
+}
+
+// NotificationRouteConfiguration configures a notifier and the jobs it is sent. Repositories are globs matched against
+// "project/name", Branches are globs and States are job state names such as "failed". Empty filters match anything.
+type NotificationRouteConfiguration struct {
+	Type shared.NotificationType
+
+	Repositories []string
+	Branches     []string
+	States       []string
+	StageUpdates bool `mapstructure:"stage-updates"`
+
+	// URL is the address notifications are sent to, for chat routes this is the incoming webhook
+	URL string
+
+	// Secret signs the payloads of webhook routes
+	Secret string
 }
 
 type Config struct {
 	Listen      string
 	Persistence shared.PersistenceType
 	Mongo       *shared.MongoConfig
+	Postgres    *shared.PostgresConfig
+	Bolt        *shared.BoltConfig
+
+	// Logs configures where container logs are kept, by default they are kept by the persistence
+	Logs shared.LogConfig
 
 	EnvironmentProvider shared.EnvironmentProviderType `mapstructure:"environment-provider"`
 	Kubernetes          *shared.KubernetesConfig
@@ -48,6 +115,10 @@ type Config struct {
 
 	Notification shared.NotificationType
 	GitLab       *shared.GitLabConfig
+	GitHub       *shared.GitHubConfig
+	SMTP         *shared.SMTPConfig
+
+	Notifications NotificationConfiguration
 
 	Remote RemoteConfiguration
 
@@ -62,6 +133,19 @@ func (config *Config) Validate() error {
 	if config.Persistence == shared.PersistenceTypeMongo && config.Mongo == nil {
 		return errors.New("invalid configuration, expecting mongoDB configuration when using mongoDB persistence")
 	}
+	if config.Persistence == shared.PersistenceTypePostgres && (config.Postgres == nil || config.Postgres.URI == "") {
+		return errors.New("invalid configuration, expecting postgres configuration when using postgres persistence")
+	}
+	if config.Persistence == shared.PersistenceTypeBolt && (config.Bolt == nil || config.Bolt.Path == "") {
+		return errors.New("invalid configuration, expecting bolt.path when using bolt persistence")
+	}
+	if config.Logs.Storage == shared.LogStorageTypeFile && (config.Logs.File == nil || config.Logs.File.Path == "") {
+		return errors.New("invalid configuration, expecting logs.file.path when using file log storage")
+	}
+	if config.Logs.Storage == shared.LogStorageTypeS3 &&
+		(config.Logs.S3 == nil || config.Logs.S3.Endpoint == "" || config.Logs.S3.Bucket == "") {
+		return errors.New("invalid configuration, expecting logs.s3.endpoint and logs.s3.bucket when using s3 log storage")
+	}
 	if config.Jwt.Secret == "" || config.Jwt.DefaultRole == "" {
 		return errors.New("jwt.secret and jwt.default-role must not be empty")
 	}
@@ -76,22 +160,222 @@ func (config *Config) Validate() error {
 	return nil
 }
 
+// notificationStores holds the stores used by notifiers, they are only connected when a notifier needs them
+type notificationStores struct {
+	config          *Config
+	jobStore        store.JobStore
+	repositoryStore store.RepositoryStore
+	stageStore      store.StageStore
+}
+
+func (stores *notificationStores) get() (store.JobStore, store.RepositoryStore, store.StageStore, error) {
+	if stores.jobStore != nil {
+		return stores.jobStore, stores.repositoryStore, stores.stageStore, nil
+	}
+
+	jobStore, err := stores.config.GetJobStore()
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error getting job store")
+	}
+	repositoryStore, err := stores.config.GetRepositoryStore()
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error getting repository store")
+	}
+	stageStore, err := stores.config.GetStageStore()
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error getting stage store")
+	}
+
+	stores.jobStore, stores.repositoryStore, stores.stageStore = jobStore, repositoryStore, stageStore
+	return jobStore, repositoryStore, stageStore, nil
+}
+
+func (config *Config) getNotifierOfType(
+	notificationType shared.NotificationType,
+	route NotificationRouteConfiguration,
+	stores *notificationStores,
+) (notify.Notify, error) {
+	switch notificationType {
+	case shared.NotificationTypeGitLab:
+		if config.GitLab == nil {
+			return nil, errors.New("gitlab configuration must be specified when using gitlab build notifications")
+		}
+		jobStore, repositoryStore, _, err := stores.get()
+		if err != nil {
+			return nil, err
+		}
+		return &notify.GitLabNotify{
+			URL:             config.GitLab.URL,
+			Secret:          config.GitLab.Secret,
+			ServerName:      config.ServerName,
+			JobStore:        jobStore,
+			RepositoryStore: repositoryStore,
+		}, nil
+	case shared.NotificationTypeGitHub:
+		if config.GitHub == nil {
+			return nil, errors.New("github configuration must be specified when using github build notifications")
+		}
+		jobStore, repositoryStore, stageStore, err := stores.get()
+		if err != nil {
+			return nil, err
+		}
+
+		gitHubNotify := &notify.GitHubNotify{
+			URL:             config.GitHub.URL,
+			Token:           config.GitHub.Token,
+			ServerName:      config.ServerName,
+			JobStore:        jobStore,
+			RepositoryStore: repositoryStore,
+			StageStore:      stageStore,
+		}
+		if config.GitHub.AppID != 0 {
+			key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(config.GitHub.PrivateKey))
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing github app private key")
+			}
+			gitHubNotify.App = &notify.GitHubApp{
+				ID:             config.GitHub.AppID,
+				InstallationID: config.GitHub.InstallationID,
+				PrivateKey:     key,
+			}
+		} else if config.GitHub.Token == "" {
+			return nil, errors.New("github.token or github.app-id must be specified when using github build notifications")
+		}
+		return gitHubNotify, nil
+	case shared.NotificationTypeChat:
+		if route.URL == "" {
+			return nil, errors.New("url must be specified for chat notifications")
+		}
+		jobStore, repositoryStore, _, err := stores.get()
+		if err != nil {
+			return nil, err
+		}
+		return &notify.ChatNotify{
+			URL:             route.URL,
+			ServerName:      config.ServerName,
+			JobStore:        jobStore,
+			RepositoryStore: repositoryStore,
+		}, nil
+	case shared.NotificationTypeWebHook:
+		if route.URL == "" {
+			return nil, errors.New("url must be specified for webhook notifications")
+		}
+		jobStore, repositoryStore, stageStore, err := stores.get()
+		if err != nil {
+			return nil, err
+		}
+		deliveryStore, err := config.GetNotificationDeliveryStore()
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting notification delivery store")
+		}
+		return &notify.WebHookNotify{
+			URL:             route.URL,
+			Secret:          route.Secret,
+			ServerName:      config.ServerName,
+			JobStore:        jobStore,
+			RepositoryStore: repositoryStore,
+			StageStore:      stageStore,
+			DeliveryStore:   deliveryStore,
+		}, nil
+	case shared.NotificationTypeEmail:
+		if config.SMTP == nil || config.SMTP.Host == "" || config.SMTP.From == "" {
+			return nil, errors.New("smtp.host and smtp.from must be specified when using email notifications")
+		}
+		jobStore, repositoryStore, stageStore, err := stores.get()
+		if err != nil {
+			return nil, err
+		}
+		containerStore, err := config.GetContainerStore()
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting container store")
+		}
+		logStore, err := config.GetLogStore()
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting log store")
+		}
+		userStore, err := config.GetUserStore()
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting user store")
+		}
+
+		port := config.SMTP.Port
+		if port == 0 {
+			port = 25
+		}
+		return &notify.EmailNotify{
+			Address:         net.JoinHostPort(config.SMTP.Host, strconv.Itoa(port)),
+			Username:        config.SMTP.Username,
+			Password:        config.SMTP.Password,
+			From:            config.SMTP.From,
+			ServerName:      config.ServerName,
+			LogLines:        config.SMTP.LogLines,
+			JobStore:        jobStore,
+			RepositoryStore: repositoryStore,
+			StageStore:      stageStore,
+			ContainerStore:  containerStore,
+			LogStore:        logStore,
+			UserStore:       userStore,
+		}, nil
+	case shared.NotificationTypeLog, "":
+		return &notify.TextNotify{}, nil
+	default:
+		return nil, fmt.Errorf("unknown notification type '%s'", notificationType)
+	}
+}
+
+// GetNotifier returns a composite notifier delivering to each of the notifications.routes in the background, or to
+// the notifier selected by notification when no routes are configured. Notifications are always delivered in the
+// background, so the runner calls and requests that send them never wait on slow notifiers.
 func (config *Config) GetNotifier() (notify.Notify, error) {
-	//if config.Notification == shared.NotificationTypeGitLab {
-	//	if config.GitLab == nil {
-	//		return nil, errors.New("gitlab configuration must be specified when using gitlab build notifications")
-	//	}
-	//	repository, err := config.GetRepository()
-	//	if err != nil {
-	//		return nil, errors.Wrap(err, "error getting repository")
-	//	}
-	//	return &notify.GitLabNotify{
-	//		URL:        config.GitLab.URL,
-	//		Secret:     config.GitLab.Secret,
-	//		Repository: repository,
-	//	}, nil
-	//}
-	return &notify.TextNotify{}, nil
+	stores := &notificationStores{config: config}
+
+	var routes []notify.Route
+	if len(config.Notifications.Routes) == 0 {
+		notifier, err := config.getNotifierOfType(config.Notification, NotificationRouteConfiguration{}, stores)
+		if err != nil {
+			return nil, err
+		}
+		name := config.Notification
+		if name == "" {
+			name = shared.NotificationTypeLog
+		}
+		routes = append(routes, notify.Route{
+			Name:         fmt.Sprintf("%s notifier", name),
+			Notify:       notifier,
+			StageUpdates: true,
+		})
+	}
+
+	for i, r := range config.Notifications.Routes {
+		notifier, err := config.getNotifierOfType(r.Type, r, stores)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating notification route %d", i)
+		}
+
+		route := notify.Route{
+			Name:         fmt.Sprintf("%s route %d", r.Type, i),
+			Notify:       notifier,
+			Repositories: r.Repositories,
+			Branches:     r.Branches,
+			StageUpdates: r.StageUpdates,
+		}
+		for _, name := range r.States {
+			state, err := notify.ParseJobState(name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error creating notification route %d", i)
+			}
+			route.States = append(route.States, state)
+		}
+		routes = append(routes, route)
+	}
+
+	jobStore, repositoryStore, _, err := stores.get()
+	if err != nil {
+		return nil, err
+	}
+	composite := notify.NewComposite(jobStore, repositoryStore, config.Notifications.QueueSize, routes...)
+	composite.Start(context.Background())
+	return composite, nil
 }
 
 func (config *Config) GetJWTSerializer() security.TokenSerializer {
@@ -116,6 +400,84 @@ func (config *Config) GetOAuthProviders() ([]goth.Provider, error) {
 	return providers, nil
 }
 
+var (
+	postgresMutex     sync.Mutex
+	postgresDatabases = map[string]*sql.DB{}
+)
+
+// getPostgresDatabase connects to postgres and migrates the schema on first use, the stores share its connection pool
+func (config *Config) getPostgresDatabase() (*sql.DB, error) {
+	if config.Postgres == nil {
+		return nil, errors.New("no postgres configuration detected")
+	}
+
+	postgresMutex.Lock()
+	defer postgresMutex.Unlock()
+
+	if db, ok := postgresDatabases[config.Postgres.URI]; ok {
+		return db, nil
+	}
+	db, err := postgres.Open(config.Postgres.URI)
+	if err != nil {
+		return nil, err
+	}
+	postgresDatabases[config.Postgres.URI] = db
+	return db, nil
+}
+
+var (
+	boltMutex     sync.Mutex
+	boltDatabases = map[string]*bbolt.DB{}
+)
+
+// getBoltDatabase opens the bolt database file on first use, a file can only be opened once so the stores share it
+func (config *Config) getBoltDatabase() (*bbolt.DB, error) {
+	if config.Bolt == nil {
+		return nil, errors.New("no bolt configuration detected")
+	}
+
+	boltMutex.Lock()
+	defer boltMutex.Unlock()
+
+	if db, ok := boltDatabases[config.Bolt.Path]; ok {
+		return db, nil
+	}
+	db, err := bolt.Open(config.Bolt.Path)
+	if err != nil {
+		return nil, err
+	}
+	boltDatabases[config.Bolt.Path] = db
+	return db, nil
+}
+
+// Migrate applies the pending schema migrations of the configured persistence, returning them. A dry run only returns
+// the migrations that would be applied. Only mongo has versioned migrations, postgres migrates its schema when it is
+// opened and bolt and memory have no schema.
+func (config *Config) Migrate(dryRun bool) ([]mongo.Migration, error) {
+	switch config.Persistence {
+	case shared.PersistenceTypeMongo:
+		if config.Mongo == nil {
+			return nil, errors.New("no mongo configuration detected")
+		}
+		database, err := config.Mongo.GetMongoDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return mongo.Migrate(database, dryRun)
+	case shared.PersistenceTypePostgres:
+		if dryRun {
+			return nil, errors.New("postgres migrations can not be dry run, the schema is migrated when the server starts")
+		}
+		_, err := config.getPostgresDatabase()
+		return nil, err
+	default:
+		return nil, nil
+	}
+}
+
+// memoryDatabase holds the state of every store when using memory persistence
+var memoryDatabase = memory.NewDatabase()
+
 func (config *Config) GetJobStore() (store.JobStore, error) {
 	switch config.Persistence {
 	case shared.PersistenceTypeMongo:
@@ -129,6 +491,26 @@ func (config *Config) GetJobStore() (store.JobStore, error) {
 		return &mongo.JobStore{
 			Database: database,
 		}, nil
+	case shared.PersistenceTypePostgres:
+		db, err := config.getPostgresDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &postgres.JobStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeBolt:
+		db, err := config.getBoltDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &bolt.JobStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeMemory:
+		return &memory.JobStore{
+			Database: memoryDatabase,
+		}, nil
 	default:
 		return nil, errors.New("no persistence configuration detected")
 	}
@@ -147,6 +529,26 @@ func (config *Config) GetStageStore() (store.StageStore, error) {
 		return &mongo.StageStore{
 			Database: database,
 		}, nil
+	case shared.PersistenceTypePostgres:
+		db, err := config.getPostgresDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &postgres.StageStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeBolt:
+		db, err := config.getBoltDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &bolt.StageStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeMemory:
+		return &memory.StageStore{
+			Database: memoryDatabase,
+		}, nil
 	default:
 		return nil, errors.New("no persistence configuration detected")
 	}
@@ -165,6 +567,26 @@ func (config *Config) GetUserStore() (store.UserStore, error) {
 		return &mongo.UserStore{
 			Database: database,
 		}, nil
+	case shared.PersistenceTypePostgres:
+		db, err := config.getPostgresDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &postgres.UserStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeBolt:
+		db, err := config.getBoltDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &bolt.UserStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeMemory:
+		return &memory.UserStore{
+			Database: memoryDatabase,
+		}, nil
 	default:
 		return nil, errors.New("no persistence configuration detected")
 	}
@@ -183,6 +605,26 @@ func (config *Config) GetRepositoryStore() (store.RepositoryStore, error) {
 		return &mongo.RepositoryStore{
 			Database: database,
 		}, nil
+	case shared.PersistenceTypePostgres:
+		db, err := config.getPostgresDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &postgres.RepositoryStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeBolt:
+		db, err := config.getBoltDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &bolt.RepositoryStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeMemory:
+		return &memory.RepositoryStore{
+			Database: memoryDatabase,
+		}, nil
 	default:
 		return nil, errors.New("no persistence configuration detected")
 	}
@@ -201,12 +643,137 @@ func (config *Config) GetEnvironmentStore() (store.EnvironmentStore, error) {
 		return &mongo.EnvironmentStore{
 			Database: database,
 		}, nil
+	case shared.PersistenceTypePostgres:
+		db, err := config.getPostgresDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &postgres.EnvironmentStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeBolt:
+		db, err := config.getBoltDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &bolt.EnvironmentStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeMemory:
+		return &memory.EnvironmentStore{
+			Database: memoryDatabase,
+		}, nil
 	default:
 		return nil, errors.New("no persistence configuration detected")
 	}
 }
 
+var (
+	chunkLogMutex sync.Mutex
+	chunkLogStore *chunk.LogStore
+)
+
+// GetLogStore returns the log store of the persistence, or when log storage is configured a chunk log store keeping
+// container logs in chunk files. The chunk log store is shared, as lines are buffered before they are written, and
+// flushes idle lines in the background.
 func (config *Config) GetLogStore() (store.LogStore, error) {
+	if config.Logs.Storage == "" {
+		return config.getDatabaseLogStore()
+	}
+
+	chunkLogMutex.Lock()
+	defer chunkLogMutex.Unlock()
+
+	if chunkLogStore != nil {
+		return chunkLogStore, nil
+	}
+
+	var storage chunk.Storage
+	switch config.Logs.Storage {
+	case shared.LogStorageTypeFile:
+		if config.Logs.File == nil {
+			return nil, errors.New("no file log storage configuration detected")
+		}
+		storage = &chunk.FileStorage{Path: config.Logs.File.Path}
+	case shared.LogStorageTypeS3:
+		if config.Logs.S3 == nil {
+			return nil, errors.New("no s3 log storage configuration detected")
+		}
+		storage = &chunk.S3Storage{
+			Endpoint:  config.Logs.S3.Endpoint,
+			Bucket:    config.Logs.S3.Bucket,
+			Region:    config.Logs.S3.Region,
+			AccessKey: config.Logs.S3.AccessKey,
+			SecretKey: config.Logs.S3.SecretKey,
+		}
+	default:
+		return nil, fmt.Errorf("unknown log storage '%s'", config.Logs.Storage)
+	}
+
+	logStore, err := config.getDatabaseLogStore()
+	if err != nil {
+		return nil, err
+	}
+	chunkLogStore = &chunk.LogStore{
+		LogStore:   logStore,
+		Storage:    storage,
+		ChunkLines: config.Logs.ChunkLines,
+	}
+	chunkLogStore.Start(context.Background(), chunk.DefaultFlushAge)
+	return chunkLogStore, nil
+}
+
+// FlushLogs writes every line buffered by the chunk log store, it is called when the server stops
+func (config *Config) FlushLogs() error {
+	chunkLogMutex.Lock()
+	defer chunkLogMutex.Unlock()
+
+	if chunkLogStore == nil {
+		return nil
+	}
+	return errors.Wrap(chunkLogStore.Flush(true), "error flushing container logs")
+}
+
+// MigrateLogs moves the container logs kept in the mongo database to the configured log storage, returning the number
+// of containers moved. The logs of a container are deleted from the database once they have been written.
+func (config *Config) MigrateLogs() (int, error) {
+	if config.Persistence != shared.PersistenceTypeMongo || config.Mongo == nil {
+		return 0, errors.New("container logs can only be migrated from mongo persistence")
+	}
+	if config.Logs.Storage == "" {
+		return 0, errors.New("no log storage configuration detected")
+	}
+
+	logStore, err := config.GetLogStore()
+	if err != nil {
+		return 0, err
+	}
+	database, err := config.Mongo.GetMongoDatabase()
+	if err != nil {
+		return 0, err
+	}
+	from := &mongo.LogStore{Database: database}
+
+	ids, err := from.FindContainerIDs()
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		logs, err := from.FilterContainerLogByContainerIDFromTime(id, time.Time{})
+		if err != nil {
+			return i, err
+		}
+		if err := logStore.(*chunk.LogStore).Import(id, logs); err != nil {
+			return i, errors.Wrapf(err, "error migrating logs of container %s", id)
+		}
+		if err := from.DeleteContainerLogByContainerID(id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+func (config *Config) getDatabaseLogStore() (store.LogStore, error) {
 	switch config.Persistence {
 	case shared.PersistenceTypeMongo:
 		if config.Mongo == nil {
@@ -219,6 +786,26 @@ func (config *Config) GetLogStore() (store.LogStore, error) {
 		return &mongo.LogStore{
 			Database: database,
 		}, nil
+	case shared.PersistenceTypePostgres:
+		db, err := config.getPostgresDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &postgres.LogStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeBolt:
+		db, err := config.getBoltDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &bolt.LogStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeMemory:
+		return &memory.LogStore{
+			Database: memoryDatabase,
+		}, nil
 	default:
 		return nil, errors.New("no persistence configuration detected")
 	}
@@ -237,6 +824,178 @@ func (config *Config) GetContainerStore() (store.ContainerStore, error) {
 		return &mongo.ContainerStore{
 			Database: database,
 		}, nil
+	case shared.PersistenceTypePostgres:
+		db, err := config.getPostgresDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &postgres.ContainerStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeBolt:
+		db, err := config.getBoltDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &bolt.ContainerStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeMemory:
+		return &memory.ContainerStore{
+			Database: memoryDatabase,
+		}, nil
+	default:
+		return nil, errors.New("no persistence configuration detected")
+	}
+}
+
+func (config *Config) GetEnrollmentTokenStore() (store.EnrollmentTokenStore, error) {
+	switch config.Persistence {
+	case shared.PersistenceTypeMongo:
+		if config.Mongo == nil {
+			return nil, errors.New("no mongo configuration detected")
+		}
+		database, err := config.Mongo.GetMongoDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &mongo.EnrollmentTokenStore{
+			Database: database,
+		}, nil
+	case shared.PersistenceTypePostgres:
+		db, err := config.getPostgresDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &postgres.EnrollmentTokenStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeBolt:
+		db, err := config.getBoltDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &bolt.EnrollmentTokenStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeMemory:
+		return &memory.EnrollmentTokenStore{
+			Database: memoryDatabase,
+		}, nil
+	default:
+		return nil, errors.New("no persistence configuration detected")
+	}
+}
+
+func (config *Config) GetTokenStore() (store.TokenStore, error) {
+	switch config.Persistence {
+	case shared.PersistenceTypeMongo:
+		if config.Mongo == nil {
+			return nil, errors.New("no mongo configuration detected")
+		}
+		database, err := config.Mongo.GetMongoDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &mongo.TokenStore{
+			Database: database,
+		}, nil
+	case shared.PersistenceTypePostgres:
+		db, err := config.getPostgresDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &postgres.TokenStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeBolt:
+		db, err := config.getBoltDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &bolt.TokenStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeMemory:
+		return &memory.TokenStore{
+			Database: memoryDatabase,
+		}, nil
+	default:
+		return nil, errors.New("no persistence configuration detected")
+	}
+}
+
+func (config *Config) GetScheduleStore() (store.ScheduleStore, error) {
+	switch config.Persistence {
+	case shared.PersistenceTypeMongo:
+		if config.Mongo == nil {
+			return nil, errors.New("no mongo configuration detected")
+		}
+		database, err := config.Mongo.GetMongoDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &mongo.ScheduleStore{
+			Database: database,
+		}, nil
+	case shared.PersistenceTypePostgres:
+		db, err := config.getPostgresDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &postgres.ScheduleStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeBolt:
+		db, err := config.getBoltDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &bolt.ScheduleStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeMemory:
+		return &memory.ScheduleStore{
+			Database: memoryDatabase,
+		}, nil
+	default:
+		return nil, errors.New("no persistence configuration detected")
+	}
+}
+
+func (config *Config) GetNotificationDeliveryStore() (store.NotificationDeliveryStore, error) {
+	switch config.Persistence {
+	case shared.PersistenceTypeMongo:
+		if config.Mongo == nil {
+			return nil, errors.New("no mongo configuration detected")
+		}
+		database, err := config.Mongo.GetMongoDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &mongo.NotificationDeliveryStore{
+			Database: database,
+		}, nil
+	case shared.PersistenceTypePostgres:
+		db, err := config.getPostgresDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &postgres.NotificationDeliveryStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeBolt:
+		db, err := config.getBoltDatabase()
+		if err != nil {
+			return nil, err
+		}
+		return &bolt.NotificationDeliveryStore{
+			DB: db,
+		}, nil
+	case shared.PersistenceTypeMemory:
+		return &memory.NotificationDeliveryStore{
+			Database: memoryDatabase,
+		}, nil
 	default:
 		return nil, errors.New("no persistence configuration detected")
 	}
@@ -1,62 +1,127 @@
 package container
 
 import (
-	"github.com/buildkite/terminal-to-html"
+	"fmt"
 	"go-brunel/internal/pkg/server/endpoint/api"
+	"go-brunel/internal/pkg/server/endpoint/api/logs"
 	"go-brunel/internal/pkg/server/security"
 	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/stream"
 	"go-brunel/internal/pkg/shared"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
 )
 
 type jobHandler struct {
 	logStore       store.LogStore
 	containerStore store.ContainerStore
 	jwtSerializer  security.TokenSerializer
+	bus            *stream.Bus
 }
 
+// logs writes the logs of the container in the format negotiated from the request, as an attachment when the
+// download query parameter is set
 func (handler *jobHandler) logs(w http.ResponseWriter, r *http.Request) {
 	id := shared.ContainerID(chi.URLParam(r, "id"))
 	since, err := api.ParseQueryTime(r, "since", false, time.Time{})
 	if err != nil {
-		log.Println("error parsing since time", err)
+		api.HandleError(w, http.StatusBadRequest, errors.Wrap(err, "error parsing query parameter 'since'"))
+		return
+	}
+
+	format, err := logs.Negotiate(r, logs.FormatHTML)
+	if err != nil {
+		api.HandleError(w, http.StatusBadRequest, err)
 		return
 	}
 
 	state, err := handler.containerStore.GetContainerState(id)
 	if err != nil {
-		log.Println("error getting job state", err)
+		if err == store.ErrorNotFound {
+			api.HandleError(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+		log.Println("error getting container state", err)
+		api.HandleError(w, http.StatusInternalServerError, errors.New("internal error"))
 		return
 	}
 
-	logs, err := handler.logStore.FilterContainerLogByContainerIDFromTime(id, since)
+	lines, err := handler.logStore.FilterContainerLogByContainerIDFromTime(id, since)
 	if err != nil {
 		log.Println("error querying container logs", err)
+		api.HandleError(w, http.StatusInternalServerError, errors.New("internal error"))
 		return
 	}
 
 	if *state == shared.ContainerStateStopped {
 		w.Header().Add("X-Content-Complete", "True")
 	}
+	if r.URL.Query().Get("download") == "1" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s%s"`, id, format.Extension()))
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	if err := logs.Write(w, format, logs.ContainerLines(lines)); err != nil {
+		log.Println("error writing container logs", err)
+	}
+}
 
-	w.Header().Add("Content-Type", "text/html")
-	for _, i := range logs {
-		w.Write(terminal.Render([]byte(i.Message)))
-		w.Write([]byte("<br/>"))
+// stream pushes the state changes and log lines of the container as server-sent events, starting with a snapshot of
+// its state and logs
+func (handler *jobHandler) stream(w http.ResponseWriter, r *http.Request) {
+	id := shared.ContainerID(chi.URLParam(r, "id"))
+	if _, err := handler.containerStore.GetContainerState(id); err != nil {
+		if err == store.ErrorNotFound {
+			api.HandleError(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+		api.HandleError(w, http.StatusInternalServerError, errors.New("internal error"))
+		log.Println("error getting container state", err)
+		return
+	}
+
+	err := stream.Serve(w, r, handler.bus, stream.Filter{ContainerID: id}, func() (interface{}, error) {
+		state, err := handler.containerStore.GetContainerState(id)
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting container state")
+		}
+
+		lines, err := handler.logStore.FilterContainerLogByContainerIDFromTime(id, time.Time{})
+		if err != nil {
+			return nil, errors.Wrap(err, "error querying container logs")
+		}
+
+		return struct {
+			State shared.ContainerState
+			Logs  []store.ContainerLog
+		}{
+			State: *state,
+			Logs:  lines,
+		}, nil
+	})
+	if err != nil {
+		log.Println("error streaming container", id, err)
 	}
 }
 
-func Routes(repository store.LogStore, containerStore store.ContainerStore, jwtSerializer security.TokenSerializer) *chi.Mux {
+func Routes(
+	repository store.LogStore,
+	containerStore store.ContainerStore,
+	jwtSerializer security.TokenSerializer,
+	bus *stream.Bus,
+) *chi.Mux {
 	handler := jobHandler{
 		logStore:       repository,
 		containerStore: containerStore,
 		jwtSerializer:  jwtSerializer,
+		bus:            bus,
 	}
 	router := chi.NewRouter()
 	router.Get("/{id}/logs", handler.logs)
+	router.Get("/{id}/stream", handler.stream)
 	return router
 }
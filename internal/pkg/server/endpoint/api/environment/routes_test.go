@@ -0,0 +1,54 @@
+package environment_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-brunel/internal/pkg/server/endpoint/api/environment"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/store/memory"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoutes_SaveAndGet(t *testing.T) {
+	router := environment.Routes(&memory.EnvironmentStore{Database: memory.NewDatabase()})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		http.MethodPost,
+		"/",
+		bytes.NewBufferString(`{"Name": " staging ", "Variables": [{"Name": "HOST", "Value": "staging.example.com"}]}`),
+	))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the environment to be saved, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var saved store.Environment
+	if err := json.NewDecoder(w.Body).Decode(&saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.ID == "" || saved.Name != "staging" {
+		t.Fatalf("unexpected saved environment %+v", saved)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+string(saved.ID), nil))
+	var fetched store.Environment
+	if err := json.NewDecoder(w.Body).Decode(&fetched); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched.Variables) != 1 || fetched.Variables[0].Value != "staging.example.com" {
+		t.Errorf("unexpected environment variables %+v", fetched.Variables)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?filter=stag", nil))
+	var list []store.EnvironmentList
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != saved.ID {
+		t.Errorf("expected the filtered list to contain the environment, got %+v", list)
+	}
+}
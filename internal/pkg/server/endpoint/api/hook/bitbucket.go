@@ -0,0 +1,121 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go-brunel/internal/pkg/server/endpoint/api"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	bitbucketserver "gopkg.in/go-playground/webhooks.v5/bitbucket-server"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	bitbucketServerEventHeader     = "X-Event-Key"
+	bitbucketServerSignatureHeader = "X-Hub-Signature"
+
+	// bitbucketServerPullRequestUpdatedEvent is sent when new commits are pushed to the source branch of a pull request
+	bitbucketServerPullRequestUpdatedEvent = "pr:from_ref_updated"
+)
+
+// bitbucketServerRepository maps a bitbucket server repository to ours using its http clone link
+func bitbucketServerRepository(repository bitbucketserver.Repository) store.Repository {
+	uri := ""
+	if links, ok := repository.Links["clone"].([]interface{}); ok {
+		for _, l := range links {
+			link, ok := l.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if name, _ := link["name"].(string); name == "http" {
+				uri, _ = link["href"].(string)
+			}
+		}
+	}
+
+	return store.Repository{
+		Project:   repository.Project.Key,
+		Name:      repository.Slug,
+		URI:       uri,
+		CreatedAt: time.Now(),
+	}
+}
+
+func (handler *webHookHandler) bitbucketServer(r *http.Request) api.Response {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error reading bitbucket server hook event"))
+	}
+
+	if handler.configuration.BitbucketServerSecret != "" {
+		signature := r.Header.Get(bitbucketServerSignatureHeader)
+		if !validSignature(handler.configuration.BitbucketServerSecret, body, signature) {
+			return api.UnAuthorized()
+		}
+	}
+
+	switch bitbucketserver.Event(r.Header.Get(bitbucketServerEventHeader)) {
+	case bitbucketserver.DiagnosticsPingEvent:
+		return api.NoContent()
+	case bitbucketserver.RepositoryReferenceChangedEvent:
+		var event bitbucketserver.RepositoryReferenceChangedPayload
+		if err := json.Unmarshal(body, &event); err != nil {
+			return api.BadRequest(err, "error parsing bitbucket server push event")
+		}
+
+		repository := bitbucketServerRepository(event.Repository)
+
+		// A single push can update several branches and tags, the payload does not list the changed files
+		var pushes []truncatedPush
+		for _, change := range event.Changes {
+			if change.Type == "DELETE" {
+				continue
+			}
+			pushes = append(pushes, truncatedPush{
+				job: store.Job{
+					Commit: shared.Commit{
+						Branch:   change.ReferenceId,
+						Revision: change.ToHash,
+					},
+					State:     shared.JobStateWaiting,
+					StartedBy: event.Actor.EmailAddress,
+					CreatedAt: time.Now(),
+				},
+				before: change.FromHash,
+			})
+		}
+
+		return handler.finishTruncatedPushes(repository, pushes...)
+	case bitbucketserver.PullRequestOpenedEvent, bitbucketServerPullRequestUpdatedEvent:
+		var event bitbucketserver.PullRequestOpenedPayload
+		if err := json.Unmarshal(body, &event); err != nil {
+			return api.BadRequest(err, "error parsing bitbucket server pull request event")
+		}
+
+		// The source branch of a pull request from a fork is not in the repository, but its pull request ref is
+		pr := event.PullRequest
+		job := store.Job{
+			Commit: shared.Commit{
+				Branch:   fmt.Sprintf("refs/pull-requests/%d/from", pr.ID),
+				Revision: pr.FromRef.LatestCommit,
+			},
+			State:     shared.JobStateWaiting,
+			StartedBy: pr.Author.User.Name,
+			PullRequest: &shared.PullRequest{
+				Number:       int64(pr.ID),
+				SourceBranch: pr.FromRef.DisplayId,
+				TargetBranch: pr.ToRef.DisplayId,
+				Author:       pr.Author.User.Name,
+			},
+			CreatedAt: time.Now(),
+		}
+
+		return handler.finishHandling(bitbucketServerRepository(pr.ToRef.Repository), job)
+	default:
+		// Bitbucket marks the hook as failing when other events are not accepted
+		return api.NoContent()
+	}
+}
@@ -0,0 +1,64 @@
+package hook_test
+
+import (
+	"bytes"
+	"go-brunel/internal/pkg/server"
+	"go-brunel/internal/pkg/server/endpoint/api/hook"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/test"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const bitbucketServerPullRequestPayload = `{
+	"eventKey": "pr:opened",
+	"pullRequest": {
+		"id": 5,
+		"author": {"user": {"name": "author"}},
+		"fromRef": {"displayId": "feature", "latestCommit": "2222222222222222222222222222222222222222"},
+		"toRef": {
+			"displayId": "master",
+			"repository": {
+				"slug": "service",
+				"project": {"key": "TEAM"},
+				"links": {"clone": [{"name": "http", "href": "https://bitbucket.example.com/scm/team/service.git"}]}
+			}
+		}
+	}
+}`
+
+func TestBitbucketServerPullRequestRef(t *testing.T) {
+	repositories := &repositoryStore{
+		triggers: []store.RepositoryTrigger{
+			{Type: store.RepositoryTriggerTypePullRequest, Pattern: "master"},
+		},
+	}
+	jobs := &jobStore{}
+	router := hook.Routes(server.WebHookConfiguration{}, jobs, repositories, &notifier{}, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/bitbucket-server", bytes.NewBufferString(bitbucketServerPullRequestPayload))
+	r.Header.Set("X-Event-Key", "pr:opened")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || len(jobs.jobs) != 1 {
+		t.Fatalf("expected a job for the pull request, got %d: %s", w.Code, w.Body.String())
+	}
+	test.ExpectString(t, "refs/pull-requests/5/from", jobs.jobs[0].Commit.Branch)
+	test.ExpectString(t, "feature", jobs.jobs[0].PullRequest.SourceBranch)
+}
+
+func TestBitbucketServerIgnoredEvent(t *testing.T) {
+	jobs := &jobStore{}
+	router := hook.Routes(server.WebHookConfiguration{}, jobs, &repositoryStore{}, &notifier{}, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/bitbucket-server", bytes.NewBufferString(`{}`))
+	r.Header.Set("X-Event-Key", "pr:comment:added")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || len(jobs.jobs) != 0 {
+		t.Fatalf("expected an ignored event to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,130 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"go-brunel/internal/pkg/server"
+	"go-brunel/internal/pkg/server/endpoint/api"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"io/ioutil"
+	"k8s.io/client-go/util/jsonpath"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	genericSignatureHeader = "X-Brunel-Signature"
+)
+
+// lookup evaluates a JSONPath expression such as '$.repository.url' against the payload
+func lookup(payload interface{}, expression string) (string, error) {
+	if !strings.HasPrefix(expression, "{") {
+		expression = "{" + expression + "}"
+	}
+
+	j := jsonpath.New("generic")
+	if err := j.Parse(expression); err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("error parsing path %s", expression))
+	}
+
+	var b bytes.Buffer
+	if err := j.Execute(&b, payload); err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("error evaluating path %s", expression))
+	}
+	return b.String(), nil
+}
+
+// repositoryNameFromURI splits a repository URL such as https://git.example.com/project/name.git into
+// its project and name
+func repositoryNameFromURI(uri string) (string, string) {
+	p := uri
+	if u, err := url.Parse(uri); err == nil && u.Path != "" {
+		p = u.Path
+	} else if i := strings.LastIndex(uri, ":"); i != -1 {
+		// scp like ssh urls, git@host:project/name.git
+		p = uri[i+1:]
+	}
+
+	p = strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+	return path.Base(path.Dir(p)), path.Base(p)
+}
+
+// mapGenericPayload uses the JSONPath mapping of the configuration to build a repository and job from the payload
+func mapGenericPayload(
+	configuration server.GenericWebHookConfiguration,
+	payload interface{},
+) (store.Repository, store.Job, error) {
+	var repository store.Repository
+	var job store.Job
+
+	fields := []struct {
+		expression string
+		value      *string
+	}{
+		{configuration.Repository, &repository.URI},
+		{configuration.Project, &repository.Project},
+		{configuration.Name, &repository.Name},
+		{configuration.Branch, &job.Commit.Branch},
+		{configuration.Revision, &job.Commit.Revision},
+		{configuration.Author, &job.StartedBy},
+	}
+	for _, field := range fields {
+		if field.expression == "" {
+			continue
+		}
+		v, err := lookup(payload, field.expression)
+		if err != nil {
+			return repository, job, err
+		}
+		*field.value = v
+	}
+
+	project, name := repositoryNameFromURI(repository.URI)
+	if repository.Project == "" {
+		repository.Project = project
+	}
+	if repository.Name == "" {
+		repository.Name = name
+	}
+
+	repository.CreatedAt = time.Now()
+	job.State = shared.JobStateWaiting
+	job.CreatedAt = time.Now()
+	return repository, job, nil
+}
+
+func (handler *webHookHandler) generic(r *http.Request) api.Response {
+	// Configuration keys are case insensitive so are always lower case
+	configuration, ok := handler.configuration.Generic[strings.ToLower(chi.URLParam(r, "name"))]
+	if !ok {
+		return api.NotFound()
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error reading generic hook event"))
+	}
+
+	if configuration.Secret != "" && !validSignature(configuration.Secret, body, r.Header.Get(genericSignatureHeader)) {
+		return api.UnAuthorized()
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return api.BadRequest(err, "error parsing generic hook event")
+	}
+
+	repository, job, err := mapGenericPayload(configuration, payload)
+	if err != nil {
+		return api.BadRequest(err, err.Error())
+	}
+
+	return handler.finishHandling(repository, job)
+}
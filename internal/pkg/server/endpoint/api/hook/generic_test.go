@@ -0,0 +1,151 @@
+package hook_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go-brunel/internal/pkg/server"
+	"go-brunel/internal/pkg/server/endpoint/api/hook"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"go-brunel/test"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type repositoryStore struct {
+	store.RepositoryStore
+	repository *store.Repository
+	triggers   []store.RepositoryTrigger
+	settings   store.RepositorySettings
+}
+
+func (s *repositoryStore) AddOrUpdate(repository store.Repository) (*store.Repository, error) {
+	repository.ID = "repo"
+	repository.Triggers = s.triggers
+	repository.Settings = s.settings
+	if repository.Triggers == nil {
+		repository.Triggers = []store.RepositoryTrigger{
+			{Type: store.RepositoryTriggerTypeBranch, Pattern: "^refs/heads/master$"},
+		}
+	}
+	s.repository = &repository
+	return &repository, nil
+}
+
+type jobStore struct {
+	store.JobStore
+	jobs []store.Job
+}
+
+func (s *jobStore) Add(job store.Job) (*store.Job, error) {
+	job.ID = shared.JobID(fmt.Sprintf("job%d", len(s.jobs)))
+	s.jobs = append(s.jobs, job)
+	return &job, nil
+}
+
+func (s *jobStore) FindActiveByBranch(repositoryID store.RepositoryID, branch string) ([]store.Job, error) {
+	active := []store.Job{}
+	for _, job := range s.jobs {
+		if job.Commit.Branch == branch && (job.State == shared.JobStateWaiting || job.State == shared.JobStateProcessing) {
+			active = append(active, job)
+		}
+	}
+	return active, nil
+}
+
+func (s *jobStore) FindActiveByPullRequest(repositoryID store.RepositoryID, number int64) ([]store.Job, error) {
+	active := []store.Job{}
+	for _, job := range s.jobs {
+		if job.PullRequest != nil && job.PullRequest.Number == number &&
+			(job.State == shared.JobStateWaiting || job.State == shared.JobStateProcessing) {
+			active = append(active, job)
+		}
+	}
+	return active, nil
+}
+
+func (s *jobStore) CancelByID(id shared.JobID, userID string) error {
+	for i := range s.jobs {
+		if s.jobs[i].ID == id {
+			s.jobs[i].State = shared.JobStateCancelled
+			s.jobs[i].StoppedBy = &userID
+		}
+	}
+	return nil
+}
+
+type notifier struct{}
+
+func (n *notifier) Notify(id shared.JobID) error {
+	return nil
+}
+
+const genericPayload = `{
+	"repo": {"url": "https://git.example.com/team/service.git"},
+	"ref": "refs/heads/master",
+	"sha": "abc123",
+	"user": {"email": "user@example.com"}
+}`
+
+func genericRequest(t *testing.T, secret string) (*repositoryStore, *jobStore, *httptest.ResponseRecorder) {
+	repositories := &repositoryStore{}
+	jobs := &jobStore{}
+	router := hook.Routes(
+		server.WebHookConfiguration{
+			Generic: map[string]server.GenericWebHookConfiguration{
+				"deploy": {
+					Secret:     "secret",
+					Repository: "$.repo.url",
+					Branch:     "$.ref",
+					Revision:   "$.sha",
+					Author:     "$.user.email",
+				},
+			},
+		},
+		jobs,
+		repositories,
+		&notifier{},
+		nil,
+	)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(genericPayload))
+
+	r := httptest.NewRequest(http.MethodPost, "/generic/Deploy", bytes.NewBufferString(genericPayload))
+	r.Header.Set("X-Brunel-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return repositories, jobs, w
+}
+
+func TestGenericHook(t *testing.T) {
+	repositories, jobs, w := genericRequest(t, "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status ok, got %d: %s", w.Code, w.Body.String())
+	}
+
+	test.ExpectString(t, "team", repositories.repository.Project)
+	test.ExpectString(t, "service", repositories.repository.Name)
+	test.ExpectString(t, "https://git.example.com/team/service.git", repositories.repository.URI)
+
+	if len(jobs.jobs) != 1 {
+		t.Fatalf("expected a single job, got %d", len(jobs.jobs))
+	}
+	test.ExpectString(t, "refs/heads/master", jobs.jobs[0].Commit.Branch)
+	test.ExpectString(t, "abc123", jobs.jobs[0].Commit.Revision)
+	test.ExpectString(t, "user@example.com", jobs.jobs[0].StartedBy)
+}
+
+func TestGenericHookInvalidSignature(t *testing.T) {
+	_, jobs, w := genericRequest(t, "not the secret")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status unauthorized, got %d", w.Code)
+	}
+	if len(jobs.jobs) != 0 {
+		t.Fatal("expected no jobs to be started")
+	}
+}
@@ -0,0 +1,159 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go-brunel/internal/pkg/server/endpoint/api"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	giteaEventHeader     = "X-Gitea-Event"
+	giteaSignatureHeader = "X-Gitea-Signature"
+
+	// Gitea also sends the headers of Gogs, which it was forked from
+	gogsEventHeader     = "X-Gogs-Event"
+	gogsSignatureHeader = "X-Gogs-Signature"
+)
+
+type giteaRepository struct {
+	Name     string `json:"name"`
+	CloneURL string `json:"clone_url"`
+	Owner    struct {
+		UserName string `json:"username"`
+	} `json:"owner"`
+}
+
+type giteaPushPayload struct {
+	Ref     string `json:"ref"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
+	} `json:"commits"`
+	TotalCommits int             `json:"total_commits"`
+	Repository   giteaRepository `json:"repository"`
+	Pusher       struct {
+		UserName string `json:"username"`
+		Email    string `json:"email"`
+	} `json:"pusher"`
+}
+
+type giteaPullRequestPayload struct {
+	Action      string `json:"action"`
+	Number      int64  `json:"number"`
+	PullRequest struct {
+		Head struct {
+			Ref string `json:"ref"`
+			Sha string `json:"sha"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+		User struct {
+			UserName string `json:"username"`
+		} `json:"user"`
+	} `json:"pull_request"`
+	Repository giteaRepository `json:"repository"`
+}
+
+func headerOrFallback(r *http.Request, header string, fallback string) string {
+	if value := r.Header.Get(header); value != "" {
+		return value
+	}
+	return r.Header.Get(fallback)
+}
+
+func (handler *webHookHandler) gitea(r *http.Request) api.Response {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error reading gitea hook event"))
+	}
+
+	if handler.configuration.GiteaSecret != "" {
+		signature := headerOrFallback(r, giteaSignatureHeader, gogsSignatureHeader)
+		if !validSignature(handler.configuration.GiteaSecret, body, signature) {
+			return api.UnAuthorized()
+		}
+	}
+
+	var job store.Job
+	var repository giteaRepository
+
+	switch headerOrFallback(r, giteaEventHeader, gogsEventHeader) {
+	case "push":
+		var event giteaPushPayload
+		if err := json.Unmarshal(body, &event); err != nil {
+			return api.BadRequest(err, "error parsing gitea push event")
+		}
+
+		var files [][]string
+		for _, commit := range event.Commits {
+			files = append(files, commit.Added, commit.Removed, commit.Modified)
+		}
+
+		job = store.Job{
+			Commit: shared.Commit{
+				Branch:   event.Ref,
+				Revision: event.After,
+			},
+			State:        shared.JobStateWaiting,
+			StartedBy:    event.Pusher.Email,
+			ChangedFiles: uniqueFiles(files...),
+			CreatedAt:    time.Now(),
+		}
+		repository = event.Repository
+
+		if event.TotalCommits > len(event.Commits) {
+			return handler.finishTruncatedPushes(giteaStoreRepository(repository), truncatedPush{job: job, before: event.Before})
+		}
+	case "pull_request":
+		var event giteaPullRequestPayload
+		if err := json.Unmarshal(body, &event); err != nil {
+			return api.BadRequest(err, "error parsing gitea pull request event")
+		}
+
+		// We only build when the pull request has new commits
+		if event.Action != "opened" && event.Action != "synchronized" && event.Action != "reopened" {
+			return api.NoContent()
+		}
+
+		// The head branch of a pull request from a fork is not in the repository, but its pull request ref is
+		job = store.Job{
+			Commit: shared.Commit{
+				Branch:   fmt.Sprintf("refs/pull/%d/head", event.Number),
+				Revision: event.PullRequest.Head.Sha,
+			},
+			State:     shared.JobStateWaiting,
+			StartedBy: event.PullRequest.User.UserName,
+			PullRequest: &shared.PullRequest{
+				Number:       event.Number,
+				SourceBranch: event.PullRequest.Head.Ref,
+				TargetBranch: event.PullRequest.Base.Ref,
+				Author:       event.PullRequest.User.UserName,
+			},
+			CreatedAt: time.Now(),
+		}
+		repository = event.Repository
+	default:
+		return api.NotFound()
+	}
+
+	return handler.finishHandling(giteaStoreRepository(repository), job)
+}
+
+func giteaStoreRepository(repository giteaRepository) store.Repository {
+	return store.Repository{
+		Project:   repository.Owner.UserName,
+		Name:      repository.Name,
+		URI:       repository.CloneURL,
+		CreatedAt: time.Now(),
+	}
+}
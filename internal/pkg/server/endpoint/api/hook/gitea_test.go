@@ -0,0 +1,44 @@
+package hook_test
+
+import (
+	"bytes"
+	"go-brunel/internal/pkg/server"
+	"go-brunel/internal/pkg/server/endpoint/api/hook"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/test"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const giteaPullRequestPayload = `{
+	"action": "opened",
+	"number": 3,
+	"pull_request": {
+		"head": {"ref": "feature", "sha": "2222222222222222222222222222222222222222"},
+		"base": {"ref": "master"},
+		"user": {"username": "author"}
+	},
+	"repository": {"name": "service", "clone_url": "https://gitea.example.com/team/service.git", "owner": {"username": "team"}}
+}`
+
+func TestGiteaPullRequestRef(t *testing.T) {
+	repositories := &repositoryStore{
+		triggers: []store.RepositoryTrigger{
+			{Type: store.RepositoryTriggerTypePullRequest, Pattern: "master"},
+		},
+	}
+	jobs := &jobStore{}
+	router := hook.Routes(server.WebHookConfiguration{}, jobs, repositories, &notifier{}, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/gitea", bytes.NewBufferString(giteaPullRequestPayload))
+	r.Header.Set("X-Gitea-Event", "pull_request")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || len(jobs.jobs) != 1 {
+		t.Fatalf("expected a job for the pull request, got %d: %s", w.Code, w.Body.String())
+	}
+	test.ExpectString(t, "refs/pull/3/head", jobs.jobs[0].Commit.Branch)
+	test.ExpectString(t, "feature", jobs.jobs[0].PullRequest.SourceBranch)
+}
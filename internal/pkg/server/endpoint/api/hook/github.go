@@ -1,6 +1,7 @@
 package hook
 
 import (
+	"fmt"
 	"github.com/pkg/errors"
 	"go-brunel/internal/pkg/server/endpoint/api"
 	"go-brunel/internal/pkg/server/store"
@@ -11,10 +12,15 @@ import (
 	"time"
 )
 
+const (
+	// gitHubMaxPayloadCommits is the most commits GitHub includes in a push payload
+	gitHubMaxPayloadCommits = 20
+)
+
 func (handler *webHookHandler) gitHub(r *http.Request) api.Response {
 	hook, _ := github.New(github.Options.Secret(handler.configuration.GitHubSecret))
 
-	payload, err := hook.Parse(r, github.PushEvent)
+	payload, err := hook.Parse(r, github.PushEvent, github.PullRequestEvent)
 	if err != nil && err != github.ErrEventNotFound {
 		return api.InternalServerError(errors.Wrap(err, "error handling github hook event"))
 	}
@@ -25,13 +31,60 @@ func (handler *webHookHandler) gitHub(r *http.Request) api.Response {
 	switch payload.(type) {
 	case github.PushPayload:
 		event := payload.(github.PushPayload)
+
+		var files [][]string
+		for _, commit := range event.Commits {
+			files = append(files, commit.Added, commit.Removed, commit.Modified)
+		}
+
 		job = store.Job{
 			Commit: shared.Commit{
 				Branch:   event.Ref,
 				Revision: event.After,
 			},
+			State:        shared.JobStateWaiting,
+			StartedBy:    event.Pusher.Email,
+			ChangedFiles: uniqueFiles(files...),
+			CreatedAt:    time.Now(),
+		}
+
+		parts := strings.Split(event.Repository.FullName, "/")
+		if len(parts) != 2 {
+			return api.InternalServerError(errors.New("invalid project/repository name"))
+		}
+
+		repository = store.Repository{
+			Project:   parts[0],
+			Name:      parts[1],
+			URI:       event.Repository.CloneURL,
+			CreatedAt: time.Now(),
+		}
+
+		if len(event.Commits) >= gitHubMaxPayloadCommits {
+			return handler.finishTruncatedPushes(repository, truncatedPush{job: job, before: event.Before})
+		}
+	case github.PullRequestPayload:
+		event := payload.(github.PullRequestPayload)
+
+		// We only build when the pull request has new commits
+		if event.Action != "opened" && event.Action != "synchronize" && event.Action != "reopened" {
+			return api.NoContent()
+		}
+
+		// The head branch of a pull request from a fork is not in the repository, but its pull request ref is
+		job = store.Job{
+			Commit: shared.Commit{
+				Branch:   fmt.Sprintf("refs/pull/%d/head", event.Number),
+				Revision: event.PullRequest.Head.Sha,
+			},
 			State:     shared.JobStateWaiting,
-			StartedBy: event.Pusher.Email,
+			StartedBy: event.PullRequest.User.Login,
+			PullRequest: &shared.PullRequest{
+				Number:       event.Number,
+				SourceBranch: event.PullRequest.Head.Ref,
+				TargetBranch: event.PullRequest.Base.Ref,
+				Author:       event.PullRequest.User.Login,
+			},
 			CreatedAt: time.Now(),
 		}
 
@@ -0,0 +1,229 @@
+package hook_test
+
+import (
+	"bytes"
+	"fmt"
+	"go-brunel/internal/pkg/server"
+	"go-brunel/internal/pkg/server/endpoint/api/hook"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	mockvcs "go-brunel/test/mocks/go-brunel/pkg/shared/vcs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+const gitHubPushPayload = `{
+	"ref": "refs/heads/master",
+	"before": "1111111111111111111111111111111111111111",
+	"after": "2222222222222222222222222222222222222222",
+	"commits": [
+		{"added": ["services/api/handler.go"], "removed": [], "modified": ["README.md"]},
+		{"added": [], "removed": [], "modified": ["services/api/handler.go"]}
+	],
+	"repository": {"full_name": "team/monorepo", "clone_url": "https://github.com/team/monorepo.git"},
+	"pusher": {"email": "user@example.com"}
+}`
+
+func TestGitHubPushPathFilters(t *testing.T) {
+	repositories := &repositoryStore{
+		triggers: []store.RepositoryTrigger{
+			{Type: store.RepositoryTriggerTypeBranch, Pattern: "master", Paths: []string{"services/api/**"}},
+			{Type: store.RepositoryTriggerTypeBranch, Pattern: "master", Paths: []string{"services/web/**"}},
+			{Type: store.RepositoryTriggerTypeBranch, Pattern: "master", IgnorePaths: []string{"**/*.md", "services/**"}},
+		},
+	}
+	jobs := &jobStore{}
+	router := hook.Routes(server.WebHookConfiguration{}, jobs, repositories, &notifier{}, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/github", bytes.NewBufferString(gitHubPushPayload))
+	r.Header.Set("X-GitHub-Event", "push")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status ok, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(jobs.jobs) != 1 {
+		t.Fatalf("expected only the api trigger to start a job, got %d jobs", len(jobs.jobs))
+	}
+	if len(jobs.jobs[0].ChangedFiles) != 2 {
+		t.Errorf("expected two unique changed files, got %v", jobs.jobs[0].ChangedFiles)
+	}
+}
+
+// channelNotifier signals every notified job, so tests can wait for jobs started in the background
+type channelNotifier struct {
+	ids chan shared.JobID
+}
+
+func (n *channelNotifier) Notify(id shared.JobID) error {
+	n.ids <- id
+	return nil
+}
+
+func TestGitHubTruncatedPushComparesRevisions(t *testing.T) {
+	repositories := &repositoryStore{
+		triggers: []store.RepositoryTrigger{
+			{Type: store.RepositoryTriggerTypeBranch, Pattern: "master", Paths: []string{"services/api/**"}},
+			{Type: store.RepositoryTriggerTypeBranch, Pattern: "master", Paths: []string{"services/web/**"}},
+		},
+	}
+	jobs := &jobStore{}
+	n := &channelNotifier{ids: make(chan shared.JobID, 10)}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	differ := mockvcs.NewMockDiffer(ctrl)
+	differ.
+		EXPECT().
+		ChangedFiles(
+			"https://github.com/team/monorepo.git",
+			"refs/heads/master",
+			"1111111111111111111111111111111111111111",
+			"2222222222222222222222222222222222222222",
+		).
+		Return([]string{"services/web/index.html"}, nil)
+
+	router := hook.Routes(server.WebHookConfiguration{}, jobs, repositories, n, differ)
+
+	// GitHub lists at most 20 commits, the files changed by the rest of the push are not in the payload
+	commits := strings.TrimSuffix(strings.Repeat(`{"added": [], "removed": [], "modified": ["services/api/handler.go"]},`, 20), ",")
+	payload := strings.Replace(
+		gitHubPushPayload,
+		`{"added": ["services/api/handler.go"], "removed": [], "modified": ["README.md"]},
+		{"added": [], "removed": [], "modified": ["services/api/handler.go"]}`,
+		commits,
+		1,
+	)
+	r := httptest.NewRequest(http.MethodPost, "/github", bytes.NewBufferString(payload))
+	r.Header.Set("X-GitHub-Event", "push")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status ok, got %d: %s", w.Code, w.Body.String())
+	}
+	select {
+	case <-n.ids:
+	case <-time.After(time.Second):
+		t.Fatal("expected a job to be started once the revisions are compared")
+	}
+	if len(jobs.jobs) != 1 || len(jobs.jobs[0].ChangedFiles) != 1 || jobs.jobs[0].ChangedFiles[0] != "services/web/index.html" {
+		t.Fatalf("expected only the web trigger to start a job with the compared files, got %+v", jobs.jobs)
+	}
+}
+
+func TestGitHubPushRequiresRepositoryURI(t *testing.T) {
+	jobs := &jobStore{}
+	router := hook.Routes(server.WebHookConfiguration{}, jobs, &repositoryStore{}, &notifier{}, nil)
+
+	payload := strings.Replace(gitHubPushPayload, "https://github.com/team/monorepo.git", "", 1)
+	r := httptest.NewRequest(http.MethodPost, "/github", bytes.NewBufferString(payload))
+	r.Header.Set("X-GitHub-Event", "push")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest || len(jobs.jobs) != 0 {
+		t.Fatalf("expected a repository without a uri to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGitHubPushSupersedesBranchJobs(t *testing.T) {
+	suites := []struct {
+		mode   store.RepositorySupersedeMode
+		expect []shared.JobState
+	}{
+		{
+			mode:   store.RepositorySupersedeModeNone,
+			expect: []shared.JobState{shared.JobStateProcessing, shared.JobStateWaiting, shared.JobStateWaiting},
+		},
+		{
+			mode:   store.RepositorySupersedeModeWaiting,
+			expect: []shared.JobState{shared.JobStateProcessing, shared.JobStateCancelled, shared.JobStateWaiting},
+		},
+		{
+			mode:   store.RepositorySupersedeModeAll,
+			expect: []shared.JobState{shared.JobStateCancelled, shared.JobStateCancelled, shared.JobStateWaiting},
+		},
+	}
+
+	for i, suite := range suites {
+		t.Run(
+			fmt.Sprintf("suites[%d]", i),
+			func(t *testing.T) {
+				repositories := &repositoryStore{
+					settings: store.RepositorySettings{Supersede: suite.mode},
+				}
+				jobs := &jobStore{}
+				for _, state := range []shared.JobState{shared.JobStateProcessing, shared.JobStateWaiting} {
+					_, _ = jobs.Add(store.Job{
+						Commit: shared.Commit{Branch: "refs/heads/master", Revision: "older"},
+						State:  state,
+					})
+				}
+				router := hook.Routes(server.WebHookConfiguration{}, jobs, repositories, &notifier{}, nil)
+
+				r := httptest.NewRequest(http.MethodPost, "/github", bytes.NewBufferString(gitHubPushPayload))
+				r.Header.Set("X-GitHub-Event", "push")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+
+				if w.Code != http.StatusOK {
+					t.Fatalf("expected status ok, got %d: %s", w.Code, w.Body.String())
+				}
+				if len(jobs.jobs) != len(suite.expect) {
+					t.Fatalf("expected %d jobs, got %d", len(suite.expect), len(jobs.jobs))
+				}
+				for j, state := range suite.expect {
+					if jobs.jobs[j].State != state {
+						t.Errorf("expected job %d to have state %d, got %d", j, state, jobs.jobs[j].State)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestGitHubPushKeepsOtherTriggerJobs(t *testing.T) {
+	repositories := &repositoryStore{
+		settings: store.RepositorySettings{Supersede: store.RepositorySupersedeModeAll},
+	}
+	jobs := &jobStore{}
+	for _, job := range []store.Job{
+		{Commit: shared.Commit{Branch: "refs/heads/master", Revision: "older"}},
+		{Commit: shared.Commit{Branch: "refs/heads/master", Revision: "2222222222222222222222222222222222222222"}},
+		{Commit: shared.Commit{Branch: "refs/heads/master", Revision: "older"}, PullRequest: &shared.PullRequest{Number: 1}},
+	} {
+		job.State = shared.JobStateWaiting
+		_, _ = jobs.Add(job)
+	}
+	router := hook.Routes(server.WebHookConfiguration{}, jobs, repositories, &notifier{}, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/github", bytes.NewBufferString(gitHubPushPayload))
+	r.Header.Set("X-GitHub-Event", "push")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status ok, got %d: %s", w.Code, w.Body.String())
+	}
+	expect := []shared.JobState{
+		shared.JobStateCancelled,
+		shared.JobStateWaiting,
+		shared.JobStateWaiting,
+		shared.JobStateWaiting,
+	}
+	if len(jobs.jobs) != len(expect) {
+		t.Fatalf("expected %d jobs, got %d", len(expect), len(jobs.jobs))
+	}
+	for j, state := range expect {
+		if jobs.jobs[j].State != state {
+			t.Errorf("expected job %d to have state %d, got %d", j, state, jobs.jobs[j].State)
+		}
+	}
+}
@@ -1,20 +1,39 @@
 package hook
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"github.com/pkg/errors"
 	"go-brunel/internal/pkg/server/endpoint/api"
 	"go-brunel/internal/pkg/server/store"
 	"go-brunel/internal/pkg/shared"
+	"io/ioutil"
 	"net/http"
 	"time"
 
 	"gopkg.in/go-playground/webhooks.v5/gitlab"
 )
 
+// gitLabMergeRequestRevisions holds the previous revision of merge request update events, which is only set when
+// the update pushed new commits
+type gitLabMergeRequestRevisions struct {
+	ObjectAttributes struct {
+		OldRev string `json:"oldrev"`
+	} `json:"object_attributes"`
+}
+
 func (handler *webHookHandler) gitLab(r *http.Request) api.Response {
 	hook, _ := gitlab.New(gitlab.Options.Secret(handler.configuration.GitLabSecret))
 
-	payload, err := hook.Parse(r, gitlab.PushEvents, gitlab.TagEvents)
+	// The body is kept for the merge request fields the payload types leave out
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return api.BadRequest(errors.Wrap(err, "error reading gitlab hook event"), "could not read request body")
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	payload, err := hook.Parse(r, gitlab.PushEvents, gitlab.TagEvents, gitlab.MergeRequestEvents)
 	if err != nil && err != gitlab.ErrEventNotFound {
 		return api.InternalServerError(errors.Wrap(err, "error handling gitlab hook event"))
 	}
@@ -25,14 +44,21 @@ func (handler *webHookHandler) gitLab(r *http.Request) api.Response {
 	switch payload.(type) {
 	case gitlab.PushEventPayload:
 		event := payload.(gitlab.PushEventPayload)
+
+		var files [][]string
+		for _, commit := range event.Commits {
+			files = append(files, commit.Added, commit.Removed, commit.Modified)
+		}
+
 		job = store.Job{
 			Commit: shared.Commit{
 				Branch:   event.Ref,
 				Revision: event.After,
 			},
-			State:     shared.JobStateWaiting,
-			StartedBy: event.UserEmail,
-			CreatedAt: time.Now(),
+			State:        shared.JobStateWaiting,
+			StartedBy:    event.UserEmail,
+			ChangedFiles: uniqueFiles(files...),
+			CreatedAt:    time.Now(),
 		}
 		repository = store.Repository{
 			Project:   event.Project.Namespace,
@@ -40,17 +66,63 @@ func (handler *webHookHandler) gitLab(r *http.Request) api.Response {
 			URI:       event.Project.GitHTTPURL,
 			CreatedAt: time.Now(),
 		}
+
+		if event.TotalCommitsCount > int64(len(event.Commits)) {
+			return handler.finishTruncatedPushes(repository, truncatedPush{job: job, before: event.Before})
+		}
 	case gitlab.TagEventPayload:
-		event := payload.(gitlab.PushEventPayload)
+		event := payload.(gitlab.TagEventPayload)
 		job = store.Job{
 			Commit: shared.Commit{
 				Branch:   event.Ref,
 				Revision: event.After,
 			},
 			State:     shared.JobStateWaiting,
-			StartedBy: event.UserEmail,
+			StartedBy: event.UserName,
 			CreatedAt: time.Now(),
 		}
+		repository = store.Repository{
+			Project:   event.Project.Namespace,
+			Name:      event.Project.Name,
+			URI:       event.Project.GitHTTPURL,
+			CreatedAt: time.Now(),
+		}
+	case gitlab.MergeRequestEventPayload:
+		event := payload.(gitlab.MergeRequestEventPayload)
+		attributes := event.ObjectAttributes
+
+		if attributes.Action != "open" && attributes.Action != "reopen" && attributes.Action != "update" {
+			return api.NoContent()
+		}
+
+		// Updates that only change the title, labels or other details of the merge request have no oldrev
+		if attributes.Action == "update" {
+			var revisions gitLabMergeRequestRevisions
+			if e := json.Unmarshal(body, &revisions); e != nil {
+				return api.BadRequest(errors.Wrap(e, "error decoding merge request revisions"), "invalid merge request event")
+			}
+			if revisions.ObjectAttributes.OldRev == "" {
+				return api.NoContent()
+			}
+		}
+
+		// The source branch of a merge request from a fork is not in the project, but its merge request ref is
+		job = store.Job{
+			Commit: shared.Commit{
+				Branch:   fmt.Sprintf("refs/merge-requests/%d/head", attributes.IID),
+				Revision: attributes.LastCommit.ID,
+			},
+			State:     shared.JobStateWaiting,
+			StartedBy: event.User.UserName,
+			PullRequest: &shared.PullRequest{
+				Number:       attributes.IID,
+				SourceBranch: attributes.SourceBranch,
+				TargetBranch: attributes.TargetBranch,
+				Author:       event.User.UserName,
+			},
+			CreatedAt: time.Now(),
+		}
+
 		repository = store.Repository{
 			Project:   event.Project.Namespace,
 			Name:      event.Project.Name,
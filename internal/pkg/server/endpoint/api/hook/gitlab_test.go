@@ -0,0 +1,66 @@
+package hook_test
+
+import (
+	"bytes"
+	"fmt"
+	"go-brunel/internal/pkg/server"
+	"go-brunel/internal/pkg/server/endpoint/api/hook"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/test"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const gitLabMergeRequestPayload = `{
+	"object_kind": "merge_request",
+	"user": {"username": "author"},
+	"project": {"name": "service", "namespace": "team", "git_http_url": "https://gitlab.com/team/service.git"},
+	"object_attributes": {
+		"iid": 7,
+		"action": "update",
+		"source_branch": "feature",
+		"target_branch": "master",
+		"last_commit": {"id": "2222222222222222222222222222222222222222"}
+		%s
+	}
+}`
+
+func TestGitLabMergeRequestUpdates(t *testing.T) {
+	suites := []struct {
+		attributes string
+		jobs       int
+	}{
+		{attributes: ``, jobs: 0},
+		{attributes: `, "oldrev": "1111111111111111111111111111111111111111"`, jobs: 1},
+	}
+
+	for i, suite := range suites {
+		t.Run(fmt.Sprintf("suites[%d]", i), func(t *testing.T) {
+			repositories := &repositoryStore{
+				triggers: []store.RepositoryTrigger{
+					{Type: store.RepositoryTriggerTypePullRequest, Pattern: "master"},
+				},
+			}
+			jobs := &jobStore{}
+			router := hook.Routes(server.WebHookConfiguration{}, jobs, repositories, &notifier{}, nil)
+
+			payload := fmt.Sprintf(gitLabMergeRequestPayload, suite.attributes)
+			r := httptest.NewRequest(http.MethodPost, "/gitlab", bytes.NewBufferString(payload))
+			r.Header.Set("X-Gitlab-Event", "Merge Request Hook")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status ok, got %d: %s", w.Code, w.Body.String())
+			}
+			if len(jobs.jobs) != suite.jobs {
+				t.Fatalf("expected %d jobs, got %d", suite.jobs, len(jobs.jobs))
+			}
+			if suite.jobs > 0 {
+				test.ExpectString(t, "refs/merge-requests/7/head", jobs.jobs[0].Commit.Branch)
+				test.ExpectString(t, "feature", jobs.jobs[0].PullRequest.SourceBranch)
+			}
+		})
+	}
+}
@@ -7,64 +7,276 @@ import (
 	"go-brunel/internal/pkg/server/endpoint/api"
 	"go-brunel/internal/pkg/server/notify"
 	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"go-brunel/internal/pkg/shared/vcs"
 	"regexp"
 
 	"github.com/go-chi/chi"
 )
 
+const (
+	// supersededBy is recorded as the user that stopped jobs replaced by a newer commit
+	supersededBy = "superseded"
+
+	// zeroRevision is sent as the before revision of pushes that create a branch
+	zeroRevision = "0000000000000000000000000000000000000000"
+
+	// maxConcurrentDiffs bounds the truncated pushes whose revisions are fetched at once
+	maxConcurrentDiffs = 4
+)
+
 type webHookHandler struct {
 	configuration   server.WebHookConfiguration
 	notifier        notify.Notify
 	jobStore        store.JobStore
 	repositoryStore store.RepositoryStore
+	differ          vcs.Differ
+	diffs           chan struct{}
+}
+
+// truncatedPush is a job of a push whose hook payload does not list every changed file, they are found by comparing
+// the before revision with the revision of the job
+type truncatedPush struct {
+	job    store.Job
+	before string
+}
+
+// uniqueFiles merges the lists of files changed by each commit of a push
+func uniqueFiles(lists ...[]string) []string {
+	seen := map[string]bool{}
+	files := []string{}
+	for _, list := range lists {
+		for _, file := range list {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	return files
+}
+
+// finishTruncatedPushes handles pushes whose payloads only list the files of a limited number of commits. The hook is
+// answered straight away, the revisions are compared in the background and the jobs started once their changed files
+// are known. When they can not be compared the changes are unknown, so every trigger of the push runs.
+func (handler *webHookHandler) finishTruncatedPushes(repository store.Repository, pushes ...truncatedPush) api.Response {
+	jobs := make([]store.Job, len(pushes))
+	for i, push := range pushes {
+		jobs[i] = push.job
+		jobs[i].ChangedFiles = nil
+	}
+	if handler.differ == nil {
+		return handler.finishHandling(repository, jobs...)
+	}
+
+	repository.Clean()
+	if e := repository.IsValid(); e != nil {
+		return api.BadRequest(errors.Wrap(e, "invalid repository"), e.Error())
+	}
+
+	go func() {
+		for i, push := range pushes {
+			jobs[i].ChangedFiles = handler.diff(repository.URI, push)
+		}
+		// Errors are logged when the response is built
+		handler.finishHandling(repository, jobs...)
+	}()
+	return api.NoContent()
 }
 
-func (handler *webHookHandler) finishHandling(repository store.Repository, job store.Job) api.Response {
-	job.Clean()
+// diff returns the files changed by the push, or nil when they can not be found
+func (handler *webHookHandler) diff(uri string, push truncatedPush) []string {
+	after := push.job.Commit.Revision
+	if push.before == "" || push.before == zeroRevision || after == zeroRevision {
+		return nil
+	}
+
+	handler.diffs <- struct{}{}
+	defer func() { <-handler.diffs }()
+
+	files, err := handler.differ.ChangedFiles(uri, push.job.Commit.Branch, push.before, after)
+	if err != nil {
+		log.Warning("error comparing revisions ", push.before, " and ", after, " of ", uri, ": ", err)
+		return nil
+	}
+	return files
+}
+
+// finishHandling stores the repository of a hook event and starts jobs for each of the events commits
+// that match one of the repositories triggers
+func (handler *webHookHandler) finishHandling(repository store.Repository, jobs ...store.Job) api.Response {
 	repository.Clean()
 
 	if e := repository.IsValid(); e != nil {
 		return api.BadRequest(errors.Wrap(e, "invalid repository"), e.Error())
 	}
 
-	if e := job.IsValid(); e != nil {
-		return api.BadRequest(errors.Wrap(e, "invalid job"), e.Error())
+	for i := range jobs {
+		jobs[i].Clean()
+		if e := jobs[i].IsValid(); e != nil {
+			return api.BadRequest(errors.Wrap(e, "invalid job"), e.Error())
+		}
 	}
 
 	repo, err := handler.repositoryStore.AddOrUpdate(repository)
 	if err != nil {
-		return api.InternalServerError(errors.Wrap(err, "error storing github hook event repository"))
+		return api.InternalServerError(errors.Wrap(err, "error storing hook event repository"))
+	}
+
+	for _, job := range jobs {
+		if err := handler.startJobs(*repo, job); err != nil {
+			return api.InternalServerError(err)
+		}
+	}
+
+	log.Info("received build notification hook for project ", repo.Project, "/", repo.Name)
+	return api.NoContent()
+}
+
+func (handler *webHookHandler) startJobs(repo store.Repository, job store.Job) error {
+	// Pull request triggers match against the branch being merged into
+	reference := job.Commit.Branch
+	if job.PullRequest != nil {
+		reference = job.PullRequest.TargetBranch
+
+		duplicate, err := handler.supersedePullRequestJobs(repo, job)
+		if err != nil {
+			return errors.Wrap(err, "error superseding pull request jobs")
+		}
+		if duplicate {
+			log.Info("ignoring duplicate pull request hook for project ", repo.Project, "/", repo.Name)
+			return nil
+		}
 	}
 
 	for _, t := range repo.Triggers {
+		// Scheduled triggers are started by the scheduler, not by pushes
+		if t.Type == store.RepositoryTriggerTypeSchedule {
+			continue
+		}
+
+		if (t.Type == store.RepositoryTriggerTypePullRequest) != (job.PullRequest != nil) {
+			continue
+		}
+
 		r, e := regexp.Compile(t.Pattern)
 		if e != nil {
-			return api.InternalServerError(
-				errors.Wrap(e, "invalid pattern"),
-			)
+			return errors.Wrap(e, "invalid pattern")
 		}
 
-		if r.Match([]byte(job.Commit.Branch)) {
+		if !r.Match([]byte(reference)) {
+			continue
+		}
+
+		matches, e := t.MatchesFiles(job.ChangedFiles)
+		if e != nil {
+			return errors.Wrap(e, "invalid trigger path")
+		}
+
+		if matches {
 			j, err := handler.jobStore.Add(store.Job{
 				RepositoryID:  repo.ID,
 				EnvironmentID: t.EnvironmentID,
 				Commit:        job.Commit,
 				State:         job.State,
 				StartedBy:     job.StartedBy,
+				PullRequest:   job.PullRequest,
+				ChangedFiles:  job.ChangedFiles,
+				Priority:      t.Priority,
 				CreatedAt:     job.CreatedAt,
 			})
 			if err != nil {
-				return api.InternalServerError(errors.Wrap(err, "error storing hook event job"))
+				return errors.Wrap(err, "error storing hook event job")
+			}
+
+			if err := handler.supersedeBranchJobs(repo, *j); err != nil {
+				return errors.Wrap(err, "error superseding branch jobs")
 			}
 
 			if err := handler.notifier.Notify(j.ID); err != nil {
-				return api.InternalServerError(errors.Wrap(err, "error notifying job status from hook event"))
+				return errors.Wrap(err, "error notifying job status from hook event")
 			}
 		}
 	}
+	return nil
+}
+
+// supersedePullRequestJobs cancels any waiting or processing jobs for the pull request that were started for an
+// older commit. If a job for the same commit is still active the event is a duplicate and true is returned.
+func (handler *webHookHandler) supersedePullRequestJobs(repository store.Repository, job store.Job) (bool, error) {
+	active, err := handler.jobStore.FindActiveByPullRequest(repository.ID, job.PullRequest.Number)
+	if err != nil {
+		return false, err
+	}
+
+	for _, a := range active {
+		if a.Commit.Revision == job.Commit.Revision {
+			return true, nil
+		}
+	}
 
-	log.Info("received build notification hook for project ", repo.Project, "/", repo.Name)
-	return api.NoContent()
+	for _, a := range active {
+		if err := handler.jobStore.CancelByID(a.ID, supersededBy); err != nil {
+			return false, err
+		}
+		log.Info("job with id ", a.ID, " has been superseded by a new commit to pull request ", job.PullRequest.Number)
+
+		if err := handler.notifier.Notify(a.ID); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// supersedeBranchJobs stops older jobs for the same branch and environment as a newly queued job, according to
+// the supersede mode of the repository. Only jobs started the same way are stopped, pushes never stop pull request
+// jobs or the other way around, and jobs for the same revision are left to run as the event may be a redelivery.
+func (handler *webHookHandler) supersedeBranchJobs(repository store.Repository, job store.Job) error {
+	mode := repository.Settings.Supersede
+	if mode == store.RepositorySupersedeModeNone {
+		return nil
+	}
+
+	active, err := handler.jobStore.FindActiveByBranch(repository.ID, job.Commit.Branch)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range active {
+		if a.ID == job.ID || !sameEnvironment(a.EnvironmentID, job.EnvironmentID) || !samePullRequest(a, job) {
+			continue
+		}
+		if a.Commit.Revision == job.Commit.Revision {
+			continue
+		}
+		if a.State == shared.JobStateProcessing && mode != store.RepositorySupersedeModeAll {
+			continue
+		}
+
+		if err := handler.jobStore.CancelByID(a.ID, supersededBy); err != nil {
+			return err
+		}
+		log.Info("job with id ", a.ID, " has been superseded by job ", job.ID)
+
+		if err := handler.notifier.Notify(a.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func samePullRequest(a store.Job, b store.Job) bool {
+	if a.PullRequest == nil || b.PullRequest == nil {
+		return a.PullRequest == b.PullRequest
+	}
+	return a.PullRequest.Number == b.PullRequest.Number
+}
+
+func sameEnvironment(a *shared.EnvironmentID, b *shared.EnvironmentID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 func Routes(
@@ -72,15 +284,21 @@ func Routes(
 	jobStore store.JobStore,
 	repositoryStore store.RepositoryStore,
 	notifier notify.Notify,
+	differ vcs.Differ,
 ) *chi.Mux {
 	handler := webHookHandler{
 		configuration:   configuration,
 		jobStore:        jobStore,
 		repositoryStore: repositoryStore,
 		notifier:        notifier,
+		differ:          differ,
+		diffs:           make(chan struct{}, maxConcurrentDiffs),
 	}
 	router := chi.NewRouter()
 	router.Post("/gitlab", api.Handle(handler.gitLab))
 	router.Post("/github", api.Handle(handler.gitHub))
+	router.Post("/gitea", api.Handle(handler.gitea))
+	router.Post("/bitbucket-server", api.Handle(handler.bitbucketServer))
+	router.Post("/generic/{name}", api.Handle(handler.generic))
 	return router
 }
@@ -0,0 +1,17 @@
+package hook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// validSignature checks the hex encoded HMAC SHA256 signature of the body, signatures may be prefixed with 'sha256='
+func validSignature(secret string, body []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(strings.TrimPrefix(signature, "sha256=")), []byte(expected))
+}
@@ -1,10 +1,14 @@
 package job
 
 import (
+	"fmt"
 	"github.com/pkg/errors"
 	"go-brunel/internal/pkg/server/endpoint/api"
+	"go-brunel/internal/pkg/server/endpoint/api/logs"
+	"go-brunel/internal/pkg/server/retention"
 	"go-brunel/internal/pkg/server/security"
 	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/stream"
 	"go-brunel/internal/pkg/shared"
 	"net/http"
 	"time"
@@ -20,6 +24,8 @@ type jobHandler struct {
 	containerStore  store.ContainerStore
 	repositoryStore store.RepositoryStore
 	jwtSerializer   security.TokenSerializer
+	purger          *retention.Purger
+	bus             *stream.Bus
 }
 
 func (handler *jobHandler) get(r *http.Request) api.Response {
@@ -46,6 +52,15 @@ func (handler *jobHandler) get(r *http.Request) api.Response {
 	})
 }
 
+type jobProgress struct {
+	State  shared.JobState
+	Stages []struct {
+		store.Stage
+		Containers []store.Container
+		Logs       []store.Log
+	}
+}
+
 func (handler *jobHandler) progress(r *http.Request) api.Response {
 	id := shared.JobID(chi.URLParam(r, "id"))
 	since, err := api.ParseQueryTime(r, "since", false, time.Time{})
@@ -53,42 +68,41 @@ func (handler *jobHandler) progress(r *http.Request) api.Response {
 		return api.InternalServerError(errors.Wrap(err, "error parsing query parameter 'since'"))
 	}
 
-	details := struct {
-		State  shared.JobState
-		Stages []struct {
-			store.Stage
-			Containers []store.Container
-			Logs       []store.Log
+	details, err := handler.readProgress(id, since)
+	if err != nil {
+		if errors.Cause(err) == store.ErrorNotFound {
+			return api.NotFound()
 		}
-	}{}
+		return api.InternalServerError(err)
+	}
+	return api.Ok(details)
+}
+
+// readProgress reads the state of the job, along with its stages, their containers and the job logs since the time
+func (handler *jobHandler) readProgress(id shared.JobID, since time.Time) (*jobProgress, error) {
+	details := jobProgress{}
 
 	job, err := handler.jobStore.Get(id)
 	if err != nil {
-		return api.InternalServerError(errors.Wrap(err, "error getting job"))
+		return nil, errors.Wrap(err, "error getting job")
 	}
 	details.State = job.State
 
 	stages, err := handler.stageStore.FindAllByJobID(id)
 	if err != nil {
-		return api.InternalServerError(errors.Wrap(err, "error getting job stages"))
+		return nil, errors.Wrap(err, "error getting job stages")
 	}
 
 	// Read out containers with a matching job id
 	containers, err := handler.containerStore.FilterByJobID(id)
 	if err != nil {
-		if err == store.ErrorNotFound {
-			return api.NotFound()
-		}
-		return api.InternalServerError(errors.Wrap(err, "error getting job containers"))
+		return nil, errors.Wrap(err, "error getting job containers")
 	}
 
 	// Read our the job level logs with the
-	logs, err := handler.logStore.FilterLogByJobIDFromTime(id, since)
+	jobLogs, err := handler.logStore.FilterLogByJobIDFromTime(id, since)
 	if err != nil {
-		if err == store.ErrorNotFound {
-			return api.NotFound()
-		}
-		return api.InternalServerError(errors.Wrap(err, "error getting job logs"))
+		return nil, errors.Wrap(err, "error getting job logs")
 	}
 
 	// Map out out object for reading the UI
@@ -108,7 +122,7 @@ func (handler *jobHandler) progress(r *http.Request) api.Response {
 		}
 
 		var stageLogs []store.Log
-		for _, l := range logs {
+		for _, l := range jobLogs {
 			if l.StageID == stage.ID {
 				stageLogs = append(stageLogs, l)
 			}
@@ -127,7 +141,104 @@ func (handler *jobHandler) progress(r *http.Request) api.Response {
 		details.Stages = append(details.Stages, mappedStage)
 	}
 
-	return api.Ok(details)
+	return &details, nil
+}
+
+// logs writes the job level logs in the format negotiated from the request. When the download query parameter is set
+// every log of the job, including its containers, is written as a gzipped tar archive instead.
+func (handler *jobHandler) logs(w http.ResponseWriter, r *http.Request) {
+	id := shared.JobID(chi.URLParam(r, "id"))
+	since, err := api.ParseQueryTime(r, "since", false, time.Time{})
+	if err != nil {
+		api.HandleError(w, http.StatusBadRequest, errors.Wrap(err, "error parsing query parameter 'since'"))
+		return
+	}
+
+	download := r.URL.Query().Get("download") == "1"
+	fallback := logs.FormatHTML
+	if download {
+		fallback = logs.FormatText
+	}
+	format, err := logs.Negotiate(r, fallback)
+	if err != nil {
+		api.HandleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := handler.jobStore.Get(id); err != nil {
+		if err == store.ErrorNotFound {
+			api.HandleError(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+		log.Error("error getting job: ", err)
+		api.HandleError(w, http.StatusInternalServerError, errors.New("internal error"))
+		return
+	}
+
+	if download {
+		containers, err := handler.containerStore.FilterByJobID(id)
+		if err != nil {
+			log.Error("error getting job containers: ", err)
+			api.HandleError(w, http.StatusInternalServerError, errors.New("internal error"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, logs.ArchiveName(id)))
+		if err := logs.WriteArchive(w, format, id, handler.logStore, containers); err != nil {
+			log.Error("error writing job log archive: ", err)
+		}
+		return
+	}
+
+	lines, err := handler.logStore.FilterLogByJobIDFromTime(id, since)
+	if err != nil {
+		log.Error("error getting job logs: ", err)
+		api.HandleError(w, http.StatusInternalServerError, errors.New("internal error"))
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	if err := logs.Write(w, format, logs.JobLines(lines)); err != nil {
+		log.Error("error writing job logs: ", err)
+	}
+}
+
+// stream pushes the changes of the job as server-sent events, starting with a snapshot of its progress
+func (handler *jobHandler) stream(w http.ResponseWriter, r *http.Request) {
+	id := shared.JobID(chi.URLParam(r, "id"))
+	job, err := handler.jobStore.Get(id)
+	if err != nil {
+		if err == store.ErrorNotFound {
+			api.HandleError(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+		api.HandleError(w, http.StatusInternalServerError, errors.New("internal error"))
+		log.Error("error getting job: ", err)
+		return
+	}
+
+	containers, err := handler.containerStore.FilterByJobID(id)
+	if err != nil {
+		api.HandleError(w, http.StatusInternalServerError, errors.New("internal error"))
+		log.Error("error getting job containers: ", err)
+		return
+	}
+
+	// Containers added before the server started are not known to the bus, their events would otherwise be missed.
+	// Finished jobs have no more container events, and the bus would not forget them.
+	if job.State <= shared.JobStateProcessing {
+		for _, c := range containers {
+			handler.bus.Track(c.ContainerID, id)
+		}
+	}
+
+	err = stream.Serve(w, r, handler.bus, stream.Filter{JobID: id}, func() (interface{}, error) {
+		return handler.readProgress(id, time.Time{})
+	})
+	if err != nil {
+		log.Error("error streaming job ", id, ": ", err)
+	}
 }
 
 func (handler *jobHandler) cancel(r *http.Request) api.Response {
@@ -167,13 +278,43 @@ func (handler *jobHandler) reschedule(r *http.Request) api.Response {
 		Commit:        job.Commit,
 		State:         shared.JobStateWaiting,
 		StartedBy:     identity.Username,
+		Parameters:    job.Parameters,
+		PullRequest:   job.PullRequest,
+		ChangedFiles:  job.ChangedFiles,
+		Priority:      job.Priority,
 		CreatedAt:     time.Now(),
 	}
 	savedJob, err := handler.jobStore.Add(newJob)
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error storing rescheduled job"))
+	}
 
 	return api.Ok(savedJob)
 }
 
+// purge deletes a stopped job along with its stages, containers and logs
+func (handler *jobHandler) purge(r *http.Request) api.Response {
+	id := shared.JobID(chi.URLParam(r, "id"))
+	job, err := handler.jobStore.Get(id)
+	if err != nil {
+		if err == store.ErrorNotFound {
+			return api.NotFound()
+		}
+		return api.InternalServerError(errors.Wrap(err, "error getting job"))
+	}
+
+	if job.State == shared.JobStateWaiting || job.State == shared.JobStateProcessing {
+		return api.BadRequest(errors.New("job is active"), "active jobs cannot be purged, cancel the job first")
+	}
+
+	if err := handler.purger.Delete(id); err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error purging job"))
+	}
+
+	log.Info("job with id ", id, " has been purged")
+	return api.NoContent()
+}
+
 func Routes(
 	jobStore store.JobStore,
 	logStore store.LogStore,
@@ -181,6 +322,7 @@ func Routes(
 	containerStore store.ContainerStore,
 	repositoryStore store.RepositoryStore,
 	jwtSerializer security.TokenSerializer,
+	bus *stream.Bus,
 ) *chi.Mux {
 	handler := jobHandler{
 		jobStore:        jobStore,
@@ -189,11 +331,20 @@ func Routes(
 		repositoryStore: repositoryStore,
 		containerStore:  containerStore,
 		jwtSerializer:   jwtSerializer,
+		bus:             bus,
+		purger: &retention.Purger{
+			JobStore:       jobStore,
+			ContainerStore: containerStore,
+			LogStore:       logStore,
+		},
 	}
 	router := chi.NewRouter()
 	router.Get("/{id}", api.Handle(handler.get))
 	router.Post("/{id}/reschedule", api.Handle(handler.reschedule))
+	router.Post("/{id}/purge", api.Handle(handler.purge))
 	router.Get("/{id}/progress", api.Handle(handler.progress))
+	router.Get("/{id}/stream", handler.stream)
+	router.Get("/{id}/logs", handler.logs)
 	router.Delete("/{id}", api.Handle(handler.cancel))
 	return router
 }
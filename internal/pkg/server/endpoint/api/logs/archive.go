@@ -0,0 +1,103 @@
+package logs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func safeName(name string) string {
+	return unsafeName.ReplaceAllString(name, "_")
+}
+
+// ArchiveName is the file name of the log archive of the job
+func ArchiveName(id shared.JobID) string {
+	return "job-" + safeName(string(id)) + ".tar.gz"
+}
+
+// WriteArchive writes every log of the job, in the format, to a gzipped tar archive. The archive holds a directory per
+// stage with the stage's job logs in stage<ext> and a file per container, numbered in the order they were created.
+// Job logs outside of a stage are written to job<ext>.
+func WriteArchive(w io.Writer, format Format, id shared.JobID, logStore store.LogStore, containers []store.Container) error {
+	jobLogs, err := logStore.FilterLogByJobIDFromTime(id, time.Time{})
+	if err != nil {
+		return errors.Wrap(err, "error getting job logs")
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	root := "job-" + safeName(string(id))
+	now := time.Now()
+
+	write := func(name string, lines []Line) error {
+		buffer := &bytes.Buffer{}
+		if err := Write(buffer, format, lines); err != nil {
+			return err
+		}
+		err := archive.WriteHeader(&tar.Header{
+			Name:    path.Join(root, name),
+			Mode:    0644,
+			Size:    int64(buffer.Len()),
+			ModTime: now,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error writing archive header")
+		}
+		_, err = archive.Write(buffer.Bytes())
+		return errors.Wrap(err, "error writing archive file")
+	}
+
+	stageLogs := map[shared.StageID][]store.Log{}
+	var stages []shared.StageID
+	for _, l := range jobLogs {
+		if _, ok := stageLogs[l.StageID]; !ok {
+			stages = append(stages, l.StageID)
+		}
+		stageLogs[l.StageID] = append(stageLogs[l.StageID], l)
+	}
+	for _, stage := range stages {
+		name := "job" + format.Extension()
+		if stage != "" {
+			name = path.Join(safeName(string(stage)), "stage"+format.Extension())
+		}
+		if err := write(name, JobLines(stageLogs[stage])); err != nil {
+			return err
+		}
+	}
+
+	sort.SliceStable(containers, func(i, j int) bool {
+		return containers[i].CreatedAt.Before(containers[j].CreatedAt)
+	})
+	for i, c := range containers {
+		logs, err := logStore.FilterContainerLogByContainerIDFromTime(c.ContainerID, time.Time{})
+		if err != nil {
+			return errors.Wrap(err, "error getting container logs")
+		}
+
+		kind := "container"
+		if c.Meta.Service {
+			kind = "service"
+		}
+		name := fmt.Sprintf("%02d-%s-%s%s", i+1, kind, safeName(string(c.ContainerID)), format.Extension())
+		if err := write(path.Join(safeName(string(c.Meta.StageID)), name), ContainerLines(logs)); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return errors.Wrap(err, "error closing archive")
+	}
+	return errors.Wrap(gz.Close(), "error closing archive")
+}
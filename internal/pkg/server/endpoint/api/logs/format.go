@@ -0,0 +1,159 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/buildkite/terminal-to-html"
+	"github.com/pkg/errors"
+)
+
+// Format is the representation logs are written in
+type Format string
+
+const (
+	// FormatHTML renders the ANSI escape codes of each line as HTML
+	FormatHTML Format = "html"
+
+	// FormatText writes each line with its ANSI escape codes removed
+	FormatText Format = "text"
+
+	// FormatANSI writes each line as it was logged, including its ANSI escape codes
+	FormatANSI Format = "ansi"
+
+	// FormatNDJSON writes each line as a JSON object along with its time and stream
+	FormatNDJSON Format = "ndjson"
+)
+
+var formatContentTypes = map[Format]string{
+	FormatHTML:   "text/html",
+	FormatText:   "text/plain",
+	FormatANSI:   "text/x-ansi",
+	FormatNDJSON: "application/x-ndjson",
+}
+
+var formatExtensions = map[Format]string{
+	FormatHTML:   ".html",
+	FormatText:   ".log",
+	FormatANSI:   ".log",
+	FormatNDJSON: ".ndjson",
+}
+
+// ansiEscape matches CSI sequences, such as colours and cursor movement, and OSC sequences, such as window titles
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// ContentType is the media type of the format, including its charset
+func (f Format) ContentType() string {
+	if f == FormatNDJSON {
+		return formatContentTypes[f]
+	}
+	return formatContentTypes[f] + "; charset=utf-8"
+}
+
+// Extension is the file name extension of logs in the format
+func (f Format) Extension() string {
+	return formatExtensions[f]
+}
+
+// Negotiate picks the log format from the 'format' query parameter, one of html, text, ansi or ndjson, or
+// otherwise from the first media type of the Accept header matching a format. The fallback is used when neither
+// selects a format.
+func Negotiate(r *http.Request, fallback Format) (Format, error) {
+	if q := r.URL.Query().Get("format"); q != "" {
+		if _, ok := formatContentTypes[Format(q)]; !ok {
+			return fallback, fmt.Errorf("unknown log format '%s'", q)
+		}
+		return Format(q), nil
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		for format, contentType := range formatContentTypes {
+			if mediaType == contentType {
+				return format, nil
+			}
+		}
+	}
+	return fallback, nil
+}
+
+// Line is a job or container log line, as written in the NDJSON format
+type Line struct {
+	Time        time.Time
+	Stream      string
+	Message     string
+	StageID     shared.StageID     `json:",omitempty"`
+	ContainerID shared.ContainerID `json:",omitempty"`
+}
+
+func stream(t shared.LogType) string {
+	if t == shared.LogTypeStdErr {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+// JobLines maps job logs to log lines
+func JobLines(logs []store.Log) []Line {
+	lines := make([]Line, 0, len(logs))
+	for _, l := range logs {
+		lines = append(lines, Line{Time: l.Time, Stream: stream(l.LogType), Message: l.Message, StageID: l.StageID})
+	}
+	return lines
+}
+
+// ContainerLines maps container logs to log lines
+func ContainerLines(logs []store.ContainerLog) []Line {
+	lines := make([]Line, 0, len(logs))
+	for _, l := range logs {
+		lines = append(lines, Line{
+			Time:        l.Time,
+			Stream:      stream(l.LogType),
+			Message:     l.Message,
+			ContainerID: l.ContainerID,
+		})
+	}
+	return lines
+}
+
+// StripANSI removes the ANSI escape codes from the message
+func StripANSI(message string) string {
+	return ansiEscape.ReplaceAllString(message, "")
+}
+
+// Write writes the lines in the format
+func Write(w io.Writer, format Format, lines []Line) error {
+	encoder := json.NewEncoder(w)
+	for _, l := range lines {
+		var err error
+		switch format {
+		case FormatHTML:
+			if _, err = w.Write(terminal.Render([]byte(l.Message))); err == nil {
+				_, err = io.WriteString(w, "<br/>")
+			}
+		case FormatText:
+			_, err = io.WriteString(w, StripANSI(l.Message)+"\n")
+		case FormatANSI:
+			_, err = io.WriteString(w, l.Message+"\n")
+		case FormatNDJSON:
+			err = encoder.Encode(l)
+		default:
+			err = fmt.Errorf("unknown log format '%s'", format)
+		}
+		if err != nil {
+			return errors.Wrap(err, "error writing log line")
+		}
+	}
+	return nil
+}
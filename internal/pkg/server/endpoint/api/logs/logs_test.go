@@ -0,0 +1,111 @@
+package logs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"go-brunel/internal/pkg/server/endpoint/api/logs"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/store/memory"
+	"go-brunel/internal/pkg/shared"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		query    string
+		accept   string
+		expected logs.Format
+	}{
+		{"", "", logs.FormatHTML},
+		{"", "*/*", logs.FormatHTML},
+		{"", "text/plain;q=0.9, text/html", logs.FormatText},
+		{"", "application/x-ndjson", logs.FormatNDJSON},
+		{"?format=ansi", "text/plain", logs.FormatANSI},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/container/c/logs"+test.query, nil)
+		r.Header.Set("Accept", test.accept)
+		if format, err := logs.Negotiate(r, logs.FormatHTML); err != nil || format != test.expected {
+			t.Errorf("expected %s for %s %s, got %s: %v", test.expected, test.query, test.accept, format, err)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/api/container/c/logs?format=pdf", nil)
+	if _, err := logs.Negotiate(r, logs.FormatHTML); err == nil {
+		t.Errorf("expected an unknown format to be rejected")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	lines := logs.ContainerLines([]store.ContainerLog{
+		{ContainerID: "c", Message: "\x1b[31mfailed\x1b[0m", LogType: shared.LogTypeStdErr, Time: time.Unix(0, 0).UTC()},
+	})
+
+	tests := map[logs.Format]string{
+		logs.FormatText:   "failed\n",
+		logs.FormatANSI:   "\x1b[31mfailed\x1b[0m\n",
+		logs.FormatNDJSON: `{"Time":"1970-01-01T00:00:00Z","Stream":"stderr","Message":"\u001b[31mfailed\u001b[0m","ContainerID":"c"}` + "\n",
+		logs.FormatHTML:   `<span class="term-fg31">failed</span><br/>`,
+	}
+	for format, expected := range tests {
+		buffer := &bytes.Buffer{}
+		if err := logs.Write(buffer, format, lines); err != nil {
+			t.Fatal(err)
+		}
+		if buffer.String() != expected {
+			t.Errorf("unexpected %s output %q", format, buffer.String())
+		}
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	logStore := &memory.LogStore{Database: memory.NewDatabase()}
+	_ = logStore.Log(store.Log{JobID: "job", Message: "cloning", Time: time.Unix(1, 0)})
+	_ = logStore.Log(store.Log{JobID: "job", StageID: "build", Message: "building", Time: time.Unix(2, 0)})
+	_ = logStore.ContainerLog(store.ContainerLog{ContainerID: "b", Message: "second", Time: time.Unix(4, 0)})
+	_ = logStore.ContainerLog(store.ContainerLog{ContainerID: "a", Message: "first", Time: time.Unix(3, 0)})
+
+	containers := []store.Container{
+		{ContainerID: "b", Meta: shared.ContainerMeta{StageID: "build"}, CreatedAt: time.Unix(2, 0)},
+		{ContainerID: "a", Meta: shared.ContainerMeta{StageID: "build", Service: true}, CreatedAt: time.Unix(1, 0)},
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := logs.WriteArchive(buffer, logs.FormatText, "job", logStore, containers); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		header, err := archive.Next()
+		if err != nil {
+			break
+		}
+		data, _ := ioutil.ReadAll(archive)
+		files[header.Name] = string(data)
+	}
+
+	expected := map[string]string{
+		"job-job/job.log":                  "cloning\n",
+		"job-job/build/stage.log":          "building\n",
+		"job-job/build/01-service-a.log":   "first\n",
+		"job-job/build/02-container-b.log": "second\n",
+	}
+	if len(files) != len(expected) {
+		t.Errorf("expected %d files, got %v", len(expected), files)
+	}
+	for name, content := range expected {
+		if files[name] != content {
+			t.Errorf("expected %s to hold %q, got %q", name, content, files[name])
+		}
+	}
+}
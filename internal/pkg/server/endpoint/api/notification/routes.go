@@ -0,0 +1,47 @@
+package notification
+
+import (
+	"go-brunel/internal/pkg/server/endpoint/api"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type notificationHandler struct {
+	deliveryStore store.NotificationDeliveryStore
+}
+
+func (handler *notificationHandler) deliveries(r *http.Request) api.Response {
+	pageIndex, err := api.ParseQueryInt(r, "pageIndex", false, 0)
+	if err != nil || pageIndex < 0 {
+		return api.BadRequest(errors.Wrap(err, "invalid page index"), "pageIndex must be a positive integer")
+	}
+
+	pageSize, err := api.ParseQueryInt(r, "pageSize", false, defaultPageSize)
+	if err != nil || pageSize <= 0 || pageSize > maxPageSize {
+		return api.BadRequest(errors.Wrap(err, "invalid page size"), "pageSize must be between 1 and 500")
+	}
+
+	deliveries, err := handler.deliveryStore.Filter(shared.JobID(r.URL.Query().Get("job")), pageIndex, pageSize)
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error getting notification deliveries"))
+	}
+	return api.Ok(deliveries)
+}
+
+func Routes(deliveryStore store.NotificationDeliveryStore) *chi.Mux {
+	handler := notificationHandler{
+		deliveryStore: deliveryStore,
+	}
+	router := chi.NewRouter()
+	router.Get("/deliveries", api.Handle(handler.deliveries))
+	return router
+}
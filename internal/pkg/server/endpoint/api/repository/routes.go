@@ -4,9 +4,16 @@ import (
 	"encoding/json"
 	"github.com/pkg/errors"
 	"go-brunel/internal/pkg/server/endpoint/api"
+	"go-brunel/internal/pkg/server/notify"
+	"go-brunel/internal/pkg/server/retention"
+	"go-brunel/internal/pkg/server/security"
 	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"go-brunel/internal/pkg/shared/vcs"
 	"net/http"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/go-chi/chi"
 )
 
@@ -16,8 +23,97 @@ const (
 )
 
 type repositoryHandler struct {
-	jobStore        store.JobStore
-	repositoryStore store.RepositoryStore
+	jobStore         store.JobStore
+	repositoryStore  store.RepositoryStore
+	environmentStore store.EnvironmentStore
+	resolver         vcs.Resolver
+	notifier         notify.Notify
+	jwtSerializer    security.TokenSerializer
+	purger           *retention.Purger
+}
+
+type runRequest struct {
+	Branch string
+
+	// Revision is optional, when empty the current head of the branch is built
+	Revision      string
+	EnvironmentID *shared.EnvironmentID
+
+	// Variables are exposed to the pipeline as brunel.parameters
+	Variables map[string]string
+
+	// Priority lets the job jump ahead of waiting jobs with a lower priority
+	Priority int
+}
+
+func (handler *repositoryHandler) run(r *http.Request) api.Response {
+	id := chi.URLParam(r, "id")
+	identity, err := handler.jwtSerializer.Decode(r)
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error decoding token"))
+	}
+
+	request := runRequest{}
+	if e := json.NewDecoder(r.Body).Decode(&request); e != nil {
+		return api.BadRequest(e, "bad request data")
+	}
+
+	repository, err := handler.repositoryStore.Get(store.RepositoryID(id))
+	if err != nil {
+		if err == store.ErrorNotFound {
+			return api.NotFound()
+		}
+		return api.InternalServerError(errors.Wrap(err, "error getting repository"))
+	}
+
+	if request.EnvironmentID != nil {
+		environment, err := handler.environmentStore.Get(*request.EnvironmentID)
+		if err != nil && err != store.ErrorNotFound {
+			return api.InternalServerError(errors.Wrap(err, "error getting environment"))
+		}
+		if err == store.ErrorNotFound || environment.DeletedAt != nil {
+			return api.BadRequest(errors.New("unknown environment"), "environment does not exist")
+		}
+	}
+
+	job := store.Job{
+		RepositoryID:  repository.ID,
+		EnvironmentID: request.EnvironmentID,
+		Commit: shared.Commit{
+			Branch:   request.Branch,
+			Revision: request.Revision,
+		},
+		State:      shared.JobStateWaiting,
+		StartedBy:  identity.Username,
+		Parameters: request.Variables,
+		Priority:   request.Priority,
+		CreatedAt:  time.Now(),
+	}
+	job.Clean()
+
+	if job.Commit.Branch != "" && job.Commit.Revision == "" {
+		revision, err := handler.resolver.Resolve(repository.URI, job.Commit.Branch)
+		if err != nil {
+			return api.BadRequest(errors.Wrap(err, "error resolving branch"), "could not resolve branch revision")
+		}
+		job.Commit.Revision = revision
+	}
+
+	if e := job.IsValid(); e != nil {
+		return api.BadRequest(errors.Wrap(e, "invalid job"), e.Error())
+	}
+
+	saved, err := handler.jobStore.Add(job)
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error storing job"))
+	}
+
+	// The job is queued whether or not it could be notified
+	if err := handler.notifier.Notify(saved.ID); err != nil {
+		log.Error("error notifying job status: ", err)
+	}
+
+	return api.Ok(saved)
 }
 
 func (handler *repositoryHandler) jobs(r *http.Request) api.Response {
@@ -90,15 +186,72 @@ func (handler *repositoryHandler) setTriggers(r *http.Request) api.Response {
 	return api.NoContent()
 }
 
-func Routes(repositoryStore store.RepositoryStore, jobStore store.JobStore) *chi.Mux {
+func (handler *repositoryHandler) setSettings(r *http.Request) api.Response {
+	id := chi.URLParam(r, "id")
+	settings := store.RepositorySettings{}
+
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		return api.BadRequest(err, "bad request data")
+	}
+
+	if e := settings.IsValid(); e != nil {
+		return api.BadRequest(errors.Wrap(e, "invalid settings"), e.Error())
+	}
+
+	if err := handler.repositoryStore.SetSettings(store.RepositoryID(id), settings); err != nil {
+		if err == store.ErrorNotFound {
+			return api.NotFound()
+		}
+		return api.InternalServerError(errors.Wrap(err, "error saving repository settings"))
+	}
+
+	return api.NoContent()
+}
+
+// purge applies the retention settings of the repository now, rather than waiting for the background purge
+func (handler *repositoryHandler) purge(r *http.Request) api.Response {
+	id := chi.URLParam(r, "id")
+	repository, err := handler.repositoryStore.Get(store.RepositoryID(id))
+	if err != nil {
+		if err == store.ErrorNotFound {
+			return api.NotFound()
+		}
+		return api.InternalServerError(errors.Wrap(err, "error getting repository"))
+	}
+
+	purged, err := handler.purger.Purge(*repository, time.Now())
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error purging jobs"))
+	}
+
+	return api.Ok(purged)
+}
+
+func Routes(
+	repositoryStore store.RepositoryStore,
+	jobStore store.JobStore,
+	environmentStore store.EnvironmentStore,
+	resolver vcs.Resolver,
+	notifier notify.Notify,
+	jwtSerializer security.TokenSerializer,
+	purger *retention.Purger,
+) *chi.Mux {
 	handler := repositoryHandler{
-		jobStore:        jobStore,
-		repositoryStore: repositoryStore,
+		jobStore:         jobStore,
+		repositoryStore:  repositoryStore,
+		environmentStore: environmentStore,
+		resolver:         resolver,
+		notifier:         notifier,
+		jwtSerializer:    jwtSerializer,
+		purger:           purger,
 	}
 	router := chi.NewRouter()
 	router.Get("/", api.Handle(handler.list))
 	router.Get("/{id}", api.Handle(handler.get))
 	router.Get("/{id}/jobs", api.Handle(handler.jobs))
+	router.Post("/{id}/jobs", api.Handle(handler.run))
 	router.Put("/{id}/triggers", api.Handle(handler.setTriggers))
+	router.Put("/{id}/settings", api.Handle(handler.setSettings))
+	router.Post("/{id}/purge", api.Handle(handler.purge))
 	return router
 }
@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/endpoint/api"
+	"go-brunel/internal/pkg/server/security"
+	"go-brunel/internal/pkg/server/store"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultTokenLifetime = time.Hour
+	maxTokenLifetime     = time.Hour * 24 * 7
+)
+
+type runnerHandler struct {
+	enrollmentTokenStore store.EnrollmentTokenStore
+	jwtSerializer        security.TokenSerializer
+}
+
+type createTokenRequest struct {
+	// Name is the name the enrolled runner will be known by
+	Name string
+
+	// ExpiresIn is the lifetime of the token in seconds
+	ExpiresIn int64
+}
+
+func (handler *runnerHandler) createToken(r *http.Request) api.Response {
+	identity, err := handler.jwtSerializer.Decode(r)
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error decoding token"))
+	}
+
+	request := createTokenRequest{}
+	if e := json.NewDecoder(r.Body).Decode(&request); e != nil {
+		return api.BadRequest(e, "bad request data")
+	}
+
+	lifetime := defaultTokenLifetime
+	if request.ExpiresIn > 0 {
+		lifetime = time.Duration(request.ExpiresIn) * time.Second
+	}
+	if lifetime > maxTokenLifetime {
+		return api.BadRequest(errors.New("token lifetime too long"), "token lifetime must not exceed 7 days")
+	}
+
+	secret, err := security.GenerateSecretToken()
+	if err != nil {
+		return api.InternalServerError(err)
+	}
+
+	token := store.EnrollmentToken{
+		Name:      request.Name,
+		Hash:      security.HashSecretToken(secret),
+		CreatedBy: identity.Username,
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+	token.Clean()
+	if e := token.IsValid(); e != nil {
+		return api.BadRequest(errors.Wrap(e, "invalid enrollment token"), e.Error())
+	}
+
+	saved, err := handler.enrollmentTokenStore.Add(token)
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error saving enrollment token"))
+	}
+
+	log.Info("enrollment token ", saved.ID, " for runner ", saved.Name, " created by ", identity.Username)
+
+	// The token is only ever returned here, we only store its hash
+	return api.Ok(struct {
+		store.EnrollmentToken
+		Token string
+	}{
+		EnrollmentToken: *saved,
+		Token:           secret,
+	})
+}
+
+func (handler *runnerHandler) listTokens(r *http.Request) api.Response {
+	tokens, err := handler.enrollmentTokenStore.Filter()
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error getting enrollment tokens"))
+	}
+	return api.Ok(tokens)
+}
+
+func (handler *runnerHandler) revokeToken(r *http.Request) api.Response {
+	id := chi.URLParam(r, "id")
+	if err := handler.enrollmentTokenStore.Revoke(store.EnrollmentTokenID(id)); err != nil {
+		if err == store.ErrorNotFound {
+			return api.NotFound()
+		}
+		return api.InternalServerError(errors.Wrap(err, "error revoking enrollment token"))
+	}
+
+	log.Info("enrollment token ", id, " has been revoked")
+	return api.NoContent()
+}
+
+func Routes(enrollmentTokenStore store.EnrollmentTokenStore, jwtSerializer security.TokenSerializer) *chi.Mux {
+	handler := runnerHandler{
+		enrollmentTokenStore: enrollmentTokenStore,
+		jwtSerializer:        jwtSerializer,
+	}
+	router := chi.NewRouter()
+	router.Get("/token", api.Handle(handler.listTokens))
+	router.Post("/token", api.Handle(handler.createToken))
+	router.Delete("/token/{id}", api.Handle(handler.revokeToken))
+	return router
+}
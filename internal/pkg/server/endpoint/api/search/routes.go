@@ -0,0 +1,71 @@
+package search
+
+import (
+	"fmt"
+	"go-brunel/internal/pkg/server/endpoint/api"
+	"go-brunel/internal/pkg/server/search"
+	"go-brunel/internal/pkg/server/store"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+const defaultPageSize = 50
+
+type searchHandler struct {
+	searcher *search.Searcher
+}
+
+// logs finds the job and container log lines matching the q query parameter, a regular expression when regex is set
+func (handler *searchHandler) logs(r *http.Request) api.Response {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		return api.BadRequest(errors.New("missing query"), "q must be specified")
+	}
+
+	logSearch, err := store.NewLogSearch(query, r.URL.Query().Get("regex") == "1")
+	if err != nil {
+		return api.BadRequest(err, err.Error())
+	}
+
+	since, err := api.ParseQueryTime(r, "since", false, time.Time{})
+	if err != nil {
+		return api.BadRequest(err, "since must be a unix timestamp")
+	}
+
+	pageIndex, err := api.ParseQueryInt(r, "pageIndex", false, 0)
+	if err != nil || pageIndex < 0 {
+		return api.BadRequest(errors.Wrap(err, "invalid page index"), "pageIndex must be a positive integer")
+	}
+
+	pageSize, err := api.ParseQueryInt(r, "pageSize", false, defaultPageSize)
+	if err != nil || pageSize <= 0 || (pageIndex+1)*pageSize > search.MaxMatches {
+		return api.BadRequest(
+			errors.Wrap(err, "invalid page size"),
+			fmt.Sprintf("pageSize must be positive, and only the first %d matches can be paged through", search.MaxMatches),
+		)
+	}
+
+	result, err := handler.searcher.Search(search.Query{
+		Search:       logSearch,
+		RepositoryID: store.RepositoryID(r.URL.Query().Get("repository")),
+		Since:        since,
+		PageIndex:    pageIndex,
+		PageSize:     pageSize,
+	})
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error searching logs"))
+	}
+	return api.Ok(result)
+}
+
+func Routes(searcher *search.Searcher) *chi.Mux {
+	handler := searchHandler{
+		searcher: searcher,
+	}
+	router := chi.NewRouter()
+	router.Get("/logs", api.Handle(handler.logs))
+	return router
+}
@@ -20,6 +20,7 @@ type authHandler struct {
 	defaultAdminUser string
 	serializer       security.TokenSerializer
 	userStore        store.UserStore
+	tokenStore       store.TokenStore
 }
 
 func (handler *authHandler) sendErrorMessage(w http.ResponseWriter, err string) {
@@ -164,9 +165,35 @@ func (handler *authHandler) setRole(r *http.Request) api.Response {
 	return api.Ok(user)
 }
 
+// setNotifications replaces the notification preferences of the signed in user
+func (handler *authHandler) setNotifications(r *http.Request) api.Response {
+	claims, err := handler.serializer.Decode(r)
+	if err != nil {
+		return api.BadRequest(err, "error getting jwt claims")
+	}
+
+	preferences := store.NotificationPreferences{}
+	if e := json.NewDecoder(r.Body).Decode(&preferences); e != nil {
+		return api.BadRequest(e, "bad request data")
+	}
+
+	if e := preferences.IsValid(); e != nil {
+		return api.BadRequest(errors.Wrap(e, "error validating notification preferences"), "invalid request data")
+	}
+
+	if e := handler.userStore.SetNotificationPreferences(claims.Username, preferences); e != nil {
+		if e == store.ErrorNotFound {
+			return api.NotFound()
+		}
+		return api.InternalServerError(errors.Wrap(e, "error saving notification preferences"))
+	}
+	return api.Ok(preferences)
+}
+
 func Routes(
 	defaultAdminUser string,
 	userStore store.UserStore,
+	tokenStore store.TokenStore,
 	oauthProviders []goth.Provider,
 	serializer security.TokenSerializer,
 ) *chi.Mux {
@@ -176,6 +203,7 @@ func Routes(
 	}
 	handler := authHandler{
 		userStore:        userStore,
+		tokenStore:       tokenStore,
 		serializer:       serializer,
 		defaultAdminUser: defaultAdminUser,
 	}
@@ -184,8 +212,12 @@ func Routes(
 	router.Get("/login", handler.login)
 	router.Get("/callback", handler.callback)
 	router.Get("/profile", api.Handle(handler.profile))
+	router.Put("/profile", api.Handle(handler.setNotifications))
 	router.Get("/profile/{username}", api.Handle(handler.get))
 	router.Post("/profile/{username}", api.Handle(handler.setRole))
+	router.Get("/tokens", api.Handle(handler.listTokens))
+	router.Post("/tokens", api.Handle(handler.createToken))
+	router.Delete("/tokens/{id}", api.Handle(handler.revokeToken))
 	router.Get("/", api.Handle(handler.list))
 	return router
 }
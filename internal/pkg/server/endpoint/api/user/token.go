@@ -0,0 +1,147 @@
+package user
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/endpoint/api"
+	"go-brunel/internal/pkg/server/security"
+	"go-brunel/internal/pkg/server/store"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+type createTokenRequest struct {
+	// Name describes what the token is used for
+	Name string
+
+	// ReadOnly tokens may only make GET requests
+	ReadOnly bool
+
+	// ExpiresIn is the lifetime of the token in seconds, tokens without a lifetime never expire
+	ExpiresIn int64
+}
+
+// PersonalTokenAuthenticator looks personal tokens up in the token store, recording when they were last used. Tokens
+// act with the current role of their user, so tokens of users that were demoted lose their access too.
+func PersonalTokenAuthenticator(tokenStore store.TokenStore, userStore store.UserStore) security.PersonalTokenAuthenticator {
+	return func(hash string) (*security.Identity, error) {
+		token, err := tokenStore.Use(hash, time.Now())
+		if err == store.ErrorNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting personal token")
+		}
+
+		user, err := userStore.GetByUsername(token.Username)
+		if err == store.ErrorNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting personal token user")
+		}
+
+		return &security.Identity{
+			Username: user.Username,
+			Role:     user.Role,
+			ReadOnly: token.ReadOnly,
+		}, nil
+	}
+}
+
+// signedIn decodes the identity of a user that signed in, personal tokens can not be used to manage personal tokens
+func (handler *authHandler) signedIn(r *http.Request) (*security.Identity, error) {
+	identity, err := handler.serializer.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if identity == nil || identity.PersonalToken {
+		return nil, errors.New("personal tokens are managed by signed in users")
+	}
+	return identity, nil
+}
+
+func (handler *authHandler) listTokens(r *http.Request) api.Response {
+	identity, err := handler.signedIn(r)
+	if err != nil {
+		return api.UnAuthorized()
+	}
+
+	tokens, err := handler.tokenStore.FilterByUsername(identity.Username)
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error getting personal tokens"))
+	}
+	return api.Ok(tokens)
+}
+
+func (handler *authHandler) createToken(r *http.Request) api.Response {
+	identity, err := handler.signedIn(r)
+	if err != nil {
+		return api.UnAuthorized()
+	}
+
+	request := createTokenRequest{}
+	if e := json.NewDecoder(r.Body).Decode(&request); e != nil {
+		return api.BadRequest(e, "bad request data")
+	}
+	if request.ExpiresIn < 0 {
+		return api.BadRequest(errors.New("negative token lifetime"), "token lifetime must not be negative")
+	}
+
+	secret, err := security.GeneratePersonalToken()
+	if err != nil {
+		return api.InternalServerError(err)
+	}
+
+	token := store.PersonalToken{
+		Username: identity.Username,
+		Name:     request.Name,
+		Hash:     security.HashSecretToken(secret),
+		ReadOnly: request.ReadOnly,
+	}
+	if request.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(request.ExpiresIn) * time.Second)
+		token.ExpiresAt = &expiresAt
+	}
+	token.Clean()
+	if e := token.IsValid(); e != nil {
+		return api.BadRequest(errors.Wrap(e, "invalid personal token"), e.Error())
+	}
+
+	saved, err := handler.tokenStore.Add(token)
+	if err != nil {
+		return api.InternalServerError(errors.Wrap(err, "error saving personal token"))
+	}
+
+	log.Info("personal token ", saved.ID, " created by ", identity.Username)
+
+	// The token is only ever returned here, we only store its hash
+	return api.Ok(struct {
+		store.PersonalToken
+		Token string
+	}{
+		PersonalToken: *saved,
+		Token:         secret,
+	})
+}
+
+func (handler *authHandler) revokeToken(r *http.Request) api.Response {
+	identity, err := handler.signedIn(r)
+	if err != nil {
+		return api.UnAuthorized()
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := handler.tokenStore.Revoke(identity.Username, store.PersonalTokenID(id)); err != nil {
+		if err == store.ErrorNotFound {
+			return api.NotFound()
+		}
+		return api.InternalServerError(errors.Wrap(err, "error revoking personal token"))
+	}
+
+	log.Info("personal token ", id, " of ", identity.Username, " has been revoked")
+	return api.NoContent()
+}
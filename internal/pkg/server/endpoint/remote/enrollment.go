@@ -0,0 +1,43 @@
+package remote
+
+import (
+	"go-brunel/internal/pkg/server/security"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared/remote"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// Enrollment is the only RPC service offered to runners connecting without a client certificate.
+// Runners exchange a single use enrollment token for a client certificate signed by our certificate authority.
+type Enrollment struct {
+	Authority            *remote.Authority
+	EnrollmentTokenStore store.EnrollmentTokenStore
+}
+
+func (t *Enrollment) Enroll(args *remote.EnrollRequest, reply *remote.EnrollResponse) error {
+	key, err := remote.ParsePublicKey(args.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "error parsing runner public key")
+	}
+
+	token, err := t.EnrollmentTokenStore.Consume(security.HashSecretToken(args.Token))
+	if err == store.ErrorNotFound {
+		return errors.New("enrollment token is invalid, expired, revoked or has already been used")
+	}
+	if err != nil {
+		return errors.Wrap(err, "error consuming enrollment token")
+	}
+
+	cert, err := t.Authority.SignRunner(token.Name, key)
+	if err != nil {
+		return errors.Wrap(err, "error signing runner certificate")
+	}
+
+	log.Info("runner ", token.Name, " has enrolled using token ", token.ID)
+	reply.Name = token.Name
+	reply.CA = t.Authority.Cert
+	reply.Cert = cert
+	return nil
+}
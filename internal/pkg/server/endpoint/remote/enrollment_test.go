@@ -0,0 +1,71 @@
+package remote_test
+
+import (
+	"go-brunel/internal/pkg/server/endpoint/remote"
+	"go-brunel/internal/pkg/server/security"
+	"go-brunel/internal/pkg/server/store"
+	shared "go-brunel/internal/pkg/shared/remote"
+	"go-brunel/test"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type tokenStore struct {
+	store.EnrollmentTokenStore
+	tokens map[string]*store.EnrollmentToken
+}
+
+func (s *tokenStore) Consume(hash string) (*store.EnrollmentToken, error) {
+	t, ok := s.tokens[hash]
+	if !ok || t.UsedAt != nil {
+		return nil, store.ErrorNotFound
+	}
+	now := time.Now()
+	t.UsedAt = &now
+	return t, nil
+}
+
+func TestEnrollment_Enroll(t *testing.T) {
+	authority, err := shared.GenerateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := security.GenerateSecretToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enrollment := remote.Enrollment{
+		Authority: authority,
+		EnrollmentTokenStore: &tokenStore{
+			tokens: map[string]*store.EnrollmentToken{
+				security.HashSecretToken(secret): {Name: "runner-1"},
+			},
+		},
+	}
+
+	_, publicKey, err := shared.GenerateRunnerKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply := shared.EnrollResponse{}
+	if err := enrollment.Enroll(&shared.EnrollRequest{Token: secret, PublicKey: publicKey}, &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := shared.ParseCertificate(reply.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ExpectString(t, "runner-1", cert.Subject.CommonName)
+	test.ExpectString(t, "runner-1", reply.Name)
+	test.ExpectString(t, authority.Cert, reply.CA)
+
+	// Tokens are single use
+	err = enrollment.Enroll(&shared.EnrollRequest{Token: secret, PublicKey: publicKey}, &shared.EnrollResponse{})
+	test.ExpectErrorLike(t, errors.New("enrollment token is invalid"), err)
+}
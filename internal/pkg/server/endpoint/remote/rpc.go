@@ -3,6 +3,7 @@ package remote
 import (
 	"go-brunel/internal/pkg/server/notify"
 	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/stream"
 	"go-brunel/internal/pkg/shared"
 	"go-brunel/internal/pkg/shared/remote"
 	"time"
@@ -12,6 +13,9 @@ import (
 )
 
 type RPC struct {
+	// Runner is the name of the runner on the other end of the connection
+	Runner string
+
 	Notify           notify.Notify
 	JobStore         store.JobStore
 	LogStore         store.LogStore
@@ -19,10 +23,13 @@ type RPC struct {
 	RepositoryStore  store.RepositoryStore
 	EnvironmentStore store.EnvironmentStore
 	StageStore       store.StageStore
+
+	// Bus receives the job changes once they are stored, it may be nil
+	Bus *stream.Bus
 }
 
 func (t *RPC) GetNextAvailableJob(_ *remote.Empty, reply *remote.GetNextAvailableJobResponse) error {
-	job, e := t.JobStore.Next()
+	job, e := t.JobStore.Next(t.Runner)
 	if e != nil {
 		return errors.Wrap(e, "error getting next job from store")
 	}
@@ -32,13 +39,16 @@ func (t *RPC) GetNextAvailableJob(_ *remote.Empty, reply *remote.GetNextAvailabl
 		if e != nil {
 			return errors.Wrap(e, "error getting job repository from store")
 		}
-		log.Info("job with id ", job.ID, " has started")
+		log.Info("job with id ", job.ID, " has started on runner ", t.Runner)
 
 		reply.Job = &shared.Job{
 			ID:            job.ID,
 			State:         job.State,
 			Commit:        job.Commit,
 			EnvironmentID: job.EnvironmentID,
+			Parameters:    job.Parameters,
+			PullRequest:   job.PullRequest,
+			ChangedFiles:  job.ChangedFiles,
 			Repository: shared.Repository{
 				URI:     r.URI,
 				Name:    r.Name,
@@ -61,11 +71,14 @@ func (t *RPC) SetJobState(args *remote.SetJobStateRequest, _ *remote.Empty) erro
 	if err := t.JobStore.UpdateStateByID(args.Id, args.State); err != nil {
 		return errors.Wrap(err, "error storing job state")
 	}
+	state := args.State
+	t.Bus.Publish(stream.Event{Type: stream.EventTypeJob, JobID: args.Id, JobState: &state})
 
-	return errors.Wrap(
-		t.Notify.Notify(args.Id),
-		"error notifying job status",
-	)
+	// The state is stored, so notification errors are not the runner's to handle
+	if err := t.Notify.Notify(args.Id); err != nil {
+		log.Error("error notifying job status: ", err)
+	}
+	return nil
 }
 
 func (t *RPC) HasBeenCancelled(args *shared.JobID, reply *bool) error {
@@ -75,51 +88,69 @@ func (t *RPC) HasBeenCancelled(args *shared.JobID, reply *bool) error {
 }
 
 func (t *RPC) Log(args *remote.LogRequest, _ *remote.Empty) error {
-	return errors.Wrap(
-		t.LogStore.Log(store.Log{
-			JobID:   args.Id,
-			Message: args.Message,
-			LogType: args.LogType,
-			StageID: args.StageID,
-			Time:    time.Now(),
-		}),
-		"error storing log",
-	)
+	l := store.Log{
+		JobID:   args.Id,
+		Message: args.Message,
+		LogType: args.LogType,
+		StageID: args.StageID,
+		Time:    time.Now(),
+	}
+	if err := t.LogStore.Log(l); err != nil {
+		return errors.Wrap(err, "error storing log")
+	}
+
+	t.Bus.Publish(stream.Event{Type: stream.EventTypeLog, JobID: args.Id, Log: &l})
+	return nil
 }
 
 func (t *RPC) SetStageState(args *remote.SetStageStateRequest, _ *remote.Empty) error {
-	var startTime time.Time
-	var stopTime time.Time
-
+	// Only the time of this change is set, the stores keep the start time of a stage when it stops
+	now := time.Now()
+	stage := store.Stage{
+		ID:    args.Id,
+		JobID: args.JobID,
+		State: args.State,
+	}
 	if args.State > shared.StageStateRunning {
-		stopTime = time.Now()
+		stage.StoppedAt = &now
 	} else {
-		startTime = time.Now()
+		stage.StartedAt = &now
 	}
+	if err := t.StageStore.AddOrUpdate(stage); err != nil {
+		return errors.Wrap(err, "error storing stage stopped time")
+	}
+	t.Bus.Publish(stream.Event{Type: stream.EventTypeStage, JobID: args.JobID, Stage: &stage})
 
-	err := t.StageStore.AddOrUpdate(store.Stage{
-		ID:        args.Id,
-		JobID:     args.JobID,
-		State:     args.State,
-		StartedAt: &startTime,
-		StoppedAt: &stopTime,
-	})
-
-	return errors.Wrap(err, "error storing stage stopped time")
+	// Stage changes are notified too, so notifiers reporting per stage statuses stay up to date
+	if err := t.Notify.Notify(args.JobID); err != nil {
+		log.Error("error notifying stage status: ", err)
+	}
+	return nil
 }
 
 func (t *RPC) AddContainer(args *remote.AddContainerRequest, _ *remote.Empty) error {
-	return errors.Wrap(
-		t.ContainerStore.Add(store.Container{
-			JobID:       args.Id,
-			ContainerID: args.ContainerID,
-			Meta:        args.Meta,
-			Spec:        args.Container,
-			State:       args.State,
-			CreatedAt:   time.Now(),
-		}),
-		"error storing container",
-	)
+	container := store.Container{
+		JobID:       args.Id,
+		ContainerID: args.ContainerID,
+		Meta:        args.Meta,
+		Spec:        args.Container,
+		State:       args.State,
+		CreatedAt:   time.Now(),
+	}
+	if err := t.ContainerStore.Add(container); err != nil {
+		return errors.Wrap(err, "error storing container")
+	}
+
+	// The environment is not published, we dont want to leak any sensitive information
+	container.Spec.Environment = nil
+	t.Bus.Track(args.ContainerID, args.Id)
+	t.Bus.Publish(stream.Event{
+		Type:        stream.EventTypeContainer,
+		JobID:       args.Id,
+		ContainerID: args.ContainerID,
+		Container:   &container,
+	})
+	return nil
 }
 
 func (t *RPC) SetContainerState(args *remote.SetContainerStateRequest, _ *remote.Empty) error {
@@ -132,22 +163,28 @@ func (t *RPC) SetContainerState(args *remote.SetContainerStateRequest, _ *remote
 			return errors.Wrap(err, "error storing container start time")
 		}
 	}
-	return errors.Wrap(
-		t.ContainerStore.UpdateStateByContainerID(args.Id, args.State),
-		"error storing container state",
-	)
+	if err := t.ContainerStore.UpdateStateByContainerID(args.Id, args.State); err != nil {
+		return errors.Wrap(err, "error storing container state")
+	}
+
+	state := args.State
+	t.Bus.Publish(stream.Event{Type: stream.EventTypeContainer, ContainerID: args.Id, ContainerState: &state})
+	return nil
 }
 
 func (t *RPC) ContainerLog(args *remote.ContainerLogRequest, _ *remote.Empty) error {
-	return errors.Wrap(
-		t.LogStore.ContainerLog(store.ContainerLog{
-			ContainerID: args.Id,
-			Message:     args.Message,
-			LogType:     args.LogType,
-			Time:        time.Now(),
-		}),
-		"error storing container log",
-	)
+	l := store.ContainerLog{
+		ContainerID: args.Id,
+		Message:     args.Message,
+		LogType:     args.LogType,
+		Time:        time.Now(),
+	}
+	if err := t.LogStore.ContainerLog(l); err != nil {
+		return errors.Wrap(err, "error storing container log")
+	}
+
+	t.Bus.Publish(stream.Event{Type: stream.EventTypeContainerLog, ContainerID: args.Id, ContainerLog: &l})
+	return nil
 }
 
 func (t *RPC) GetEnvironmentVariable(args *remote.GetEnvironmentRequest, reply *string) error {
@@ -0,0 +1,197 @@
+package remote_test
+
+import (
+	runner "go-brunel/internal/pkg/runner/remote"
+	"go-brunel/internal/pkg/server/endpoint/remote"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/store/memory"
+	"go-brunel/internal/pkg/shared"
+	credentials "go-brunel/internal/pkg/shared/remote"
+	"go-brunel/test"
+	"net"
+	"sync"
+	"testing"
+)
+
+type countingNotify struct {
+	mutex sync.Mutex
+	ids   []shared.JobID
+}
+
+func (n *countingNotify) Notify(id shared.JobID) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.ids = append(n.ids, id)
+	return nil
+}
+
+// listen returns a free local address for the RPC server
+func listen(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestServer_Job(t *testing.T) {
+	database := memory.NewDatabase()
+	jobStore := &memory.JobStore{Database: database}
+	logStore := &memory.LogStore{Database: database}
+	containerStore := &memory.ContainerStore{Database: database}
+	repositoryStore := &memory.RepositoryStore{Database: database}
+	stageStore := &memory.StageStore{Database: database}
+	notify := &countingNotify{}
+
+	repository, err := repositoryStore.AddOrUpdate(store.Repository{Project: "project", Name: "name", URI: "uri"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := jobStore.Add(store.Job{
+		RepositoryID: repository.ID,
+		Commit:       shared.Commit{Branch: "refs/heads/master", Revision: "abc123"},
+		State:        shared.JobStateWaiting,
+		StartedBy:    "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authority, err := credentials.GenerateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCredentials, err := authority.IssueServer([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runnerCredentials, err := authority.IssueRunner("runner-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := listen(t)
+	if err := remote.Server(
+		jobStore,
+		logStore,
+		containerStore,
+		repositoryStore,
+		&memory.EnvironmentStore{Database: database},
+		stageStore,
+		notify,
+		nil,
+		nil,
+		*serverCredentials,
+		"",
+		address,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := runner.NewRPCClient(*runnerCredentials, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := client.GetNextAvailableJob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == nil || next.ID != job.ID || next.Repository.URI != "uri" {
+		t.Fatalf("expected the queued job, got %+v", next)
+	}
+
+	// A runner running a job with a single step in a build stage
+	containerID := shared.ContainerID("container-1")
+	calls := []error{
+		client.SetJobState(job.ID, shared.JobStateProcessing),
+		client.SetStageState(job.ID, "build", shared.StageStateRunning),
+		client.Log(job.ID, "starting build", shared.LogTypeStdOut, "build"),
+		client.AddContainer(
+			job.ID,
+			containerID,
+			shared.ContainerMeta{StageID: "build"},
+			shared.Container{Image: "alpine", Environment: map[string]string{"SECRET": "value"}},
+			shared.ContainerStateStarting,
+		),
+		client.SetContainerState(containerID, shared.ContainerStateRunning),
+		client.ContainerLog(containerID, "hello", shared.LogTypeStdOut),
+		client.ContainerLog(containerID, "failed", shared.LogTypeStdErr),
+		client.SetContainerState(containerID, shared.ContainerStateStopped),
+		client.SetStageState(job.ID, "build", shared.StageStateError),
+		client.SetJobState(job.ID, shared.JobStateFailed),
+	}
+	for i, err := range calls {
+		if err != nil {
+			t.Fatalf("error in call %d: %s", i, err)
+		}
+	}
+
+	cancelled, err := client.HasBeenCancelled(job.ID)
+	if err != nil || cancelled {
+		t.Errorf("expected the job to not be cancelled, got %v: %v", cancelled, err)
+	}
+
+	stored, err := jobStore.Get(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.State != shared.JobStateFailed || stored.StoppedAt == nil || stored.Runner != "runner-1" {
+		t.Errorf("expected the job to have failed on runner-1, got %+v", stored)
+	}
+
+	stages, err := stageStore.FindAllByJobID(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stages) != 1 || stages[0].ID != "build" || stages[0].State != shared.StageStateError {
+		t.Fatalf("expected the failed build stage, got %+v", stages)
+	}
+	startedAt, stoppedAt := stages[0].StartedAt, stages[0].StoppedAt
+	if startedAt == nil || stoppedAt == nil || startedAt.Before(stored.CreatedAt) || stoppedAt.Before(*startedAt) {
+		t.Errorf("expected the build stage to keep its start time, got %v %v", startedAt, stoppedAt)
+	}
+
+	containers, err := containerStore.FilterByJobID(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("expected a container, got %d", len(containers))
+	}
+	container := containers[0]
+	if container.ContainerID != containerID || container.State != shared.ContainerStateStopped ||
+		container.Meta.StageID != "build" || container.Spec.Image != "alpine" {
+		t.Errorf("expected the stopped container of the build stage, got %+v", container)
+	}
+	if container.StartedAt == nil || container.StoppedAt == nil {
+		t.Errorf("expected the container times to be stored, got %v %v", container.StartedAt, container.StoppedAt)
+	}
+
+	logs, err := logStore.FilterLogByJobIDFromTime(job.ID, stored.CreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].StageID != "build" {
+		t.Fatalf("expected the build stage log, got %+v", logs)
+	}
+	test.ExpectString(t, "starting build", logs[0].Message)
+
+	containerLogs, err := logStore.FilterContainerLogByContainerIDFromTime(containerID, stored.CreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containerLogs) != 2 || containerLogs[1].LogType != shared.LogTypeStdErr {
+		t.Fatalf("expected both container logs, got %+v", containerLogs)
+	}
+	test.ExpectString(t, "hello", containerLogs[0].Message)
+	test.ExpectString(t, "failed", containerLogs[1].Message)
+
+	// Job and stage changes are notified
+	notify.mutex.Lock()
+	defer notify.mutex.Unlock()
+	if len(notify.ids) != 4 {
+		t.Errorf("expected 4 notifications, got %d", len(notify.ids))
+	}
+}
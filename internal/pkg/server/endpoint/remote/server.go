@@ -4,13 +4,19 @@ import (
 	"crypto/tls"
 	"go-brunel/internal/pkg/server/notify"
 	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/stream"
 	"go-brunel/internal/pkg/shared/remote"
+	"net"
 	"net/rpc"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 )
 
+// handshakeTimeout bounds the TLS handshake, so clients that connect and send nothing do not hold a connection open
+const handshakeTimeout = 30 * time.Second
+
 func Server(
 	jr store.JobStore,
 	lr store.LogStore,
@@ -19,10 +25,13 @@ func Server(
 	er store.EnvironmentStore,
 	sr store.StageStore,
 	notify notify.Notify,
+	bus *stream.Bus,
+	enrollment *Enrollment,
 	credentials remote.Credentials,
+	revocationList string,
 	listen string,
 ) error {
-	service := &RPC{
+	service := RPC{
 		JobStore:         jr,
 		LogStore:         lr,
 		ContainerStore:   cr,
@@ -30,22 +39,87 @@ func Server(
 		EnvironmentStore: er,
 		StageStore:       sr,
 		Notify:           notify,
-	}
-	err := rpc.Register(service)
-	if err != nil {
-		return errors.Wrap(err, "error registering remote RPC service")
+		Bus:              bus,
 	}
 
-	tlsConfig, err := credentials.ServerConfig()
+	tlsConfig, err := credentials.ServerConfig(revocationList)
 	if err != nil {
 		return err
 	}
 
+	// Runners without a certificate may connect, but can only enroll
+	if enrollment != nil {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
 	log.Info("listening for RPC agent connections on ", listen)
 	l, err := tls.Listen("tcp", listen, tlsConfig)
 	if err != nil {
 		return errors.Wrap(err, "error listening for remote RPC")
 	}
-	go rpc.Accept(l)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				log.Error("error accepting RPC connection: ", err)
+				return
+			}
+			go serve(conn, service, enrollment)
+		}
+	}()
 	return nil
 }
+
+// serve handles a single runner connection. Each connection gets its own RPC service so that
+// calls can be attributed to the runner identified by the client certificate.
+func serve(conn net.Conn, service RPC, enrollment *Enrollment) {
+	defer conn.Close()
+
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		log.Error("rejecting non TLS RPC connection from ", conn.RemoteAddr())
+		return
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		log.Error("error setting RPC handshake deadline: ", err)
+		return
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		log.Warning("rejecting RPC connection from ", conn.RemoteAddr(), ": ", err)
+		return
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		log.Error("error clearing RPC handshake deadline: ", err)
+		return
+	}
+
+	server := rpc.NewServer()
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 && enrollment != nil {
+		if err := server.Register(enrollment); err != nil {
+			log.Error("error registering remote enrollment service: ", err)
+			return
+		}
+		log.Info("runner enrolling from ", conn.RemoteAddr())
+		server.ServeConn(conn)
+		return
+	}
+
+	runner, err := remote.RunnerName(state)
+	if err != nil {
+		log.Warning("rejecting RPC connection from ", conn.RemoteAddr(), ": ", err)
+		return
+	}
+	service.Runner = runner
+
+	if err := server.Register(&service); err != nil {
+		log.Error("error registering remote RPC service: ", err)
+		return
+	}
+
+	log.Info("runner ", runner, " connected from ", conn.RemoteAddr())
+	server.ServeConn(conn)
+	log.Info("runner ", runner, " disconnected")
+}
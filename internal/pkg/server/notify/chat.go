@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var jobStateDescriptions = map[shared.JobState]string{
+	shared.JobStateWaiting:    "is waiting",
+	shared.JobStateProcessing: "is running",
+	shared.JobStateFailed:     "failed",
+	shared.JobStateSuccess:    "succeeded",
+	shared.JobStateCancelled:  "was cancelled",
+	shared.JobStateExpired:    "expired",
+}
+
+// ChatNotify posts a message about the job to a chat incoming webhook, the {"text": ...} payload is understood by
+// Slack, Mattermost and Rocket.Chat
+type ChatNotify struct {
+	URL string
+
+	// ServerName is the external URL of brunel, used to link messages to the job page
+	ServerName string
+
+	JobStore        store.JobStore
+	RepositoryStore store.RepositoryStore
+
+	Client *http.Client
+
+	// Attempts is the number of times a message is sent before giving up, RetryDelay is doubled after each failure
+	Attempts   int
+	RetryDelay time.Duration
+}
+
+func (notify *ChatNotify) Notify(id shared.JobID) error {
+	job, err := notify.JobStore.Get(id)
+	if err != nil {
+		return errors.Wrap(err, "error getting job")
+	}
+
+	repository, err := notify.RepositoryStore.Get(job.RepositoryID)
+	if err != nil {
+		return errors.Wrap(err, "error getting repository")
+	}
+
+	revision := job.Commit.Revision
+	if len(revision) > 8 {
+		revision = revision[:8]
+	}
+
+	body, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{
+		Text: fmt.Sprintf(
+			"%s/%s build of %s (%s) %s: %s/job/%s",
+			repository.Project,
+			repository.Name,
+			job.Commit.Branch,
+			revision,
+			jobStateDescriptions[job.State],
+			strings.TrimSuffix(notify.ServerName, "/"),
+			id,
+		),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error encoding message")
+	}
+
+	return retry(notify.Attempts, notify.RetryDelay, "chat message", func() error {
+		req, err := http.NewRequest(http.MethodPost, notify.URL, bytes.NewReader(body))
+		if err != nil {
+			return errors.Wrap(err, "error building request")
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		response, err := do(notify.Client, req)
+		if err != nil {
+			return errors.Wrap(err, "error posting message")
+		}
+		return response.Body.Close()
+	})
+}
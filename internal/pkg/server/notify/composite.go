@@ -0,0 +1,239 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"go-brunel/internal/pkg/shared/util"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultQueueSize = 100
+
+	// maxTrackedJobs bounds the states kept for unfinished jobs, the oldest are forgotten first
+	maxTrackedJobs = 10000
+
+	// trackedJobTTL is how long the state of a job is kept without a notification, jobs that finish without one,
+	// for example when their runner disappears, would otherwise be tracked forever
+	trackedJobTTL = 24 * time.Hour
+
+	// finishedJobTTL is how long the state of a finished job is kept, so notifications queued before it finished
+	// and routed after are still seen as stage updates rather than delivered again
+	finishedJobTTL = 10 * time.Minute
+)
+
+var jobStateNames = map[string]shared.JobState{
+	"waiting":    shared.JobStateWaiting,
+	"processing": shared.JobStateProcessing,
+	"failed":     shared.JobStateFailed,
+	"success":    shared.JobStateSuccess,
+	"cancelled":  shared.JobStateCancelled,
+	"expired":    shared.JobStateExpired,
+}
+
+// ParseJobState returns the job state with the given name, for example "failed"
+func ParseJobState(name string) (shared.JobState, error) {
+	state, ok := jobStateNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return 0, fmt.Errorf("unknown job state '%s'", name)
+	}
+	return state, nil
+}
+
+// Route sends notifications for matching jobs to a notifier. Empty Repositories, Branches or States match anything.
+type Route struct {
+	// Name identifies the route in logs
+	Name   string
+	Notify Notify
+
+	// Repositories are globs matched against "project/name" and Branches are globs matched against the job branch
+	Repositories []string
+	Branches     []string
+
+	// States are the job states the route is notified of when a job moves into them
+	States []shared.JobState
+
+	// StageUpdates also sends notifications when a stage of the job changes, for notifiers reporting stage statuses
+	StageUpdates bool
+}
+
+func (route *Route) matches(job *store.Job, repository *store.Repository, stageUpdate bool) (bool, error) {
+	if stageUpdate && !route.StageUpdates {
+		return false, nil
+	}
+
+	if len(route.States) > 0 {
+		found := false
+		for _, s := range route.States {
+			found = found || s == job.State
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	if len(route.Repositories) > 0 {
+		matches, err := util.MatchAnyGlob(route.Repositories, []string{repository.Project + "/" + repository.Name})
+		if err != nil || !matches {
+			return false, err
+		}
+	}
+
+	if len(route.Branches) > 0 {
+		matches, err := util.MatchAnyGlob(route.Branches, []string{job.Commit.Branch})
+		if err != nil || !matches {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Composite fans notifications out to several notifiers according to their routes. Notify only queues the job,
+// routing and delivery happen in the background with a queue per route, so a slow notifier never blocks the caller
+// or the other routes. Notifications are dropped and logged when a queue is full.
+type Composite struct {
+	JobStore        store.JobStore
+	RepositoryStore store.RepositoryStore
+	Routes          []Route
+
+	queue  chan shared.JobID
+	routes []chan shared.JobID
+
+	// states holds the last state each job was routed with, notifications without a state change are stage updates
+	states map[shared.JobID]trackedJob
+}
+
+type trackedJob struct {
+	state shared.JobState
+	at    time.Time
+}
+
+// NewComposite creates a composite notifier with queues of queueSize, Start must be called to deliver notifications
+func NewComposite(jobStore store.JobStore, repositoryStore store.RepositoryStore, queueSize int, routes ...Route) *Composite {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	composite := &Composite{
+		JobStore:        jobStore,
+		RepositoryStore: repositoryStore,
+		Routes:          routes,
+		queue:           make(chan shared.JobID, queueSize),
+		states:          map[shared.JobID]trackedJob{},
+	}
+	for range routes {
+		composite.routes = append(composite.routes, make(chan shared.JobID, queueSize))
+	}
+	return composite
+}
+
+// Start delivers queued notifications until the context is done
+func (c *Composite) Start(ctx context.Context) {
+	for i := range c.Routes {
+		go c.deliver(ctx, c.Routes[i], c.routes[i])
+	}
+
+	go func() {
+		ticker := time.NewTicker(finishedJobTTL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				c.evict(now)
+			case id := <-c.queue:
+				if err := c.route(id); err != nil {
+					log.Error("error routing notification for job ", id, ": ", err)
+				}
+			}
+		}
+	}()
+}
+
+func (c *Composite) Notify(id shared.JobID) error {
+	select {
+	case c.queue <- id:
+	default:
+		log.Error("notification queue is full, dropping notification for job ", id)
+	}
+	return nil
+}
+
+func (c *Composite) route(id shared.JobID) error {
+	job, err := c.JobStore.Get(id)
+	if err != nil {
+		return errors.Wrap(err, "error getting job")
+	}
+
+	repository, err := c.RepositoryStore.Get(job.RepositoryID)
+	if err != nil {
+		return errors.Wrap(err, "error getting repository")
+	}
+
+	last, seen := c.states[id]
+	stageUpdate := seen && last.state == job.State
+	c.states[id] = trackedJob{state: job.State, at: time.Now()}
+	if !seen && len(c.states) > maxTrackedJobs {
+		c.evict(time.Now())
+	}
+
+	for i := range c.Routes {
+		matches, err := c.Routes[i].matches(job, repository, stageUpdate)
+		if err != nil {
+			log.Error("error matching notification route ", c.Routes[i].Name, ": ", err)
+			continue
+		}
+		if !matches {
+			continue
+		}
+
+		select {
+		case c.routes[i] <- id:
+		default:
+			log.Error("notification queue for ", c.Routes[i].Name, " is full, dropping notification for job ", id)
+		}
+	}
+	return nil
+}
+
+// evict forgets the jobs not notified within trackedJobTTL, the finished jobs not notified within finishedJobTTL
+// and, if there are still too many, the oldest
+func (c *Composite) evict(now time.Time) {
+	var oldest shared.JobID
+	for id, tracked := range c.states {
+		ttl := trackedJobTTL
+		if tracked.state > shared.JobStateProcessing {
+			ttl = finishedJobTTL
+		}
+
+		if now.Sub(tracked.at) > ttl {
+			delete(c.states, id)
+		} else if oldest == "" || tracked.at.Before(c.states[oldest].at) {
+			oldest = id
+		}
+	}
+	if len(c.states) > maxTrackedJobs {
+		delete(c.states, oldest)
+	}
+}
+
+func (c *Composite) deliver(ctx context.Context, route Route, queue chan shared.JobID) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-queue:
+			if err := route.Notify.Notify(id); err != nil {
+				log.Error("error sending ", route.Name, " notification for job ", id, ": ", err)
+			}
+		}
+	}
+}
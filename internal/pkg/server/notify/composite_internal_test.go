@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"fmt"
+	"go-brunel/internal/pkg/shared"
+	"testing"
+	"time"
+)
+
+func TestComposite_Evict(t *testing.T) {
+	now := time.Now()
+	composite := NewComposite(nil, nil, 0)
+	composite.states["expired"] = trackedJob{state: shared.JobStateProcessing, at: now.Add(-trackedJobTTL - time.Minute)}
+	composite.states["finished"] = trackedJob{state: shared.JobStateSuccess, at: now.Add(-finishedJobTTL - time.Minute)}
+	composite.states["oldest"] = trackedJob{state: shared.JobStateWaiting, at: now.Add(-time.Hour)}
+	for i := 0; i < maxTrackedJobs; i++ {
+		composite.states[shared.JobID(fmt.Sprint(i))] = trackedJob{state: shared.JobStateProcessing, at: now}
+	}
+
+	composite.evict(now)
+
+	if len(composite.states) != maxTrackedJobs {
+		t.Fatalf("expected %d tracked jobs, got %d", maxTrackedJobs, len(composite.states))
+	}
+	if _, ok := composite.states["expired"]; ok {
+		t.Error("expected the expired job to be evicted")
+	}
+	if _, ok := composite.states["finished"]; ok {
+		t.Error("expected the finished job to be evicted")
+	}
+	if _, ok := composite.states["oldest"]; ok {
+		t.Error("expected the oldest job to be evicted")
+	}
+}
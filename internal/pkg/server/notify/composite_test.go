@@ -0,0 +1,103 @@
+package notify_test
+
+import (
+	"context"
+	"go-brunel/internal/pkg/server/notify"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"testing"
+	"time"
+)
+
+type channelNotify struct {
+	ids   chan shared.JobID
+	block chan struct{}
+}
+
+func (n *channelNotify) Notify(id shared.JobID) error {
+	if n.block != nil {
+		<-n.block
+	}
+	n.ids <- id
+	return nil
+}
+
+func receive(t *testing.T, n *channelNotify) shared.JobID {
+	select {
+	case id := <-n.ids:
+		return id
+	case <-time.After(time.Second):
+		t.Fatal("expected a notification")
+		return ""
+	}
+}
+
+func expectNone(t *testing.T, n *channelNotify) {
+	select {
+	case id := <-n.ids:
+		t.Fatalf("unexpected notification for job %s", id)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestComposite_Notify(t *testing.T) {
+	jobs := &jobStore{job: store.Job{
+		ID:           "job",
+		RepositoryID: "repo",
+		Commit:       shared.Commit{Branch: "master", Revision: "abc123"},
+		State:        shared.JobStateProcessing,
+	}}
+	repositories := &repositoryStore{repository: store.Repository{ID: "repo", Project: "group", Name: "project"}}
+
+	all := &channelNotify{ids: make(chan shared.JobID, 10)}
+	failures := &channelNotify{ids: make(chan shared.JobID, 10)}
+	otherRepository := &channelNotify{ids: make(chan shared.JobID, 10)}
+	slow := &channelNotify{ids: make(chan shared.JobID, 10), block: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	composite := notify.NewComposite(
+		jobs,
+		repositories,
+		10,
+		notify.Route{Name: "all", Notify: all, StageUpdates: true},
+		notify.Route{Name: "failures", Notify: failures, States: []shared.JobState{shared.JobStateFailed}, Branches: []string{"master"}},
+		notify.Route{Name: "other", Notify: otherRepository, Repositories: []string{"other/*"}},
+		notify.Route{Name: "slow", Notify: slow},
+	)
+	composite.Start(ctx)
+
+	// A slow notifier must not block the caller or the other routes
+	if err := composite.Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, all)
+	expectNone(t, failures)
+
+	// A notification without a state change is a stage update
+	if err := composite.Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, all)
+
+	jobs.job.State = shared.JobStateFailed
+	if err := composite.Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, all)
+	receive(t, failures)
+	expectNone(t, otherRepository)
+
+	// A notification routed after the job finished, for example for its last stage, is not delivered again
+	if err := composite.Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, all)
+	expectNone(t, failures)
+
+	close(slow.block)
+	receive(t, slow)
+	receive(t, slow)
+	expectNone(t, slow)
+}
@@ -0,0 +1,329 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const defaultEmailLogLines = 20
+
+var emailSubjectTemplate = template.Must(template.New("subject").Parse(
+	`[brunel] {{.Repository.Project}}/{{.Repository.Name}} {{.Job.Commit.Branch}} {{if .Fixed}}fixed{{else}}failed{{end}}`,
+))
+
+var emailTextTemplate = template.Must(template.New("text").Parse(`{{if .Fixed -}}
+The build of {{.Repository.Project}}/{{.Repository.Name}} on {{.Job.Commit.Branch}} has been fixed.
+{{- else -}}
+The build of {{.Repository.Project}}/{{.Repository.Name}} on {{.Job.Commit.Branch}} failed{{if .Stage}} in stage {{.Stage}}{{end}}.
+{{- end}}
+
+Revision: {{.Job.Commit.Revision}}
+Started by: {{.Job.StartedBy}}
+Details: {{.URL}}
+{{if .Logs}}
+Last log lines:
+{{range .Logs}}    {{.}}
+{{end}}{{end}}`))
+
+var emailHTMLTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<html>
+<body>
+{{if .Fixed -}}
+<p>The build of <b>{{.Repository.Project}}/{{.Repository.Name}}</b> on <b>{{.Job.Commit.Branch}}</b> has been fixed.</p>
+{{- else -}}
+<p>The build of <b>{{.Repository.Project}}/{{.Repository.Name}}</b> on <b>{{.Job.Commit.Branch}}</b> failed{{if .Stage}} in stage <b>{{.Stage}}</b>{{end}}.</p>
+{{- end}}
+<table>
+<tr><td>Revision</td><td>{{.Job.Commit.Revision}}</td></tr>
+<tr><td>Started by</td><td>{{.Job.StartedBy}}</td></tr>
+</table>
+<p><a href="{{.URL}}">View the build</a></p>
+{{if .Logs -}}
+<p>Last log lines:</p>
+<pre>{{range .Logs}}{{.}}
+{{end}}</pre>
+{{- end}}
+</body>
+</html>
+`))
+
+type emailData struct {
+	Job        *store.Job
+	Repository *store.Repository
+	URL        string
+	Fixed      bool
+
+	// Stage is the first failed stage and Logs are its last log lines, both are empty for fixed builds
+	Stage shared.StageID
+	Logs  []string
+}
+
+// EmailNotify emails the user that started a job, and the users watching its repository, when the job fails or
+// when it succeeds after the previous job for the branch failed. Users can opt out in their notification preferences.
+// Errors are logged rather than returned, and the retries sleep, so it should be run in the background behind a Composite.
+type EmailNotify struct {
+	// Address of the SMTP server as host:port, Username and Password are optional
+	Address  string
+	Username string
+	Password string
+	From     string
+
+	// ServerName is the external URL of brunel, used to link emails to the job page
+	ServerName string
+
+	// LogLines is the number of log lines of the failed stage included in failure emails
+	LogLines int
+
+	JobStore        store.JobStore
+	RepositoryStore store.RepositoryStore
+	StageStore      store.StageStore
+	ContainerStore  store.ContainerStore
+	LogStore        store.LogStore
+	UserStore       store.UserStore
+
+	// Attempts is the number of times an email is sent before giving up, RetryDelay is doubled after each failure
+	Attempts   int
+	RetryDelay time.Duration
+}
+
+func (notify *EmailNotify) Notify(id shared.JobID) error {
+	if err := notify.notify(id); err != nil {
+		log.Error("error sending build email for job ", id, ": ", err)
+	}
+	return nil
+}
+
+func (notify *EmailNotify) notify(id shared.JobID) error {
+	job, err := notify.JobStore.Get(id)
+	if err != nil {
+		return errors.Wrap(err, "error getting job")
+	}
+	if job.State != shared.JobStateFailed && job.State != shared.JobStateSuccess {
+		return nil
+	}
+
+	fixed := false
+	if job.State == shared.JobStateSuccess {
+		previous, err := notify.JobStore.FindPreviousCompleted(*job)
+		if err == store.ErrorNotFound {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "error getting previous job")
+		}
+		if previous.State != shared.JobStateFailed {
+			return nil
+		}
+		fixed = true
+	}
+
+	repository, err := notify.RepositoryStore.Get(job.RepositoryID)
+	if err != nil {
+		return errors.Wrap(err, "error getting repository")
+	}
+
+	recipients, err := notify.recipients(job, repository)
+	if err != nil || len(recipients) == 0 {
+		return err
+	}
+
+	data := emailData{
+		Job:        job,
+		Repository: repository,
+		URL:        fmt.Sprintf("%s/job/%s", strings.TrimSuffix(notify.ServerName, "/"), id),
+		Fixed:      fixed,
+	}
+	if !fixed {
+		data.Stage, data.Logs, err = notify.failedStageLogs(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	message, err := notify.message(recipients, data)
+	if err != nil {
+		return err
+	}
+
+	return retry(notify.Attempts, notify.RetryDelay, "email", func() error {
+		return notify.send(recipients, message)
+	})
+}
+
+// recipients returns the email addresses of the user that started the job and the repository watchers, leaving
+// out users that never want emails. Jobs started by hooks record the commit author, which is emailed directly when
+// it is an email address of someone without an account.
+func (notify *EmailNotify) recipients(job *store.Job, repository *store.Repository) ([]string, error) {
+	var recipients []string
+	seen := map[string]bool{}
+	add := func(email string) {
+		email = strings.TrimSpace(email)
+		if email != "" && !seen[email] {
+			seen[email] = true
+			recipients = append(recipients, email)
+		}
+	}
+
+	user, err := notify.UserStore.GetByUsername(job.StartedBy)
+	switch {
+	case err == store.ErrorNotFound:
+		if strings.Contains(job.StartedBy, "@") {
+			add(job.StartedBy)
+		}
+	case err != nil:
+		return nil, errors.Wrap(err, "error getting user")
+	case user.Notifications.Email != store.EmailNotificationModeNever:
+		add(user.Email)
+	}
+
+	watchers, err := notify.UserStore.FindWatchers(repository.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting repository watchers")
+	}
+	for _, watcher := range watchers {
+		if watcher.Notifications.Email != store.EmailNotificationModeNever {
+			add(watcher.Email)
+		}
+	}
+	return recipients, nil
+}
+
+// failedStageLogs returns the first failed stage of the job and the last log lines of its steps
+func (notify *EmailNotify) failedStageLogs(id shared.JobID) (shared.StageID, []string, error) {
+	stages, err := notify.StageStore.FindAllByJobID(id)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "error getting stages")
+	}
+
+	stage := shared.EmptyStageID
+	for _, s := range stages {
+		if s.State == shared.StageStateError {
+			stage = s.ID
+			break
+		}
+	}
+	if stage == shared.EmptyStageID {
+		return stage, nil, nil
+	}
+
+	containers, err := notify.ContainerStore.FilterByJobID(id)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "error getting containers")
+	}
+
+	var lines []string
+	for _, c := range containers {
+		if c.Meta.StageID != stage || c.Meta.Service {
+			continue
+		}
+		logs, err := notify.LogStore.FilterContainerLogByContainerIDFromTime(c.ContainerID, time.Time{})
+		if err != nil {
+			return "", nil, errors.Wrap(err, "error getting container logs")
+		}
+		for _, l := range logs {
+			lines = append(lines, strings.TrimRight(l.Message, "\n"))
+		}
+	}
+
+	// Stages without step output, for example ones that failed to start, fall back to the job logs of the stage
+	if len(lines) == 0 {
+		logs, err := notify.LogStore.FilterLogByJobIDFromTime(id, time.Time{})
+		if err != nil {
+			return "", nil, errors.Wrap(err, "error getting job logs")
+		}
+		for _, l := range logs {
+			if l.StageID == stage {
+				lines = append(lines, strings.TrimRight(l.Message, "\n"))
+			}
+		}
+	}
+
+	count := notify.LogLines
+	if count <= 0 {
+		count = defaultEmailLogLines
+	}
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	return stage, lines, nil
+}
+
+func (notify *EmailNotify) message(recipients []string, data emailData) ([]byte, error) {
+	var subject, text, html bytes.Buffer
+	if err := emailSubjectTemplate.Execute(&subject, data); err != nil {
+		return nil, errors.Wrap(err, "error rendering email subject")
+	}
+	if err := emailTextTemplate.Execute(&text, data); err != nil {
+		return nil, errors.Wrap(err, "error rendering text email")
+	}
+	if err := emailHTMLTemplate.Execute(&html, data); err != nil {
+		return nil, errors.Wrap(err, "error rendering html email")
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=UTF-8", text.Bytes()},
+		{"text/html; charset=UTF-8", html.Bytes()},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating email part")
+		}
+		if _, err := w.Write(part.content); err != nil {
+			return nil, errors.Wrap(err, "error writing email part")
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, errors.Wrap(err, "error writing email")
+	}
+
+	to := strings.Join(recipients, ", ")
+	for _, value := range []string{notify.From, to, subject.String()} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("email header '%s' contains a line break", value)
+		}
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", notify.From)
+	fmt.Fprintf(&message, "To: %s\r\n", to)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject.String()))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+func (notify *EmailNotify) send(recipients []string, message []byte) error {
+	var auth smtp.Auth
+	if notify.Username != "" {
+		host, _, err := net.SplitHostPort(notify.Address)
+		if err != nil {
+			return errors.Wrap(err, "invalid smtp address")
+		}
+		auth = smtp.PlainAuth("", notify.Username, notify.Password, host)
+	}
+
+	if err := smtp.SendMail(notify.Address, auth, notify.From, recipients, message); err != nil {
+		return errors.Wrap(err, "error sending email")
+	}
+	log.Info("sent build email to ", strings.Join(recipients, ", "))
+	return nil
+}
@@ -0,0 +1,244 @@
+package notify_test
+
+import (
+	"go-brunel/internal/pkg/server/notify"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+type previousJobStore struct {
+	jobStore
+	previous *store.Job
+}
+
+func (s *previousJobStore) FindPreviousCompleted(job store.Job) (*store.Job, error) {
+	if s.previous == nil {
+		return nil, store.ErrorNotFound
+	}
+	return s.previous, nil
+}
+
+type userStore struct {
+	store.UserStore
+	users    []store.User
+	watchers []store.User
+}
+
+func (s *userStore) GetByUsername(username string) (*store.User, error) {
+	for i := range s.users {
+		if s.users[i].Username == username {
+			return &s.users[i], nil
+		}
+	}
+	return nil, store.ErrorNotFound
+}
+
+func (s *userStore) FindWatchers(repositoryID store.RepositoryID) ([]store.User, error) {
+	return s.watchers, nil
+}
+
+type containerStore struct {
+	store.ContainerStore
+	containers []store.Container
+}
+
+func (s *containerStore) FilterByJobID(jobID shared.JobID) ([]store.Container, error) {
+	return s.containers, nil
+}
+
+type logStore struct {
+	store.LogStore
+	logs map[shared.ContainerID][]store.ContainerLog
+}
+
+func (s *logStore) FilterContainerLogByContainerIDFromTime(id shared.ContainerID, t time.Time) ([]store.ContainerLog, error) {
+	return s.logs[id], nil
+}
+
+func (s *logStore) FilterLogByJobIDFromTime(id shared.JobID, t time.Time) ([]store.Log, error) {
+	return nil, nil
+}
+
+type email struct {
+	recipients []string
+	data       string
+}
+
+// smtpServer accepts SMTP sessions on a local port, sending each received email to the returned channel
+func smtpServer(t *testing.T) (net.Listener, <-chan email) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails := make(chan email, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				text := textproto.NewConn(conn)
+				received := email{}
+				_ = text.PrintfLine("220 localhost")
+				for {
+					line, err := text.ReadLine()
+					if err != nil {
+						return
+					}
+					command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+					switch command {
+					case "RCPT":
+						received.recipients = append(received.recipients, strings.Trim(line[strings.Index(line, ":")+1:], "<>"))
+						_ = text.PrintfLine("250 ok")
+					case "DATA":
+						_ = text.PrintfLine("354 go ahead")
+						data, _ := text.ReadDotBytes()
+						received.data = string(data)
+						emails <- received
+						_ = text.PrintfLine("250 ok")
+					case "QUIT":
+						_ = text.PrintfLine("221 bye")
+						return
+					default:
+						_ = text.PrintfLine("250 ok")
+					}
+				}
+			}()
+		}
+	}()
+	return listener, emails
+}
+
+func newEmailNotify(address string, state shared.JobState, previous *store.Job) *notify.EmailNotify {
+	return &notify.EmailNotify{
+		Address:    address,
+		From:       "brunel@example.com",
+		ServerName: "https://brunel.example.com",
+		LogLines:   2,
+		JobStore: &previousJobStore{
+			jobStore: jobStore{job: store.Job{
+				ID:           "job",
+				RepositoryID: "repo",
+				Commit:       shared.Commit{Branch: "master", Revision: "abc123"},
+				State:        state,
+				StartedBy:    "committer@example.com",
+			}},
+			previous: previous,
+		},
+		RepositoryStore: &repositoryStore{repository: store.Repository{ID: "repo", Project: "group", Name: "project"}},
+		StageStore: &stageStore{stages: []store.Stage{
+			{ID: "test", State: shared.StageStateSuccess},
+			{ID: "build", State: shared.StageStateError},
+		}},
+		ContainerStore: &containerStore{containers: []store.Container{
+			{ContainerID: "service", Meta: shared.ContainerMeta{StageID: "build", Service: true}},
+			{ContainerID: "step", Meta: shared.ContainerMeta{StageID: "build"}},
+		}},
+		LogStore: &logStore{logs: map[shared.ContainerID][]store.ContainerLog{
+			"service": {{Message: "service output"}},
+			"step":    {{Message: "first"}, {Message: "second"}, {Message: "compile error\n"}},
+		}},
+		UserStore: &userStore{watchers: []store.User{
+			{Username: "watcher", Email: "watcher@example.com"},
+			{Username: "quiet", Email: "quiet@example.com", Notifications: store.NotificationPreferences{
+				Email: store.EmailNotificationModeNever,
+			}},
+		}},
+		RetryDelay: time.Millisecond,
+	}
+}
+
+func TestEmailNotify_NotifyFailed(t *testing.T) {
+	listener, emails := smtpServer(t)
+	defer listener.Close()
+	address := listener.Addr().String()
+
+	if err := newEmailNotify(address, shared.JobStateFailed, nil).Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+
+	received := <-emails
+	if strings.Join(received.recipients, ",") != "committer@example.com,watcher@example.com" {
+		t.Errorf("unexpected recipients %v", received.recipients)
+	}
+	for _, expected := range []string{
+		"Subject: [brunel] group/project master failed",
+		"multipart/alternative",
+		"in stage build",
+		"second",
+		"compile error",
+		"https://brunel.example.com/job/job",
+	} {
+		if !strings.Contains(received.data, expected) {
+			t.Errorf("expected email to contain %q, got:\n%s", expected, received.data)
+		}
+	}
+	for _, unexpected := range []string{"first", "service output"} {
+		if strings.Contains(received.data, unexpected) {
+			t.Errorf("expected email not to contain %q", unexpected)
+		}
+	}
+}
+
+func TestEmailNotify_NotifySuccess(t *testing.T) {
+	listener, emails := smtpServer(t)
+	defer listener.Close()
+	address := listener.Addr().String()
+
+	if err := newEmailNotify(address, shared.JobStateSuccess, &store.Job{State: shared.JobStateSuccess}).Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+	if err := newEmailNotify(address, shared.JobStateSuccess, &store.Job{State: shared.JobStateFailed}).Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+
+	received := <-emails
+	if !strings.Contains(received.data, "Subject: [brunel] group/project master fixed") {
+		t.Errorf("expected a fixed email, got:\n%s", received.data)
+	}
+	select {
+	case e := <-emails:
+		t.Errorf("expected no email for a success after a success, got:\n%s", e.data)
+	default:
+	}
+}
+
+func TestEmailNotify_NotifyHeaders(t *testing.T) {
+	listener, emails := smtpServer(t)
+	defer listener.Close()
+	address := listener.Addr().String()
+
+	injected := newEmailNotify(address, shared.JobStateFailed, nil)
+	injected.JobStore.(*previousJobStore).job.Commit.Branch = "master\r\nBcc: attacker@example.com"
+	if err := injected.Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded := newEmailNotify(address, shared.JobStateFailed, nil)
+	encoded.JobStore.(*previousJobStore).job.Commit.Branch = "fünf"
+	if err := encoded.Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The email with the line break in its subject is never sent
+	received := <-emails
+	if strings.Contains(received.data, "attacker") {
+		t.Fatalf("expected the injected header to be rejected, got:\n%s", received.data)
+	}
+	if !strings.Contains(received.data, "Subject: =?utf-8?q?") {
+		t.Errorf("expected an encoded subject, got:\n%s", received.data)
+	}
+	select {
+	case e := <-emails:
+		t.Errorf("expected a single email, got:\n%s", e.data)
+	default:
+	}
+}
@@ -0,0 +1,277 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// gitHubStatusContext is the context of the job status, stage statuses are reported as gitHubStatusContext/<stage>
+	gitHubStatusContext = "brunel"
+
+	gitHubDefaultURL = "https://api.github.com"
+)
+
+// GitHubApp holds the credentials of a GitHub App installation, used instead of a personal access token to
+// authenticate with the statuses API
+type GitHubApp struct {
+	ID             int64
+	InstallationID int64
+	PrivateKey     *rsa.PrivateKey
+
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// GitHubNotify reports the state of jobs, and each of their stages, as GitHub commit statuses. Only the statuses that
+// changed since the last notification of an unfinished job are sent, so large pipelines stay within GitHub's rate
+// limits. Failures to reach GitHub are logged rather than returned, so a GitHub outage never stops job states from
+// being recorded.
+type GitHubNotify struct {
+	// URL is the base URL of the GitHub API, defaulting to https://api.github.com
+	URL string
+
+	// Token is a personal access token with the repo:status scope, it is not used when App is set
+	Token string
+	App   *GitHubApp
+
+	// ServerName is the external URL of brunel, used to link statuses back to the job page
+	ServerName string
+
+	JobStore        store.JobStore
+	RepositoryStore store.RepositoryStore
+	StageStore      store.StageStore
+
+	Client *http.Client
+
+	// Attempts is the number of times a status is sent before giving up, RetryDelay is doubled after each failure
+	Attempts   int
+	RetryDelay time.Duration
+
+	mutex sync.Mutex
+
+	// sent holds the state last sent for each status context of the unfinished jobs
+	sent map[shared.JobID]map[string]string
+}
+
+type gitHubStatus struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url"`
+	Description string `json:"description"`
+	Context     string `json:"context"`
+}
+
+func gitHubJobState(state shared.JobState) (string, string) {
+	switch state {
+	case shared.JobStateProcessing:
+		return "pending", "The build is running"
+	case shared.JobStateSuccess:
+		return "success", "The build succeeded"
+	case shared.JobStateFailed:
+		return "failure", "The build failed"
+	case shared.JobStateCancelled:
+		return "error", "The build was cancelled"
+	case shared.JobStateExpired:
+		return "error", "The build expired while waiting for a runner"
+	default:
+		return "pending", "The build is waiting for a runner"
+	}
+}
+
+func gitHubStageState(state shared.StageState) string {
+	switch state {
+	case shared.StageStateSuccess:
+		return "success"
+	case shared.StageStateError:
+		return "failure"
+	default:
+		return "pending"
+	}
+}
+
+func (notify *GitHubNotify) Notify(id shared.JobID) error {
+	job, err := notify.JobStore.Get(id)
+	if err != nil {
+		log.Error("error getting job ", id, " for github notification: ", err)
+		return nil
+	}
+
+	repository, err := notify.RepositoryStore.Get(job.RepositoryID)
+	if err != nil {
+		log.Error("error getting repository of job ", id, " for github notification: ", err)
+		return nil
+	}
+
+	stages, err := notify.StageStore.FindAllByJobID(id)
+	if err != nil {
+		log.Error("error getting stages of job ", id, " for github notification: ", err)
+		return nil
+	}
+
+	targetURL := fmt.Sprintf("%s/job/%s", strings.TrimSuffix(notify.ServerName, "/"), id)
+	state, description := gitHubJobState(job.State)
+	statuses := []gitHubStatus{
+		{State: state, TargetURL: targetURL, Description: description, Context: gitHubStatusContext},
+	}
+	for _, stage := range stages {
+		statuses = append(statuses, gitHubStatus{
+			State:       gitHubStageState(stage.State),
+			TargetURL:   targetURL,
+			Description: fmt.Sprintf("Stage %s", stage.ID),
+			Context:     fmt.Sprintf("%s/%s", gitHubStatusContext, stage.ID),
+		})
+	}
+
+	apiURL := notify.URL
+	if apiURL == "" {
+		apiURL = gitHubDefaultURL
+	}
+	endpoint := fmt.Sprintf(
+		"%s/repos/%s/%s/statuses/%s",
+		strings.TrimSuffix(apiURL, "/"),
+		repository.Project,
+		repository.Name,
+		job.Commit.Revision,
+	)
+
+	for _, status := range statuses {
+		if notify.unchanged(id, status) {
+			continue
+		}
+
+		status := status
+		err := retry(notify.Attempts, notify.RetryDelay, "github status", func() error {
+			return notify.post(apiURL, endpoint, status)
+		})
+		if err != nil {
+			log.Error("error sending github status ", status.Context, " for job ", id, ": ", err)
+			continue
+		}
+		notify.record(id, status)
+	}
+
+	if job.State > shared.JobStateProcessing {
+		notify.mutex.Lock()
+		delete(notify.sent, id)
+		notify.mutex.Unlock()
+	}
+	return nil
+}
+
+// unchanged reports whether the status was already sent for the job with the same state
+func (notify *GitHubNotify) unchanged(id shared.JobID, status gitHubStatus) bool {
+	notify.mutex.Lock()
+	defer notify.mutex.Unlock()
+
+	state, ok := notify.sent[id][status.Context]
+	return ok && state == status.State
+}
+
+func (notify *GitHubNotify) record(id shared.JobID, status gitHubStatus) {
+	notify.mutex.Lock()
+	defer notify.mutex.Unlock()
+
+	// Jobs that never finish, for example when their runner disappears, are forgotten once too many are tracked, at
+	// worst their statuses are sent again
+	if notify.sent == nil || len(notify.sent) > maxTrackedJobs {
+		notify.sent = map[shared.JobID]map[string]string{}
+	}
+	if notify.sent[id] == nil {
+		notify.sent[id] = map[string]string{}
+	}
+	notify.sent[id][status.Context] = status.State
+}
+
+func (notify *GitHubNotify) post(apiURL string, endpoint string, status gitHubStatus) error {
+	authorization, err := notify.authorization(apiURL)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(status)
+	if err != nil {
+		return errors.Wrap(err, "error encoding status")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "error building request")
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", authorization)
+
+	response, err := do(notify.Client, req)
+	if err != nil {
+		return errors.Wrap(err, "error posting status")
+	}
+	return response.Body.Close()
+}
+
+// authorization returns the authorization header for the statuses API, for GitHub Apps this is an installation
+// token which is cached until shortly before it expires
+func (notify *GitHubNotify) authorization(apiURL string) (string, error) {
+	if notify.App == nil {
+		return "token " + notify.Token, nil
+	}
+
+	app := notify.App
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	if app.token != "" && time.Now().Add(time.Minute).Before(app.expires) {
+		return "token " + app.token, nil
+	}
+
+	now := time.Now()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		IssuedAt:  now.Add(-time.Minute).Unix(),
+		ExpiresAt: now.Add(time.Minute * 9).Unix(),
+		Issuer:    fmt.Sprint(app.ID),
+	}).SignedString(app.PrivateKey)
+	if err != nil {
+		return "", errors.Wrap(err, "error signing github app token")
+	}
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("%s/app/installations/%d/access_tokens", strings.TrimSuffix(apiURL, "/"), app.InstallationID),
+		nil,
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Authorization", "Bearer "+signed)
+
+	response, err := do(notify.Client, req)
+	if err != nil {
+		return "", errors.Wrap(err, "error getting github app installation token")
+	}
+	defer response.Body.Close()
+
+	installation := struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&installation); err != nil {
+		return "", errors.Wrap(err, "error decoding github app installation token")
+	}
+
+	app.token = installation.Token
+	app.expires = installation.ExpiresAt
+	return "token " + app.token, nil
+}
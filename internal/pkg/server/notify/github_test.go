@@ -0,0 +1,177 @@
+package notify_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"go-brunel/internal/pkg/server/notify"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type stageStore struct {
+	store.StageStore
+	stages []store.Stage
+}
+
+func (s *stageStore) FindAllByJobID(jobID shared.JobID) ([]store.Stage, error) {
+	return s.stages, nil
+}
+
+type gitHubStatus struct {
+	State     string `json:"state"`
+	TargetURL string `json:"target_url"`
+	Context   string `json:"context"`
+}
+
+func newGitHubNotify(serverURL string) *notify.GitHubNotify {
+	return &notify.GitHubNotify{
+		URL:        serverURL,
+		Token:      "token",
+		ServerName: "https://brunel.example.com/",
+		JobStore: &jobStore{job: store.Job{
+			ID:           "job",
+			RepositoryID: "repo",
+			Commit:       shared.Commit{Branch: "master", Revision: "abc123"},
+			State:        shared.JobStateFailed,
+		}},
+		RepositoryStore: &repositoryStore{repository: store.Repository{
+			ID:      "repo",
+			Project: "owner",
+			Name:    "project",
+		}},
+		StageStore: &stageStore{stages: []store.Stage{
+			{ID: "test", State: shared.StageStateSuccess},
+			{ID: "build", State: shared.StageStateError},
+		}},
+		RetryDelay: time.Millisecond,
+	}
+}
+
+func TestGitHubNotify_Notify(t *testing.T) {
+	statuses := map[string]gitHubStatus{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/project/statuses/abc123" {
+			t.Errorf("unexpected status path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "token token" {
+			t.Errorf("unexpected authorization %s", r.Header.Get("Authorization"))
+		}
+
+		var status gitHubStatus
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		statuses[status.Context] = status
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	if err := newGitHubNotify(server.URL).Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"brunel":       "failure",
+		"brunel/test":  "success",
+		"brunel/build": "failure",
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("expected %d statuses, got %d", len(expected), len(statuses))
+	}
+	for context, state := range expected {
+		if statuses[context].State != state {
+			t.Errorf("expected %s to be %s, got %s", context, state, statuses[context].State)
+		}
+		if statuses[context].TargetURL != "https://brunel.example.com/job/job" {
+			t.Errorf("unexpected target url %s", statuses[context].TargetURL)
+		}
+	}
+}
+
+func TestGitHubNotify_NotifyApp(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/app/installations/42/access_tokens" {
+			tokenRequests++
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"token":      "installation",
+				"expires_at": time.Now().Add(time.Hour),
+			})
+			return
+		}
+
+		if r.Header.Get("Authorization") != "token installation" {
+			t.Errorf("unexpected authorization %s", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	n := newGitHubNotify(server.URL)
+	n.Token = ""
+	n.App = &notify.GitHubApp{ID: 1, InstallationID: 42, PrivateKey: key}
+
+	for i := 0; i < 2; i++ {
+		if err := n.Notify("job"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if tokenRequests != 1 {
+		t.Errorf("expected the installation token to be cached, got %d token requests", tokenRequests)
+	}
+}
+
+func TestGitHubNotify_NotifyChanges(t *testing.T) {
+	var contexts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status gitHubStatus
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		contexts = append(contexts, status.Context)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	n := newGitHubNotify(server.URL)
+	job := &n.JobStore.(*jobStore).job
+	stages := n.StageStore.(*stageStore)
+	job.State = shared.JobStateProcessing
+	stages.stages[1].State = shared.StageStateRunning
+
+	notifyContexts := func() []string {
+		contexts = nil
+		if err := n.Notify("job"); err != nil {
+			t.Fatal(err)
+		}
+		return contexts
+	}
+
+	if sent := notifyContexts(); len(sent) != 3 {
+		t.Fatalf("expected every status to be sent first, got %v", sent)
+	}
+	if sent := notifyContexts(); len(sent) != 0 {
+		t.Errorf("expected unchanged statuses to not be sent again, got %v", sent)
+	}
+
+	stages.stages[1].State = shared.StageStateError
+	if sent := notifyContexts(); len(sent) != 1 || sent[0] != "brunel/build" {
+		t.Errorf("expected only the changed stage to be sent, got %v", sent)
+	}
+
+	job.State = shared.JobStateFailed
+	if sent := notifyContexts(); len(sent) != 1 || sent[0] != "brunel" {
+		t.Errorf("expected only the job status to be sent, got %v", sent)
+	}
+}
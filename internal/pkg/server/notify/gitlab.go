@@ -1,59 +1,122 @@
 package notify
 
 import (
+	"fmt"
 	"go-brunel/internal/pkg/server/store"
 	"go-brunel/internal/pkg/shared"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
 )
 
 const (
 	gitLabPrivateTokenHeader = "Private-Token"
+
+	// gitLabStatusName is the name the commit status is shown under in GitLab
+	gitLabStatusName = "brunel"
 )
 
+// GitLabNotify reports the state of jobs as GitLab commit statuses. Failures to reach GitLab are logged rather than
+// returned, so a GitLab outage never stops job states from being recorded.
 type GitLabNotify struct {
-	Secret     string
-	URL        string
-	Repository store.JobStore
+	// URL is the base URL of the GitLab API, for example https://gitlab.com/api/v4/
+	URL string
+
+	// Secret is a GitLab access token with the api scope
+	Secret string
+
+	// ServerName is the external URL of brunel, used to link statuses back to the job page
+	ServerName string
+
+	JobStore        store.JobStore
+	RepositoryStore store.RepositoryStore
+
+	Client *http.Client
+
+	// Attempts is the number of times a status is sent before giving up, RetryDelay is doubled after each failure
+	Attempts   int
+	RetryDelay time.Duration
+}
+
+func gitLabState(state shared.JobState) string {
+	switch state {
+	case shared.JobStateProcessing:
+		return "running"
+	case shared.JobStateSuccess:
+		return "success"
+	case shared.JobStateFailed:
+		return "failed"
+	case shared.JobStateCancelled, shared.JobStateExpired:
+		return "canceled"
+	default:
+		return "pending"
+	}
+}
+
+// gitLabRef returns the name GitLab knows the ref of the job by, the short name of branches and tags, and the source
+// branch of merge requests
+func gitLabRef(job *store.Job) string {
+	if job.PullRequest != nil {
+		return job.PullRequest.SourceBranch
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		if strings.HasPrefix(job.Commit.Branch, prefix) {
+			return strings.TrimPrefix(job.Commit.Branch, prefix)
+		}
+	}
+	return job.Commit.Branch
 }
 
 func (notify *GitLabNotify) Notify(id shared.JobID) error {
-	// client := &http.Client{}
-	// stateText := "pending"
-
-	//job, err := notify.Repository.FindAllByJobID(id)
-	//if err != nil {
-	//	return errors.Wrap(err, "error getting job")
-	//}
-	//
-	//switch job.State {
-	//case shared.JobStateProcessing:
-	//	stateText = "running"
-	//case shared.JobStateSuccess:
-	//	stateText = "success"
-	//case shared.JobStateFailed:
-	//	stateText = "failed"
-	//case shared.JobStateCancelled:
-	//	stateText = "canceled"
-	//}
-
-	//form := url.Values{
-	//	"state": {stateText},
-	//}
-	//req, err := http.NewRequest(
-	//	http.MethodPost,
-	//	fmt.Sprintf("%s/projects/%s%%2F%s/statuses/%s", notify.URL, job.Repository.Project, job.Repository.Name, job.Commit.Revision),
-	//	strings.NewReader(form.Encode()),
-	//)
-	//if err != nil {
-	//	return errors.Wrap(err, "error building request")
-	//}
-	//
-	//req.Header.Set(gitLabPrivateTokenHeader, notify.Secret)
-	//
-	//// TODO we could add better error handling here, i.e log the gitlab message if there is an error
-	//response, err := client.Do(req)
-	//if response.StatusCode >= 300 {
-	//	err = errors.New("received non 200 status from gitlab API")
-	//}
-
-	return nil // errors.Wrap(err, "error posting status")
+	job, err := notify.JobStore.Get(id)
+	if err != nil {
+		log.Error("error getting job ", id, " for gitlab notification: ", err)
+		return nil
+	}
+
+	repository, err := notify.RepositoryStore.Get(job.RepositoryID)
+	if err != nil {
+		log.Error("error getting repository of job ", id, " for gitlab notification: ", err)
+		return nil
+	}
+
+	endpoint := fmt.Sprintf(
+		"%s/projects/%s/statuses/%s",
+		strings.TrimSuffix(notify.URL, "/"),
+		url.PathEscape(repository.Project+"/"+repository.Name),
+		job.Commit.Revision,
+	)
+	form := url.Values{
+		"state":      {gitLabState(job.State)},
+		"ref":        {gitLabRef(job)},
+		"name":       {gitLabStatusName},
+		"target_url": {fmt.Sprintf("%s/job/%s", strings.TrimSuffix(notify.ServerName, "/"), id)},
+	}
+
+	err = retry(notify.Attempts, notify.RetryDelay, "gitlab status", func() error {
+		return notify.post(endpoint, form)
+	})
+	if err != nil {
+		log.Error("error sending gitlab status for job ", id, ": ", err)
+	}
+	return nil
+}
+
+func (notify *GitLabNotify) post(endpoint string, form url.Values) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.Wrap(err, "error building request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(gitLabPrivateTokenHeader, notify.Secret)
+
+	response, err := do(notify.Client, req)
+	if err != nil {
+		return errors.Wrap(err, "error posting status")
+	}
+	return response.Body.Close()
 }
@@ -0,0 +1,156 @@
+package notify_test
+
+import (
+	"go-brunel/internal/pkg/server/notify"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type jobStore struct {
+	store.JobStore
+	job store.Job
+}
+
+func (s *jobStore) Get(id shared.JobID) (*store.Job, error) {
+	if id != s.job.ID {
+		return nil, store.ErrorNotFound
+	}
+	return &s.job, nil
+}
+
+type repositoryStore struct {
+	store.RepositoryStore
+	repository store.Repository
+}
+
+func (s *repositoryStore) Get(id store.RepositoryID) (*store.Repository, error) {
+	if id != s.repository.ID {
+		return nil, store.ErrorNotFound
+	}
+	return &s.repository, nil
+}
+
+func newGitLabNotify(serverURL string, state shared.JobState) *notify.GitLabNotify {
+	return &notify.GitLabNotify{
+		URL:        serverURL + "/api/v4/",
+		Secret:     "token",
+		ServerName: "https://brunel.example.com",
+		JobStore: &jobStore{job: store.Job{
+			ID:           "job",
+			RepositoryID: "repo",
+			Commit:       shared.Commit{Branch: "refs/heads/master", Revision: "abc123"},
+			State:        state,
+		}},
+		RepositoryStore: &repositoryStore{repository: store.Repository{
+			ID:      "repo",
+			Project: "group",
+			Name:    "project",
+		}},
+		RetryDelay: time.Millisecond,
+	}
+}
+
+func TestGitLabNotify_Notify(t *testing.T) {
+	var form url.Values
+	var path, token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		token = r.Header.Get("Private-Token")
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		form = r.PostForm
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	states := map[shared.JobState]string{
+		shared.JobStateWaiting:    "pending",
+		shared.JobStateProcessing: "running",
+		shared.JobStateSuccess:    "success",
+		shared.JobStateFailed:     "failed",
+		shared.JobStateCancelled:  "canceled",
+		shared.JobStateExpired:    "canceled",
+	}
+	for state, expected := range states {
+		if err := newGitLabNotify(server.URL, state).Notify("job"); err != nil {
+			t.Fatal(err)
+		}
+
+		if form.Get("state") != expected {
+			t.Errorf("expected state %d to be sent as %s, got %s", state, expected, form.Get("state"))
+		}
+	}
+
+	if path != "/api/v4/projects/group%2Fproject/statuses/abc123" {
+		t.Errorf("unexpected status path %s", path)
+	}
+	if token != "token" {
+		t.Error("expected the private token to be sent")
+	}
+	if form.Get("target_url") != "https://brunel.example.com/job/job" || form.Get("ref") != "master" {
+		t.Errorf("unexpected status form %v", form)
+	}
+}
+
+func TestGitLabNotify_NotifyRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	n := newGitLabNotify(server.URL, shared.JobStateSuccess)
+	n.Attempts = 3
+
+	if err := n.Notify("job"); err != nil {
+		t.Errorf("expected delivery errors to be logged and not returned, got %s", err)
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 attempts, got %d", requests)
+	}
+}
+
+func TestGitLabNotify_NotifyRef(t *testing.T) {
+	var ref string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		ref = r.PostForm.Get("ref")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	suites := []struct {
+		job store.Job
+		ref string
+	}{
+		{job: store.Job{Commit: shared.Commit{Branch: "refs/tags/v1.0"}}, ref: "v1.0"},
+		{
+			job: store.Job{
+				Commit:      shared.Commit{Branch: "refs/merge-requests/7/head"},
+				PullRequest: &shared.PullRequest{Number: 7, SourceBranch: "feature"},
+			},
+			ref: "feature",
+		},
+	}
+	for _, suite := range suites {
+		n := newGitLabNotify(server.URL, shared.JobStateSuccess)
+		job := &n.JobStore.(*jobStore).job
+		job.Commit.Branch = suite.job.Commit.Branch
+		job.PullRequest = suite.job.PullRequest
+		if err := n.Notify("job"); err != nil {
+			t.Fatal(err)
+		}
+		if ref != suite.ref {
+			t.Errorf("expected the status of %s to be sent for ref %s, got %s", suite.job.Commit.Branch, suite.ref, ref)
+		}
+	}
+}
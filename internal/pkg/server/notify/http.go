@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultAttempts   = 3
+	defaultRetryDelay = time.Second
+	requestTimeout    = time.Second * 10
+)
+
+// retry calls send until it succeeds or the attempts run out, doubling the delay after every failure
+func retry(attempts int, delay time.Duration, description string, send func() error) error {
+	if attempts <= 0 {
+		attempts = defaultAttempts
+	}
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil || attempt >= attempts {
+			return err
+		}
+		log.Warning("error sending ", description, ", retrying: ", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// do sends the request, non 2xx responses are returned as errors including the start of the response body
+func do(client *http.Client, req *http.Request) (*http.Response, error) {
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending request")
+	}
+
+	if response.StatusCode >= 300 {
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, fmt.Errorf("received status %d from %s: %s", response.StatusCode, req.URL.Host, strings.TrimSpace(string(body)))
+	}
+	return response, nil
+}
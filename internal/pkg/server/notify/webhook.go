@@ -0,0 +1,232 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	// WebHookSignatureHeader holds the hex HMAC SHA256 of the payload, prefixed with "sha256="
+	WebHookSignatureHeader = "X-Brunel-Signature"
+
+	// WebHookEventHeader names the kind of payload, currently always "job"
+	WebHookEventHeader = "X-Brunel-Event"
+)
+
+// WebHookNotify posts a JSON document describing the job to a URL. When a secret is configured the payload is
+// signed, and every delivery attempt is recorded in the DeliveryStore. As failed deliveries are recorded there they
+// are only logged, and the retries sleep, so it should be run in the background behind a Composite.
+type WebHookNotify struct {
+	URL    string
+	Secret string
+
+	// ServerName is the external URL of brunel, used to link the payload to the job page
+	ServerName string
+
+	JobStore        store.JobStore
+	RepositoryStore store.RepositoryStore
+	StageStore      store.StageStore
+	DeliveryStore   store.NotificationDeliveryStore
+
+	Client *http.Client
+
+	// Attempts is the number of times a payload is sent before giving up, RetryDelay is doubled after each failure
+	Attempts   int
+	RetryDelay time.Duration
+}
+
+// WebHookPayload is the document posted by WebHookNotify
+type WebHookPayload struct {
+	Job        WebHookJob        `json:"job"`
+	Repository WebHookRepository `json:"repository"`
+	Stages     []WebHookStage    `json:"stages"`
+}
+
+type WebHookJob struct {
+	ID          shared.JobID        `json:"id"`
+	URL         string              `json:"url"`
+	State       string              `json:"state"`
+	Branch      string              `json:"branch"`
+	Revision    string              `json:"revision"`
+	StartedBy   string              `json:"startedBy"`
+	StoppedBy   *string             `json:"stoppedBy"`
+	PullRequest *shared.PullRequest `json:"pullRequest"`
+	CreatedAt   time.Time           `json:"createdAt"`
+	StartedAt   *time.Time          `json:"startedAt"`
+	StoppedAt   *time.Time          `json:"stoppedAt"`
+
+	// Duration is the running time of the job in seconds, null until it has stopped
+	Duration *float64 `json:"duration"`
+}
+
+type WebHookRepository struct {
+	Project string `json:"project"`
+	Name    string `json:"name"`
+	URI     string `json:"uri"`
+}
+
+type WebHookStage struct {
+	Name      shared.StageID `json:"name"`
+	State     string         `json:"state"`
+	StartedAt *time.Time     `json:"startedAt"`
+	StoppedAt *time.Time     `json:"stoppedAt"`
+	Duration  *float64       `json:"duration"`
+}
+
+var stageStateNames = map[shared.StageState]string{
+	shared.StageStateRunning: "running",
+	shared.StageStateSuccess: "success",
+	shared.StageStateError:   "error",
+}
+
+func jobStateName(state shared.JobState) string {
+	for name, s := range jobStateNames {
+		if s == state {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func duration(start *time.Time, stop *time.Time) *float64 {
+	if start == nil || stop == nil || start.IsZero() || stop.IsZero() {
+		return nil
+	}
+	seconds := stop.Sub(*start).Seconds()
+	return &seconds
+}
+
+// sign returns the signature header value of the payload
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (notify *WebHookNotify) payload(id shared.JobID) (*WebHookPayload, error) {
+	job, err := notify.JobStore.Get(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting job")
+	}
+
+	repository, err := notify.RepositoryStore.Get(job.RepositoryID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting repository")
+	}
+
+	stages, err := notify.StageStore.FindAllByJobID(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting stages")
+	}
+
+	payload := &WebHookPayload{
+		Job: WebHookJob{
+			ID:          job.ID,
+			URL:         fmt.Sprintf("%s/job/%s", strings.TrimSuffix(notify.ServerName, "/"), id),
+			State:       jobStateName(job.State),
+			Branch:      job.Commit.Branch,
+			Revision:    job.Commit.Revision,
+			StartedBy:   job.StartedBy,
+			StoppedBy:   job.StoppedBy,
+			PullRequest: job.PullRequest,
+			CreatedAt:   job.CreatedAt,
+			StartedAt:   job.StartedAt,
+			StoppedAt:   job.StoppedAt,
+			Duration:    duration(job.StartedAt, job.StoppedAt),
+		},
+		Repository: WebHookRepository{
+			Project: repository.Project,
+			Name:    repository.Name,
+			URI:     repository.URI,
+		},
+		Stages: []WebHookStage{},
+	}
+	for _, stage := range stages {
+		payload.Stages = append(payload.Stages, WebHookStage{
+			Name:      stage.ID,
+			State:     stageStateNames[stage.State],
+			StartedAt: stage.StartedAt,
+			StoppedAt: stage.StoppedAt,
+			Duration:  duration(stage.StartedAt, stage.StoppedAt),
+		})
+	}
+	return payload, nil
+}
+
+func (notify *WebHookNotify) Notify(id shared.JobID) error {
+	payload, err := notify.payload(id)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "error encoding payload")
+	}
+
+	attempt := 0
+	err = retry(notify.Attempts, notify.RetryDelay, "web hook", func() error {
+		attempt++
+		return notify.send(id, attempt, body)
+	})
+	if err != nil {
+		log.Error("giving up delivering web hook for job ", id, " after ", attempt, " attempts: ", err)
+	}
+	return nil
+}
+
+func (notify *WebHookNotify) send(id shared.JobID, attempt int, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, notify.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "error building request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebHookEventHeader, "job")
+	if notify.Secret != "" {
+		req.Header.Set(WebHookSignatureHeader, sign(notify.Secret, body))
+	}
+
+	client := notify.Client
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+
+	delivery := store.NotificationDelivery{
+		JobID:     id,
+		URL:       notify.URL,
+		Attempt:   attempt,
+		CreatedAt: time.Now(),
+	}
+
+	response, err := client.Do(req)
+	delivery.Duration = time.Since(delivery.CreatedAt).Nanoseconds() / int64(time.Millisecond)
+	if err == nil {
+		delivery.StatusCode = response.StatusCode
+		_ = response.Body.Close()
+		if response.StatusCode >= 300 {
+			err = fmt.Errorf("received status %d", response.StatusCode)
+		}
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	if notify.DeliveryStore != nil {
+		if e := notify.DeliveryStore.Add(delivery); e != nil {
+			log.Error("error recording web hook delivery for job ", id, ": ", e)
+		}
+	}
+	return errors.Wrap(err, "error posting web hook")
+}
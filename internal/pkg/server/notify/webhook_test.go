@@ -0,0 +1,130 @@
+package notify_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go-brunel/internal/pkg/server/notify"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type deliveryStore struct {
+	store.NotificationDeliveryStore
+	deliveries []store.NotificationDelivery
+}
+
+func (s *deliveryStore) Add(delivery store.NotificationDelivery) error {
+	s.deliveries = append(s.deliveries, delivery)
+	return nil
+}
+
+func TestWebHookNotify_Notify(t *testing.T) {
+	started := time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC)
+	stopped := started.Add(time.Minute)
+
+	requests := 0
+	var payload notify.WebHookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		if r.Header.Get(notify.WebHookSignatureHeader) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Error("invalid payload signature")
+		}
+
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	deliveries := &deliveryStore{}
+	n := &notify.WebHookNotify{
+		URL:        server.URL,
+		Secret:     "secret",
+		ServerName: "https://brunel.example.com",
+		JobStore: &jobStore{job: store.Job{
+			ID:           "job",
+			RepositoryID: "repo",
+			Commit:       shared.Commit{Branch: "master", Revision: "abc123"},
+			State:        shared.JobStateSuccess,
+			StartedBy:    "user",
+			StartedAt:    &started,
+			StoppedAt:    &stopped,
+		}},
+		RepositoryStore: &repositoryStore{repository: store.Repository{ID: "repo", Project: "group", Name: "project"}},
+		StageStore: &stageStore{stages: []store.Stage{
+			{ID: "build", State: shared.StageStateSuccess, StartedAt: &started, StoppedAt: &stopped},
+		}},
+		DeliveryStore: deliveries,
+		RetryDelay:    time.Millisecond,
+	}
+
+	if err := n.Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Job.State != "success" || payload.Job.StartedBy != "user" || payload.Job.URL != "https://brunel.example.com/job/job" {
+		t.Errorf("unexpected job payload %+v", payload.Job)
+	}
+	if payload.Job.Duration == nil || *payload.Job.Duration != 60 {
+		t.Error("expected the job duration in seconds")
+	}
+	if payload.Repository.Project != "group" || len(payload.Stages) != 1 || payload.Stages[0].State != "success" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+
+	if len(deliveries.deliveries) != 2 {
+		t.Fatalf("expected 2 delivery attempts to be recorded, got %d", len(deliveries.deliveries))
+	}
+	if deliveries.deliveries[0].StatusCode != http.StatusServiceUnavailable || deliveries.deliveries[0].Error == "" {
+		t.Error("expected the failed attempt to be recorded")
+	}
+	if deliveries.deliveries[1].Attempt != 2 || deliveries.deliveries[1].Error != "" {
+		t.Error("expected the successful retry to be recorded")
+	}
+}
+
+func TestWebHookNotify_NotifyFailedDelivery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	deliveries := &deliveryStore{}
+	n := &notify.WebHookNotify{
+		URL:             server.URL,
+		JobStore:        &jobStore{job: store.Job{ID: "job", RepositoryID: "repo"}},
+		RepositoryStore: &repositoryStore{repository: store.Repository{ID: "repo"}},
+		StageStore:      &stageStore{},
+		DeliveryStore:   deliveries,
+		Attempts:        2,
+		RetryDelay:      time.Millisecond,
+	}
+
+	// Failures are recorded as deliveries rather than returned
+	if err := n.Notify("job"); err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries.deliveries) != 2 || deliveries.deliveries[1].Error == "" {
+		t.Errorf("expected both failed attempts to be recorded, got %+v", deliveries.deliveries)
+	}
+}
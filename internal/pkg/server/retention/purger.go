@@ -0,0 +1,121 @@
+package retention
+
+import (
+	"context"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"regexp"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// Purger deletes the stopped jobs of repositories that fall outside their retention settings
+type Purger struct {
+	JobStore        store.JobStore
+	RepositoryStore store.RepositoryStore
+
+	// ContainerStore and LogStore are used to delete container logs kept outside of the database, when the log store
+	// is a store.ContainerLogDeleter
+	ContainerStore store.ContainerStore
+	LogStore       store.LogStore
+}
+
+// Start will purge jobs every interval until the context is done
+func (p *Purger) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := p.Run(now); err != nil {
+					log.Error("error purging jobs: ", err)
+				}
+			}
+		}
+	}()
+}
+
+// Run purges the jobs of every repository, a repository failing to purge does not stop the others
+func (p *Purger) Run(now time.Time) error {
+	repositories, err := p.RepositoryStore.Filter("")
+	if err != nil {
+		return errors.Wrap(err, "error getting repositories")
+	}
+
+	for _, repository := range repositories {
+		if _, err := p.Purge(repository, now); err != nil {
+			log.Error("error purging jobs for ", repository.Project, "/", repository.Name, ": ", err)
+		}
+	}
+	return nil
+}
+
+// Purge deletes the stopped jobs of the repository that are neither among its newest RetainJobs jobs nor created
+// within its last RetainDays days, returning the ids of the deleted jobs. Jobs with a branch matching RetainPattern
+// are always kept, and do not count towards RetainJobs.
+func (p *Purger) Purge(repository store.Repository, now time.Time) ([]shared.JobID, error) {
+	settings := repository.Settings
+	purged := []shared.JobID{}
+	if settings.RetainJobs == 0 && settings.RetainDays == 0 {
+		return purged, nil
+	}
+
+	var retain *regexp.Regexp
+	if settings.RetainPattern != "" {
+		pattern, err := regexp.Compile(settings.RetainPattern)
+		if err != nil {
+			return purged, errors.Wrap(err, "invalid retain pattern")
+		}
+		retain = pattern
+	}
+
+	jobs, err := p.JobStore.FindStoppedByRepositoryID(repository.ID)
+	if err != nil {
+		return purged, errors.Wrap(err, "error getting stopped jobs")
+	}
+
+	deadline := now.AddDate(0, 0, -settings.RetainDays)
+	kept := 0
+	for i := len(jobs) - 1; i >= 0; i-- {
+		job := jobs[i]
+		if retain != nil && retain.MatchString(job.Commit.Branch) {
+			continue
+		}
+
+		if settings.RetainJobs > 0 && kept < settings.RetainJobs {
+			kept++
+			continue
+		}
+		if settings.RetainDays > 0 && !job.CreatedAt.Before(deadline) {
+			continue
+		}
+
+		if err := p.Delete(job.ID); err != nil {
+			return purged, err
+		}
+		log.Info("job with id ", job.ID, " has been purged")
+		purged = append(purged, job.ID)
+	}
+	return purged, nil
+}
+
+// Delete deletes the job, along with the container logs the job store does not delete
+func (p *Purger) Delete(id shared.JobID) error {
+	if deleter, ok := p.LogStore.(store.ContainerLogDeleter); ok && p.ContainerStore != nil {
+		containers, err := p.ContainerStore.FilterByJobID(id)
+		if err != nil {
+			return errors.Wrap(err, "error getting job containers")
+		}
+		for _, c := range containers {
+			if err := deleter.DeleteContainerLog(c.ContainerID); err != nil {
+				return errors.Wrap(err, "error deleting container logs")
+			}
+		}
+	}
+	return errors.Wrap(p.JobStore.Delete(id), "error deleting job")
+}
@@ -0,0 +1,82 @@
+package retention_test
+
+import (
+	"go-brunel/internal/pkg/server/retention"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+	"testing"
+	"time"
+)
+
+type jobStore struct {
+	store.JobStore
+	jobs    []store.Job
+	deleted []shared.JobID
+}
+
+func (s *jobStore) FindStoppedByRepositoryID(repositoryID store.RepositoryID) ([]store.Job, error) {
+	var jobs []store.Job
+	for _, j := range s.jobs {
+		if j.RepositoryID == repositoryID && j.State != shared.JobStateWaiting && j.State != shared.JobStateProcessing {
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+func (s *jobStore) Delete(id shared.JobID) error {
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+func TestPurger_Purge(t *testing.T) {
+	now := time.Date(2019, 1, 10, 10, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time {
+		return now.AddDate(0, 0, -n)
+	}
+
+	jobs := &jobStore{jobs: []store.Job{
+		{ID: "newest", RepositoryID: "r", State: shared.JobStateSuccess, CreatedAt: day(1)},
+		{ID: "recent", RepositoryID: "r", State: shared.JobStateFailed, CreatedAt: day(2)},
+		{ID: "old", RepositoryID: "r", State: shared.JobStateSuccess, CreatedAt: day(5)},
+		{ID: "oldest", RepositoryID: "r", State: shared.JobStateCancelled, CreatedAt: day(9)},
+		{ID: "tagged", RepositoryID: "r", State: shared.JobStateSuccess, CreatedAt: day(8), Commit: shared.Commit{Branch: "refs/tags/v1"}},
+		{ID: "waiting", RepositoryID: "r", State: shared.JobStateWaiting, CreatedAt: day(9)},
+		{ID: "other", RepositoryID: "other", State: shared.JobStateSuccess, CreatedAt: day(9)},
+	}}
+	purger := retention.Purger{JobStore: jobs}
+
+	tests := []struct {
+		name     string
+		settings store.RepositorySettings
+		expected []shared.JobID
+	}{
+		{"unlimited", store.RepositorySettings{}, nil},
+		{"jobs", store.RepositorySettings{RetainJobs: 2}, []shared.JobID{"old", "tagged", "oldest"}},
+		{"days", store.RepositorySettings{RetainDays: 3}, []shared.JobID{"old", "tagged", "oldest"}},
+		{"jobs or days", store.RepositorySettings{RetainJobs: 1, RetainDays: 3}, []shared.JobID{"old", "tagged", "oldest"}},
+		{"pattern", store.RepositorySettings{RetainJobs: 2, RetainPattern: "^refs/tags/"}, []shared.JobID{"old", "oldest"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jobs.deleted = nil
+			purged, err := purger.Purge(store.Repository{ID: "r", Settings: test.settings}, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(purged) != len(test.expected) || len(jobs.deleted) != len(test.expected) {
+				t.Fatalf("expected %v to be purged, got %v", test.expected, purged)
+			}
+			for i, id := range test.expected {
+				if purged[i] != id {
+					t.Errorf("expected %v to be purged, got %v", test.expected, purged)
+				}
+			}
+		})
+	}
+}
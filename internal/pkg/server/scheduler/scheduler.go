@@ -0,0 +1,151 @@
+package scheduler
+
+import (
+	"context"
+	"go-brunel/internal/pkg/server/notify"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"go-brunel/internal/pkg/shared/vcs"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// StartedBy is recorded against jobs that were started by a schedule trigger
+const StartedBy = "schedule"
+
+// Scheduler starts jobs for repositories with schedule triggers
+type Scheduler struct {
+	JobStore        store.JobStore
+	RepositoryStore store.RepositoryStore
+	ScheduleStore   store.ScheduleStore
+	Resolver        vcs.Resolver
+	Notify          notify.Notify
+
+	started time.Time
+}
+
+// Start will check schedule triggers every interval until the context is done
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	s.started = time.Now()
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := s.Run(now); err != nil {
+					log.Error("error running scheduled triggers: ", err)
+				}
+			}
+		}
+	}()
+}
+
+// Run starts a job for every schedule trigger that has been due since its last scheduled job.
+// Any number of missed runs result in a single job, and no job is started while the previous
+// scheduled job for the trigger is still waiting or processing. Every server sharing the database
+// runs the schedules, the server that claims the latest due tick of a trigger starts its job.
+func (s *Scheduler) Run(now time.Time) error {
+	if s.started.IsZero() {
+		s.started = now
+	}
+
+	repositories, err := s.RepositoryStore.Filter("")
+	if err != nil {
+		return errors.Wrap(err, "error getting repositories")
+	}
+
+	for _, repository := range repositories {
+		if repository.DeletedAt != nil {
+			continue
+		}
+
+		for _, trigger := range repository.Triggers {
+			if trigger.Type != store.RepositoryTriggerTypeSchedule {
+				continue
+			}
+
+			if err := s.runTrigger(repository, trigger, now); err != nil {
+				log.Error("error running schedule for ", repository.Project, "/", repository.Name, ": ", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) runTrigger(repository store.Repository, trigger store.RepositoryTrigger, now time.Time) error {
+	schedule, err := trigger.ParseSchedule()
+	if err != nil {
+		return errors.Wrap(err, "invalid schedule")
+	}
+
+	last := s.started
+	latest, err := s.JobStore.FindLatest(repository.ID, trigger.Branch, trigger.EnvironmentID, StartedBy)
+	if err != nil && err != store.ErrorNotFound {
+		return errors.Wrap(err, "error getting latest scheduled job")
+	}
+	if latest != nil {
+		if latest.State == shared.JobStateWaiting || latest.State == shared.JobStateProcessing {
+			return nil
+		}
+		last = latest.CreatedAt
+	}
+
+	tick := schedule.Next(last)
+	if tick.After(now) {
+		return nil
+	}
+	for next := schedule.Next(tick); !next.After(now); next = schedule.Next(tick) {
+		tick = next
+	}
+
+	run := store.ScheduledRun{
+		RepositoryID: repository.ID,
+		Trigger:      trigger.ScheduleKey(),
+		Tick:         tick,
+	}
+	err = s.ScheduleStore.Claim(run)
+	if err == store.ErrorConflict {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "error claiming scheduled run")
+	}
+
+	job, err := s.addJob(repository, trigger, now)
+	if err != nil {
+		// The tick is released so it is tried again, by this or another server, on the next run
+		if e := s.ScheduleStore.Release(run); e != nil {
+			log.Error("error releasing scheduled run: ", e)
+		}
+		return err
+	}
+
+	log.Info("scheduled job ", job.ID, " started for ", repository.Project, "/", repository.Name, " on ", trigger.Branch)
+	return errors.Wrap(s.Notify.Notify(job.ID), "error notifying scheduled job")
+}
+
+func (s *Scheduler) addJob(repository store.Repository, trigger store.RepositoryTrigger, now time.Time) (*store.Job, error) {
+	revision, err := s.Resolver.Resolve(repository.URI, trigger.Branch)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving branch revision")
+	}
+
+	job, err := s.JobStore.Add(store.Job{
+		RepositoryID:  repository.ID,
+		EnvironmentID: trigger.EnvironmentID,
+		Commit: shared.Commit{
+			Branch:   trigger.Branch,
+			Revision: revision,
+		},
+		State:     shared.JobStateWaiting,
+		StartedBy: StartedBy,
+		Priority:  trigger.Priority,
+		CreatedAt: now,
+	})
+	return job, errors.Wrap(err, "error storing scheduled job")
+}
@@ -0,0 +1,177 @@
+package scheduler_test
+
+import (
+	"errors"
+	"go-brunel/internal/pkg/server/scheduler"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/store/memory"
+	"go-brunel/internal/pkg/shared"
+	"go-brunel/test"
+	mockvcs "go-brunel/test/mocks/go-brunel/pkg/shared/vcs"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+type repositoryStore struct {
+	store.RepositoryStore
+	repositories []store.Repository
+}
+
+func (s *repositoryStore) Filter(filter string) ([]store.Repository, error) {
+	return s.repositories, nil
+}
+
+type jobStore struct {
+	store.JobStore
+	jobs []store.Job
+}
+
+func (s *jobStore) Add(job store.Job) (*store.Job, error) {
+	job.ID = shared.JobID("job")
+	s.jobs = append(s.jobs, job)
+	return &job, nil
+}
+
+func (s *jobStore) FindLatest(
+	repositoryID store.RepositoryID,
+	branch string,
+	environmentID *shared.EnvironmentID,
+	startedBy string,
+) (*store.Job, error) {
+	if len(s.jobs) == 0 {
+		return nil, store.ErrorNotFound
+	}
+	return &s.jobs[len(s.jobs)-1], nil
+}
+
+type notifier struct {
+	count int
+}
+
+func (n *notifier) Notify(id shared.JobID) error {
+	n.count++
+	return nil
+}
+
+func newScheduler(t *testing.T, jobs *jobStore, n *notifier) (*scheduler.Scheduler, *mockvcs.MockResolver) {
+	ctrl := gomock.NewController(t)
+	v := mockvcs.NewMockResolver(ctrl)
+	return &scheduler.Scheduler{
+		JobStore: jobs,
+		RepositoryStore: &repositoryStore{repositories: []store.Repository{
+			{
+				ID:  "repo",
+				URI: "https://example.com/repo.git",
+				Triggers: []store.RepositoryTrigger{
+					{Type: store.RepositoryTriggerTypeBranch, Pattern: ".*"},
+					{Type: store.RepositoryTriggerTypeSchedule, Schedule: "0 * * * *", Branch: "master"},
+				},
+			},
+		}},
+		ScheduleStore: &memory.ScheduleStore{Database: memory.NewDatabase()},
+		Resolver:      v,
+		Notify:        n,
+	}, v
+}
+
+func TestScheduler_Run(t *testing.T) {
+	jobs := &jobStore{}
+	n := &notifier{}
+	s, v := newScheduler(t, jobs, n)
+	v.EXPECT().Resolve("https://example.com/repo.git", "master").Return("abc123", nil).Times(1)
+
+	start := time.Date(2019, 1, 1, 10, 30, 0, 0, time.UTC)
+	if err := s.Run(start); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.jobs) != 0 {
+		t.Fatal("expected no job before the schedule is due")
+	}
+
+	if err := s.Run(start.Add(time.Hour * 3)); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.jobs) != 1 {
+		t.Fatalf("expected missed runs to start a single job, got %d", len(jobs.jobs))
+	}
+	test.ExpectString(t, "abc123", jobs.jobs[0].Commit.Revision)
+	test.ExpectString(t, "master", jobs.jobs[0].Commit.Branch)
+	test.ExpectString(t, scheduler.StartedBy, jobs.jobs[0].StartedBy)
+	if n.count != 1 {
+		t.Fatal("expected scheduled job to be notified")
+	}
+}
+
+func TestScheduler_RunSkipsOverlapping(t *testing.T) {
+	jobs := &jobStore{jobs: []store.Job{
+		{
+			State:     shared.JobStateProcessing,
+			StartedBy: scheduler.StartedBy,
+			CreatedAt: time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC),
+		},
+	}}
+	n := &notifier{}
+	s, _ := newScheduler(t, jobs, n)
+
+	if err := s.Run(time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.jobs) != 1 || n.count != 0 {
+		t.Fatal("expected no job while the previous scheduled job is processing")
+	}
+}
+
+func TestScheduler_RunClaimsTicks(t *testing.T) {
+	scheduleStore := &memory.ScheduleStore{Database: memory.NewDatabase()}
+	replicas := make([]*jobStore, 2)
+	n := &notifier{}
+	start := time.Date(2019, 1, 1, 10, 30, 0, 0, time.UTC)
+	for i := range replicas {
+		replicas[i] = &jobStore{}
+		s, v := newScheduler(t, replicas[i], n)
+		s.ScheduleStore = scheduleStore
+		v.EXPECT().Resolve("https://example.com/repo.git", "master").Return("abc123", nil).AnyTimes()
+
+		if err := s.Run(start); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Run(start.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(replicas[0].jobs) != 1 || len(replicas[1].jobs) != 0 || n.count != 1 {
+		t.Fatal("expected a single server to start the job of a tick")
+	}
+}
+
+func TestScheduler_RunReleasesFailedTicks(t *testing.T) {
+	jobs := &jobStore{}
+	n := &notifier{}
+	s, v := newScheduler(t, jobs, n)
+	gomock.InOrder(
+		v.EXPECT().Resolve("https://example.com/repo.git", "master").Return("", errors.New("unreachable")),
+		v.EXPECT().Resolve("https://example.com/repo.git", "master").Return("abc123", nil),
+	)
+
+	start := time.Date(2019, 1, 1, 10, 30, 0, 0, time.UTC)
+	if err := s.Run(start); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Run(start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.jobs) != 0 {
+		t.Fatal("expected no job when the branch could not be resolved")
+	}
+
+	// The tick was released, so the next run tries it again
+	if err := s.Run(start.Add(time.Hour + time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.jobs) != 1 || n.count != 1 {
+		t.Fatalf("expected the failed tick to be started again, got %d jobs", len(jobs.jobs))
+	}
+}
@@ -0,0 +1,190 @@
+package search
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxJobs is the number of newest jobs searched, older jobs are found by narrowing the search with a repository
+	// or a since time
+	MaxJobs = 500
+
+	// MaxMatches is the number of matches that can be paged through, every match is still counted
+	MaxMatches = 1000
+)
+
+// Query selects the logs to search, and the page of matches returned
+type Query struct {
+	Search       store.LogSearch
+	RepositoryID store.RepositoryID
+	Since        time.Time
+
+	PageIndex int64
+	PageSize  int64
+}
+
+// Result is a page of the lines found by a search, newest first, along with the number of lines found
+type Result struct {
+	Count   int
+	Matches []store.LogMatch
+}
+
+// Searcher finds the job and container log lines matching a search, using the log store's indexes when it has any
+// and reading every line otherwise
+type Searcher struct {
+	JobStore        store.JobStore
+	RepositoryStore store.RepositoryStore
+	ContainerStore  store.ContainerStore
+	LogStore        store.LogStore
+}
+
+// jobs returns the newest jobs of the repository, or of every repository, created since the time
+func (s *Searcher) jobs(repositoryID store.RepositoryID, since time.Time) ([]store.Job, error) {
+	repositoryIDs := []store.RepositoryID{repositoryID}
+	if repositoryID == "" {
+		repositories, err := s.RepositoryStore.Filter("")
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting repositories")
+		}
+		repositoryIDs = nil
+		for _, r := range repositories {
+			repositoryIDs = append(repositoryIDs, r.ID)
+		}
+	}
+
+	var jobs []store.Job
+	for _, id := range repositoryIDs {
+		page, err := s.JobStore.FilterByRepositoryID(id, "", 0, MaxJobs, "created_at", -1)
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting repository jobs")
+		}
+		for _, job := range page.Jobs {
+			if !job.CreatedAt.Before(since) {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	if len(jobs) > MaxJobs {
+		jobs = jobs[:MaxJobs]
+	}
+	return jobs, nil
+}
+
+// Search finds the lines of the jobs selected by the query, and of their containers, returning the requested page
+func (s *Searcher) Search(query Query) (Result, error) {
+	result := Result{Matches: []store.LogMatch{}}
+	if query.PageIndex < 0 || query.PageSize <= 0 || (query.PageIndex+1)*query.PageSize > MaxMatches {
+		return result, errors.Errorf("only the first %d matches can be paged through", MaxMatches)
+	}
+
+	jobs, err := s.jobs(query.RepositoryID, query.Since)
+	if err != nil {
+		return result, err
+	}
+
+	search := query.Search
+	search.Limit = int((query.PageIndex + 1) * query.PageSize)
+	search.JobIDs = nil
+	search.ContainerIDs = nil
+	containers := map[shared.ContainerID]store.Container{}
+	for _, job := range jobs {
+		search.JobIDs = append(search.JobIDs, job.ID)
+
+		jobContainers, err := s.ContainerStore.FilterByJobID(job.ID)
+		if err != nil {
+			return result, errors.Wrap(err, "error getting job containers")
+		}
+		for _, c := range jobContainers {
+			c.JobID = job.ID
+			containers[c.ContainerID] = c
+			search.ContainerIDs = append(search.ContainerIDs, c.ContainerID)
+		}
+	}
+	if len(jobs) == 0 {
+		return result, nil
+	}
+
+	var jobMatches []store.LogMatch
+	var jobCount int
+	if searcher, ok := s.LogStore.(store.JobLogSearcher); ok {
+		jobMatches, jobCount, err = searcher.SearchJobLogs(search)
+	} else {
+		jobMatches, jobCount, err = s.scanJobLogs(search)
+	}
+	if err != nil {
+		return result, errors.Wrap(err, "error searching job logs")
+	}
+
+	var containerMatches []store.LogMatch
+	var containerCount int
+	if searcher, ok := s.LogStore.(store.ContainerLogSearcher); ok {
+		containerMatches, containerCount, err = searcher.SearchContainerLogs(search)
+	} else {
+		containerMatches, containerCount, err = s.scanContainerLogs(search)
+	}
+	if err != nil {
+		return result, errors.Wrap(err, "error searching container logs")
+	}
+
+	for i, m := range containerMatches {
+		c := containers[m.ContainerID]
+		containerMatches[i].JobID = c.JobID
+		containerMatches[i].StageID = c.Meta.StageID
+	}
+
+	matches := store.NewestLogMatches(append(jobMatches, containerMatches...), search.Limit)
+	result.Count = jobCount + containerCount
+	if start := int(query.PageIndex * query.PageSize); start < len(matches) {
+		result.Matches = matches[start:]
+	}
+	return result, nil
+}
+
+// scanJobLogs reads every line of the jobs, for log stores without a JobLogSearcher
+func (s *Searcher) scanJobLogs(search store.LogSearch) ([]store.LogMatch, int, error) {
+	var matches []store.LogMatch
+	for _, id := range search.JobIDs {
+		logs, err := s.LogStore.FilterLogByJobIDFromTime(id, time.Time{})
+		if err != nil {
+			return nil, 0, err
+		}
+		for i, l := range logs {
+			if search.Pattern.MatchString(l.Message) {
+				matches = append(matches, store.LogMatch{
+					JobID:   id,
+					StageID: l.StageID,
+					Line:    i + 1,
+					Time:    l.Time,
+					Message: l.Message,
+				})
+			}
+		}
+	}
+	return store.NewestLogMatches(matches, search.Limit), len(matches), nil
+}
+
+// scanContainerLogs reads every line of the containers, for log stores without a ContainerLogSearcher
+func (s *Searcher) scanContainerLogs(search store.LogSearch) ([]store.LogMatch, int, error) {
+	var matches []store.LogMatch
+	for _, id := range search.ContainerIDs {
+		logs, err := s.LogStore.FilterContainerLogByContainerIDFromTime(id, time.Time{})
+		if err != nil {
+			return nil, 0, err
+		}
+		for i, l := range logs {
+			if search.Pattern.MatchString(l.Message) {
+				matches = append(matches, store.LogMatch{ContainerID: id, Line: i + 1, Time: l.Time, Message: l.Message})
+			}
+		}
+	}
+	return store.NewestLogMatches(matches, search.Limit), len(matches), nil
+}
@@ -0,0 +1,123 @@
+package search_test
+
+import (
+	"go-brunel/internal/pkg/server/search"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/store/memory"
+	"go-brunel/internal/pkg/shared"
+	"testing"
+	"time"
+)
+
+func TestNewLogSearch(t *testing.T) {
+	s, err := store.NewLogSearch("Connection refused", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"dial tcp: connection refused":   true,
+		"CONNECTION   REFUSED, retrying": true,
+		"reconnection refused":           false,
+		"connection was refused":         false,
+	}
+	for message, expected := range tests {
+		if s.Pattern.MatchString(message) != expected {
+			t.Errorf("expected %q to match %v", message, expected)
+		}
+	}
+
+	if _, err := store.NewLogSearch("-- ", false); err == nil {
+		t.Errorf("expected a query without words to be rejected")
+	}
+	if _, err := store.NewLogSearch("(", true); err == nil {
+		t.Errorf("expected an invalid regular expression to be rejected")
+	}
+}
+
+func TestSearcher_Search(t *testing.T) {
+	database := memory.NewDatabase()
+	repositoryStore := &memory.RepositoryStore{Database: database}
+	jobStore := &memory.JobStore{Database: database}
+	containerStore := &memory.ContainerStore{Database: database}
+	logStore := &memory.LogStore{Database: database}
+
+	repository, err := repositoryStore.AddOrUpdate(store.Repository{Project: "brunel", Name: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := repositoryStore.AddOrUpdate(store.Repository{Project: "brunel", Name: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Jobs are stamped with the time they are added, so they are added a little apart
+	var jobs []*store.Job
+	for _, repositoryID := range []store.RepositoryID{repository.ID, repository.ID, other.ID} {
+		time.Sleep(5 * time.Millisecond)
+		job, err := jobStore.Add(store.Job{RepositoryID: repositoryID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, job)
+
+		containerID := shared.ContainerID(job.ID + "-container")
+		if err := containerStore.Add(store.Container{
+			JobID:       job.ID,
+			ContainerID: containerID,
+			Meta:        shared.ContainerMeta{StageID: "test"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		for j, message := range []string{"running tests", "--- FAIL: TestFlaky", "done"} {
+			_ = logStore.ContainerLog(store.ContainerLog{
+				ContainerID: containerID,
+				Message:     message,
+				Time:        job.CreatedAt.Add(time.Duration(j) * time.Second),
+			})
+		}
+	}
+	_ = logStore.Log(store.Log{JobID: jobs[0].ID, StageID: "test", Message: "retrying TestFlaky", Time: jobs[0].CreatedAt})
+
+	searcher := &search.Searcher{
+		JobStore:        jobStore,
+		RepositoryStore: repositoryStore,
+		ContainerStore:  containerStore,
+		LogStore:        logStore,
+	}
+	logSearch, err := store.NewLogSearch("testflaky", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := searcher.Search(search.Query{Search: logSearch, PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 4 || len(result.Matches) != 2 {
+		t.Fatalf("expected the first page of 4 matches, got %d of %d", len(result.Matches), result.Count)
+	}
+	newest := result.Matches[0]
+	if newest.JobID != jobs[2].ID || newest.StageID != "test" || newest.ContainerID == "" || newest.Line != 2 {
+		t.Errorf("expected the newest match to link to the second line of the other repository's job, got %+v", newest)
+	}
+
+	result, err = searcher.Search(search.Query{
+		Search:       logSearch,
+		RepositoryID: repository.ID,
+		Since:        jobs[1].CreatedAt,
+		PageIndex:    0,
+		PageSize:     10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 1 || result.Matches[0].JobID != jobs[1].ID {
+		t.Errorf("expected a single match of the repository's jobs since the time, got %+v", result)
+	}
+
+	if _, err := searcher.Search(search.Query{Search: logSearch, PageIndex: search.MaxMatches, PageSize: 1}); err == nil {
+		t.Errorf("expected pages past the maximum number of matches to be rejected")
+	}
+}
@@ -16,7 +16,13 @@ func Middleware(keyMatchFile string, policyFile string, serializer TokenSerializ
 			func(w http.ResponseWriter, r *http.Request) {
 				identity, err := serializer.Decode(r)
 				if err != nil {
-					api.HandleError(w, http.StatusUnauthorized, errors.Wrap(err, "error parsing jwt token"))
+					api.HandleError(w, http.StatusUnauthorized, errors.Wrap(err, "error parsing token"))
+					return
+				}
+
+				// Read only personal tokens can look at everything their user can, but change nothing
+				if identity != nil && identity.ReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+					api.HandleError(w, http.StatusForbidden, errors.New("read only token"))
 					return
 				}
 
@@ -18,4 +18,10 @@ const (
 type Identity struct {
 	Username string
 	Role     UserRole
+
+	// PersonalToken is set when the user authenticated with a personal token rather than by signing in
+	PersonalToken bool
+
+	// ReadOnly identities may only make GET requests
+	ReadOnly bool
 }
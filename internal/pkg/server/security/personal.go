@@ -0,0 +1,52 @@
+package security
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PersonalTokenPrefix starts every personal token, telling them apart from the JWTs issued when signing in
+const PersonalTokenPrefix = "brunel_"
+
+// PersonalTokenAuthenticator returns the identity of the user owning the active personal token with the hash, or nil
+// when there is no such token
+type PersonalTokenAuthenticator func(hash string) (*Identity, error)
+
+// NewPersonalTokenSerializer wraps the serializer so bearer tokens starting with PersonalTokenPrefix are decoded as
+// personal tokens, looked up by their hash, while every other token is decoded by the wrapped serializer
+func NewPersonalTokenSerializer(serializer TokenSerializer, authenticate PersonalTokenAuthenticator) TokenSerializer {
+	return &personalTokenSerializer{
+		TokenSerializer: serializer,
+		authenticate:    authenticate,
+	}
+}
+
+// GeneratePersonalToken creates a new personal token, only its hash from HashSecretToken should be stored
+func GeneratePersonalToken() (string, error) {
+	secret, err := GenerateSecretToken()
+	return PersonalTokenPrefix + secret, err
+}
+
+type personalTokenSerializer struct {
+	TokenSerializer
+	authenticate PersonalTokenAuthenticator
+}
+
+func (p *personalTokenSerializer) Decode(r *http.Request) (*Identity, error) {
+	token := strings.TrimPrefix(r.Header.Get(authHeader), "Bearer ")
+	if !strings.HasPrefix(token, PersonalTokenPrefix) {
+		return p.TokenSerializer.Decode(r)
+	}
+
+	identity, err := p.authenticate(HashSecretToken(token))
+	if err != nil {
+		return nil, errors.Wrap(err, "error authenticating personal token")
+	}
+	if identity == nil {
+		return nil, errors.New("invalid personal token")
+	}
+	identity.PersonalToken = true
+	return identity, nil
+}
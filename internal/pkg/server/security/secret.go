@@ -0,0 +1,30 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	secretTokenBytes = 32
+)
+
+// GenerateSecretToken creates a new random token for handing out to users or runners, the token should only be shown
+// once and only its hash from HashSecretToken should be stored.
+func GenerateSecretToken() (string, error) {
+	b := make([]byte, secretTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "error generating token")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashSecretToken hashes a token from GenerateSecretToken for storage and lookup
+func HashSecretToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
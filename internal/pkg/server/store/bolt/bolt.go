@@ -0,0 +1,154 @@
+package bolt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+// Buckets hold JSON encoded records. Records belonging to a job are keyed by the job id followed by a separator, so
+// they can be found with a prefix scan.
+var (
+	bucketRepository      = []byte("repository")
+	bucketEnvironment     = []byte("environment")
+	bucketUser            = []byte("user")
+	bucketJob             = []byte("job")
+	bucketStage           = []byte("job_stage")
+	bucketContainer       = []byte("job_container")
+	bucketContainerIndex  = []byte("job_container_index")
+	bucketLog             = []byte("job_log")
+	bucketContainerLog    = []byte("job_container_log")
+	bucketEnrollmentToken = []byte("runner_enrollment_token")
+	bucketDelivery        = []byte("notification_delivery")
+	bucketPersonalToken   = []byte("user_personal_token")
+	bucketScheduledRun    = []byte("repository_scheduled_run")
+)
+
+// Open opens the database file at path, creating it and its buckets when they do not exist yet
+func Open(path string) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening bolt database")
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, bucket := range [][]byte{
+			bucketRepository,
+			bucketEnvironment,
+			bucketUser,
+			bucketJob,
+			bucketStage,
+			bucketContainer,
+			bucketContainerIndex,
+			bucketLog,
+			bucketContainerLog,
+			bucketEnrollmentToken,
+			bucketDelivery,
+			bucketPersonalToken,
+			bucketScheduledRun,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "error creating bolt buckets")
+	}
+	return db, nil
+}
+
+// newID returns an identifier formatted like the object ids of the mongo stores. Ids start with the time they were
+// created at, so records keyed by them are iterated in creation order even when their timestamps are equal.
+func newID() string {
+	id := make([]byte, 12)
+	binary.BigEndian.PutUint64(id, uint64(time.Now().UnixNano()))
+	if _, err := rand.Read(id[8:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// childKey is the key of a record belonging to parent
+func childKey(parent string, id []byte) []byte {
+	return append(append([]byte(parent), 0), id...)
+}
+
+// sequenceKey is the key of the next record belonging to parent, in insertion order
+func sequenceKey(b *bbolt.Bucket, parent string) ([]byte, error) {
+	sequence, err := b.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, sequence)
+	return childKey(parent, id), nil
+}
+
+func put(b *bbolt.Bucket, key []byte, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "error encoding record")
+	}
+	return b.Put(key, value)
+}
+
+// get decodes the record at key into v, returning store.ErrorNotFound when there is none
+func get(b *bbolt.Bucket, key []byte, v interface{}) error {
+	value := b.Get(key)
+	if value == nil {
+		return store.ErrorNotFound
+	}
+	return errors.Wrap(json.Unmarshal(value, v), "error decoding record")
+}
+
+// each calls fn with the value of every record whose key starts with prefix, in key order
+func each(b *bbolt.Bucket, prefix []byte, fn func(value []byte) error) error {
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePrefix deletes every record whose key starts with prefix
+func deletePrefix(b *bbolt.Bucket, prefix []byte) error {
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte{}, k...))
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterPattern compiles the regular expression list endpoints filter on, like the mongo $regex filters
+func filterPattern(filter string, caseInsensitive bool) (*regexp.Regexp, error) {
+	if caseInsensitive {
+		filter = "(?i)" + filter
+	}
+	pattern, err := regexp.Compile(filter)
+	return pattern, errors.Wrap(err, "invalid filter")
+}
+
+// timestamp returns the current time at the millisecond precision mongo stores times with, so records read back
+// compare the same way across stores
+func timestamp() time.Time {
+	return time.Now().Truncate(time.Millisecond)
+}
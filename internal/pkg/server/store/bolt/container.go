@@ -0,0 +1,108 @@
+package bolt
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+// ContainerStore keys containers by their job, with an index from the runtime container id to that key
+type ContainerStore struct {
+	DB *bbolt.DB
+}
+
+func (r *ContainerStore) Add(c store.Container) error {
+	c.ID = newID()
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		key := childKey(string(c.JobID), []byte(c.ID))
+		if err := put(tx.Bucket(bucketContainer), key, c); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketContainerIndex).Put([]byte(c.ContainerID), key)
+	})
+	return errors.Wrap(err, "error adding container")
+}
+
+func (r *ContainerStore) update(id shared.ContainerID, fn func(c *store.Container)) error {
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		key := tx.Bucket(bucketContainerIndex).Get([]byte(id))
+		if key == nil {
+			return nil
+		}
+
+		b := tx.Bucket(bucketContainer)
+		var c store.Container
+		if err := get(b, key, &c); err != nil {
+			if err == store.ErrorNotFound {
+				return nil
+			}
+			return err
+		}
+		fn(&c)
+		return put(b, key, c)
+	})
+	return errors.Wrap(err, "error updating container")
+}
+
+func (r *ContainerStore) UpdateStateByContainerID(id shared.ContainerID, state shared.ContainerState) error {
+	return r.update(id, func(c *store.Container) {
+		c.State = state
+	})
+}
+
+func (r *ContainerStore) UpdateStoppedAtByContainerID(id shared.ContainerID, t time.Time) error {
+	return r.update(id, func(c *store.Container) {
+		c.StoppedAt = &t
+	})
+}
+
+func (r *ContainerStore) UpdateStartedAtByContainerID(id shared.ContainerID, t time.Time) error {
+	return r.update(id, func(c *store.Container) {
+		c.StartedAt = &t
+	})
+}
+
+func (r *ContainerStore) GetContainerState(id shared.ContainerID) (*shared.ContainerState, error) {
+	var c store.Container
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		key := tx.Bucket(bucketContainerIndex).Get([]byte(id))
+		if key == nil {
+			return store.ErrorNotFound
+		}
+		return get(tx.Bucket(bucketContainer), key, &c)
+	})
+	if err == store.ErrorNotFound {
+		return nil, errors.New("could not find container")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting container state")
+	}
+	return &c.State, nil
+}
+
+func (r *ContainerStore) FilterByJobID(jobID shared.JobID) ([]store.Container, error) {
+	containers := []store.Container{}
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketContainer), childKey(string(jobID), nil), func(value []byte) error {
+			var c store.Container
+			if err := json.Unmarshal(value, &c); err != nil {
+				return err
+			}
+			containers = append(containers, c)
+			return nil
+		})
+	})
+	if err != nil {
+		return containers, errors.Wrap(err, "error getting containers")
+	}
+
+	sort.SliceStable(containers, func(i, j int) bool {
+		return containers[i].CreatedAt.Before(containers[j].CreatedAt)
+	})
+	return containers, nil
+}
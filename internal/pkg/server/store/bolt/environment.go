@@ -0,0 +1,151 @@
+package bolt
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+type EnvironmentStore struct {
+	DB *bbolt.DB
+}
+
+func (s *EnvironmentStore) Get(id shared.EnvironmentID) (*store.Environment, error) {
+	var environment store.Environment
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		return get(tx.Bucket(bucketEnvironment), []byte(id), &environment)
+	})
+	if err == store.ErrorNotFound {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting environment")
+	}
+	return &environment, nil
+}
+
+func (s *EnvironmentStore) AddOrUpdate(environment store.Environment) (*store.Environment, error) {
+	if environment.Variables == nil {
+		environment.Variables = []store.EnvironmentVariable{}
+	}
+
+	var updated store.Environment
+	var unique = true
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketEnvironment)
+
+		var existing *store.Environment
+		err := each(b, nil, func(value []byte) error {
+			var other store.Environment
+			if err := json.Unmarshal(value, &other); err != nil {
+				return err
+			}
+			if other.Name == environment.Name {
+				existing = &other
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if existing != nil && existing.ID != environment.ID {
+			unique = false
+			return nil
+		}
+
+		now := timestamp()
+		id := environment.ID
+		if id == "" {
+			id = shared.EnvironmentID(newID())
+		}
+		existing = &store.Environment{}
+		if err := get(b, []byte(id), existing); err == store.ErrorNotFound {
+			existing = &store.Environment{ID: id, CreatedAt: now}
+		} else if err != nil {
+			return err
+		}
+
+		existing.Name = environment.Name
+		existing.Variables = environment.Variables
+		existing.UpdatedAt = now
+		updated = *existing
+		return put(b, []byte(existing.ID), existing)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error adding or updating environment")
+	}
+	if !unique {
+		return nil, errors.New("environment name must be unique")
+	}
+	return &updated, nil
+}
+
+func (s *EnvironmentStore) Filter(filter string) ([]store.EnvironmentList, error) {
+	pattern, err := filterPattern(filter, true)
+	if err != nil {
+		return nil, err
+	}
+
+	environments := []store.EnvironmentList{}
+	err = s.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketEnvironment), nil, func(value []byte) error {
+			var environment store.Environment
+			if err := json.Unmarshal(value, &environment); err != nil {
+				return err
+			}
+			if pattern.MatchString(environment.Name) {
+				environments = append(environments, store.EnvironmentList{ID: environment.ID, Name: environment.Name})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching environment list")
+	}
+
+	sort.Slice(environments, func(i, j int) bool {
+		return environments[i].Name < environments[j].Name
+	})
+	return environments, nil
+}
+
+func (s *EnvironmentStore) GetVariable(id shared.EnvironmentID, name string) (*string, error) {
+	env, err := s.Get(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting environment")
+	}
+
+	for _, v := range env.Variables {
+		if v.Name == name {
+			return &v.Value, nil
+		}
+	}
+
+	return nil, errors.New("environment variable not found")
+}
+
+func (s *EnvironmentStore) Delete(id shared.EnvironmentID, hard bool) error {
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketEnvironment)
+		if hard {
+			return b.Delete([]byte(id))
+		}
+
+		var environment store.Environment
+		if err := get(b, []byte(id), &environment); err != nil {
+			if err == store.ErrorNotFound {
+				return nil
+			}
+			return err
+		}
+		now := timestamp()
+		environment.DeletedAt = &now
+		return put(b, []byte(id), environment)
+	})
+	return errors.Wrap(err, "error deleting")
+}
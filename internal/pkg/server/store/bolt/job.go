@@ -0,0 +1,429 @@
+package bolt
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+type JobStore struct {
+	DB *bbolt.DB
+}
+
+func (r *JobStore) find(match func(job *store.Job) bool) ([]store.Job, error) {
+	jobs := []store.Job{}
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketJob), nil, func(value []byte) error {
+			var job store.Job
+			if err := json.Unmarshal(value, &job); err != nil {
+				return err
+			}
+			if match(&job) {
+				jobs = append(jobs, job)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting jobs")
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// findLatest returns the most recently created job matching, or store.ErrorNotFound
+func (r *JobStore) findLatest(match func(job *store.Job) bool) (*store.Job, error) {
+	jobs, err := r.find(match)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, store.ErrorNotFound
+	}
+	return &jobs[len(jobs)-1], nil
+}
+
+func (r *JobStore) update(id shared.JobID, fn func(job *store.Job)) error {
+	return r.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketJob)
+		var job store.Job
+		if err := get(b, []byte(id), &job); err != nil {
+			return err
+		}
+		fn(&job)
+		return put(b, []byte(id), job)
+	})
+}
+
+// Next claims the next job inside a single write transaction, bolt only runs one at a time so two runners can never
+// claim the same job.
+func (r *JobStore) Next(runner string) (*store.Job, error) {
+	var next *store.Job
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		jobs := tx.Bucket(bucketJob)
+		repositories := tx.Bucket(bucketRepository)
+
+		var waiting []store.Job
+		processing := map[store.RepositoryID]int{}
+		err := each(jobs, nil, func(value []byte) error {
+			var job store.Job
+			if err := json.Unmarshal(value, &job); err != nil {
+				return err
+			}
+			switch job.State {
+			case shared.JobStateWaiting:
+				waiting = append(waiting, job)
+			case shared.JobStateProcessing:
+				processing[job.RepositoryID]++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		records := map[store.RepositoryID]*repositoryRecord{}
+		var candidates []store.Job
+		for _, job := range waiting {
+			record, ok := records[job.RepositoryID]
+			if !ok {
+				record = &repositoryRecord{}
+				if err := get(repositories, []byte(job.RepositoryID), record); err != nil && err != store.ErrorNotFound {
+					return err
+				}
+				records[job.RepositoryID] = record
+			}
+
+			limit := record.Settings.MaxConcurrentJobs
+			if limit <= 0 || processing[job.RepositoryID] < limit {
+				candidates = append(candidates, job)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if a.Priority != b.Priority {
+				return a.Priority > b.Priority
+			}
+			dispatchedA, dispatchedB := records[a.RepositoryID].LastDispatchedAt, records[b.RepositoryID].LastDispatchedAt
+			if dispatchedA == nil || dispatchedB == nil {
+				if (dispatchedA == nil) != (dispatchedB == nil) {
+					return dispatchedA == nil
+				}
+			} else if !dispatchedA.Equal(*dispatchedB) {
+				return dispatchedA.Before(*dispatchedB)
+			}
+			return a.CreatedAt.Before(b.CreatedAt)
+		})
+
+		now := timestamp()
+		job := candidates[0]
+		job.State = shared.JobStateProcessing
+		job.StartedAt = &now
+		job.Runner = runner
+		if err := put(jobs, []byte(job.ID), job); err != nil {
+			return err
+		}
+
+		if record := records[job.RepositoryID]; record.ID != "" {
+			record.LastDispatchedAt = &now
+			if err := put(repositories, []byte(record.ID), record); err != nil {
+				return err
+			}
+		}
+		next = &job
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting next available job")
+	}
+	return next, nil
+}
+
+func (r *JobStore) Get(id shared.JobID) (*store.Job, error) {
+	var job store.Job
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return get(tx.Bucket(bucketJob), []byte(id), &job)
+	})
+	if err == store.ErrorNotFound {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting job")
+	}
+	return &job, nil
+}
+
+func (r *JobStore) Add(j store.Job) (*store.Job, error) {
+	j.ID = shared.JobID(newID())
+	j.CreatedAt = timestamp()
+
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		return put(tx.Bucket(bucketJob), []byte(j.ID), j)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error adding job")
+	}
+	return &j, nil
+}
+
+func (r *JobStore) UpdateStoppedAtByID(id shared.JobID, t time.Time) error {
+	err := r.update(id, func(job *store.Job) {
+		job.StoppedAt = &t
+	})
+	if err == store.ErrorNotFound {
+		return nil
+	}
+	return errors.Wrap(err, "error setting job state")
+}
+
+func (r *JobStore) UpdateStateByID(id shared.JobID, s shared.JobState) error {
+	err := r.update(id, func(job *store.Job) {
+		job.State = s
+	})
+	if err == store.ErrorNotFound {
+		return nil
+	}
+	return errors.Wrap(err, "error setting job state")
+}
+
+func (r *JobStore) CancelByID(id shared.JobID, userID string) error {
+	err := r.update(id, func(job *store.Job) {
+		job.State = shared.JobStateCancelled
+		job.StoppedBy = &userID
+	})
+	if err == store.ErrorNotFound {
+		return nil
+	}
+	return errors.Wrap(err, "error setting job state")
+}
+
+func sameEnvironment(a *shared.EnvironmentID, b *shared.EnvironmentID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func (r *JobStore) FindLatest(
+	repositoryID store.RepositoryID,
+	branch string,
+	environmentID *shared.EnvironmentID,
+	startedBy string,
+) (*store.Job, error) {
+	return r.findLatest(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID &&
+			job.Commit.Branch == branch &&
+			sameEnvironment(job.EnvironmentID, environmentID) &&
+			job.StartedBy == startedBy
+	})
+}
+
+func (r *JobStore) FindPreviousCompleted(previous store.Job) (*store.Job, error) {
+	return r.findLatest(func(job *store.Job) bool {
+		return job.RepositoryID == previous.RepositoryID &&
+			job.Commit.Branch == previous.Commit.Branch &&
+			sameEnvironment(job.EnvironmentID, previous.EnvironmentID) &&
+			job.CreatedAt.Before(previous.CreatedAt) &&
+			(job.State == shared.JobStateSuccess || job.State == shared.JobStateFailed)
+	})
+}
+
+func isActive(job *store.Job) bool {
+	return job.State == shared.JobStateWaiting || job.State == shared.JobStateProcessing
+}
+
+func (r *JobStore) FindActiveByBranch(repositoryID store.RepositoryID, branch string) ([]store.Job, error) {
+	return r.find(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID && job.Commit.Branch == branch && isActive(job)
+	})
+}
+
+func (r *JobStore) FindActiveByPullRequest(repositoryID store.RepositoryID, number int64) ([]store.Job, error) {
+	return r.find(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID &&
+			job.PullRequest != nil &&
+			job.PullRequest.Number == number &&
+			isActive(job)
+	})
+}
+
+func (r *JobStore) FindProcessingStartedBefore(repositoryID store.RepositoryID, t time.Time) ([]store.Job, error) {
+	return r.find(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID &&
+			job.State == shared.JobStateProcessing &&
+			job.StartedAt != nil &&
+			job.StartedAt.Before(t)
+	})
+}
+
+func (r *JobStore) ExpireWaitingCreatedBefore(
+	repositoryID store.RepositoryID,
+	t time.Time,
+	stoppedBy string,
+) ([]shared.JobID, error) {
+	expired := []shared.JobID{}
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketJob)
+
+		var jobs []store.Job
+		err := each(b, nil, func(value []byte) error {
+			var job store.Job
+			if err := json.Unmarshal(value, &job); err != nil {
+				return err
+			}
+			if job.RepositoryID == repositoryID && job.State == shared.JobStateWaiting && job.CreatedAt.Before(t) {
+				jobs = append(jobs, job)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		now := timestamp()
+		for _, job := range jobs {
+			job.State = shared.JobStateExpired
+			job.StoppedAt = &now
+			job.StoppedBy = &stoppedBy
+			if err := put(b, []byte(job.ID), job); err != nil {
+				return err
+			}
+			expired = append(expired, job.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error expiring jobs")
+	}
+	return expired, nil
+}
+
+func (r *JobStore) FindStoppedByRepositoryID(repositoryID store.RepositoryID) ([]store.Job, error) {
+	return r.find(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID &&
+			job.State != shared.JobStateWaiting &&
+			job.State != shared.JobStateProcessing
+	})
+}
+
+func (r *JobStore) FilterByRepositoryID(
+	repositoryID store.RepositoryID,
+	filter string,
+	pageIndex int64,
+	pageSize int64,
+	sortColumn string,
+	sortOrder int,
+) (store.JobListPage, error) {
+	page := store.JobListPage{}
+	page.Jobs = []store.Job{}
+
+	pattern, err := filterPattern(filter, false)
+	if err != nil {
+		return page, err
+	}
+
+	jobs, err := r.find(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID &&
+			(pattern.MatchString(job.Commit.Branch) ||
+				pattern.MatchString(job.Commit.Revision) ||
+				pattern.MatchString(job.StartedBy))
+	})
+	if err != nil {
+		return page, errors.Wrap(err, "error fetching jobs")
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		a, b := jobs[i], jobs[j]
+		if sortOrder < 0 {
+			a, b = b, a
+		}
+		if sortColumn == "state" && a.State != b.State {
+			return a.State < b.State
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+
+	page.Count = int64(len(jobs))
+	start := pageIndex * pageSize
+	if start < 0 || start >= page.Count {
+		return page, nil
+	}
+	end := start + pageSize
+	if end > page.Count {
+		end = page.Count
+	}
+	page.Jobs = jobs[start:end]
+	return page, nil
+}
+
+// Delete removes the job and everything belonging to it in a single transaction
+func (r *JobStore) Delete(id shared.JobID) error {
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		prefix := childKey(string(id), nil)
+
+		var containers []store.Container
+		err := each(tx.Bucket(bucketContainer), prefix, func(value []byte) error {
+			var c store.Container
+			if err := json.Unmarshal(value, &c); err != nil {
+				return err
+			}
+			containers = append(containers, c)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, c := range containers {
+			if err := deletePrefix(tx.Bucket(bucketContainerLog), childKey(string(c.ContainerID), nil)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(bucketContainerIndex).Delete([]byte(c.ContainerID)); err != nil {
+				return err
+			}
+		}
+
+		for _, bucket := range [][]byte{bucketLog, bucketContainer, bucketStage} {
+			if err := deletePrefix(tx.Bucket(bucket), prefix); err != nil {
+				return err
+			}
+		}
+
+		var deliveries [][]byte
+		err = each(tx.Bucket(bucketDelivery), nil, func(value []byte) error {
+			var delivery store.NotificationDelivery
+			if err := json.Unmarshal(value, &delivery); err != nil {
+				return err
+			}
+			if delivery.JobID == id {
+				deliveries = append(deliveries, []byte(delivery.ID))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range deliveries {
+			if err := tx.Bucket(bucketDelivery).Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(bucketJob).Delete([]byte(id))
+	})
+	return errors.Wrap(err, "error deleting")
+}
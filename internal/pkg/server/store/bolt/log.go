@@ -0,0 +1,88 @@
+package bolt
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+// LogStore keys log lines by their job or container followed by a sequence number, so they are read back in the
+// order they were written
+type LogStore struct {
+	DB *bbolt.DB
+}
+
+func (r *LogStore) append(bucket []byte, parent string, v interface{}) error {
+	return r.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucket)
+		key, err := sequenceKey(b, parent)
+		if err != nil {
+			return err
+		}
+		return put(b, key, v)
+	})
+}
+
+func (r *LogStore) Log(l store.Log) error {
+	return errors.Wrap(r.append(bucketLog, string(l.JobID), l), "error logging job message")
+}
+
+func (r *LogStore) ContainerLog(l store.ContainerLog) error {
+	return errors.Wrap(r.append(bucketContainerLog, string(l.ContainerID), l), "error logging job message")
+}
+
+func (r *LogStore) FilterLogByJobIDFromTime(id shared.JobID, t time.Time) ([]store.Log, error) {
+	logs := []store.Log{}
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketLog), childKey(string(id), nil), func(value []byte) error {
+			var l store.Log
+			if err := json.Unmarshal(value, &l); err != nil {
+				return err
+			}
+			if !l.Time.Before(t) {
+				logs = append(logs, l)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return logs, errors.Wrap(err, "error getting logs")
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].Time.Before(logs[j].Time)
+	})
+	return logs, nil
+}
+
+func (r *LogStore) FilterContainerLogByContainerIDFromTime(
+	id shared.ContainerID,
+	t time.Time,
+) ([]store.ContainerLog, error) {
+	logs := []store.ContainerLog{}
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketContainerLog), childKey(string(id), nil), func(value []byte) error {
+			var l store.ContainerLog
+			if err := json.Unmarshal(value, &l); err != nil {
+				return err
+			}
+			if !l.Time.Before(t) {
+				logs = append(logs, l)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return logs, errors.Wrap(err, "error getting container logs")
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].Time.Before(logs[j].Time)
+	})
+	return logs, nil
+}
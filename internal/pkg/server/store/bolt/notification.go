@@ -0,0 +1,60 @@
+package bolt
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+type NotificationDeliveryStore struct {
+	DB *bbolt.DB
+}
+
+func (r *NotificationDeliveryStore) Add(delivery store.NotificationDelivery) error {
+	delivery.ID = store.NotificationDeliveryID(newID())
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		return put(tx.Bucket(bucketDelivery), []byte(delivery.ID), delivery)
+	})
+	return errors.Wrap(err, "error adding notification delivery")
+}
+
+func (r *NotificationDeliveryStore) Filter(
+	jobID shared.JobID,
+	pageIndex int64,
+	pageSize int64,
+) ([]store.NotificationDelivery, error) {
+	deliveries := []store.NotificationDelivery{}
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketDelivery), nil, func(value []byte) error {
+			var delivery store.NotificationDelivery
+			if err := json.Unmarshal(value, &delivery); err != nil {
+				return err
+			}
+			if jobID == "" || delivery.JobID == jobID {
+				deliveries = append(deliveries, delivery)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching notification deliveries")
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+
+	start := pageIndex * pageSize
+	if start < 0 || start >= int64(len(deliveries)) {
+		return []store.NotificationDelivery{}, nil
+	}
+	end := start + pageSize
+	if end > int64(len(deliveries)) {
+		end = int64(len(deliveries))
+	}
+	return deliveries[start:end], nil
+}
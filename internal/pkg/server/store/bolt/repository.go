@@ -0,0 +1,173 @@
+package bolt
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+// repositoryRecord is a stored repository, along with when it last had a job claimed so the queue can take turns
+// between repositories
+type repositoryRecord struct {
+	store.Repository
+	LastDispatchedAt *time.Time
+}
+
+type RepositoryStore struct {
+	DB *bbolt.DB
+}
+
+func (r *RepositoryStore) update(id store.RepositoryID, fn func(repository *repositoryRecord)) error {
+	return r.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketRepository)
+		var record repositoryRecord
+		if err := get(b, []byte(id), &record); err != nil {
+			return err
+		}
+		fn(&record)
+		return put(b, []byte(id), record)
+	})
+}
+
+func (r *RepositoryStore) AddOrUpdate(repository store.Repository) (*store.Repository, error) {
+	var updated store.Repository
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketRepository)
+
+		var record *repositoryRecord
+		err := each(b, nil, func(value []byte) error {
+			var existing repositoryRecord
+			if err := json.Unmarshal(value, &existing); err != nil {
+				return err
+			}
+			if existing.Project == repository.Project && existing.Name == repository.Name {
+				record = &existing
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		now := timestamp()
+		if record == nil {
+			record = &repositoryRecord{Repository: store.Repository{
+				ID:        store.RepositoryID(newID()),
+				Project:   repository.Project,
+				Name:      repository.Name,
+				Triggers:  []store.RepositoryTrigger{},
+				CreatedAt: now,
+			}}
+		}
+
+		// Repositories are updated when hooks are received, which do not carry triggers, so they are only replaced
+		// when new ones are given
+		if len(repository.Triggers) > 0 {
+			record.Triggers = repository.Triggers
+		}
+		record.URI = repository.URI
+		record.UpdatedAt = now
+		record.DeletedAt = repository.DeletedAt
+
+		updated = record.Repository
+		return put(b, []byte(record.ID), record)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error adding or updating repository")
+	}
+	return &updated, nil
+}
+
+func (r *RepositoryStore) SetTriggers(id store.RepositoryID, triggers []store.RepositoryTrigger) error {
+	if triggers == nil {
+		triggers = []store.RepositoryTrigger{}
+	}
+
+	err := r.update(id, func(repository *repositoryRecord) {
+		repository.Triggers = triggers
+		repository.UpdatedAt = timestamp()
+	})
+	if err == store.ErrorNotFound {
+		return nil
+	}
+	return errors.Wrap(err, "error adding or updating repository")
+}
+
+func (r *RepositoryStore) SetSettings(id store.RepositoryID, settings store.RepositorySettings) error {
+	err := r.update(id, func(repository *repositoryRecord) {
+		repository.Settings = settings
+		repository.UpdatedAt = timestamp()
+	})
+	if err == store.ErrorNotFound {
+		return err
+	}
+	return errors.Wrap(err, "error setting repository settings")
+}
+
+func (r *RepositoryStore) Get(id store.RepositoryID) (*store.Repository, error) {
+	var record repositoryRecord
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return get(tx.Bucket(bucketRepository), []byte(id), &record)
+	})
+	if err == store.ErrorNotFound {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting repository")
+	}
+	return &record.Repository, nil
+}
+
+func (r *RepositoryStore) Filter(filter string) ([]store.Repository, error) {
+	pattern, err := filterPattern(filter, true)
+	if err != nil {
+		return nil, err
+	}
+
+	repositories := []store.Repository{}
+	err = r.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketRepository), nil, func(value []byte) error {
+			var record repositoryRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			if pattern.MatchString(record.Name) || pattern.MatchString(record.Project) {
+				repositories = append(repositories, record.Repository)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching repository list")
+	}
+
+	sort.Slice(repositories, func(i, j int) bool {
+		if repositories[i].Project != repositories[j].Project {
+			return repositories[i].Project < repositories[j].Project
+		}
+		return repositories[i].Name < repositories[j].Name
+	})
+	return repositories, nil
+}
+
+func (r *RepositoryStore) Delete(id store.RepositoryID, hard bool) error {
+	if hard {
+		err := r.DB.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(bucketRepository).Delete([]byte(id))
+		})
+		return errors.Wrap(err, "error deleting")
+	}
+
+	err := r.update(id, func(repository *repositoryRecord) {
+		now := timestamp()
+		repository.DeletedAt = &now
+	})
+	if err == store.ErrorNotFound {
+		return nil
+	}
+	return errors.Wrap(err, "error soft deleting")
+}
@@ -0,0 +1,130 @@
+package bolt
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+type EnrollmentTokenStore struct {
+	DB *bbolt.DB
+}
+
+// enrollmentTokenRecord stores the token hash, which store.EnrollmentToken leaves out of its JSON
+type enrollmentTokenRecord struct {
+	store.EnrollmentToken
+	Hash string
+}
+
+func putEnrollmentToken(b *bbolt.Bucket, token store.EnrollmentToken) error {
+	return put(b, []byte(token.ID), enrollmentTokenRecord{token, token.Hash})
+}
+
+func decodeEnrollmentToken(value []byte) (store.EnrollmentToken, error) {
+	var record enrollmentTokenRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return store.EnrollmentToken{}, err
+	}
+	record.EnrollmentToken.Hash = record.Hash
+	return record.EnrollmentToken, nil
+}
+
+func (r *EnrollmentTokenStore) Add(token store.EnrollmentToken) (*store.EnrollmentToken, error) {
+	token.ID = store.EnrollmentTokenID(newID())
+	token.CreatedAt = timestamp()
+
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		return putEnrollmentToken(tx.Bucket(bucketEnrollmentToken), token)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error adding enrollment token")
+	}
+	return &token, nil
+}
+
+func (r *EnrollmentTokenStore) Filter() ([]store.EnrollmentToken, error) {
+	tokens := []store.EnrollmentToken{}
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketEnrollmentToken), nil, func(value []byte) error {
+			token, err := decodeEnrollmentToken(value)
+			if err != nil {
+				return err
+			}
+			tokens = append(tokens, token)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching enrollment tokens")
+	}
+
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (r *EnrollmentTokenStore) Consume(hash string) (*store.EnrollmentToken, error) {
+	var consumed *store.EnrollmentToken
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketEnrollmentToken)
+		now := timestamp()
+		err := each(b, nil, func(value []byte) error {
+			token, err := decodeEnrollmentToken(value)
+			if err != nil {
+				return err
+			}
+			if token.Hash == hash && token.UsedAt == nil && token.RevokedAt == nil && token.ExpiresAt.After(now) {
+				consumed = &token
+			}
+			return nil
+		})
+		if err != nil || consumed == nil {
+			return err
+		}
+
+		consumed.UsedAt = &now
+		return putEnrollmentToken(b, *consumed)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error consuming enrollment token")
+	}
+	if consumed == nil {
+		return nil, store.ErrorNotFound
+	}
+	return consumed, nil
+}
+
+func (r *EnrollmentTokenStore) Revoke(id store.EnrollmentTokenID) error {
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(bucketEnrollmentToken).Get([]byte(id))
+		if value == nil {
+			return store.ErrorNotFound
+		}
+		token, err := decodeEnrollmentToken(value)
+		if err != nil {
+			return err
+		}
+		if token.RevokedAt != nil {
+			return store.ErrorNotFound
+		}
+
+		now := timestamp()
+		token.RevokedAt = &now
+		return putEnrollmentToken(tx.Bucket(bucketEnrollmentToken), token)
+	})
+	if err == store.ErrorNotFound {
+		return err
+	}
+	return errors.Wrap(err, "error revoking enrollment token")
+}
+
+func (r *EnrollmentTokenStore) Delete(id store.EnrollmentTokenID) error {
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketEnrollmentToken).Delete([]byte(id))
+	})
+	return errors.Wrap(err, "error deleting")
+}
@@ -0,0 +1,49 @@
+package bolt
+
+import (
+	"go-brunel/internal/pkg/server/store"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+type ScheduleStore struct {
+	DB *bbolt.DB
+}
+
+func (r *ScheduleStore) Claim(run store.ScheduledRun) error {
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketScheduledRun)
+
+		var last store.ScheduledRun
+		err := get(b, []byte(run.ID()), &last)
+		if err != nil && err != store.ErrorNotFound {
+			return err
+		}
+		if err == nil && !run.Tick.After(last.Tick) {
+			return store.ErrorConflict
+		}
+		return put(b, []byte(run.ID()), run)
+	})
+	if err == store.ErrorConflict {
+		return err
+	}
+	return errors.Wrap(err, "error claiming scheduled run")
+}
+
+func (r *ScheduleStore) Release(run store.ScheduledRun) error {
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketScheduledRun)
+
+		var last store.ScheduledRun
+		err := get(b, []byte(run.ID()), &last)
+		if err == store.ErrorNotFound || (err == nil && !last.Tick.Equal(run.Tick)) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return b.Delete([]byte(run.ID()))
+	})
+	return errors.Wrap(err, "error releasing scheduled run")
+}
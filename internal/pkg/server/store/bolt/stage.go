@@ -0,0 +1,61 @@
+package bolt
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+type StageStore struct {
+	DB *bbolt.DB
+}
+
+func (r *StageStore) AddOrUpdate(stage store.Stage) error {
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketStage)
+		key := childKey(string(stage.JobID), []byte(stage.ID))
+
+		var existing store.Stage
+		if err := get(b, key, &existing); err != nil && err != store.ErrorNotFound {
+			return err
+		}
+		if stage.StartedAt == nil {
+			stage.StartedAt = existing.StartedAt
+		}
+		if stage.StoppedAt == nil {
+			stage.StoppedAt = existing.StoppedAt
+		}
+		return put(b, key, stage)
+	})
+	return errors.Wrap(err, "error adding or updating stage")
+}
+
+func (r *StageStore) FindAllByJobID(jobID shared.JobID) ([]store.Stage, error) {
+	stages := []store.Stage{}
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketStage), childKey(string(jobID), nil), func(value []byte) error {
+			var stage store.Stage
+			if err := json.Unmarshal(value, &stage); err != nil {
+				return err
+			}
+			stages = append(stages, stage)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching stage list")
+	}
+
+	sort.SliceStable(stages, func(i, j int) bool {
+		a, b := stages[i].StartedAt, stages[j].StartedAt
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return a.Before(*b)
+	})
+	return stages, nil
+}
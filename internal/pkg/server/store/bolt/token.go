@@ -0,0 +1,131 @@
+package bolt
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+type TokenStore struct {
+	DB *bbolt.DB
+}
+
+// personalTokenRecord stores the token hash, which store.PersonalToken leaves out of its JSON
+type personalTokenRecord struct {
+	store.PersonalToken
+	Hash string
+}
+
+func putPersonalToken(b *bbolt.Bucket, token store.PersonalToken) error {
+	return put(b, []byte(token.ID), personalTokenRecord{token, token.Hash})
+}
+
+func decodePersonalToken(value []byte) (store.PersonalToken, error) {
+	var record personalTokenRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return store.PersonalToken{}, err
+	}
+	record.PersonalToken.Hash = record.Hash
+	return record.PersonalToken, nil
+}
+
+func (r *TokenStore) Add(token store.PersonalToken) (*store.PersonalToken, error) {
+	token.ID = store.PersonalTokenID(newID())
+	token.CreatedAt = timestamp()
+
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		return putPersonalToken(tx.Bucket(bucketPersonalToken), token)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error adding personal token")
+	}
+	return &token, nil
+}
+
+func (r *TokenStore) FilterByUsername(username string) ([]store.PersonalToken, error) {
+	tokens := []store.PersonalToken{}
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketPersonalToken), nil, func(value []byte) error {
+			token, err := decodePersonalToken(value)
+			if err != nil {
+				return err
+			}
+			if token.Username == username {
+				tokens = append(tokens, token)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching personal tokens")
+	}
+
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (r *TokenStore) Use(hash string, t time.Time) (*store.PersonalToken, error) {
+	var used *store.PersonalToken
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketPersonalToken), nil, func(value []byte) error {
+			token, err := decodePersonalToken(value)
+			if err != nil {
+				return err
+			}
+			if token.Hash == hash && token.RevokedAt == nil && (token.ExpiresAt == nil || token.ExpiresAt.After(t)) {
+				used = &token
+			}
+			return nil
+		})
+	})
+	if err == nil && used != nil && !used.RecentlyUsed(t) {
+		used.LastUsedAt = &t
+		err = r.DB.Update(func(tx *bbolt.Tx) error {
+			return putPersonalToken(tx.Bucket(bucketPersonalToken), *used)
+		})
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error using personal token")
+	}
+	if used == nil {
+		return nil, store.ErrorNotFound
+	}
+	return used, nil
+}
+
+func (r *TokenStore) Revoke(username string, id store.PersonalTokenID) error {
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(bucketPersonalToken).Get([]byte(id))
+		if value == nil {
+			return store.ErrorNotFound
+		}
+		token, err := decodePersonalToken(value)
+		if err != nil {
+			return err
+		}
+		if token.Username != username || token.RevokedAt != nil {
+			return store.ErrorNotFound
+		}
+
+		now := timestamp()
+		token.RevokedAt = &now
+		return putPersonalToken(tx.Bucket(bucketPersonalToken), token)
+	})
+	if err == store.ErrorNotFound {
+		return err
+	}
+	return errors.Wrap(err, "error revoking personal token")
+}
+
+func (r *TokenStore) Delete(id store.PersonalTokenID) error {
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketPersonalToken).Delete([]byte(id))
+	})
+	return errors.Wrap(err, "error deleting")
+}
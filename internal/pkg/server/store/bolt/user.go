@@ -0,0 +1,171 @@
+package bolt
+
+import (
+	"encoding/json"
+	"go-brunel/internal/pkg/server/security"
+	"go-brunel/internal/pkg/server/store"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+// userRecord is a stored user, users are soft deleted so their name is kept on the jobs they started
+type userRecord struct {
+	store.User
+	DeletedAt *time.Time
+}
+
+type UserStore struct {
+	DB *bbolt.DB
+}
+
+func (r *UserStore) each(fn func(user *userRecord)) error {
+	return r.DB.View(func(tx *bbolt.Tx) error {
+		return each(tx.Bucket(bucketUser), nil, func(value []byte) error {
+			var record userRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			fn(&record)
+			return nil
+		})
+	})
+}
+
+func (r *UserStore) Filter(filter string) ([]store.UserList, error) {
+	pattern, err := filterPattern(filter, true)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []store.UserList{}
+	err = r.each(func(user *userRecord) {
+		if pattern.MatchString(user.Username) || pattern.MatchString(user.Email) {
+			users = append(users, store.UserList{Username: user.Username, Role: user.Role})
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching user list")
+	}
+	return users, nil
+}
+
+func (r *UserStore) AddOrUpdate(user store.User) (*store.User, error) {
+	var updated store.User
+	err := r.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketUser)
+
+		var record userRecord
+		if err := get(b, []byte(user.Username), &record); err == store.ErrorNotFound {
+			record.Username = user.Username
+			record.Role = security.UserRoleReader
+			record.CreatedAt = timestamp()
+		} else if err != nil {
+			return err
+		}
+
+		// Empty fields keep their stored values, so signing in never clears a role or profile details
+		for _, field := range []struct {
+			value  string
+			target *string
+		}{
+			{user.Email, &record.Email},
+			{user.Name, &record.Name},
+			{user.AvatarURL, &record.AvatarURL},
+		} {
+			if field.value != "" {
+				*field.target = field.value
+			}
+		}
+		if user.Role != "" {
+			record.Role = user.Role
+		}
+
+		updated = record.User
+		return put(b, []byte(user.Username), record)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error saving user")
+	}
+	return &updated, nil
+}
+
+func (r *UserStore) GetByUsername(username string) (*store.User, error) {
+	var record userRecord
+	err := r.DB.View(func(tx *bbolt.Tx) error {
+		return get(tx.Bucket(bucketUser), []byte(username), &record)
+	})
+	if err == store.ErrorNotFound {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting user")
+	}
+	return &record.User, nil
+}
+
+func (r *UserStore) update(username string, fn func(user *userRecord)) error {
+	return r.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketUser)
+		var record userRecord
+		if err := get(b, []byte(username), &record); err != nil {
+			return err
+		}
+		fn(&record)
+		return put(b, []byte(username), record)
+	})
+}
+
+func (r *UserStore) SetNotificationPreferences(username string, preferences store.NotificationPreferences) error {
+	if preferences.Watching == nil {
+		preferences.Watching = []store.RepositoryID{}
+	}
+
+	err := r.update(username, func(user *userRecord) {
+		user.Notifications = preferences
+	})
+	if err == store.ErrorNotFound {
+		return err
+	}
+	return errors.Wrap(err, "error setting notification preferences")
+}
+
+func (r *UserStore) FindWatchers(repositoryID store.RepositoryID) ([]store.User, error) {
+	users := []store.User{}
+	err := r.each(func(user *userRecord) {
+		for _, watching := range user.Notifications.Watching {
+			if watching == repositoryID {
+				users = append(users, user.User)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting repository watchers")
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+func (r *UserStore) Delete(username string, hard bool) error {
+	if hard {
+		err := r.DB.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(bucketUser).Delete([]byte(username))
+		})
+		return errors.Wrap(err, "error deleting")
+	}
+
+	err := r.update(username, func(user *userRecord) {
+		now := timestamp()
+		user.DeletedAt = &now
+	})
+	if err == store.ErrorNotFound {
+		return nil
+	}
+	return errors.Wrap(err, "error soft deleting")
+}
@@ -0,0 +1,439 @@
+package chunk
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultChunkLines is the number of lines written to a chunk when LogStore.ChunkLines is not set
+	DefaultChunkLines = 1000
+
+	// DefaultFlushAge is how long lines are buffered when LogStore.FlushAge is not set
+	DefaultFlushAge = 5 * time.Second
+
+	indexName = "index.json"
+)
+
+// unsafeName matches the characters of container ids that are not used in file names
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// LogStore keeps container logs in gzip compressed chunk files rather than in the database, job logs are kept by the
+// embedded store. Lines are buffered per container and written as a chunk once ChunkLines lines have been buffered,
+// or once the first of them has been buffered for FlushAge. Each container has an index of its chunks, recording the
+// line offset and time range of every chunk so reads from a time only decompress the chunks they need.
+//
+// Buffered lines are only visible to readers of the same store, so every endpoint of a server must share it.
+type LogStore struct {
+	store.LogStore
+	Storage Storage
+
+	ChunkLines int
+	FlushAge   time.Duration
+
+	mutex   sync.Mutex
+	buffers map[shared.ContainerID]*buffer
+}
+
+// chunkIndex lists the chunks of a container in the order they were written
+type chunkIndex struct {
+	Chunks []chunkEntry
+}
+
+type chunkEntry struct {
+	Name string
+
+	// Offset is the number of lines written to the container's earlier chunks
+	Offset int64
+	Lines  int
+
+	// From and To are the times of the earliest and latest lines of the chunk
+	From time.Time
+	To   time.Time
+
+	// Terms are the distinct words of the chunk's lines, text searches skip the chunks missing any of their words.
+	// Chunks written before searches were added have no terms and are always read.
+	Terms []string `json:",omitempty"`
+}
+
+// buffer holds the lines of a container that have not been written to a chunk yet, along with its index
+type buffer struct {
+	mutex sync.Mutex
+	id    shared.ContainerID
+	index *chunkIndex
+	lines []store.ContainerLog
+
+	// started is when the first buffered line was received, line times come from the runner's clock
+	started time.Time
+
+	// removed is set once the buffer is no longer in the store, users holding it must look the container up again
+	removed bool
+}
+
+// chunkLine is the encoding of a line within a chunk, the container id is left out as it is the same for every line
+type chunkLine struct {
+	Message string
+	LogType shared.LogType
+	Time    time.Time
+}
+
+func containerDir(id shared.ContainerID) string {
+	return unsafeName.ReplaceAllString(string(id), "_")
+}
+
+func (r *LogStore) chunkLines() int {
+	if r.ChunkLines > 0 {
+		return r.ChunkLines
+	}
+	return DefaultChunkLines
+}
+
+func (r *LogStore) flushAge() time.Duration {
+	if r.FlushAge > 0 {
+		return r.FlushAge
+	}
+	return DefaultFlushAge
+}
+
+// lock returns the locked buffer of the container, creating it when needed. The store is only locked while the
+// buffer is looked up, so waiting for the buffer of one container never blocks the others. A buffer removed before
+// it could be locked is looked up again.
+func (r *LogStore) lock(id shared.ContainerID) *buffer {
+	for {
+		r.mutex.Lock()
+		if r.buffers == nil {
+			r.buffers = map[shared.ContainerID]*buffer{}
+		}
+		b, ok := r.buffers[id]
+		if !ok {
+			b = &buffer{id: id}
+			r.buffers[id] = b
+		}
+		r.mutex.Unlock()
+
+		b.mutex.Lock()
+		if !b.removed {
+			return b
+		}
+		b.mutex.Unlock()
+	}
+}
+
+// remove takes the locked buffer out of the store
+func (r *LogStore) remove(b *buffer) {
+	b.removed = true
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.buffers[b.id] == b {
+		delete(r.buffers, b.id)
+	}
+}
+
+func (r *LogStore) readIndex(id shared.ContainerID) (*chunkIndex, error) {
+	data, err := r.Storage.Read(containerDir(id) + "/" + indexName)
+	if err == store.ErrorNotFound {
+		return &chunkIndex{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := chunkIndex{}
+	return &index, errors.Wrap(json.Unmarshal(data, &index), "error decoding log index")
+}
+
+// flush writes the buffered lines as a new chunk followed by the index listing it. The buffer must be locked.
+func (r *LogStore) flush(b *buffer) error {
+	if len(b.lines) == 0 {
+		return nil
+	}
+
+	if b.index == nil {
+		index, err := r.readIndex(b.id)
+		if err != nil {
+			return err
+		}
+		b.index = index
+	}
+
+	var data bytes.Buffer
+	w := gzip.NewWriter(&data)
+	encoder := json.NewEncoder(w)
+	entry := chunkEntry{Lines: len(b.lines), From: b.lines[0].Time, To: b.lines[0].Time}
+	terms := map[string]bool{}
+	for _, l := range b.lines {
+		for _, t := range store.LogTerms(l.Message) {
+			terms[t] = true
+		}
+		if err := encoder.Encode(chunkLine{Message: l.Message, LogType: l.LogType, Time: l.Time}); err != nil {
+			return errors.Wrap(err, "error encoding log chunk")
+		}
+		if l.Time.Before(entry.From) {
+			entry.From = l.Time
+		}
+		if l.Time.After(entry.To) {
+			entry.To = l.Time
+		}
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "error compressing log chunk")
+	}
+	for t := range terms {
+		entry.Terms = append(entry.Terms, t)
+	}
+	sort.Strings(entry.Terms)
+
+	if n := len(b.index.Chunks); n > 0 {
+		last := b.index.Chunks[n-1]
+		entry.Offset = last.Offset + int64(last.Lines)
+	}
+	entry.Name = fmt.Sprintf("%s/%012d.log.gz", containerDir(b.id), entry.Offset)
+	if err := r.Storage.Write(entry.Name, data.Bytes()); err != nil {
+		return err
+	}
+
+	index := chunkIndex{Chunks: append(append([]chunkEntry{}, b.index.Chunks...), entry)}
+	encoded, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, "error encoding log index")
+	}
+	if err := r.Storage.Write(containerDir(b.id)+"/"+indexName, encoded); err != nil {
+		return err
+	}
+
+	b.index = &index
+	b.lines = nil
+	return nil
+}
+
+func (r *LogStore) ContainerLog(l store.ContainerLog) error {
+	b := r.lock(l.ContainerID)
+	defer b.mutex.Unlock()
+
+	if len(b.lines) == 0 {
+		b.started = time.Now()
+	}
+	b.lines = append(b.lines, l)
+	if len(b.lines) < r.chunkLines() && time.Since(b.started) < r.flushAge() {
+		return nil
+	}
+	return errors.Wrap(r.flush(b), "error writing log chunk")
+}
+
+// readChunk decodes the lines of the chunk from the time
+func (r *LogStore) readChunk(id shared.ContainerID, entry chunkEntry, t time.Time) ([]store.ContainerLog, error) {
+	data, err := r.Storage.Read(entry.Name)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decompressing log chunk")
+	}
+	defer reader.Close()
+
+	logs := []store.ContainerLog{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := chunkLine{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, errors.Wrap(err, "error decoding log chunk")
+		}
+		if !line.Time.Before(t) {
+			logs = append(logs, store.ContainerLog{ContainerID: id, Message: line.Message, LogType: line.LogType, Time: line.Time})
+		}
+	}
+	return logs, errors.Wrap(scanner.Err(), "error reading log chunk")
+}
+
+// read returns the index of the container along with its buffered lines
+func (r *LogStore) read(id shared.ContainerID) (*chunkIndex, []store.ContainerLog, error) {
+	// The index is read while the buffer is locked, so lines being written as a chunk are not read twice
+	b := r.lock(id)
+	defer b.mutex.Unlock()
+
+	if b.index == nil {
+		index, err := r.readIndex(id)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error reading log index")
+		}
+		b.index = index
+	}
+	return b.index, append([]store.ContainerLog{}, b.lines...), nil
+}
+
+// FilterContainerLogByContainerIDFromTime reads the chunks with lines from the time followed by the buffered lines
+func (r *LogStore) FilterContainerLogByContainerIDFromTime(id shared.ContainerID, t time.Time) ([]store.ContainerLog, error) {
+	index, buffered, err := r.read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := []store.ContainerLog{}
+	for _, entry := range index.Chunks {
+		if entry.To.Before(t) {
+			continue
+		}
+		chunk, err := r.readChunk(id, entry, t)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading log chunk")
+		}
+		logs = append(logs, chunk...)
+	}
+
+	for _, l := range buffered {
+		if !l.Time.Before(t) {
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+// hasTerms reports whether the chunk may hold lines with every term, chunks without terms always may
+func (e chunkEntry) hasTerms(terms []string) bool {
+	if len(e.Terms) == 0 {
+		return true
+	}
+	for _, t := range terms {
+		i := sort.SearchStrings(e.Terms, t)
+		if i == len(e.Terms) || e.Terms[i] != t {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchContainerLogs reads the chunks of the containers that hold every term of the search, along with their
+// buffered lines
+func (r *LogStore) SearchContainerLogs(search store.LogSearch) ([]store.LogMatch, int, error) {
+	var matches []store.LogMatch
+	for _, id := range search.ContainerIDs {
+		index, buffered, err := r.read(id)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		match := func(offset int64, lines []store.ContainerLog) {
+			for i, l := range lines {
+				if search.Pattern.MatchString(l.Message) {
+					matches = append(matches, store.LogMatch{
+						ContainerID: id,
+						Line:        int(offset) + i + 1,
+						Time:        l.Time,
+						Message:     l.Message,
+					})
+				}
+			}
+		}
+
+		offset := int64(0)
+		for _, entry := range index.Chunks {
+			offset = entry.Offset + int64(entry.Lines)
+			if !entry.hasTerms(search.Terms) {
+				continue
+			}
+			chunk, err := r.readChunk(id, entry, time.Time{})
+			if err != nil {
+				return nil, 0, errors.Wrap(err, "error reading log chunk")
+			}
+			match(entry.Offset, chunk)
+		}
+		match(offset, buffered)
+	}
+	return store.NewestLogMatches(matches, search.Limit), len(matches), nil
+}
+
+// Import writes the lines of the container as chunks of ChunkLines lines, replacing the chunks it already has. It is
+// used to move container logs out of the database, so importing the same container again is harmless.
+func (r *LogStore) Import(id shared.ContainerID, lines []store.ContainerLog) error {
+	b := r.lock(id)
+	defer b.mutex.Unlock()
+
+	if err := r.Storage.DeleteAll(containerDir(id)); err != nil {
+		return errors.Wrap(err, "error deleting log chunks")
+	}
+	b.index = &chunkIndex{}
+
+	buffered := b.lines
+	for start := 0; start < len(lines); start += r.chunkLines() {
+		end := start + r.chunkLines()
+		if end > len(lines) {
+			end = len(lines)
+		}
+		b.lines = lines[start:end]
+		if err := r.flush(b); err != nil {
+			b.lines = buffered
+			return errors.Wrap(err, "error writing log chunk")
+		}
+	}
+	b.lines = buffered
+	return nil
+}
+
+// DeleteContainerLog removes the chunks and buffered lines of the container
+func (r *LogStore) DeleteContainerLog(id shared.ContainerID) error {
+	b := r.lock(id)
+	defer b.mutex.Unlock()
+
+	r.remove(b)
+	return errors.Wrap(r.Storage.DeleteAll(containerDir(id)), "error deleting log chunks")
+}
+
+// Flush writes the lines buffered for longer than FlushAge, or every buffered line when all is set. Containers with
+// no lines left buffered are forgotten, their index is read again when they are next used. The chunks are written
+// without the store locked, so containers receiving lines are not held up.
+func (r *LogStore) Flush(all bool) error {
+	r.mutex.Lock()
+	buffers := make([]*buffer, 0, len(r.buffers))
+	for _, b := range r.buffers {
+		buffers = append(buffers, b)
+	}
+	r.mutex.Unlock()
+
+	var failed error
+	for _, b := range buffers {
+		b.mutex.Lock()
+		if !b.removed && (all || len(b.lines) == 0 || time.Since(b.started) >= r.flushAge()) {
+			if err := r.flush(b); err != nil {
+				failed = errors.Wrapf(err, "error writing log chunk of container %s", b.id)
+			} else {
+				r.remove(b)
+			}
+		}
+		b.mutex.Unlock()
+	}
+	return failed
+}
+
+// Start will write idle buffered lines every interval until the context is done
+func (r *LogStore) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.Flush(false); err != nil {
+					log.Error("error flushing container logs: ", err)
+				}
+			}
+		}
+	}()
+}
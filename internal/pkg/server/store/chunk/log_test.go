@@ -0,0 +1,216 @@
+package chunk_test
+
+import (
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/store/chunk"
+	"go-brunel/internal/pkg/shared"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// countingStorage counts the files read, to check reads from a time skip the chunks before it
+type countingStorage struct {
+	chunk.Storage
+	reads int
+}
+
+func (s *countingStorage) Read(name string) ([]byte, error) {
+	s.reads++
+	return s.Storage.Read(name)
+}
+
+func TestLogStore_ContainerLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "brunel-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storage := &countingStorage{Storage: &chunk.FileStorage{Path: dir}}
+	logs := &chunk.LogStore{Storage: storage, ChunkLines: 10, FlushAge: time.Hour}
+
+	start := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	for i := 0; i < 25; i++ {
+		if err := logs.ContainerLog(store.ContainerLog{
+			ContainerID: "container/1",
+			Message:     fmt.Sprintf("line %d", i),
+			LogType:     shared.LogTypeStdOut,
+			Time:        start.Add(time.Duration(i) * time.Second),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := logs.FilterContainerLogByContainerIDFromTime("container/1", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 25 || all[0].Message != "line 0" || all[24].Message != "line 24" {
+		t.Fatalf("expected the written and buffered lines in order, got %d lines", len(all))
+	}
+	if all[3].ContainerID != "container/1" || !all[3].Time.Equal(start.Add(3*time.Second)) {
+		t.Errorf("unexpected line %+v", all[3])
+	}
+
+	// Reading from line 15 should only decompress the second chunk, along with the index
+	storage.reads = 0
+	fromTime, err := logs.FilterContainerLogByContainerIDFromTime("container/1", start.Add(15*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromTime) != 10 || fromTime[0].Message != "line 15" {
+		t.Errorf("expected the lines from line 15, got %d lines", len(fromTime))
+	}
+	if storage.reads != 1 {
+		t.Errorf("expected a single chunk to be read, got %d reads", storage.reads)
+	}
+
+	// A new store sees the buffered lines once they are flushed
+	if err := logs.Flush(true); err != nil {
+		t.Fatal(err)
+	}
+	reopened := &chunk.LogStore{Storage: &chunk.FileStorage{Path: dir}}
+	flushed, err := reopened.FilterContainerLogByContainerIDFromTime("container/1", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flushed) != 25 {
+		t.Errorf("expected every line to be flushed, got %d lines", len(flushed))
+	}
+
+	if err := logs.DeleteContainerLog("container/1"); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := reopened.FilterContainerLogByContainerIDFromTime("other", time.Time{})
+	if err != nil || len(deleted) != 0 {
+		t.Errorf("expected no lines for an unknown container, got %d: %v", len(deleted), err)
+	}
+	if _, err := os.Stat(dir + "/container_1"); !os.IsNotExist(err) {
+		t.Errorf("expected the container's chunks to be deleted")
+	}
+}
+
+func TestLogStore_FlushAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "brunel-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logs := &chunk.LogStore{Storage: &chunk.FileStorage{Path: dir}, FlushAge: 50 * time.Millisecond}
+	flushed := func() int {
+		reopened := &chunk.LogStore{Storage: &chunk.FileStorage{Path: dir}}
+		lines, err := reopened.FilterContainerLogByContainerIDFromTime("container", time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(lines)
+	}
+
+	// The age is measured from when the line was received, a runner with a clock behind must not flush every line
+	if err := logs.ContainerLog(store.ContainerLog{ContainerID: "container", Message: "line", Time: time.Now().Add(-24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := logs.Flush(false); err != nil {
+		t.Fatal(err)
+	}
+	if n := flushed(); n != 0 {
+		t.Fatalf("expected the line to stay buffered, got %d flushed lines", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := logs.Flush(false); err != nil {
+		t.Fatal(err)
+	}
+	if n := flushed(); n != 1 {
+		t.Fatalf("expected the line to be flushed once it was buffered for the flush age, got %d lines", n)
+	}
+}
+
+func TestLogStore_Import(t *testing.T) {
+	dir, err := ioutil.TempDir("", "brunel-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logs := &chunk.LogStore{Storage: &chunk.FileStorage{Path: dir}, ChunkLines: 2}
+	var lines []store.ContainerLog
+	for i := 0; i < 5; i++ {
+		lines = append(lines, store.ContainerLog{ContainerID: "c", Message: fmt.Sprint(i), Time: time.Unix(int64(i), 0)})
+	}
+
+	// Importing twice replaces the chunks of the first import
+	for i := 0; i < 2; i++ {
+		if err := logs.Import("c", lines); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	imported, err := logs.FilterContainerLogByContainerIDFromTime("c", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 5 || imported[4].Message != "4" {
+		t.Errorf("expected the imported lines, got %+v", imported)
+	}
+}
+
+func TestLogStore_SearchContainerLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "brunel-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storage := &countingStorage{Storage: &chunk.FileStorage{Path: dir}}
+	logs := &chunk.LogStore{Storage: storage, ChunkLines: 10, FlushAge: time.Hour}
+
+	start := time.Now().Add(-time.Minute)
+	for i := 0; i < 25; i++ {
+		message := fmt.Sprintf("line %d", i)
+		if i == 3 || i == 22 {
+			message = "connection refused"
+		}
+		if err := logs.ContainerLog(store.ContainerLog{
+			ContainerID: "c",
+			Message:     message,
+			Time:        start.Add(time.Duration(i) * time.Second),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search, err := store.NewLogSearch("Connection refused", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search.ContainerIDs = []shared.ContainerID{"c"}
+	search.Limit = 1
+
+	// Only the first chunk holds the words, the second is skipped and the match of line 23 is still buffered
+	storage.reads = 0
+	matches, count, err := logs.SearchContainerLogs(search)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(matches) != 1 || matches[0].Line != 23 || matches[0].ContainerID != "c" {
+		t.Errorf("expected the newest of 2 matches to be line 23, got %d: %+v", count, matches)
+	}
+	if storage.reads != 1 {
+		t.Errorf("expected a single chunk to be read, got %d reads", storage.reads)
+	}
+
+	regex, err := store.NewLogSearch(`^line 1\d$`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regex.ContainerIDs = []shared.ContainerID{"c"}
+	regex.Limit = 100
+	if matches, count, err := logs.SearchContainerLogs(regex); err != nil || count != 10 || matches[9].Line != 11 {
+		t.Errorf("expected lines 11 to 20 to match, got %d: %+v %v", count, matches, err)
+	}
+}
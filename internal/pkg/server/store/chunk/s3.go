@@ -0,0 +1,256 @@
+package chunk
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultS3Timeout bounds the requests of an S3Storage without a Client, including reading their responses
+const DefaultS3Timeout = time.Minute
+
+var defaultS3Client = &http.Client{Timeout: DefaultS3Timeout}
+
+// S3Storage keeps files as objects of an S3 compatible bucket, such as AWS S3 or MinIO. Objects are addressed by path
+// rather than by virtual host, so the endpoint only needs to resolve to the service itself.
+type S3Storage struct {
+	// Endpoint is the URL of the service, for example https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+
+	// Client is used to send requests, a client with a timeout of DefaultS3Timeout is used when it is nil
+	Client *http.Client
+}
+
+// emptyPayloadHash is the SHA256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+type listBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key string
+	}
+}
+
+func (s *S3Storage) Read(name string) ([]byte, error) {
+	res, err := s.do(http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading log object")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, store.ErrorNotFound
+	}
+	if err := checkResponse(res); err != nil {
+		return nil, errors.Wrap(err, "error reading log object")
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	return data, errors.Wrap(err, "error reading log object")
+}
+
+func (s *S3Storage) Write(name string, data []byte) error {
+	res, err := s.do(http.MethodPut, name, nil, data)
+	if err != nil {
+		return errors.Wrap(err, "error writing log object")
+	}
+	defer res.Body.Close()
+	return errors.Wrap(checkResponse(res), "error writing log object")
+}
+
+// DeleteAll lists the objects prefixed by the directory and deletes them one by one, which S3 compatible services
+// all support unlike batch deletes
+func (s *S3Storage) DeleteAll(dir string) error {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		res, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return errors.Wrap(err, "error listing log objects")
+		}
+		result := listBucketResult{}
+		err = checkResponse(res)
+		if err == nil {
+			err = xml.NewDecoder(res.Body).Decode(&result)
+		}
+		res.Body.Close()
+		if err != nil {
+			return errors.Wrap(err, "error listing log objects")
+		}
+
+		for _, object := range result.Contents {
+			res, err := s.do(http.MethodDelete, object.Key, nil, nil)
+			if err != nil {
+				return errors.Wrap(err, "error deleting log object")
+			}
+			res.Body.Close()
+			if err := checkResponse(res); err != nil {
+				return errors.Wrap(err, "error deleting log object")
+			}
+		}
+
+		if !result.IsTruncated {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request for the object with the key, an empty key addresses the bucket
+func (s *S3Storage) do(method string, key string, query url.Values, body []byte) (*http.Response, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid s3 endpoint")
+	}
+	u.Path = u.Path + "/" + s.Bucket + "/" + key
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, body, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = defaultS3Client
+	}
+	return client.Do(req)
+}
+
+// sign adds an AWS signature version 4 authorization header to the request. Every header already set on the request
+// is signed, along with the host, date and payload hash headers added here.
+func (s *S3Storage) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date, s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escape encodes everything but the unreserved characters, as signature version 4 expects
+func escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery encodes the query sorted by name, as signature version 4 expects
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, escape(name)+"="+escape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// checkResponse returns the error of responses that were not successful
+func checkResponse(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	e := s3Error{}
+	if err := xml.NewDecoder(res.Body).Decode(&e); err != nil || e.Code == "" {
+		return errors.Errorf("unexpected response status %d", res.StatusCode)
+	}
+	return errors.Errorf("unexpected response status %d: %s: %s", res.StatusCode, e.Code, e.Message)
+}
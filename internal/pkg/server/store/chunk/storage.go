@@ -0,0 +1,76 @@
+package chunk
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Storage holds the chunk and index files of container logs. Names are slash separated paths, the files of a
+// container share the container's directory.
+type Storage interface {
+	// Read returns the content of the named file, store.ErrorNotFound is returned when it does not exist
+	Read(name string) ([]byte, error)
+
+	// Write creates or replaces the named file
+	Write(name string, data []byte) error
+
+	// DeleteAll removes every file in the named directory
+	DeleteAll(dir string) error
+}
+
+// FileStorage keeps files in a directory of the local file system
+type FileStorage struct {
+	Path string
+}
+
+// path returns the location of the named file, refusing names that would leave the storage directory
+func (s *FileStorage) path(name string) (string, error) {
+	clean := path.Clean("/" + name)
+	if clean == "/" || strings.Contains(name, "..") {
+		return "", errors.Errorf("invalid log file name '%s'", name)
+	}
+	return filepath.Join(s.Path, filepath.FromSlash(clean)), nil
+}
+
+func (s *FileStorage) Read(name string) ([]byte, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, store.ErrorNotFound
+	}
+	return data, errors.Wrap(err, "error reading log file")
+}
+
+// Write writes to a temporary file that is renamed over the named file, so readers never see a partial file
+func (s *FileStorage) Write(name string, data []byte) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return errors.Wrap(err, "error creating log directory")
+	}
+	if err := ioutil.WriteFile(p+".tmp", data, 0600); err != nil {
+		return errors.Wrap(err, "error writing log file")
+	}
+	return errors.Wrap(os.Rename(p+".tmp", p), "error writing log file")
+}
+
+func (s *FileStorage) DeleteAll(dir string) error {
+	p, err := s.path(dir)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(os.RemoveAll(p), "error deleting log files")
+}
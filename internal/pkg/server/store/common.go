@@ -3,3 +3,6 @@ package store
 import "errors"
 
 var ErrorNotFound = errors.New("entity not found")
+
+// ErrorConflict is returned when a record has already been written by someone else
+var ErrorConflict = errors.New("entity already exists")
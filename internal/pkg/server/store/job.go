@@ -2,11 +2,15 @@ package store
 
 import (
 	"errors"
+	"fmt"
 	"go-brunel/internal/pkg/shared"
+	"regexp"
 	"strings"
 	"time"
 )
 
+var parameterNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 type JobListPage struct {
 	Count int64 `bson:"job_count"`
 	Jobs  []Job `bson:"jobs"`
@@ -19,10 +23,23 @@ type Job struct {
 	Commit        shared.Commit
 	State         shared.JobState
 	StartedBy     string     `bson:"started_by"`
+	Runner        string     `bson:"runner"`
 	StoppedBy     *string    `bson:"stopped_by"`
 	CreatedAt     time.Time  `bson:"created_at"`
 	StartedAt     *time.Time `bson:"started_at"`
 	StoppedAt     *time.Time `bson:"stopped_at"`
+
+	// Parameters are the ad-hoc variables the job was started with, reruns of the job reuse them
+	Parameters map[string]string `bson:"parameters,omitempty"`
+
+	// PullRequest is set for jobs started by pull or merge request triggers
+	PullRequest *shared.PullRequest `bson:"pull_request,omitempty"`
+
+	// ChangedFiles are the files changed by the push that started the job, nil when they are not known
+	ChangedFiles []string `bson:"changed_files,omitempty"`
+
+	// Priority orders the queue, waiting jobs with a higher priority are processed first
+	Priority int `bson:"priority"`
 }
 
 func (job *Job) Clean() {
@@ -35,6 +52,12 @@ func (job *Job) IsValid() error {
 		return errors.New("branch and revision are required")
 	}
 
+	for name := range job.Parameters {
+		if !parameterNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid parameter name '%s'", name)
+		}
+	}
+
 	return nil
 }
 
@@ -47,7 +70,10 @@ type JobDetail struct {
 }
 
 type JobStore interface {
-	Next() (*Job, error)
+	// Next should atomically claim the next waiting job for the named runner. Jobs with the highest priority are
+	// claimed first, oldest first within a repository, taking turns between repositories with jobs of that priority.
+	// Jobs of repositories that are already processing their maximum number of concurrent jobs are left waiting.
+	Next(runner string) (*Job, error)
 
 	Get(id shared.JobID) (*Job, error)
 
@@ -59,6 +85,36 @@ type JobStore interface {
 
 	CancelByID(id shared.JobID, userID string) error
 
+	// FindLatest returns the most recently created job for the repository, branch and environment that was started by
+	// startedBy. ErrorNotFound is returned if there is no such job.
+	FindLatest(
+		repositoryID RepositoryID,
+		branch string,
+		environmentID *shared.EnvironmentID,
+		startedBy string,
+	) (*Job, error)
+
+	// FindPreviousCompleted returns the latest job for the same repository, branch and environment as the job that
+	// was created before it and has succeeded or failed. ErrorNotFound is returned if there is no such job.
+	FindPreviousCompleted(job Job) (*Job, error)
+
+	// FindActiveByBranch returns the waiting and processing jobs for a branch of the repository
+	FindActiveByBranch(repositoryID RepositoryID, branch string) ([]Job, error)
+
+	// FindActiveByPullRequest returns the waiting and processing jobs for a pull request of the repository
+	FindActiveByPullRequest(repositoryID RepositoryID, number int64) ([]Job, error)
+
+	// FindProcessingStartedBefore returns the processing jobs of the repository that were started before t
+	FindProcessingStartedBefore(repositoryID RepositoryID, t time.Time) ([]Job, error)
+
+	// ExpireWaitingCreatedBefore moves the waiting jobs of the repository that were created before t to
+	// JobStateExpired, returning the ids of the expired jobs. Jobs claimed by a runner in the meantime are left alone.
+	ExpireWaitingCreatedBefore(repositoryID RepositoryID, t time.Time, stoppedBy string) ([]shared.JobID, error)
+
+	// FindStoppedByRepositoryID returns the jobs of the repository that are no longer waiting or processing, oldest
+	// first
+	FindStoppedByRepositoryID(repositoryID RepositoryID) ([]Job, error)
+
 	FilterByRepositoryID(
 		repositoryID RepositoryID,
 		filter string,
@@ -68,5 +124,7 @@ type JobStore interface {
 		sortOrder int,
 	) (JobListPage, error)
 
+	// Delete removes the job along with its stages, containers, logs and notification deliveries. Records belonging to
+	// the job are removed before the job, so a job that failed to delete can be deleted again.
 	Delete(id shared.JobID) error
 }
@@ -2,7 +2,13 @@ package store
 
 import (
 	"go-brunel/internal/pkg/shared"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
 )
 
 type Log struct {
@@ -31,3 +37,88 @@ type LogStore interface {
 
 	FilterContainerLogByContainerIDFromTime(id shared.ContainerID, t time.Time) ([]ContainerLog, error)
 }
+
+// ContainerLogDeleter is implemented by log stores keeping container logs outside of the database, their logs are not
+// removed by JobStore.Delete so are deleted through it
+type ContainerLogDeleter interface {
+	DeleteContainerLog(id shared.ContainerID) error
+}
+
+// LogSearch selects the lines of the jobs' logs, or of the containers' logs, matching its pattern
+type LogSearch struct {
+	JobIDs       []shared.JobID
+	ContainerIDs []shared.ContainerID
+
+	// Terms are the words of a text search, a line matching the search holds every term. Terms are empty for regular
+	// expression searches.
+	Terms []string
+
+	// Pattern decides whether a line matches, stores may use Terms to skip lines but must check the pattern
+	Pattern *regexp.Regexp
+
+	// Limit is the number of matches returned, newest first. Every matching line is counted.
+	Limit int
+}
+
+// NewLogSearch creates a search for the query as a regular expression when regex is set. Otherwise lines match when
+// they hold the words of the query next to each other, ignoring case and punctuation.
+func NewLogSearch(query string, regex bool) (LogSearch, error) {
+	if regex {
+		pattern, err := regexp.Compile(query)
+		return LogSearch{Pattern: pattern}, errors.Wrap(err, "invalid regular expression")
+	}
+
+	terms := LogTerms(query)
+	if len(terms) == 0 {
+		return LogSearch{}, errors.New("the query has no words to search for")
+	}
+
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	pattern := regexp.MustCompile(`(?i)(?:^|[^\pL\pN])` + strings.Join(quoted, `[^\pL\pN]+`) + `(?:$|[^\pL\pN])`)
+	return LogSearch{Terms: terms, Pattern: pattern}, nil
+}
+
+// LogTerms splits the message into its lower case words, in order
+func LogTerms(message string) []string {
+	return strings.FieldsFunc(strings.ToLower(message), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// LogMatch is a line found by a log search. Line is the position of the line, starting at 1, in the logs of its
+// container, or in the job logs when it was logged by the job itself.
+type LogMatch struct {
+	JobID       shared.JobID
+	StageID     shared.StageID     `json:",omitempty"`
+	ContainerID shared.ContainerID `json:",omitempty"`
+	Line        int
+	Time        time.Time
+	Message     string
+}
+
+// NewestLogMatches sorts the matches newest first, keeping at most limit of them
+func NewestLogMatches(matches []LogMatch, limit int) []LogMatch {
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Time.After(matches[j].Time)
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// JobLogSearcher is implemented by log stores that can search job logs without reading every line of every job. The
+// matches are returned newest first along with the number of lines matching.
+type JobLogSearcher interface {
+	SearchJobLogs(search LogSearch) ([]LogMatch, int, error)
+}
+
+// ContainerLogSearcher is implemented by log stores that can search container logs without reading every line of every
+// container. The matches are returned newest first along with the number of lines matching, their job and stage are
+// left for the caller to fill in.
+type ContainerLogSearcher interface {
+	SearchContainerLogs(search LogSearch) ([]LogMatch, int, error)
+}
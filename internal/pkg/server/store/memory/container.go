@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type ContainerStore struct {
+	Database *Database
+}
+
+func (r *ContainerStore) Add(c store.Container) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	c.ID = r.Database.newID()
+	r.Database.containers[c.JobID] = append(r.Database.containers[c.JobID], copyContainer(c))
+	r.Database.containerJobs[c.ContainerID] = c.JobID
+	return nil
+}
+
+// find returns the stored container with the runtime container id, or nil. The database must be locked.
+func (r *ContainerStore) find(id shared.ContainerID) *store.Container {
+	jobID, ok := r.Database.containerJobs[id]
+	if !ok {
+		return nil
+	}
+
+	containers := r.Database.containers[jobID]
+	for i := len(containers) - 1; i >= 0; i-- {
+		if containers[i].ContainerID == id {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+func (r *ContainerStore) update(id shared.ContainerID, fn func(c *store.Container)) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	if c := r.find(id); c != nil {
+		fn(c)
+	}
+	return nil
+}
+
+func (r *ContainerStore) UpdateStateByContainerID(id shared.ContainerID, state shared.ContainerState) error {
+	return r.update(id, func(c *store.Container) {
+		c.State = state
+	})
+}
+
+func (r *ContainerStore) UpdateStoppedAtByContainerID(id shared.ContainerID, t time.Time) error {
+	return r.update(id, func(c *store.Container) {
+		c.StoppedAt = &t
+	})
+}
+
+func (r *ContainerStore) UpdateStartedAtByContainerID(id shared.ContainerID, t time.Time) error {
+	return r.update(id, func(c *store.Container) {
+		c.StartedAt = &t
+	})
+}
+
+func (r *ContainerStore) GetContainerState(id shared.ContainerID) (*shared.ContainerState, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	c := r.find(id)
+	if c == nil {
+		return nil, errors.New("could not find container")
+	}
+	state := c.State
+	return &state, nil
+}
+
+func (r *ContainerStore) FilterByJobID(jobID shared.JobID) ([]store.Container, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	containers := []store.Container{}
+	for _, c := range r.Database.containers[jobID] {
+		containers = append(containers, copyContainer(c))
+	}
+
+	sort.SliceStable(containers, func(i, j int) bool {
+		return containers[i].CreatedAt.Before(containers[j].CreatedAt)
+	})
+	return containers, nil
+}
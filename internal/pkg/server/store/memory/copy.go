@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"time"
+)
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	return &c
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+func copyEnvironmentID(id *shared.EnvironmentID) *shared.EnvironmentID {
+	if id == nil {
+		return nil
+	}
+	c := *id
+	return &c
+}
+
+func copyJob(job store.Job) store.Job {
+	job.EnvironmentID = copyEnvironmentID(job.EnvironmentID)
+	job.StoppedBy = copyString(job.StoppedBy)
+	job.StartedAt = copyTime(job.StartedAt)
+	job.StoppedAt = copyTime(job.StoppedAt)
+	job.ChangedFiles = copyStrings(job.ChangedFiles)
+
+	if job.Parameters != nil {
+		parameters := make(map[string]string, len(job.Parameters))
+		for name, value := range job.Parameters {
+			parameters[name] = value
+		}
+		job.Parameters = parameters
+	}
+	if job.PullRequest != nil {
+		pullRequest := *job.PullRequest
+		job.PullRequest = &pullRequest
+	}
+	return job
+}
+
+func copyRepository(repository store.Repository) store.Repository {
+	repository.DeletedAt = copyTime(repository.DeletedAt)
+	if repository.Triggers != nil {
+		triggers := make([]store.RepositoryTrigger, len(repository.Triggers))
+		for i, trigger := range repository.Triggers {
+			trigger.EnvironmentID = copyEnvironmentID(trigger.EnvironmentID)
+			trigger.Paths = copyStrings(trigger.Paths)
+			trigger.IgnorePaths = copyStrings(trigger.IgnorePaths)
+			triggers[i] = trigger
+		}
+		repository.Triggers = triggers
+	}
+	return repository
+}
+
+func copyEnvironment(environment store.Environment) store.Environment {
+	environment.DeletedAt = copyTime(environment.DeletedAt)
+	if environment.Variables != nil {
+		environment.Variables = append([]store.EnvironmentVariable{}, environment.Variables...)
+	}
+	return environment
+}
+
+func copyUser(user store.User) store.User {
+	if user.Notifications.Watching != nil {
+		user.Notifications.Watching = append([]store.RepositoryID{}, user.Notifications.Watching...)
+	}
+	return user
+}
+
+func copyStage(stage store.Stage) store.Stage {
+	stage.StartedAt = copyTime(stage.StartedAt)
+	stage.StoppedAt = copyTime(stage.StoppedAt)
+	return stage
+}
+
+func copyContainer(c store.Container) store.Container {
+	c.StartedAt = copyTime(c.StartedAt)
+	c.StoppedAt = copyTime(c.StoppedAt)
+	c.Spec.Args = copyStrings(c.Spec.Args)
+
+	if c.Spec.Environment != nil {
+		environment := make(map[string]string, len(c.Spec.Environment))
+		for name, value := range c.Spec.Environment {
+			environment[name] = value
+		}
+		c.Spec.Environment = environment
+	}
+	if c.Spec.Resources != nil {
+		resources := *c.Spec.Resources
+		for _, units := range []**shared.ContainerResourcesUnits{&resources.Limits, &resources.Requests} {
+			if *units != nil {
+				c := **units
+				*units = &c
+			}
+		}
+		c.Spec.Resources = &resources
+	}
+	if c.Spec.Wait != nil {
+		wait := *c.Spec.Wait
+		if wait.Timeout != nil {
+			timeout := *wait.Timeout
+			wait.Timeout = &timeout
+		}
+		c.Spec.Wait = &wait
+	}
+	return c
+}
+
+func copyEnrollmentToken(token store.EnrollmentToken) store.EnrollmentToken {
+	token.UsedAt = copyTime(token.UsedAt)
+	token.RevokedAt = copyTime(token.RevokedAt)
+	return token
+}
+
+func copyPersonalToken(token store.PersonalToken) store.PersonalToken {
+	token.ExpiresAt = copyTime(token.ExpiresAt)
+	token.LastUsedAt = copyTime(token.LastUsedAt)
+	token.RevokedAt = copyTime(token.RevokedAt)
+	return token
+}
@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+type EnvironmentStore struct {
+	Database *Database
+}
+
+func (s *EnvironmentStore) Get(id shared.EnvironmentID) (*store.Environment, error) {
+	s.Database.mutex.RLock()
+	defer s.Database.mutex.RUnlock()
+
+	environment, ok := s.Database.environments[id]
+	if !ok {
+		return nil, store.ErrorNotFound
+	}
+	environment = copyEnvironment(environment)
+	return &environment, nil
+}
+
+func (s *EnvironmentStore) AddOrUpdate(environment store.Environment) (*store.Environment, error) {
+	s.Database.mutex.Lock()
+	defer s.Database.mutex.Unlock()
+
+	for _, other := range s.Database.environments {
+		if other.Name == environment.Name && other.ID != environment.ID {
+			return nil, errors.New("environment name must be unique")
+		}
+	}
+
+	if environment.Variables == nil {
+		environment.Variables = []store.EnvironmentVariable{}
+	}
+
+	now := timestamp()
+	id := environment.ID
+	if id == "" {
+		id = shared.EnvironmentID(s.Database.newID())
+	}
+	updated, ok := s.Database.environments[id]
+	if !ok {
+		updated = store.Environment{ID: id, CreatedAt: now}
+	}
+	updated.Name = environment.Name
+	updated.Variables = environment.Variables
+	updated.UpdatedAt = now
+	s.Database.environments[id] = copyEnvironment(updated)
+
+	updated = copyEnvironment(updated)
+	return &updated, nil
+}
+
+func (s *EnvironmentStore) Filter(filter string) ([]store.EnvironmentList, error) {
+	pattern, err := filterPattern(filter, true)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Database.mutex.RLock()
+	defer s.Database.mutex.RUnlock()
+
+	environments := []store.EnvironmentList{}
+	for _, environment := range s.Database.environments {
+		if pattern.MatchString(environment.Name) {
+			environments = append(environments, store.EnvironmentList{ID: environment.ID, Name: environment.Name})
+		}
+	}
+
+	sort.Slice(environments, func(i, j int) bool {
+		return environments[i].Name < environments[j].Name
+	})
+	return environments, nil
+}
+
+func (s *EnvironmentStore) GetVariable(id shared.EnvironmentID, name string) (*string, error) {
+	env, err := s.Get(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting environment")
+	}
+
+	for _, v := range env.Variables {
+		if v.Name == name {
+			return &v.Value, nil
+		}
+	}
+
+	return nil, errors.New("environment variable not found")
+}
+
+func (s *EnvironmentStore) Delete(id shared.EnvironmentID, hard bool) error {
+	s.Database.mutex.Lock()
+	defer s.Database.mutex.Unlock()
+
+	if hard {
+		delete(s.Database.environments, id)
+		return nil
+	}
+
+	if environment, ok := s.Database.environments[id]; ok {
+		now := timestamp()
+		environment.DeletedAt = &now
+		s.Database.environments[id] = environment
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+	"time"
+)
+
+type JobStore struct {
+	Database *Database
+}
+
+// sortJobs orders jobs by when they were created, oldest first
+func sortJobs(jobs []store.Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+}
+
+func (r *JobStore) find(match func(job *store.Job) bool) []store.Job {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	jobs := []store.Job{}
+	for _, job := range r.Database.jobs {
+		if match(&job) {
+			jobs = append(jobs, copyJob(job))
+		}
+	}
+	sortJobs(jobs)
+	return jobs
+}
+
+// findLatest returns the most recently created job matching, or store.ErrorNotFound
+func (r *JobStore) findLatest(match func(job *store.Job) bool) (*store.Job, error) {
+	jobs := r.find(match)
+	if len(jobs) == 0 {
+		return nil, store.ErrorNotFound
+	}
+	return &jobs[len(jobs)-1], nil
+}
+
+// update applies fn to the stored job, jobs that do not exist are ignored like the other stores ignore them
+func (r *JobStore) update(id shared.JobID, fn func(job *store.Job)) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	if job, ok := r.Database.jobs[id]; ok {
+		fn(&job)
+		r.Database.jobs[id] = job
+	}
+	return nil
+}
+
+// Next claims the next job while holding the database lock, so two runners can never claim the same job
+func (r *JobStore) Next(runner string) (*store.Job, error) {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	processing := map[store.RepositoryID]int{}
+	for _, job := range r.Database.jobs {
+		if job.State == shared.JobStateProcessing {
+			processing[job.RepositoryID]++
+		}
+	}
+
+	var candidates []store.Job
+	for _, job := range r.Database.jobs {
+		if job.State != shared.JobStateWaiting {
+			continue
+		}
+		limit := r.Database.repositories[job.RepositoryID].Settings.MaxConcurrentJobs
+		if limit <= 0 || processing[job.RepositoryID] < limit {
+			candidates = append(candidates, job)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	sortJobs(candidates)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		dispatchedA := r.Database.repositories[a.RepositoryID].LastDispatchedAt
+		dispatchedB := r.Database.repositories[b.RepositoryID].LastDispatchedAt
+		if dispatchedA == nil || dispatchedB == nil {
+			return dispatchedA == nil && dispatchedB != nil
+		}
+		return dispatchedA.Before(*dispatchedB)
+	})
+
+	now := timestamp()
+	job := candidates[0]
+	job.State = shared.JobStateProcessing
+	job.StartedAt = &now
+	job.Runner = runner
+	r.Database.jobs[job.ID] = job
+
+	if record, ok := r.Database.repositories[job.RepositoryID]; ok {
+		record.LastDispatchedAt = &now
+		r.Database.repositories[job.RepositoryID] = record
+	}
+
+	job = copyJob(job)
+	return &job, nil
+}
+
+func (r *JobStore) Get(id shared.JobID) (*store.Job, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	job, ok := r.Database.jobs[id]
+	if !ok {
+		return nil, store.ErrorNotFound
+	}
+	job = copyJob(job)
+	return &job, nil
+}
+
+func (r *JobStore) Add(j store.Job) (*store.Job, error) {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	j.ID = shared.JobID(r.Database.newID())
+	j.CreatedAt = timestamp()
+	r.Database.jobs[j.ID] = copyJob(j)
+	return &j, nil
+}
+
+func (r *JobStore) UpdateStoppedAtByID(id shared.JobID, t time.Time) error {
+	return r.update(id, func(job *store.Job) {
+		job.StoppedAt = &t
+	})
+}
+
+func (r *JobStore) UpdateStateByID(id shared.JobID, s shared.JobState) error {
+	return r.update(id, func(job *store.Job) {
+		job.State = s
+	})
+}
+
+func (r *JobStore) CancelByID(id shared.JobID, userID string) error {
+	return r.update(id, func(job *store.Job) {
+		job.State = shared.JobStateCancelled
+		job.StoppedBy = &userID
+	})
+}
+
+func sameEnvironment(a *shared.EnvironmentID, b *shared.EnvironmentID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func (r *JobStore) FindLatest(
+	repositoryID store.RepositoryID,
+	branch string,
+	environmentID *shared.EnvironmentID,
+	startedBy string,
+) (*store.Job, error) {
+	return r.findLatest(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID &&
+			job.Commit.Branch == branch &&
+			sameEnvironment(job.EnvironmentID, environmentID) &&
+			job.StartedBy == startedBy
+	})
+}
+
+func (r *JobStore) FindPreviousCompleted(previous store.Job) (*store.Job, error) {
+	return r.findLatest(func(job *store.Job) bool {
+		return job.RepositoryID == previous.RepositoryID &&
+			job.Commit.Branch == previous.Commit.Branch &&
+			sameEnvironment(job.EnvironmentID, previous.EnvironmentID) &&
+			job.CreatedAt.Before(previous.CreatedAt) &&
+			(job.State == shared.JobStateSuccess || job.State == shared.JobStateFailed)
+	})
+}
+
+func isActive(job *store.Job) bool {
+	return job.State == shared.JobStateWaiting || job.State == shared.JobStateProcessing
+}
+
+func (r *JobStore) FindActiveByBranch(repositoryID store.RepositoryID, branch string) ([]store.Job, error) {
+	return r.find(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID && job.Commit.Branch == branch && isActive(job)
+	}), nil
+}
+
+func (r *JobStore) FindActiveByPullRequest(repositoryID store.RepositoryID, number int64) ([]store.Job, error) {
+	return r.find(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID &&
+			job.PullRequest != nil &&
+			job.PullRequest.Number == number &&
+			isActive(job)
+	}), nil
+}
+
+func (r *JobStore) FindProcessingStartedBefore(repositoryID store.RepositoryID, t time.Time) ([]store.Job, error) {
+	return r.find(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID &&
+			job.State == shared.JobStateProcessing &&
+			job.StartedAt != nil &&
+			job.StartedAt.Before(t)
+	}), nil
+}
+
+func (r *JobStore) ExpireWaitingCreatedBefore(
+	repositoryID store.RepositoryID,
+	t time.Time,
+	stoppedBy string,
+) ([]shared.JobID, error) {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	var jobs []store.Job
+	for _, job := range r.Database.jobs {
+		if job.RepositoryID == repositoryID && job.State == shared.JobStateWaiting && job.CreatedAt.Before(t) {
+			jobs = append(jobs, job)
+		}
+	}
+	sortJobs(jobs)
+
+	now := timestamp()
+	expired := []shared.JobID{}
+	for _, job := range jobs {
+		job.State = shared.JobStateExpired
+		job.StoppedAt = &now
+		job.StoppedBy = &stoppedBy
+		r.Database.jobs[job.ID] = job
+		expired = append(expired, job.ID)
+	}
+	return expired, nil
+}
+
+func (r *JobStore) FindStoppedByRepositoryID(repositoryID store.RepositoryID) ([]store.Job, error) {
+	return r.find(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID &&
+			job.State != shared.JobStateWaiting &&
+			job.State != shared.JobStateProcessing
+	}), nil
+}
+
+func (r *JobStore) FilterByRepositoryID(
+	repositoryID store.RepositoryID,
+	filter string,
+	pageIndex int64,
+	pageSize int64,
+	sortColumn string,
+	sortOrder int,
+) (store.JobListPage, error) {
+	result := store.JobListPage{}
+	result.Jobs = []store.Job{}
+
+	pattern, err := filterPattern(filter, false)
+	if err != nil {
+		return result, err
+	}
+
+	jobs := r.find(func(job *store.Job) bool {
+		return job.RepositoryID == repositoryID &&
+			(pattern.MatchString(job.Commit.Branch) ||
+				pattern.MatchString(job.Commit.Revision) ||
+				pattern.MatchString(job.StartedBy))
+	})
+
+	if sortColumn == "state" {
+		sort.SliceStable(jobs, func(i, j int) bool {
+			return jobs[i].State < jobs[j].State
+		})
+	}
+	if sortOrder < 0 {
+		for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
+			jobs[i], jobs[j] = jobs[j], jobs[i]
+		}
+	}
+
+	result.Count = int64(len(jobs))
+	start, end := page(len(jobs), pageIndex, pageSize)
+	result.Jobs = append(result.Jobs, jobs[start:end]...)
+	return result, nil
+}
+
+func (r *JobStore) Delete(id shared.JobID) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	for _, c := range r.Database.containers[id] {
+		delete(r.Database.containerLogs, c.ContainerID)
+		delete(r.Database.containerJobs, c.ContainerID)
+	}
+	delete(r.Database.logs, id)
+	delete(r.Database.containers, id)
+	delete(r.Database.stages, id)
+
+	deliveries := r.Database.deliveries[:0]
+	for _, delivery := range r.Database.deliveries {
+		if delivery.JobID != id {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	r.Database.deliveries = deliveries
+
+	delete(r.Database.jobs, id)
+	return nil
+}
@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+	"time"
+)
+
+type LogStore struct {
+	Database *Database
+}
+
+func (r *LogStore) Log(l store.Log) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	r.Database.logs[l.JobID] = append(r.Database.logs[l.JobID], l)
+	return nil
+}
+
+func (r *LogStore) ContainerLog(l store.ContainerLog) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	r.Database.containerLogs[l.ContainerID] = append(r.Database.containerLogs[l.ContainerID], l)
+	return nil
+}
+
+func (r *LogStore) FilterLogByJobIDFromTime(id shared.JobID, t time.Time) ([]store.Log, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	logs := []store.Log{}
+	for _, l := range r.Database.logs[id] {
+		if !l.Time.Before(t) {
+			logs = append(logs, l)
+		}
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].Time.Before(logs[j].Time)
+	})
+	return logs, nil
+}
+
+func (r *LogStore) FilterContainerLogByContainerIDFromTime(
+	id shared.ContainerID,
+	t time.Time,
+) ([]store.ContainerLog, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	logs := []store.ContainerLog{}
+	for _, l := range r.Database.containerLogs[id] {
+		if !l.Time.Before(t) {
+			logs = append(logs, l)
+		}
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].Time.Before(logs[j].Time)
+	})
+	return logs, nil
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Database holds every record of the in-memory stores. Stores sharing a database see each other's records, like the
+// stores of the other backends sharing a connection.
+//
+// Records are copied when they are stored and when they are returned, so callers can never modify stored records.
+type Database struct {
+	mutex    sync.RWMutex
+	sequence uint64
+
+	repositories  map[store.RepositoryID]repositoryRecord
+	environments  map[shared.EnvironmentID]store.Environment
+	users         map[string]userRecord
+	jobs          map[shared.JobID]store.Job
+	stages        map[shared.JobID][]store.Stage
+	containers    map[shared.JobID][]store.Container
+	containerJobs map[shared.ContainerID]shared.JobID
+	logs          map[shared.JobID][]store.Log
+	containerLogs map[shared.ContainerID][]store.ContainerLog
+	tokens        map[store.EnrollmentTokenID]store.EnrollmentToken
+	personal      map[store.PersonalTokenID]store.PersonalToken
+	deliveries    []store.NotificationDelivery
+	scheduledRuns map[string]store.ScheduledRun
+}
+
+func NewDatabase() *Database {
+	return &Database{
+		repositories:  map[store.RepositoryID]repositoryRecord{},
+		environments:  map[shared.EnvironmentID]store.Environment{},
+		users:         map[string]userRecord{},
+		jobs:          map[shared.JobID]store.Job{},
+		stages:        map[shared.JobID][]store.Stage{},
+		containers:    map[shared.JobID][]store.Container{},
+		containerJobs: map[shared.ContainerID]shared.JobID{},
+		logs:          map[shared.JobID][]store.Log{},
+		containerLogs: map[shared.ContainerID][]store.ContainerLog{},
+		tokens:        map[store.EnrollmentTokenID]store.EnrollmentToken{},
+		personal:      map[store.PersonalTokenID]store.PersonalToken{},
+		scheduledRuns: map[string]store.ScheduledRun{},
+	}
+}
+
+// newID returns the next identifier, formatted like the object ids of the mongo stores. Ids increase, so records
+// created at the same time still sort in creation order. The database must be locked for writing.
+func (db *Database) newID() string {
+	db.sequence++
+	return fmt.Sprintf("%024x", db.sequence)
+}
+
+// timestamp returns the current time at the millisecond precision mongo stores times with, so records read back
+// compare the same way across stores
+func timestamp() time.Time {
+	return time.Now().Truncate(time.Millisecond)
+}
+
+// filterPattern compiles the regular expression list endpoints filter on, like the mongo $regex filters
+func filterPattern(filter string, caseInsensitive bool) (*regexp.Regexp, error) {
+	if caseInsensitive {
+		filter = "(?i)" + filter
+	}
+	pattern, err := regexp.Compile(filter)
+	return pattern, errors.Wrap(err, "invalid filter")
+}
+
+// page returns the bounds of a page of size items, clamped to the number of items
+func page(size int, pageIndex int64, pageSize int64) (int, int) {
+	start := pageIndex * pageSize
+	if start < 0 || start >= int64(size) {
+		return 0, 0
+	}
+	end := start + pageSize
+	if end > int64(size) {
+		end = int64(size)
+	}
+	return int(start), int(end)
+}
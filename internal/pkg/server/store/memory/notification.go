@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+)
+
+type NotificationDeliveryStore struct {
+	Database *Database
+}
+
+func (r *NotificationDeliveryStore) Add(delivery store.NotificationDelivery) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	delivery.ID = store.NotificationDeliveryID(r.Database.newID())
+	r.Database.deliveries = append(r.Database.deliveries, delivery)
+	return nil
+}
+
+func (r *NotificationDeliveryStore) Filter(
+	jobID shared.JobID,
+	pageIndex int64,
+	pageSize int64,
+) ([]store.NotificationDelivery, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	deliveries := []store.NotificationDelivery{}
+	for i := len(r.Database.deliveries) - 1; i >= 0; i-- {
+		if delivery := r.Database.deliveries[i]; jobID == "" || delivery.JobID == jobID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+
+	start, end := page(len(deliveries), pageIndex, pageSize)
+	return deliveries[start:end], nil
+}
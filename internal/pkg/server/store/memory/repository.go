@@ -0,0 +1,150 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"sort"
+	"time"
+)
+
+// repositoryRecord is a stored repository, along with when it last had a job claimed so the queue can take turns
+// between repositories
+type repositoryRecord struct {
+	store.Repository
+	LastDispatchedAt *time.Time
+}
+
+type RepositoryStore struct {
+	Database *Database
+}
+
+func (r *RepositoryStore) AddOrUpdate(repository store.Repository) (*store.Repository, error) {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	var record *repositoryRecord
+	for _, existing := range r.Database.repositories {
+		if existing.Project == repository.Project && existing.Name == repository.Name {
+			existing := existing
+			record = &existing
+			break
+		}
+	}
+
+	now := timestamp()
+	if record == nil {
+		record = &repositoryRecord{Repository: store.Repository{
+			ID:        store.RepositoryID(r.Database.newID()),
+			Project:   repository.Project,
+			Name:      repository.Name,
+			Triggers:  []store.RepositoryTrigger{},
+			CreatedAt: now,
+		}}
+	}
+
+	// Repositories are updated when hooks are received, which do not carry triggers, so they are only replaced when
+	// new ones are given
+	if len(repository.Triggers) > 0 {
+		record.Triggers = repository.Triggers
+	}
+	record.URI = repository.URI
+	record.UpdatedAt = now
+	record.DeletedAt = repository.DeletedAt
+
+	record.Repository = copyRepository(record.Repository)
+	r.Database.repositories[record.ID] = *record
+
+	updated := copyRepository(record.Repository)
+	return &updated, nil
+}
+
+// update applies fn to the stored repository, returning store.ErrorNotFound when there is none
+func (r *RepositoryStore) update(id store.RepositoryID, fn func(repository *repositoryRecord)) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	record, ok := r.Database.repositories[id]
+	if !ok {
+		return store.ErrorNotFound
+	}
+	fn(&record)
+	r.Database.repositories[id] = record
+	return nil
+}
+
+func (r *RepositoryStore) SetTriggers(id store.RepositoryID, triggers []store.RepositoryTrigger) error {
+	if triggers == nil {
+		triggers = []store.RepositoryTrigger{}
+	}
+
+	err := r.update(id, func(repository *repositoryRecord) {
+		repository.Triggers = copyRepository(store.Repository{Triggers: triggers}).Triggers
+		repository.UpdatedAt = timestamp()
+	})
+	if err == store.ErrorNotFound {
+		return nil
+	}
+	return err
+}
+
+func (r *RepositoryStore) SetSettings(id store.RepositoryID, settings store.RepositorySettings) error {
+	return r.update(id, func(repository *repositoryRecord) {
+		repository.Settings = settings
+		repository.UpdatedAt = timestamp()
+	})
+}
+
+func (r *RepositoryStore) Get(id store.RepositoryID) (*store.Repository, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	record, ok := r.Database.repositories[id]
+	if !ok {
+		return nil, store.ErrorNotFound
+	}
+	repository := copyRepository(record.Repository)
+	return &repository, nil
+}
+
+func (r *RepositoryStore) Filter(filter string) ([]store.Repository, error) {
+	pattern, err := filterPattern(filter, true)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	repositories := []store.Repository{}
+	for _, record := range r.Database.repositories {
+		if pattern.MatchString(record.Name) || pattern.MatchString(record.Project) {
+			repositories = append(repositories, copyRepository(record.Repository))
+		}
+	}
+
+	sort.Slice(repositories, func(i, j int) bool {
+		if repositories[i].Project != repositories[j].Project {
+			return repositories[i].Project < repositories[j].Project
+		}
+		return repositories[i].Name < repositories[j].Name
+	})
+	return repositories, nil
+}
+
+func (r *RepositoryStore) Delete(id store.RepositoryID, hard bool) error {
+	if hard {
+		r.Database.mutex.Lock()
+		defer r.Database.mutex.Unlock()
+
+		delete(r.Database.repositories, id)
+		return nil
+	}
+
+	err := r.update(id, func(repository *repositoryRecord) {
+		now := timestamp()
+		repository.DeletedAt = &now
+	})
+	if err == store.ErrorNotFound {
+		return nil
+	}
+	return err
+}
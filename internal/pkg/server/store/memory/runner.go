@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"sort"
+)
+
+type EnrollmentTokenStore struct {
+	Database *Database
+}
+
+func (r *EnrollmentTokenStore) Add(token store.EnrollmentToken) (*store.EnrollmentToken, error) {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	token.ID = store.EnrollmentTokenID(r.Database.newID())
+	token.CreatedAt = timestamp()
+	r.Database.tokens[token.ID] = copyEnrollmentToken(token)
+	return &token, nil
+}
+
+func (r *EnrollmentTokenStore) Filter() ([]store.EnrollmentToken, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	tokens := []store.EnrollmentToken{}
+	for _, token := range r.Database.tokens {
+		tokens = append(tokens, copyEnrollmentToken(token))
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+		}
+		return tokens[i].ID > tokens[j].ID
+	})
+	return tokens, nil
+}
+
+func (r *EnrollmentTokenStore) Consume(hash string) (*store.EnrollmentToken, error) {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	now := timestamp()
+	for id, token := range r.Database.tokens {
+		if token.Hash != hash || token.UsedAt != nil || token.RevokedAt != nil || !token.ExpiresAt.After(now) {
+			continue
+		}
+
+		token.UsedAt = &now
+		r.Database.tokens[id] = token
+		token = copyEnrollmentToken(token)
+		return &token, nil
+	}
+	return nil, store.ErrorNotFound
+}
+
+func (r *EnrollmentTokenStore) Revoke(id store.EnrollmentTokenID) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	token, ok := r.Database.tokens[id]
+	if !ok || token.RevokedAt != nil {
+		return store.ErrorNotFound
+	}
+
+	now := timestamp()
+	token.RevokedAt = &now
+	r.Database.tokens[id] = token
+	return nil
+}
+
+func (r *EnrollmentTokenStore) Delete(id store.EnrollmentTokenID) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	delete(r.Database.tokens, id)
+	return nil
+}
@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/store"
+)
+
+type ScheduleStore struct {
+	Database *Database
+}
+
+func (r *ScheduleStore) Claim(run store.ScheduledRun) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	if last, ok := r.Database.scheduledRuns[run.ID()]; ok && !run.Tick.After(last.Tick) {
+		return store.ErrorConflict
+	}
+	r.Database.scheduledRuns[run.ID()] = run
+	return nil
+}
+
+func (r *ScheduleStore) Release(run store.ScheduledRun) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	if last, ok := r.Database.scheduledRuns[run.ID()]; ok && last.Tick.Equal(run.Tick) {
+		delete(r.Database.scheduledRuns, run.ID())
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sort"
+)
+
+type StageStore struct {
+	Database *Database
+}
+
+func (r *StageStore) AddOrUpdate(stage store.Stage) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	stages := r.Database.stages[stage.JobID]
+	for i, existing := range stages {
+		if existing.ID != stage.ID {
+			continue
+		}
+		if stage.StartedAt == nil {
+			stage.StartedAt = existing.StartedAt
+		}
+		if stage.StoppedAt == nil {
+			stage.StoppedAt = existing.StoppedAt
+		}
+		stages[i] = copyStage(stage)
+		return nil
+	}
+
+	r.Database.stages[stage.JobID] = append(stages, copyStage(stage))
+	return nil
+}
+
+func (r *StageStore) FindAllByJobID(jobID shared.JobID) ([]store.Stage, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	stages := []store.Stage{}
+	for _, stage := range r.Database.stages[jobID] {
+		stages = append(stages, copyStage(stage))
+	}
+
+	sort.SliceStable(stages, func(i, j int) bool {
+		a, b := stages[i].StartedAt, stages[j].StartedAt
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return a.Before(*b)
+	})
+	return stages, nil
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"sort"
+	"time"
+)
+
+type TokenStore struct {
+	Database *Database
+}
+
+func (r *TokenStore) Add(token store.PersonalToken) (*store.PersonalToken, error) {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	token.ID = store.PersonalTokenID(r.Database.newID())
+	token.CreatedAt = timestamp()
+	r.Database.personal[token.ID] = copyPersonalToken(token)
+	token = copyPersonalToken(token)
+	return &token, nil
+}
+
+func (r *TokenStore) FilterByUsername(username string) ([]store.PersonalToken, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	tokens := []store.PersonalToken{}
+	for _, token := range r.Database.personal {
+		if token.Username == username {
+			tokens = append(tokens, copyPersonalToken(token))
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+		}
+		return tokens[i].ID > tokens[j].ID
+	})
+	return tokens, nil
+}
+
+func (r *TokenStore) Use(hash string, t time.Time) (*store.PersonalToken, error) {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	for id, token := range r.Database.personal {
+		if token.Hash != hash || token.RevokedAt != nil || (token.ExpiresAt != nil && !token.ExpiresAt.After(t)) {
+			continue
+		}
+
+		if !token.RecentlyUsed(t) {
+			token.LastUsedAt = &t
+			r.Database.personal[id] = copyPersonalToken(token)
+		}
+		token = copyPersonalToken(token)
+		return &token, nil
+	}
+	return nil, store.ErrorNotFound
+}
+
+func (r *TokenStore) Revoke(username string, id store.PersonalTokenID) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	token, ok := r.Database.personal[id]
+	if !ok || token.Username != username || token.RevokedAt != nil {
+		return store.ErrorNotFound
+	}
+
+	now := timestamp()
+	token.RevokedAt = &now
+	r.Database.personal[id] = token
+	return nil
+}
+
+func (r *TokenStore) Delete(id store.PersonalTokenID) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	delete(r.Database.personal, id)
+	return nil
+}
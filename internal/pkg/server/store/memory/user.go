@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"go-brunel/internal/pkg/server/security"
+	"go-brunel/internal/pkg/server/store"
+	"sort"
+	"time"
+)
+
+// userRecord is a stored user, users are soft deleted so their name is kept on the jobs they started
+type userRecord struct {
+	store.User
+	DeletedAt *time.Time
+}
+
+type UserStore struct {
+	Database *Database
+}
+
+func (r *UserStore) Filter(filter string) ([]store.UserList, error) {
+	pattern, err := filterPattern(filter, true)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	users := []store.UserList{}
+	for _, user := range r.Database.users {
+		if pattern.MatchString(user.Username) || pattern.MatchString(user.Email) {
+			users = append(users, store.UserList{Username: user.Username, Role: user.Role})
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+func (r *UserStore) AddOrUpdate(user store.User) (*store.User, error) {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	record, ok := r.Database.users[user.Username]
+	if !ok {
+		record.Username = user.Username
+		record.Role = security.UserRoleReader
+		record.CreatedAt = timestamp()
+	}
+
+	// Empty fields keep their stored values, so signing in never clears a role or profile details
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{
+		{user.Email, &record.Email},
+		{user.Name, &record.Name},
+		{user.AvatarURL, &record.AvatarURL},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+	if user.Role != "" {
+		record.Role = user.Role
+	}
+	r.Database.users[user.Username] = record
+
+	updated := copyUser(record.User)
+	return &updated, nil
+}
+
+func (r *UserStore) GetByUsername(username string) (*store.User, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	record, ok := r.Database.users[username]
+	if !ok {
+		return nil, store.ErrorNotFound
+	}
+	user := copyUser(record.User)
+	return &user, nil
+}
+
+func (r *UserStore) SetNotificationPreferences(username string, preferences store.NotificationPreferences) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	record, ok := r.Database.users[username]
+	if !ok {
+		return store.ErrorNotFound
+	}
+
+	if preferences.Watching == nil {
+		preferences.Watching = []store.RepositoryID{}
+	}
+	record.Notifications = preferences
+	record.User = copyUser(record.User)
+	r.Database.users[username] = record
+	return nil
+}
+
+func (r *UserStore) FindWatchers(repositoryID store.RepositoryID) ([]store.User, error) {
+	r.Database.mutex.RLock()
+	defer r.Database.mutex.RUnlock()
+
+	users := []store.User{}
+	for _, record := range r.Database.users {
+		for _, watching := range record.Notifications.Watching {
+			if watching == repositoryID {
+				users = append(users, copyUser(record.User))
+				break
+			}
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+func (r *UserStore) Delete(username string, hard bool) error {
+	r.Database.mutex.Lock()
+	defer r.Database.mutex.Unlock()
+
+	if hard {
+		delete(r.Database.users, username)
+		return nil
+	}
+
+	if record, ok := r.Database.users[username]; ok {
+		now := timestamp()
+		record.DeletedAt = &now
+		r.Database.users[username] = record
+	}
+	return nil
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"go-brunel/internal/pkg/server/store"
 	"go-brunel/internal/pkg/shared"
+	"sort"
 	"time"
 
 	"github.com/mongodb/mongo-go-driver/bson"
 	"github.com/mongodb/mongo-go-driver/bson/primitive"
 	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
 	"github.com/mongodb/mongo-go-driver/x/bsonx"
 	"github.com/pkg/errors"
 )
@@ -35,38 +37,273 @@ type mongoJobUpdate struct {
 	StoppedBy *string          `bson:"stopped_by,omitempty"`
 }
 
-func (r *JobStore) Next() (*store.Job, error) {
+// candidate is the oldest waiting job of a repository, along with the repository's concurrency limit
+type candidate struct {
+	job   mongoJob
+	limit int
+}
+
+// nextCandidates returns the oldest waiting job of each repository that is below its concurrency limit, out of the
+// waiting jobs of those repositories with the highest priority. Repositories at their limit are left out before the
+// priority is compared, so their jobs never hold up the jobs of other repositories. Candidates are ordered so the repository that least recently had a job
+// claimed comes first, which stops one busy repository from starving the rest.
+func (r *JobStore) nextCandidates() ([]candidate, error) {
+	cursor, err := r.
+		Database.
+		Collection(jobCollectionName).
+		Aggregate(
+			context.Background(),
+			[]bson.M{
+				{"$match": bson.M{"state": shared.JobStateWaiting}},
+				{"$sort": bson.D{{Key: "priority", Value: -1}, {Key: "created_at", Value: 1}}},
+				{"$group": bson.M{"_id": "$repository_id", "job": bson.M{"$first": "$$ROOT"}}},
+			},
+		)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting waiting jobs")
+	}
+	defer cursor.Close(context.Background())
+
+	var jobs []mongoJob
+	for cursor.Next(context.Background()) {
+		var group struct {
+			Job mongoJob `bson:"job"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return nil, errors.Wrap(err, "error decoding waiting job")
+		}
+		jobs = append(jobs, group.Job)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, errors.Wrap(err, "error reading waiting jobs")
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(jobs))
+	for i, j := range jobs {
+		ids[i] = j.RepositoryID
+	}
+
+	repositories, err := r.
+		Database.
+		Collection(repositoryCollectionName).
+		Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting repositories of waiting jobs")
+	}
+	defer repositories.Close(context.Background())
+
+	dispatched := map[primitive.ObjectID]time.Time{}
+	limits := map[primitive.ObjectID]int{}
+	var limited []primitive.ObjectID
+	for repositories.Next(context.Background()) {
+		var repository struct {
+			ObjectID         primitive.ObjectID        `bson:"_id"`
+			LastDispatchedAt *time.Time                `bson:"last_dispatched_at"`
+			Settings         *store.RepositorySettings `bson:"settings"`
+		}
+		if err := repositories.Decode(&repository); err != nil {
+			return nil, errors.Wrap(err, "error decoding repository")
+		}
+		if repository.LastDispatchedAt != nil {
+			dispatched[repository.ObjectID] = *repository.LastDispatchedAt
+		}
+		if repository.Settings != nil && repository.Settings.MaxConcurrentJobs > 0 {
+			limits[repository.ObjectID] = repository.Settings.MaxConcurrentJobs
+			limited = append(limited, repository.ObjectID)
+		}
+	}
+	if err := repositories.Err(); err != nil {
+		return nil, errors.Wrap(err, "error reading repositories of waiting jobs")
+	}
+
+	processing, err := r.countProcessing(limited)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []candidate
+	for _, j := range jobs {
+		limit, ok := limits[j.RepositoryID]
+		if ok && processing[j.RepositoryID] >= limit {
+			continue
+		}
+		if len(candidates) > 0 && j.Priority < candidates[0].job.Priority {
+			continue
+		}
+		if len(candidates) > 0 && j.Priority > candidates[0].job.Priority {
+			candidates = nil
+		}
+		candidates = append(candidates, candidate{job: j, limit: limit})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := dispatched[candidates[i].job.RepositoryID], dispatched[candidates[j].job.RepositoryID]
+		if a.Equal(b) {
+			return candidates[i].job.CreatedAt.Before(candidates[j].job.CreatedAt)
+		}
+		return a.Before(b)
+	})
+	return candidates, nil
+}
+
+// countProcessing returns the number of jobs each of the repositories is processing
+func (r *JobStore) countProcessing(repositoryIDs []primitive.ObjectID) (map[primitive.ObjectID]int, error) {
+	counts := map[primitive.ObjectID]int{}
+	if len(repositoryIDs) == 0 {
+		return counts, nil
+	}
+
+	cursor, err := r.
+		Database.
+		Collection(jobCollectionName).
+		Aggregate(
+			context.Background(),
+			[]bson.M{
+				{"$match": bson.M{"repository_id": bson.M{"$in": repositoryIDs}, "state": shared.JobStateProcessing}},
+				{"$group": bson.M{"_id": "$repository_id", "count": bson.M{"$sum": 1}}},
+			},
+		)
+	if err != nil {
+		return nil, errors.Wrap(err, "error counting processing jobs")
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var count struct {
+			RepositoryID primitive.ObjectID `bson:"_id"`
+			Count        int                `bson:"count"`
+		}
+		if err := cursor.Decode(&count); err != nil {
+			return nil, errors.Wrap(err, "error decoding processing job count")
+		}
+		counts[count.RepositoryID] = count.Count
+	}
+	return counts, errors.Wrap(cursor.Err(), "error reading processing job counts")
+}
+
+// dispatch records that a job of the repository was claimed. For repositories with a concurrency limit false is
+// returned when the claim took the repository over its limit. Claims of a repository bump its dispatch version, and
+// a claim only stands when the processing jobs, counted after reading the version, are within the limit and no other
+// claim bumped the version in the meantime. So runners claiming jobs of a repository at the same moment are
+// serialised, and at most one of them can take its last free slot.
+func (r *JobStore) dispatch(repositoryID primitive.ObjectID, limit int, now time.Time) (bool, error) {
+	collection := r.Database.Collection(repositoryCollectionName)
+	for {
+		var repository struct {
+			DispatchVersion int64 `bson:"dispatch_version"`
+		}
+		err := collection.FindOne(context.Background(), bson.M{"_id": repositoryID}).Decode(&repository)
+		if err == mongo.ErrNoDocuments {
+			return true, nil
+		}
+		if err != nil {
+			return false, errors.Wrap(err, "error getting repository dispatch version")
+		}
+
+		if limit > 0 {
+			processing, err := r.countProcessing([]primitive.ObjectID{repositoryID})
+			if err != nil {
+				return false, err
+			}
+			if processing[repositoryID] > limit {
+				return false, nil
+			}
+		}
+
+		// The version is only written by claims, so repositories without one have never had a job claimed
+		filter := bson.M{"_id": repositoryID, "dispatch_version": repository.DispatchVersion}
+		if repository.DispatchVersion == 0 {
+			filter["dispatch_version"] = bson.M{"$exists": false}
+		}
+		result, err := collection.UpdateOne(
+			context.Background(),
+			filter,
+			bson.M{"$inc": bson.M{"dispatch_version": 1}, "$set": bson.M{"last_dispatched_at": now}},
+		)
+		if err != nil {
+			return false, errors.Wrap(err, "error recording repository dispatch")
+		}
+		if result.MatchedCount == 1 {
+			return true, nil
+		}
+	}
+}
+
+// claim moves a waiting job to processing for the runner, nil is returned when another runner claimed it first or
+// the repository reached its concurrency limit
+func (r *JobStore) claim(c candidate, runner string) (*store.Job, error) {
+	now := time.Now()
+
 	var job mongoJob
 	err := r.
 		Database.
 		Collection(jobCollectionName).
 		FindOneAndUpdate(
 			context.Background(),
-			bson.M{"state": shared.JobStateWaiting},
-			bson.M{"$set": bson.M{"state": shared.JobStateProcessing, "started_at": time.Now()}},
+			bson.M{"_id": c.job.ObjectID, "state": shared.JobStateWaiting},
+			bson.M{"$set": bson.M{"state": shared.JobStateProcessing, "started_at": now, "runner": runner}},
 		).
 		Decode(&job)
-
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
 	if err != nil {
-		if err != mongo.ErrNoDocuments {
-			return nil, errors.Wrap(err, "error getting next available job")
+		return nil, errors.Wrap(err, "error getting next available job")
+	}
+
+	// A job that can not be dispatched goes back to the queue, otherwise it would wait for the sweeper with no runner
+	dispatched, err := r.dispatch(job.RepositoryID, c.limit, now)
+	if err != nil || !dispatched {
+		_, e := r.
+			Database.
+			Collection(jobCollectionName).
+			UpdateOne(
+				context.Background(),
+				bson.M{"_id": job.ObjectID, "state": shared.JobStateProcessing, "runner": runner},
+				bson.M{"$set": bson.M{"state": shared.JobStateWaiting, "started_at": nil, "runner": ""}},
+			)
+		if e != nil {
+			return nil, errors.Wrap(e, "error returning job to the queue")
 		}
-		return nil, nil
+		return nil, err
 	}
+
 	job.Job.ID = shared.JobID(job.ObjectID.Hex())
 	job.Job.RepositoryID = store.RepositoryID(job.RepositoryID.Hex())
-	if job.EnvironmentID != nil {
-		e := shared.EnvironmentID(job.EnvironmentID.Hex())
-		job.Job.EnvironmentID = &e
-	}
+	job.Job.Runner = runner
 	if job.EnvironmentID != nil {
 		hex := shared.EnvironmentID(job.EnvironmentID.Hex())
 		job.Job.EnvironmentID = &hex
 	}
-
 	return &job.Job, nil
 }
 
+func (r *JobStore) Next(runner string) (*store.Job, error) {
+	for {
+		candidates, err := r.nextCandidates()
+		if err != nil {
+			return nil, err
+		}
+		if len(candidates) == 0 {
+			return nil, nil
+		}
+
+		// When every candidate was claimed by other runners in the meantime the queue is read again
+		for _, c := range candidates {
+			job, err := r.claim(c, runner)
+			if err != nil {
+				return nil, err
+			}
+			if job != nil {
+				return job, nil
+			}
+		}
+	}
+}
+
 func (r *JobStore) Get(id shared.JobID) (*store.Job, error) {
 	jobID, err := primitive.ObjectIDFromHex(string(id))
 	if err != nil {
@@ -159,6 +396,222 @@ func (r *JobStore) CancelByID(id shared.JobID, userID string) error {
 	return r.update(id, mongoJobUpdate{StoppedBy: &userID, State: &state})
 }
 
+func (r *JobStore) FindLatest(
+	repositoryID store.RepositoryID,
+	branch string,
+	environmentID *shared.EnvironmentID,
+	startedBy string,
+) (*store.Job, error) {
+	repositoryObjectID, err := primitive.ObjectIDFromHex(string(repositoryID))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing id")
+	}
+
+	filter := bson.M{
+		"repository_id":  repositoryObjectID,
+		"commit.branch":  branch,
+		"started_by":     startedBy,
+		"environment_id": nil,
+	}
+	if environmentID != nil {
+		environmentObjectID, err := primitive.ObjectIDFromHex(string(*environmentID))
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing id")
+		}
+		filter["environment_id"] = environmentObjectID
+	}
+
+	var mJob mongoJob
+	err = r.
+		Database.
+		Collection(jobCollectionName).
+		FindOne(
+			context.Background(),
+			filter,
+			&options.FindOneOptions{Sort: bson.M{"created_at": -1}},
+		).Decode(&mJob)
+	if err == mongo.ErrNoDocuments {
+		return nil, store.ErrorNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting latest job")
+	}
+
+	mJob.Job.ID = shared.JobID(mJob.ObjectID.Hex())
+	mJob.Job.RepositoryID = store.RepositoryID(mJob.RepositoryID.Hex())
+	if mJob.EnvironmentID != nil {
+		hex := shared.EnvironmentID(mJob.EnvironmentID.Hex())
+		mJob.Job.EnvironmentID = &hex
+	}
+	return &mJob.Job, nil
+}
+
+func (r *JobStore) find(filter bson.M) ([]store.Job, error) {
+	cursor, err := r.
+		Database.
+		Collection(jobCollectionName).
+		Find(
+			context.Background(),
+			filter,
+			&options.FindOptions{Sort: bson.M{"created_at": 1}},
+		)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting jobs")
+	}
+	defer cursor.Close(context.Background())
+
+	jobs := []store.Job{}
+	for cursor.Next(context.Background()) {
+		var mJob mongoJob
+		if err := cursor.Decode(&mJob); err != nil {
+			return nil, errors.Wrap(err, "error decoding job")
+		}
+		mJob.Job.ID = shared.JobID(mJob.ObjectID.Hex())
+		mJob.Job.RepositoryID = store.RepositoryID(mJob.RepositoryID.Hex())
+		if mJob.EnvironmentID != nil {
+			hex := shared.EnvironmentID(mJob.EnvironmentID.Hex())
+			mJob.Job.EnvironmentID = &hex
+		}
+		jobs = append(jobs, mJob.Job)
+	}
+	return jobs, errors.Wrap(cursor.Err(), "error reading jobs")
+}
+
+func (r *JobStore) FindPreviousCompleted(job store.Job) (*store.Job, error) {
+	repositoryObjectID, err := primitive.ObjectIDFromHex(string(job.RepositoryID))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing id")
+	}
+
+	filter := bson.M{
+		"repository_id":  repositoryObjectID,
+		"commit.branch":  job.Commit.Branch,
+		"environment_id": nil,
+		"created_at":     bson.M{"$lt": job.CreatedAt},
+		"state":          bson.M{"$in": []shared.JobState{shared.JobStateSuccess, shared.JobStateFailed}},
+	}
+	if job.EnvironmentID != nil {
+		environmentObjectID, err := primitive.ObjectIDFromHex(string(*job.EnvironmentID))
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing id")
+		}
+		filter["environment_id"] = environmentObjectID
+	}
+
+	var mJob mongoJob
+	err = r.
+		Database.
+		Collection(jobCollectionName).
+		FindOne(
+			context.Background(),
+			filter,
+			&options.FindOneOptions{Sort: bson.M{"created_at": -1}},
+		).Decode(&mJob)
+	if err == mongo.ErrNoDocuments {
+		return nil, store.ErrorNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting previous job")
+	}
+
+	mJob.Job.ID = shared.JobID(mJob.ObjectID.Hex())
+	mJob.Job.RepositoryID = store.RepositoryID(mJob.RepositoryID.Hex())
+	if mJob.EnvironmentID != nil {
+		hex := shared.EnvironmentID(mJob.EnvironmentID.Hex())
+		mJob.Job.EnvironmentID = &hex
+	}
+	return &mJob.Job, nil
+}
+
+func (r *JobStore) findActive(repositoryID store.RepositoryID, filter bson.M) ([]store.Job, error) {
+	repositoryObjectID, err := primitive.ObjectIDFromHex(string(repositoryID))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing id")
+	}
+
+	filter["repository_id"] = repositoryObjectID
+	filter["state"] = bson.M{"$in": []shared.JobState{shared.JobStateWaiting, shared.JobStateProcessing}}
+	return r.find(filter)
+}
+
+func (r *JobStore) FindActiveByBranch(repositoryID store.RepositoryID, branch string) ([]store.Job, error) {
+	return r.findActive(repositoryID, bson.M{"commit.branch": branch})
+}
+
+func (r *JobStore) FindActiveByPullRequest(repositoryID store.RepositoryID, number int64) ([]store.Job, error) {
+	return r.findActive(repositoryID, bson.M{"pull_request.number": number})
+}
+
+func (r *JobStore) FindProcessingStartedBefore(repositoryID store.RepositoryID, t time.Time) ([]store.Job, error) {
+	repositoryObjectID, err := primitive.ObjectIDFromHex(string(repositoryID))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing id")
+	}
+
+	return r.find(bson.M{
+		"repository_id": repositoryObjectID,
+		"state":         shared.JobStateProcessing,
+		"started_at":    bson.M{"$lt": t},
+	})
+}
+
+func (r *JobStore) ExpireWaitingCreatedBefore(
+	repositoryID store.RepositoryID,
+	t time.Time,
+	stoppedBy string,
+) ([]shared.JobID, error) {
+	repositoryObjectID, err := primitive.ObjectIDFromHex(string(repositoryID))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing id")
+	}
+
+	waiting, err := r.find(bson.M{
+		"repository_id": repositoryObjectID,
+		"state":         shared.JobStateWaiting,
+		"created_at":    bson.M{"$lt": t},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	expired := []shared.JobID{}
+	for _, job := range waiting {
+		objectID, err := primitive.ObjectIDFromHex(string(job.ID))
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing id")
+		}
+
+		// Only expire the job if a runner has not claimed it since it was read
+		result, err := r.
+			Database.
+			Collection(jobCollectionName).
+			UpdateOne(
+				context.Background(),
+				bson.M{"_id": objectID, "state": shared.JobStateWaiting},
+				bson.M{"$set": bson.M{"state": shared.JobStateExpired, "stopped_at": time.Now(), "stopped_by": stoppedBy}},
+			)
+		if err != nil {
+			return nil, errors.Wrap(err, "error expiring job")
+		}
+		if result.ModifiedCount > 0 {
+			expired = append(expired, job.ID)
+		}
+	}
+	return expired, nil
+}
+
+func (r *JobStore) FindStoppedByRepositoryID(repositoryID store.RepositoryID) ([]store.Job, error) {
+	repositoryObjectID, err := primitive.ObjectIDFromHex(string(repositoryID))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing id")
+	}
+
+	return r.find(bson.M{
+		"repository_id": repositoryObjectID,
+		"state":         bson.M{"$nin": []shared.JobState{shared.JobStateWaiting, shared.JobStateProcessing}},
+	})
+}
+
 func (r *JobStore) FilterByRepositoryID(
 	repositoryID store.RepositoryID,
 	filter string,
@@ -250,10 +703,35 @@ func (r *JobStore) Delete(id shared.JobID) error {
 		return err
 	}
 
+	ctx := context.Background()
+	containerIDs, err := r.
+		Database.
+		Collection(jobContainerCollectionName).
+		Distinct(ctx, "container_id", bson.M{"job_id": objectID})
+	if err != nil {
+		return errors.Wrap(err, "error getting job containers")
+	}
+
+	// Stages and notification deliveries reference the job by its hex id, the other collections by its object id
+	for _, d := range []struct {
+		collection string
+		filter     bson.M
+	}{
+		{jobContainerLogCollectionName, bson.M{"container_id": bson.M{"$in": containerIDs}}},
+		{jobLogCollectionName, bson.M{"job_id": objectID}},
+		{jobContainerCollectionName, bson.M{"job_id": objectID}},
+		{stageCollectionName, bson.M{"job_id": id}},
+		{notificationDeliveryCollectionName, bson.M{"job_id": id}},
+	} {
+		if _, err := r.Database.Collection(d.collection).DeleteMany(ctx, d.filter); err != nil {
+			return errors.Wrapf(err, "error deleting from %s", d.collection)
+		}
+	}
+
 	_, err = r.
 		Database.
 		Collection(jobCollectionName).
-		DeleteOne(context.Background(), bson.M{"_id": objectID})
+		DeleteOne(ctx, bson.M{"_id": objectID})
 
 	return errors.Wrap(err, "error deleting")
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 	"go-brunel/internal/pkg/server/store"
 	"go-brunel/internal/pkg/shared"
+	"strings"
 	"time"
 )
 
@@ -62,7 +63,7 @@ func (r *LogStore) FilterLogByJobIDFromTime(id shared.JobID, t time.Time) ([]sto
 		Aggregate(
 			context.Background(),
 			[]bson.M{
-				{"$match": bson.M{"job_id": objectId, "time": bson.M{"$gte": primitive.DateTime(t.Unix())}}},
+				{"$match": bson.M{"job_id": objectId, "time": bson.M{"$gte": t}}},
 				{"$sort": bson.M{"time": 1}},
 			},
 		)
@@ -91,7 +92,7 @@ func (r *LogStore) FilterContainerLogByContainerIDFromTime(id shared.ContainerID
 		Aggregate(
 			context.Background(),
 			[]bson.M{
-				{"$match": bson.M{"container_id": id, "time": bson.M{"$gte": primitive.DateTime(t.Unix())}}},
+				{"$match": bson.M{"container_id": id, "time": bson.M{"$gte": t}}},
 				{"$sort": bson.M{"time": 1}},
 			},
 		)
@@ -109,3 +110,139 @@ func (r *LogStore) FilterContainerLogByContainerIDFromTime(id shared.ContainerID
 	}
 	return logs, nil
 }
+
+// FindContainerIDs returns the ids of the containers with logs in the database, for moving them to chunk files
+func (r *LogStore) FindContainerIDs() ([]shared.ContainerID, error) {
+	values, err := r.
+		Database.
+		Collection(jobContainerLogCollectionName).
+		Distinct(context.Background(), "container_id", bson.M{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting container ids")
+	}
+
+	ids := []shared.ContainerID{}
+	for _, v := range values {
+		if id, ok := v.(string); ok {
+			ids = append(ids, shared.ContainerID(id))
+		}
+	}
+	return ids, nil
+}
+
+// DeleteContainerLogByContainerID deletes the logs of the container from the database
+func (r *LogStore) DeleteContainerLogByContainerID(id shared.ContainerID) error {
+	_, err := r.
+		Database.
+		Collection(jobContainerLogCollectionName).
+		DeleteMany(context.Background(), bson.M{"container_id": id})
+	return errors.Wrap(err, "error deleting container logs")
+}
+
+// searchFilter narrows the lines of a search through the text index of the messages, or through a regular expression,
+// the lines found are then checked against the pattern of the search
+func searchFilter(search store.LogSearch) bson.M {
+	if len(search.Terms) == 0 {
+		return bson.M{"message": bson.M{"$regex": search.Pattern.String()}}
+	}
+
+	phrases := make([]string, len(search.Terms))
+	for i, t := range search.Terms {
+		phrases[i] = `"` + t + `"`
+	}
+	return bson.M{"$text": bson.M{"$search": strings.Join(phrases, " ")}}
+}
+
+// SearchJobLogs finds the job log lines matching the search, counting the earlier lines of each match's job for its
+// line number
+func (r *LogStore) SearchJobLogs(search store.LogSearch) ([]store.LogMatch, int, error) {
+	ids := []primitive.ObjectID{}
+	for _, id := range search.JobIDs {
+		objectId, err := primitive.ObjectIDFromHex(string(id))
+		if err != nil {
+			return nil, 0, errors.Wrap(err, fmt.Sprintf("invalid job id '%s'", id))
+		}
+		ids = append(ids, objectId)
+	}
+
+	filter := searchFilter(search)
+	filter["job_id"] = bson.M{"$in": ids}
+	collection := r.Database.Collection(jobLogCollectionName)
+	cursor, err := collection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error searching logs")
+	}
+	defer cursor.Close(context.Background())
+
+	matches := []store.LogMatch{}
+	jobIDs := map[shared.JobID]primitive.ObjectID{}
+	for cursor.Next(context.Background()) {
+		var l mongoLog
+		if err := cursor.Decode(&l); err != nil {
+			return nil, 0, errors.Wrap(err, "error decoding log")
+		}
+		if search.Pattern.MatchString(l.Message) {
+			id := shared.JobID(l.JobID.Hex())
+			jobIDs[id] = l.JobID
+			matches = append(matches, store.LogMatch{JobID: id, StageID: l.StageID, Time: l.Time, Message: l.Message})
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, 0, errors.Wrap(err, "error reading logs")
+	}
+
+	count := len(matches)
+	matches = store.NewestLogMatches(matches, search.Limit)
+	for i, m := range matches {
+		earlier, err := collection.CountDocuments(
+			context.Background(),
+			bson.M{"job_id": jobIDs[m.JobID], "time": bson.M{"$lt": m.Time}},
+		)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "error counting log lines")
+		}
+		matches[i].Line = int(earlier) + 1
+	}
+	return matches, count, nil
+}
+
+// SearchContainerLogs finds the container log lines matching the search, counting the earlier lines of each match's
+// container for its line number
+func (r *LogStore) SearchContainerLogs(search store.LogSearch) ([]store.LogMatch, int, error) {
+	filter := searchFilter(search)
+	filter["container_id"] = bson.M{"$in": search.ContainerIDs}
+	collection := r.Database.Collection(jobContainerLogCollectionName)
+	cursor, err := collection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error searching container logs")
+	}
+	defer cursor.Close(context.Background())
+
+	matches := []store.LogMatch{}
+	for cursor.Next(context.Background()) {
+		var l store.ContainerLog
+		if err := cursor.Decode(&l); err != nil {
+			return nil, 0, errors.Wrap(err, "error decoding container log")
+		}
+		if search.Pattern.MatchString(l.Message) {
+			matches = append(matches, store.LogMatch{ContainerID: l.ContainerID, Time: l.Time, Message: l.Message})
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, 0, errors.Wrap(err, "error reading container logs")
+	}
+
+	count := len(matches)
+	matches = store.NewestLogMatches(matches, search.Limit)
+	for i, m := range matches {
+		earlier, err := collection.CountDocuments(
+			context.Background(),
+			bson.M{"container_id": m.ContainerID, "time": bson.M{"$lt": m.Time}},
+		)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "error counting container log lines")
+		}
+		matches[i].Line = int(earlier) + 1
+	}
+	return matches, count, nil
+}
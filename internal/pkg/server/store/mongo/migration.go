@@ -0,0 +1,188 @@
+package mongo
+
+import (
+	"context"
+	"go-brunel/internal/pkg/server/security"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+	"github.com/pkg/errors"
+)
+
+const (
+	migrationCollectionName = "migrations"
+)
+
+// Migration is a versioned change to the database, such as creating indexes or backfilling fields of documents
+// written by older versions. Migrations must be safe to apply again, servers starting together may both apply one
+// before either records it.
+type Migration struct {
+	Version     int
+	Description string
+	apply       func(ctx context.Context, database *mongo.Database) error
+}
+
+type mongoMigration struct {
+	Version     int       `bson:"version"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// index describes an index of a collection, indexes are named after their collection and purpose
+type index struct {
+	collection string
+	name       string
+	keys       bson.D
+}
+
+func createIndexes(indexes []index) func(ctx context.Context, database *mongo.Database) error {
+	return func(ctx context.Context, database *mongo.Database) error {
+		for _, i := range indexes {
+			if _, err := database.
+				Collection(i.collection).
+				Indexes().
+				CreateOne(ctx, mongo.IndexModel{Keys: i.keys, Options: options.Index().SetName(i.name)}); err != nil {
+				return errors.Wrapf(err, "error creating index %s", i.name)
+			}
+		}
+		return nil
+	}
+}
+
+// createTextIndexes creates text indexes of the message field, with the language set to none so words are indexed as
+// they were written rather than stemmed
+func createTextIndexes(indexes []index) func(ctx context.Context, database *mongo.Database) error {
+	return func(ctx context.Context, database *mongo.Database) error {
+		for _, i := range indexes {
+			if _, err := database.
+				Collection(i.collection).
+				Indexes().
+				CreateOne(ctx, mongo.IndexModel{
+					Keys:    i.keys,
+					Options: options.Index().SetName(i.name).SetDefaultLanguage("none"),
+				}); err != nil {
+				return errors.Wrapf(err, "error creating index %s", i.name)
+			}
+		}
+		return nil
+	}
+}
+
+// migrations are applied in order, applied migrations must never be changed so new ones are appended
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create indexes for job queue, job list, log and container queries",
+		apply: createIndexes([]index{
+			{jobCollectionName, "job_queue", bson.D{{Key: "state", Value: 1}, {Key: "priority", Value: -1}, {Key: "created_at", Value: 1}}},
+			{jobCollectionName, "job_repository", bson.D{{Key: "repository_id", Value: 1}, {Key: "created_at", Value: -1}}},
+			{jobCollectionName, "job_repository_state", bson.D{{Key: "repository_id", Value: 1}, {Key: "state", Value: 1}}},
+			{jobLogCollectionName, "job_log_job", bson.D{{Key: "job_id", Value: 1}, {Key: "time", Value: 1}}},
+			{jobContainerLogCollectionName, "job_container_log_container", bson.D{{Key: "container_id", Value: 1}, {Key: "time", Value: 1}}},
+			{jobContainerCollectionName, "job_container_container", bson.D{{Key: "container_id", Value: 1}}},
+			{jobContainerCollectionName, "job_container_job", bson.D{{Key: "job_id", Value: 1}, {Key: "created_at", Value: 1}}},
+			{stageCollectionName, "job_stage_job", bson.D{{Key: "job_id", Value: 1}, {Key: "id", Value: 1}}},
+			{repositoryCollectionName, "repository_name", bson.D{{Key: "project", Value: 1}, {Key: "name", Value: 1}}},
+			{userCollectionName, "user_username", bson.D{{Key: "username", Value: 1}}},
+			{userCollectionName, "user_watching", bson.D{{Key: "notifications.watching", Value: 1}}},
+			{enrollmentTokenCollectionName, "runner_enrollment_token_hash", bson.D{{Key: "hash", Value: 1}}},
+			{notificationDeliveryCollectionName, "notification_delivery_job", bson.D{{Key: "job_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		}),
+	},
+	{
+		// Jobs queued before priorities were added have no priority, which mongo sorts after every number
+		Version:     2,
+		Description: "backfill the priority of jobs queued before job priorities",
+		apply: func(ctx context.Context, database *mongo.Database) error {
+			_, err := database.
+				Collection(jobCollectionName).
+				UpdateMany(ctx, bson.M{"priority": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"priority": 0}})
+			return errors.Wrap(err, "error backfilling job priorities")
+		},
+	},
+	{
+		// Users created before roles were added have no role, new users are given the reader role
+		Version:     3,
+		Description: "backfill the role of users created before user roles",
+		apply: func(ctx context.Context, database *mongo.Database) error {
+			_, err := database.
+				Collection(userCollectionName).
+				UpdateMany(ctx, bson.M{"role": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"role": security.UserRoleReader}})
+			return errors.Wrap(err, "error backfilling user roles")
+		},
+	},
+	{
+		Version:     4,
+		Description: "create text indexes for log searches",
+		apply: createTextIndexes([]index{
+			{jobLogCollectionName, "job_log_message", bson.D{{Key: "message", Value: "text"}}},
+			{jobContainerLogCollectionName, "job_container_log_message", bson.D{{Key: "message", Value: "text"}}},
+		}),
+	},
+	{
+		Version:     5,
+		Description: "create indexes for personal token lookups",
+		apply: createIndexes([]index{
+			{personalTokenCollectionName, "user_personal_token_hash", bson.D{{Key: "hash", Value: 1}}},
+			{personalTokenCollectionName, "user_personal_token_username", bson.D{{Key: "username", Value: 1}, {Key: "created_at", Value: -1}}},
+		}),
+	},
+}
+
+// pendingMigrations returns the migrations not recorded in the migrations collection yet
+func pendingMigrations(ctx context.Context, database *mongo.Database) ([]Migration, error) {
+	cursor, err := database.Collection(migrationCollectionName).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting applied migrations")
+	}
+	defer cursor.Close(ctx)
+
+	applied := map[int]bool{}
+	for cursor.Next(ctx) {
+		var migration mongoMigration
+		if err := cursor.Decode(&migration); err != nil {
+			return nil, errors.Wrap(err, "error decoding applied migration")
+		}
+		applied[migration.Version] = true
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, errors.Wrap(err, "error reading applied migrations")
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies the migrations that have not been applied to the database yet, returning them. A dry run only
+// returns the migrations that would be applied.
+func Migrate(database *mongo.Database, dryRun bool) ([]Migration, error) {
+	ctx := context.Background()
+	pending, err := pendingMigrations(ctx, database)
+	if err != nil || dryRun {
+		return pending, err
+	}
+
+	for i, migration := range pending {
+		log.Infof("applying mongo migration %d: %s", migration.Version, migration.Description)
+		if err := migration.apply(ctx, database); err != nil {
+			return pending[:i], errors.Wrapf(err, "error applying migration %d", migration.Version)
+		}
+
+		if _, err := database.Collection(migrationCollectionName).InsertOne(ctx, mongoMigration{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now(),
+		}); err != nil {
+			return pending[:i], errors.Wrapf(err, "error recording migration %d", migration.Version)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,70 @@
+package mongo
+
+import (
+	"context"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/pkg/errors"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+)
+
+const (
+	notificationDeliveryCollectionName = "notification_delivery"
+)
+
+type NotificationDeliveryStore struct {
+	Database *mongo.Database
+}
+
+type mongoNotificationDelivery struct {
+	ObjectID                   primitive.ObjectID `bson:"_id,omitempty"`
+	store.NotificationDelivery `bson:",inline"`
+}
+
+func (r *NotificationDeliveryStore) Add(delivery store.NotificationDelivery) error {
+	_, err := r.
+		Database.
+		Collection(notificationDeliveryCollectionName).
+		InsertOne(context.Background(), mongoNotificationDelivery{NotificationDelivery: delivery})
+	return errors.Wrap(err, "error adding notification delivery")
+}
+
+func (r *NotificationDeliveryStore) Filter(
+	jobID shared.JobID,
+	pageIndex int64,
+	pageSize int64,
+) ([]store.NotificationDelivery, error) {
+	match := bson.M{}
+	if jobID != "" {
+		match["job_id"] = jobID
+	}
+
+	decoder, err := r.
+		Database.
+		Collection(notificationDeliveryCollectionName).
+		Aggregate(
+			context.Background(),
+			[]bson.M{
+				{"$match": match},
+				{"$sort": bson.M{"created_at": -1}},
+				{"$skip": pageIndex * pageSize},
+				{"$limit": pageSize},
+			},
+		)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching notification deliveries")
+	}
+
+	deliveries := []store.NotificationDelivery{}
+	for decoder.Next(context.Background()) {
+		var delivery mongoNotificationDelivery
+		if err := decoder.Decode(&delivery); err != nil {
+			return nil, errors.Wrap(err, "error decoding notification delivery")
+		}
+		delivery.NotificationDelivery.ID = store.NotificationDeliveryID(delivery.ObjectID.Hex())
+		deliveries = append(deliveries, delivery.NotificationDelivery)
+	}
+	return deliveries, nil
+}
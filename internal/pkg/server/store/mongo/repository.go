@@ -27,18 +27,25 @@ type mongoRepository struct {
 	Name      string                    `bson:"name"`
 	URI       string                    `bson:"uri"`
 	Triggers  []store.RepositoryTrigger `bson:",omitempty"`
+	Settings  *store.RepositorySettings `bson:"settings,omitempty"`
 	CreatedAt *time.Time                `bson:"created_at,omitempty"`
 	UpdatedAt time.Time                 `bson:"updated_at"`
 	DeletedAt *time.Time                `bson:"deleted_at" json:",omitempty"`
 }
 
 func (r *mongoRepository) ToRepository() *store.Repository {
+	settings := store.RepositorySettings{}
+	if r.Settings != nil {
+		settings = *r.Settings
+	}
+
 	return &store.Repository{
 		ID:        store.RepositoryID(r.ObjectID.Hex()),
 		Project:   r.Project,
 		Name:      r.Name,
 		URI:       r.URI,
 		Triggers:  r.Triggers,
+		Settings:  settings,
 		CreatedAt: *r.CreatedAt,
 		UpdatedAt: r.UpdatedAt,
 		DeletedAt: r.DeletedAt,
@@ -96,6 +103,32 @@ func (r *RepositoryStore) SetTriggers(id store.RepositoryID, triggers []store.Re
 	return nil
 }
 
+func (r *RepositoryStore) SetSettings(id store.RepositoryID, settings store.RepositorySettings) error {
+	objectID, err := primitive.ObjectIDFromHex(string(id))
+	if err != nil {
+		return errors.Wrap(err, "error parsing object id")
+	}
+
+	result, err := r.
+		Database.
+		Collection(repositoryCollectionName).
+		UpdateOne(
+			context.Background(),
+			bson.M{"_id": objectID},
+			bson.M{"$set": bson.M{
+				"settings":   settings,
+				"updated_at": time.Now(),
+			}},
+		)
+	if err != nil {
+		return errors.Wrap(err, "error setting repository settings")
+	}
+	if result.MatchedCount == 0 {
+		return store.ErrorNotFound
+	}
+	return nil
+}
+
 func (r *RepositoryStore) Get(id store.RepositoryID) (*store.Repository, error) {
 	objectID, err := primitive.ObjectIDFromHex(string(id))
 	if err != nil {
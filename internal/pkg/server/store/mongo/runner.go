@@ -0,0 +1,137 @@
+package mongo
+
+import (
+	"context"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+	"github.com/pkg/errors"
+	"go-brunel/internal/pkg/server/store"
+	"time"
+)
+
+const (
+	enrollmentTokenCollectionName = "runner_enrollment_token"
+)
+
+type EnrollmentTokenStore struct {
+	Database *mongo.Database
+}
+
+type mongoEnrollmentToken struct {
+	ObjectID              primitive.ObjectID `bson:"_id,omitempty"`
+	store.EnrollmentToken `bson:",inline"`
+}
+
+func (t *mongoEnrollmentToken) ToEnrollmentToken() *store.EnrollmentToken {
+	t.EnrollmentToken.ID = store.EnrollmentTokenID(t.ObjectID.Hex())
+	return &t.EnrollmentToken
+}
+
+func (r *EnrollmentTokenStore) Add(token store.EnrollmentToken) (*store.EnrollmentToken, error) {
+	mToken := mongoEnrollmentToken{EnrollmentToken: token}
+	mToken.CreatedAt = time.Now()
+
+	result, err := r.
+		Database.
+		Collection(enrollmentTokenCollectionName).
+		InsertOne(context.Background(), mToken)
+	if err != nil {
+		return nil, errors.Wrap(err, "error adding enrollment token")
+	}
+
+	mToken.ObjectID = result.InsertedID.(primitive.ObjectID)
+	return mToken.ToEnrollmentToken(), nil
+}
+
+func (r *EnrollmentTokenStore) Filter() ([]store.EnrollmentToken, error) {
+	tokens := []store.EnrollmentToken{}
+	decoder, err := r.
+		Database.
+		Collection(enrollmentTokenCollectionName).
+		Aggregate(
+			context.Background(),
+			[]bson.M{
+				{"$sort": bson.M{"created_at": -1}},
+			},
+		)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching enrollment tokens")
+	}
+
+	for decoder.Next(context.Background()) {
+		var token mongoEnrollmentToken
+		if err := decoder.Decode(&token); err != nil {
+			return nil, errors.Wrap(err, "error decoding enrollment token")
+		}
+		tokens = append(tokens, *token.ToEnrollmentToken())
+	}
+	return tokens, nil
+}
+
+func (r *EnrollmentTokenStore) Consume(hash string) (*store.EnrollmentToken, error) {
+	var token mongoEnrollmentToken
+	now := time.Now()
+	after := options.After
+	err := r.
+		Database.
+		Collection(enrollmentTokenCollectionName).
+		FindOneAndUpdate(
+			context.Background(),
+			bson.M{
+				"hash":       hash,
+				"used_at":    nil,
+				"revoked_at": nil,
+				"expires_at": bson.M{"$gt": now},
+			},
+			bson.M{"$set": bson.M{"used_at": now}},
+			&options.FindOneAndUpdateOptions{ReturnDocument: &after},
+		).
+		Decode(&token)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, store.ErrorNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error consuming enrollment token")
+	}
+	return token.ToEnrollmentToken(), nil
+}
+
+func (r *EnrollmentTokenStore) Revoke(id store.EnrollmentTokenID) error {
+	objectID, err := primitive.ObjectIDFromHex(string(id))
+	if err != nil {
+		return errors.Wrap(err, "error parsing id")
+	}
+
+	result, err := r.
+		Database.
+		Collection(enrollmentTokenCollectionName).
+		UpdateOne(
+			context.Background(),
+			bson.M{"_id": objectID, "revoked_at": nil},
+			bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+		)
+	if err != nil {
+		return errors.Wrap(err, "error revoking enrollment token")
+	}
+	if result.MatchedCount == 0 {
+		return store.ErrorNotFound
+	}
+	return nil
+}
+
+func (r *EnrollmentTokenStore) Delete(id store.EnrollmentTokenID) error {
+	objectID, err := primitive.ObjectIDFromHex(string(id))
+	if err != nil {
+		return err
+	}
+
+	_, err = r.
+		Database.
+		Collection(enrollmentTokenCollectionName).
+		DeleteOne(context.Background(), bson.M{"_id": objectID})
+
+	return errors.Wrap(err, "error deleting")
+}
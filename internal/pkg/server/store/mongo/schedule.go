@@ -0,0 +1,58 @@
+package mongo
+
+import (
+	"context"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+	"github.com/pkg/errors"
+	"go-brunel/internal/pkg/server/store"
+)
+
+const (
+	scheduledRunCollectionName = "repository_scheduled_run"
+
+	duplicateKeyCode = 11000
+)
+
+type ScheduleStore struct {
+	Database *mongo.Database
+}
+
+// isDuplicateKey checks if a write failed because a document with the same unique key exists
+func isDuplicateKey(err error) bool {
+	if e, ok := err.(mongo.WriteException); ok {
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKeyCode {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *ScheduleStore) Claim(run store.ScheduledRun) error {
+	// When the trigger already ran at or after the tick the filter matches nothing, and the upsert fails inserting a
+	// second document with the id
+	_, err := r.
+		Database.
+		Collection(scheduledRunCollectionName).
+		UpdateOne(
+			context.Background(),
+			bson.M{"_id": run.ID(), "tick": bson.M{"$lt": run.Tick}},
+			bson.M{"$set": run},
+			options.Update().SetUpsert(true),
+		)
+	if isDuplicateKey(err) {
+		return store.ErrorConflict
+	}
+	return errors.Wrap(err, "error claiming scheduled run")
+}
+
+func (r *ScheduleStore) Release(run store.ScheduledRun) error {
+	_, err := r.
+		Database.
+		Collection(scheduledRunCollectionName).
+		DeleteOne(context.Background(), bson.M{"_id": run.ID(), "tick": run.Tick})
+	return errors.Wrap(err, "error releasing scheduled run")
+}
@@ -0,0 +1,157 @@
+package mongo
+
+import (
+	"context"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/primitive"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/pkg/errors"
+	"go-brunel/internal/pkg/server/store"
+	"time"
+)
+
+const (
+	personalTokenCollectionName = "user_personal_token"
+)
+
+type TokenStore struct {
+	Database *mongo.Database
+}
+
+type mongoPersonalToken struct {
+	ObjectID            primitive.ObjectID `bson:"_id,omitempty"`
+	store.PersonalToken `bson:",inline"`
+}
+
+func (t *mongoPersonalToken) ToPersonalToken() *store.PersonalToken {
+	t.PersonalToken.ID = store.PersonalTokenID(t.ObjectID.Hex())
+	return &t.PersonalToken
+}
+
+func (r *TokenStore) Add(token store.PersonalToken) (*store.PersonalToken, error) {
+	mToken := mongoPersonalToken{PersonalToken: token}
+	mToken.CreatedAt = time.Now()
+
+	result, err := r.
+		Database.
+		Collection(personalTokenCollectionName).
+		InsertOne(context.Background(), mToken)
+	if err != nil {
+		return nil, errors.Wrap(err, "error adding personal token")
+	}
+
+	mToken.ObjectID = result.InsertedID.(primitive.ObjectID)
+	return mToken.ToPersonalToken(), nil
+}
+
+func (r *TokenStore) FilterByUsername(username string) ([]store.PersonalToken, error) {
+	tokens := []store.PersonalToken{}
+	decoder, err := r.
+		Database.
+		Collection(personalTokenCollectionName).
+		Aggregate(
+			context.Background(),
+			[]bson.M{
+				{"$match": bson.M{"username": username}},
+				{"$sort": bson.M{"created_at": -1}},
+			},
+		)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching personal tokens")
+	}
+
+	for decoder.Next(context.Background()) {
+		var token mongoPersonalToken
+		if err := decoder.Decode(&token); err != nil {
+			return nil, errors.Wrap(err, "error decoding personal token")
+		}
+		tokens = append(tokens, *token.ToPersonalToken())
+	}
+	return tokens, nil
+}
+
+func (r *TokenStore) Use(hash string, t time.Time) (*store.PersonalToken, error) {
+	var token mongoPersonalToken
+	err := r.
+		Database.
+		Collection(personalTokenCollectionName).
+		FindOne(
+			context.Background(),
+			bson.M{
+				"hash":       hash,
+				"revoked_at": nil,
+				"$or": []bson.M{
+					{"expires_at": nil},
+					{"expires_at": bson.M{"$gt": t}},
+				},
+			},
+		).
+		Decode(&token)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, store.ErrorNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error using personal token")
+	}
+	if token.RecentlyUsed(t) {
+		return token.ToPersonalToken(), nil
+	}
+
+	_, err = r.
+		Database.
+		Collection(personalTokenCollectionName).
+		UpdateOne(
+			context.Background(),
+			bson.M{
+				"_id": token.ObjectID,
+				"$or": []bson.M{
+					{"last_used_at": nil},
+					{"last_used_at": bson.M{"$lt": t}},
+				},
+			},
+			bson.M{"$set": bson.M{"last_used_at": t}},
+		)
+	if err != nil {
+		return nil, errors.Wrap(err, "error using personal token")
+	}
+	token.LastUsedAt = &t
+	return token.ToPersonalToken(), nil
+}
+
+func (r *TokenStore) Revoke(username string, id store.PersonalTokenID) error {
+	objectID, err := primitive.ObjectIDFromHex(string(id))
+	if err != nil {
+		return store.ErrorNotFound
+	}
+
+	result, err := r.
+		Database.
+		Collection(personalTokenCollectionName).
+		UpdateOne(
+			context.Background(),
+			bson.M{"_id": objectID, "username": username, "revoked_at": nil},
+			bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+		)
+	if err != nil {
+		return errors.Wrap(err, "error revoking personal token")
+	}
+	if result.MatchedCount == 0 {
+		return store.ErrorNotFound
+	}
+	return nil
+}
+
+func (r *TokenStore) Delete(id store.PersonalTokenID) error {
+	objectID, err := primitive.ObjectIDFromHex(string(id))
+	if err != nil {
+		return err
+	}
+
+	_, err = r.
+		Database.
+		Collection(personalTokenCollectionName).
+		DeleteOne(context.Background(), bson.M{"_id": objectID})
+
+	return errors.Wrap(err, "error deleting")
+}
@@ -28,16 +28,25 @@ type mongoUser struct {
 	AvatarURL string            `bson:"avatar_url,omitempty"`
 	Role      security.UserRole `bson:"role,omitempty"`
 	CreatedAt *time.Time        `bson:"created_at,omitempty"`
+
+	// Notifications are omitted when empty so signing in does not reset them
+	Notifications *store.NotificationPreferences `bson:"notifications,omitempty"`
 }
 
 func (u *mongoUser) ToUser() *store.User {
+	notifications := store.NotificationPreferences{}
+	if u.Notifications != nil {
+		notifications = *u.Notifications
+	}
+
 	return &store.User{
-		Username:  u.Username,
-		Email:     u.Email,
-		Name:      u.Name,
-		AvatarURL: u.AvatarURL,
-		Role:      u.Role,
-		CreatedAt: *u.CreatedAt,
+		Username:      u.Username,
+		Email:         u.Email,
+		Name:          u.Name,
+		AvatarURL:     u.AvatarURL,
+		Role:          u.Role,
+		Notifications: notifications,
+		CreatedAt:     *u.CreatedAt,
 	}
 }
 
@@ -130,6 +139,49 @@ func (r *UserStore) GetByUsername(username string) (*store.User, error) {
 	return f.ToUser(), nil
 }
 
+func (r *UserStore) SetNotificationPreferences(username string, preferences store.NotificationPreferences) error {
+	if preferences.Watching == nil {
+		preferences.Watching = []store.RepositoryID{}
+	}
+
+	result, err := r.
+		Database.
+		Collection(userCollectionName).
+		UpdateOne(
+			context.Background(),
+			bson.M{"username": username},
+			bson.M{"$set": bson.M{"notifications": preferences}},
+		)
+	if err != nil {
+		return errors.Wrap(err, "error setting notification preferences")
+	}
+	if result.MatchedCount == 0 {
+		return store.ErrorNotFound
+	}
+	return nil
+}
+
+func (r *UserStore) FindWatchers(repositoryID store.RepositoryID) ([]store.User, error) {
+	cursor, err := r.
+		Database.
+		Collection(userCollectionName).
+		Find(context.Background(), bson.M{"notifications.watching": repositoryID})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting repository watchers")
+	}
+	defer cursor.Close(context.Background())
+
+	users := []store.User{}
+	for cursor.Next(context.Background()) {
+		var user mongoUser
+		if err := cursor.Decode(&user); err != nil {
+			return nil, errors.Wrap(err, "error decoding user")
+		}
+		users = append(users, *user.ToUser())
+	}
+	return users, errors.Wrap(cursor.Err(), "error reading repository watchers")
+}
+
 func (r *UserStore) Delete(username string, hard bool) error {
 	if hard {
 		_, err := r.
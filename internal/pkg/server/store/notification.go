@@ -0,0 +1,29 @@
+package store
+
+import (
+	"go-brunel/internal/pkg/shared"
+	"time"
+)
+
+type NotificationDeliveryID string
+
+// NotificationDelivery records a single attempt at delivering a notification, kept for debugging notifiers
+type NotificationDelivery struct {
+	ID         NotificationDeliveryID `bson:"-"`
+	JobID      shared.JobID           `bson:"job_id"`
+	URL        string                 `bson:"url"`
+	Attempt    int                    `bson:"attempt"`
+	StatusCode int                    `bson:"status_code"`
+	Error      string                 `bson:"error,omitempty"`
+
+	// Duration is how long the request took in milliseconds
+	Duration  int64     `bson:"duration"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+type NotificationDeliveryStore interface {
+	Add(delivery NotificationDelivery) error
+
+	// Filter returns a page of deliveries, newest first, optionally restricted to those of a job
+	Filter(jobID shared.JobID, pageIndex int64, pageSize int64) ([]NotificationDelivery, error)
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type ContainerStore struct {
+	DB *sql.DB
+}
+
+func (r *ContainerStore) Add(c store.Container) error {
+	spec, err := jsonValue(c.Spec)
+	if err != nil {
+		return err
+	}
+	meta, err := jsonValue(c.Meta)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.DB.Exec(`
+		INSERT INTO job_container (id, job_id, container_id, state, spec, meta, created_at, started_at, stopped_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		newID(),
+		c.JobID,
+		c.ContainerID,
+		c.State,
+		spec,
+		meta,
+		c.CreatedAt,
+		c.StartedAt,
+		c.StoppedAt,
+	)
+	return errors.Wrap(err, "error adding container")
+}
+
+func (r *ContainerStore) update(id shared.ContainerID, column string, value interface{}) error {
+	_, err := r.DB.Exec(`UPDATE job_container SET `+column+` = $1 WHERE container_id = $2`, value, id)
+	return errors.Wrap(err, "error updating container")
+}
+
+func (r *ContainerStore) UpdateStateByContainerID(id shared.ContainerID, state shared.ContainerState) error {
+	return r.update(id, "state", state)
+}
+
+func (r *ContainerStore) UpdateStoppedAtByContainerID(id shared.ContainerID, t time.Time) error {
+	return r.update(id, "stopped_at", t)
+}
+
+func (r *ContainerStore) UpdateStartedAtByContainerID(id shared.ContainerID, t time.Time) error {
+	return r.update(id, "started_at", t)
+}
+
+func (r *ContainerStore) GetContainerState(id shared.ContainerID) (*shared.ContainerState, error) {
+	var state shared.ContainerState
+	err := r.DB.QueryRow(`SELECT state FROM job_container WHERE container_id = $1 LIMIT 1`, id).Scan(&state)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("could not find container")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting container state")
+	}
+	return &state, nil
+}
+
+func (r *ContainerStore) FilterByJobID(jobID shared.JobID) ([]store.Container, error) {
+	containers := []store.Container{}
+	rows, err := r.DB.Query(`
+		SELECT id, job_id, container_id, state, spec, meta, created_at, started_at, stopped_at
+		FROM job_container WHERE job_id = $1 ORDER BY created_at`,
+		jobID,
+	)
+	if err != nil {
+		return containers, errors.Wrap(err, "error getting containers")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c store.Container
+		var spec, meta []byte
+		if err := rows.Scan(
+			&c.ID,
+			&c.JobID,
+			&c.ContainerID,
+			&c.State,
+			&spec,
+			&meta,
+			&c.CreatedAt,
+			&c.StartedAt,
+			&c.StoppedAt,
+		); err != nil {
+			return containers, errors.Wrap(err, "error decoding container")
+		}
+		if err := json.Unmarshal(spec, &c.Spec); err != nil {
+			return containers, errors.Wrap(err, "error decoding container spec")
+		}
+		if err := json.Unmarshal(meta, &c.Meta); err != nil {
+			return containers, errors.Wrap(err, "error decoding container meta")
+		}
+		containers = append(containers, c)
+	}
+	return containers, errors.Wrap(rows.Err(), "error reading containers")
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const environmentColumns = `id, name, variables, created_at, updated_at, deleted_at`
+
+type EnvironmentStore struct {
+	DB *sql.DB
+}
+
+func scanEnvironment(row scanner) (*store.Environment, error) {
+	var environment store.Environment
+	var variables []byte
+	if err := row.Scan(
+		&environment.ID,
+		&environment.Name,
+		&variables,
+		&environment.CreatedAt,
+		&environment.UpdatedAt,
+		&environment.DeletedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(variables, &environment.Variables); err != nil {
+		return nil, errors.Wrap(err, "error decoding environment variables")
+	}
+	return &environment, nil
+}
+
+func (s *EnvironmentStore) Get(id shared.EnvironmentID) (*store.Environment, error) {
+	environment, err := scanEnvironment(
+		s.DB.QueryRow(`SELECT `+environmentColumns+` FROM environment WHERE id = $1`, id),
+	)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrorNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting environment")
+	}
+	return environment, nil
+}
+
+func (s *EnvironmentStore) nameIsUnique(id shared.EnvironmentID, name string) error {
+	var existing shared.EnvironmentID
+	err := s.DB.QueryRow(`SELECT id FROM environment WHERE name = $1`, name).Scan(&existing)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "error checking if name is unique")
+	}
+
+	if existing != id {
+		return errors.New("environment name must be unique")
+	}
+	return nil
+}
+
+func (s *EnvironmentStore) AddOrUpdate(environment store.Environment) (*store.Environment, error) {
+	if e := s.nameIsUnique(environment.ID, environment.Name); e != nil {
+		return nil, e
+	}
+
+	if environment.Variables == nil {
+		environment.Variables = []store.EnvironmentVariable{}
+	}
+	variables, err := jsonValue(environment.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	id := environment.ID
+	conflict := "name"
+	if id == "" {
+		id = shared.EnvironmentID(newID())
+	} else {
+		conflict = "id"
+	}
+
+	updated, err := scanEnvironment(s.DB.QueryRow(`
+		INSERT INTO environment (id, name, variables, created_at, updated_at) VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (`+conflict+`) DO UPDATE SET
+			name = EXCLUDED.name,
+			variables = EXCLUDED.variables,
+			updated_at = EXCLUDED.updated_at
+		RETURNING `+environmentColumns,
+		id,
+		environment.Name,
+		variables,
+		time.Now(),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "error adding or updating environment")
+	}
+	return updated, nil
+}
+
+func (s *EnvironmentStore) Filter(filter string) ([]store.EnvironmentList, error) {
+	rows, err := s.DB.Query(`SELECT id, name FROM environment WHERE name ~* $1 ORDER BY name`, filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching environment list")
+	}
+	defer rows.Close()
+
+	environments := []store.EnvironmentList{}
+	for rows.Next() {
+		var environment store.EnvironmentList
+		if err := rows.Scan(&environment.ID, &environment.Name); err != nil {
+			return nil, errors.Wrap(err, "error decoding environment list")
+		}
+		environments = append(environments, environment)
+	}
+	return environments, errors.Wrap(rows.Err(), "error reading environment list")
+}
+
+func (s *EnvironmentStore) GetVariable(id shared.EnvironmentID, name string) (*string, error) {
+	env, err := s.Get(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting environment")
+	}
+
+	for _, v := range env.Variables {
+		if v.Name == name {
+			return &v.Value, nil
+		}
+	}
+
+	return nil, errors.New("environment variable not found")
+}
+
+func (s *EnvironmentStore) Delete(id shared.EnvironmentID, hard bool) error {
+	if hard {
+		_, err := s.DB.Exec(`DELETE FROM environment WHERE id = $1`, id)
+		return errors.Wrap(err, "error deleting")
+	}
+
+	_, err := s.DB.Exec(`UPDATE environment SET deleted_at = $1 WHERE id = $2`, time.Now(), id)
+	return errors.Wrap(err, "error soft deleting")
+}
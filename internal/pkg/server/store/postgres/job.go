@@ -0,0 +1,422 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const jobColumns = `
+	job.id, job.repository_id, job.environment_id, job.branch, job.revision, job.state, job.started_by, job.runner,
+	job.stopped_by, job.created_at, job.started_at, job.stopped_at, job.parameters, job.pull_request,
+	job.changed_files, job.priority`
+
+// maxClaimAttempts bounds how often Next looks for another job after a claim took a repository over its limit
+const maxClaimAttempts = 5
+
+var errorOverLimit = errors.New("repository is over its concurrency limit")
+
+type JobStore struct {
+	DB *sql.DB
+}
+
+func scanJob(row scanner) (*store.Job, error) {
+	var job store.Job
+	var environmentID, stoppedBy *string
+	var parameters, pullRequest, changedFiles []byte
+
+	if err := row.Scan(
+		&job.ID,
+		&job.RepositoryID,
+		&environmentID,
+		&job.Commit.Branch,
+		&job.Commit.Revision,
+		&job.State,
+		&job.StartedBy,
+		&job.Runner,
+		&stoppedBy,
+		&job.CreatedAt,
+		&job.StartedAt,
+		&job.StoppedAt,
+		&parameters,
+		&pullRequest,
+		&changedFiles,
+		&job.Priority,
+	); err != nil {
+		return nil, err
+	}
+
+	if environmentID != nil {
+		id := shared.EnvironmentID(*environmentID)
+		job.EnvironmentID = &id
+	}
+	job.StoppedBy = stoppedBy
+
+	for _, column := range []struct {
+		value  []byte
+		target interface{}
+	}{
+		{parameters, &job.Parameters},
+		{pullRequest, &job.PullRequest},
+		{changedFiles, &job.ChangedFiles},
+	} {
+		if column.value == nil {
+			continue
+		}
+		if err := json.Unmarshal(column.value, column.target); err != nil {
+			return nil, errors.Wrap(err, "error decoding job")
+		}
+	}
+	return &job, nil
+}
+
+func (r *JobStore) find(query string, args ...interface{}) ([]store.Job, error) {
+	rows, err := r.DB.Query(`SELECT `+jobColumns+` FROM job `+query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting jobs")
+	}
+	defer rows.Close()
+
+	jobs := []store.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding job")
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, errors.Wrap(rows.Err(), "error reading jobs")
+}
+
+func (r *JobStore) findOne(query string, args ...interface{}) (*store.Job, error) {
+	job, err := scanJob(r.DB.QueryRow(`SELECT `+jobColumns+` FROM job `+query, args...))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrorNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting job")
+	}
+	return job, nil
+}
+
+// Next claims the next job, picked in a single statement. Waiting jobs of repositories below their concurrency limit are
+// ordered by priority, then by when their repository last had a job claimed and then by age, and rows locked by
+// other runners claiming at the same moment are skipped rather than waited on. Runners claiming jobs of the same
+// repository at the same moment can both see it below its limit, so the claim locks the repository row and counts
+// its processing jobs again, giving the job back when the repository went over its limit.
+func (r *JobStore) Next(runner string) (*store.Job, error) {
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		job, err := r.claim(runner)
+		if err != errorOverLimit {
+			return job, err
+		}
+	}
+	return nil, nil
+}
+
+func (r *JobStore) claim(runner string) (*store.Job, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting transaction")
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	job, err := scanJob(tx.QueryRow(`
+		UPDATE job SET state = $1, started_at = $2, runner = $3
+		WHERE id = (
+			SELECT candidate.id FROM job candidate
+			LEFT JOIN repository ON repository.id = candidate.repository_id
+			WHERE candidate.state = $4 AND (
+				COALESCE((repository.settings ->> 'MaxConcurrentJobs')::INTEGER, 0) <= 0 OR
+				(repository.settings ->> 'MaxConcurrentJobs')::INTEGER > (
+					SELECT COUNT(*) FROM job processing
+					WHERE processing.repository_id = candidate.repository_id AND processing.state = $1
+				)
+			)
+			ORDER BY candidate.priority DESC, repository.last_dispatched_at ASC NULLS FIRST, candidate.created_at ASC
+			LIMIT 1
+			FOR UPDATE OF candidate SKIP LOCKED
+		)
+		RETURNING `+jobColumns,
+		shared.JobStateProcessing,
+		now,
+		runner,
+		shared.JobStateWaiting,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting next available job")
+	}
+
+	// Updating the repository locks its row until the claim commits, and the count that follows sees the jobs of
+	// any claim of the repository that committed while this one waited
+	if _, err := tx.Exec(
+		`UPDATE repository SET last_dispatched_at = $1 WHERE id = $2`,
+		now,
+		job.RepositoryID,
+	); err != nil {
+		return nil, errors.Wrap(err, "error recording repository dispatch")
+	}
+
+	var overLimit bool
+	err = tx.QueryRow(`
+		SELECT COALESCE((settings ->> 'MaxConcurrentJobs')::INTEGER, 0) > 0 AND
+			(settings ->> 'MaxConcurrentJobs')::INTEGER < (
+				SELECT COUNT(*) FROM job WHERE repository_id = $1 AND state = $2
+			)
+		FROM repository WHERE id = $1`,
+		job.RepositoryID,
+		shared.JobStateProcessing,
+	).Scan(&overLimit)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "error counting processing jobs")
+	}
+	if overLimit {
+		return nil, errorOverLimit
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "error claiming job")
+	}
+	return job, nil
+}
+
+func (r *JobStore) Get(id shared.JobID) (*store.Job, error) {
+	return r.findOne(`WHERE id = $1`, id)
+}
+
+func (r *JobStore) Add(j store.Job) (*store.Job, error) {
+	j.ID = shared.JobID(newID())
+	j.CreatedAt = time.Now()
+
+	var values []interface{}
+	for _, v := range []interface{}{j.Parameters, j.PullRequest, j.ChangedFiles} {
+		value, err := jsonValue(v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	var pullRequestNumber *int64
+	if j.PullRequest != nil {
+		pullRequestNumber = &j.PullRequest.Number
+	}
+
+	if _, err := r.DB.Exec(`
+		INSERT INTO job (
+			id, repository_id, environment_id, branch, revision, state, started_by, runner, stopped_by, created_at,
+			started_at, stopped_at, parameters, pull_request, pull_request_number, changed_files, priority
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
+		j.ID,
+		j.RepositoryID,
+		j.EnvironmentID,
+		j.Commit.Branch,
+		j.Commit.Revision,
+		j.State,
+		j.StartedBy,
+		j.Runner,
+		j.StoppedBy,
+		j.CreatedAt,
+		j.StartedAt,
+		j.StoppedAt,
+		values[0],
+		values[1],
+		pullRequestNumber,
+		values[2],
+		j.Priority,
+	); err != nil {
+		return nil, errors.Wrap(err, "error adding job")
+	}
+	return &j, nil
+}
+
+func (r *JobStore) UpdateStoppedAtByID(id shared.JobID, t time.Time) error {
+	_, err := r.DB.Exec(`UPDATE job SET stopped_at = $1 WHERE id = $2`, t, id)
+	return errors.Wrap(err, "error setting job state")
+}
+
+func (r *JobStore) UpdateStateByID(id shared.JobID, s shared.JobState) error {
+	_, err := r.DB.Exec(`UPDATE job SET state = $1 WHERE id = $2`, s, id)
+	return errors.Wrap(err, "error setting job state")
+}
+
+func (r *JobStore) CancelByID(id shared.JobID, userID string) error {
+	_, err := r.DB.Exec(
+		`UPDATE job SET state = $1, stopped_by = $2 WHERE id = $3`,
+		shared.JobStateCancelled,
+		userID,
+		id,
+	)
+	return errors.Wrap(err, "error setting job state")
+}
+
+func (r *JobStore) FindLatest(
+	repositoryID store.RepositoryID,
+	branch string,
+	environmentID *shared.EnvironmentID,
+	startedBy string,
+) (*store.Job, error) {
+	return r.findOne(`
+		WHERE repository_id = $1 AND branch = $2 AND environment_id IS NOT DISTINCT FROM $3 AND started_by = $4
+		ORDER BY created_at DESC LIMIT 1`,
+		repositoryID,
+		branch,
+		environmentID,
+		startedBy,
+	)
+}
+
+func (r *JobStore) FindPreviousCompleted(job store.Job) (*store.Job, error) {
+	return r.findOne(`
+		WHERE repository_id = $1 AND branch = $2 AND environment_id IS NOT DISTINCT FROM $3 AND created_at < $4
+			AND state IN ($5, $6)
+		ORDER BY created_at DESC LIMIT 1`,
+		job.RepositoryID,
+		job.Commit.Branch,
+		job.EnvironmentID,
+		job.CreatedAt,
+		shared.JobStateSuccess,
+		shared.JobStateFailed,
+	)
+}
+
+func (r *JobStore) FindActiveByBranch(repositoryID store.RepositoryID, branch string) ([]store.Job, error) {
+	return r.find(
+		`WHERE repository_id = $1 AND branch = $2 AND state IN ($3, $4) ORDER BY created_at`,
+		repositoryID,
+		branch,
+		shared.JobStateWaiting,
+		shared.JobStateProcessing,
+	)
+}
+
+func (r *JobStore) FindActiveByPullRequest(repositoryID store.RepositoryID, number int64) ([]store.Job, error) {
+	return r.find(
+		`WHERE repository_id = $1 AND pull_request_number = $2 AND state IN ($3, $4) ORDER BY created_at`,
+		repositoryID,
+		number,
+		shared.JobStateWaiting,
+		shared.JobStateProcessing,
+	)
+}
+
+func (r *JobStore) FindProcessingStartedBefore(repositoryID store.RepositoryID, t time.Time) ([]store.Job, error) {
+	return r.find(
+		`WHERE repository_id = $1 AND state = $2 AND started_at < $3 ORDER BY created_at`,
+		repositoryID,
+		shared.JobStateProcessing,
+		t,
+	)
+}
+
+func (r *JobStore) ExpireWaitingCreatedBefore(
+	repositoryID store.RepositoryID,
+	t time.Time,
+	stoppedBy string,
+) ([]shared.JobID, error) {
+	// Jobs claimed by a runner since the sweep started no longer match the state condition
+	rows, err := r.DB.Query(`
+		UPDATE job SET state = $1, stopped_at = $2, stopped_by = $3
+		WHERE repository_id = $4 AND state = $5 AND created_at < $6
+		RETURNING id`,
+		shared.JobStateExpired,
+		time.Now(),
+		stoppedBy,
+		repositoryID,
+		shared.JobStateWaiting,
+		t,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "error expiring jobs")
+	}
+	defer rows.Close()
+
+	expired := []shared.JobID{}
+	for rows.Next() {
+		var id shared.JobID
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "error decoding expired job")
+		}
+		expired = append(expired, id)
+	}
+	return expired, errors.Wrap(rows.Err(), "error reading expired jobs")
+}
+
+func (r *JobStore) FindStoppedByRepositoryID(repositoryID store.RepositoryID) ([]store.Job, error) {
+	return r.find(
+		`WHERE repository_id = $1 AND state NOT IN ($2, $3) ORDER BY created_at`,
+		repositoryID,
+		shared.JobStateWaiting,
+		shared.JobStateProcessing,
+	)
+}
+
+func (r *JobStore) FilterByRepositoryID(
+	repositoryID store.RepositoryID,
+	filter string,
+	pageIndex int64,
+	pageSize int64,
+	sortColumn string,
+	sortOrder int,
+) (store.JobListPage, error) {
+	page := store.JobListPage{}
+	page.Jobs = []store.Job{}
+
+	if sortColumn != "state" {
+		sortColumn = "created_at"
+	}
+	order := "ASC"
+	if sortOrder < 0 {
+		order = "DESC"
+	}
+
+	where := `WHERE repository_id = $1 AND (branch ~ $2 OR revision ~ $2 OR started_by ~ $2)`
+	if err := r.DB.QueryRow(`SELECT COUNT(*) FROM job `+where, repositoryID, filter).Scan(&page.Count); err != nil {
+		return page, errors.Wrap(err, "error counting jobs")
+	}
+
+	jobs, err := r.find(
+		fmt.Sprintf(`%s ORDER BY %s %s LIMIT $3 OFFSET $4`, where, sortColumn, order),
+		repositoryID,
+		filter,
+		pageSize,
+		pageIndex*pageSize,
+	)
+	if err != nil {
+		return page, errors.Wrap(err, "error fetching jobs")
+	}
+	page.Jobs = jobs
+	return page, nil
+}
+
+// Delete removes the job and everything belonging to it in a single transaction
+func (r *JobStore) Delete(id shared.JobID) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "error starting transaction")
+	}
+	defer tx.Rollback()
+
+	for _, statement := range []string{
+		`DELETE FROM job_container_log WHERE container_id IN (SELECT container_id FROM job_container WHERE job_id = $1)`,
+		`DELETE FROM job_log WHERE job_id = $1`,
+		`DELETE FROM job_container WHERE job_id = $1`,
+		`DELETE FROM job_stage WHERE job_id = $1`,
+		`DELETE FROM notification_delivery WHERE job_id = $1`,
+		`DELETE FROM job WHERE id = $1`,
+	} {
+		if _, err := tx.Exec(statement, id); err != nil {
+			return errors.Wrap(err, "error deleting")
+		}
+	}
+	return errors.Wrap(tx.Commit(), "error deleting")
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"database/sql"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type LogStore struct {
+	DB *sql.DB
+}
+
+func (r *LogStore) Log(l store.Log) error {
+	_, err := r.DB.Exec(
+		`INSERT INTO job_log (job_id, message, type, stage_id, time) VALUES ($1, $2, $3, $4, $5)`,
+		l.JobID,
+		l.Message,
+		l.LogType,
+		l.StageID,
+		l.Time,
+	)
+	return errors.Wrap(err, "error logging job message")
+}
+
+func (r *LogStore) ContainerLog(l store.ContainerLog) error {
+	_, err := r.DB.Exec(
+		`INSERT INTO job_container_log (container_id, message, type, time) VALUES ($1, $2, $3, $4)`,
+		l.ContainerID,
+		l.Message,
+		l.LogType,
+		l.Time,
+	)
+	return errors.Wrap(err, "error logging job message")
+}
+
+func (r *LogStore) FilterLogByJobIDFromTime(id shared.JobID, t time.Time) ([]store.Log, error) {
+	logs := []store.Log{}
+	rows, err := r.DB.Query(
+		`SELECT job_id, message, type, stage_id, time FROM job_log WHERE job_id = $1 AND time >= $2 ORDER BY time, id`,
+		id,
+		t,
+	)
+	if err != nil {
+		return logs, errors.Wrap(err, "error getting logs")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l store.Log
+		if err := rows.Scan(&l.JobID, &l.Message, &l.LogType, &l.StageID, &l.Time); err != nil {
+			return logs, errors.Wrap(err, "error decoding log")
+		}
+		logs = append(logs, l)
+	}
+	return logs, errors.Wrap(rows.Err(), "error reading logs")
+}
+
+func (r *LogStore) FilterContainerLogByContainerIDFromTime(
+	id shared.ContainerID,
+	t time.Time,
+) ([]store.ContainerLog, error) {
+	logs := []store.ContainerLog{}
+	rows, err := r.DB.Query(`
+		SELECT container_id, message, type, time FROM job_container_log
+		WHERE container_id = $1 AND time >= $2 ORDER BY time, id`,
+		id,
+		t,
+	)
+	if err != nil {
+		return logs, errors.Wrap(err, "error getting container logs")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l store.ContainerLog
+		if err := rows.Scan(&l.ContainerID, &l.Message, &l.LogType, &l.Time); err != nil {
+			return logs, errors.Wrap(err, "error decoding container log")
+		}
+		logs = append(logs, l)
+	}
+	return logs, errors.Wrap(rows.Err(), "error reading container logs")
+}
@@ -0,0 +1,163 @@
+package postgres
+
+// migrations are applied in order and recorded in the schema_migration table. Applied migrations must never be
+// changed, schema changes are made by appending a new migration.
+var migrations = []string{
+	`
+	CREATE TABLE repository (
+		id                 TEXT PRIMARY KEY,
+		project            TEXT NOT NULL,
+		name               TEXT NOT NULL,
+		uri                TEXT NOT NULL,
+		triggers           JSONB NOT NULL DEFAULT '[]',
+		settings           JSONB NOT NULL DEFAULT '{}',
+		created_at         TIMESTAMPTZ NOT NULL,
+		updated_at         TIMESTAMPTZ NOT NULL,
+		deleted_at         TIMESTAMPTZ,
+		last_dispatched_at TIMESTAMPTZ,
+		UNIQUE (project, name)
+	);
+
+	CREATE TABLE environment (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL UNIQUE,
+		variables  JSONB NOT NULL DEFAULT '[]',
+		created_at TIMESTAMPTZ NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL,
+		deleted_at TIMESTAMPTZ
+	);
+
+	CREATE TABLE users (
+		username      TEXT PRIMARY KEY,
+		email         TEXT NOT NULL DEFAULT '',
+		name          TEXT NOT NULL DEFAULT '',
+		avatar_url    TEXT NOT NULL DEFAULT '',
+		role          TEXT NOT NULL,
+		notifications JSONB NOT NULL DEFAULT '{}',
+		created_at    TIMESTAMPTZ NOT NULL,
+		deleted_at    TIMESTAMPTZ
+	);
+
+	CREATE INDEX users_watching ON users USING GIN ((notifications -> 'Watching'));
+
+	CREATE TABLE job (
+		id                  TEXT PRIMARY KEY,
+		repository_id       TEXT NOT NULL,
+		environment_id      TEXT,
+		branch              TEXT NOT NULL,
+		revision            TEXT NOT NULL,
+		state               SMALLINT NOT NULL,
+		started_by          TEXT NOT NULL,
+		runner              TEXT NOT NULL DEFAULT '',
+		stopped_by          TEXT,
+		created_at          TIMESTAMPTZ NOT NULL,
+		started_at          TIMESTAMPTZ,
+		stopped_at          TIMESTAMPTZ,
+		parameters          JSONB,
+		pull_request        JSONB,
+		pull_request_number BIGINT,
+		changed_files       JSONB,
+		priority            INTEGER NOT NULL DEFAULT 0
+	);
+
+	CREATE INDEX job_queue ON job (state, priority DESC, created_at);
+	CREATE INDEX job_repository ON job (repository_id, state, created_at);
+	CREATE INDEX job_branch ON job (repository_id, branch, created_at);
+
+	CREATE TABLE job_stage (
+		job_id     TEXT NOT NULL,
+		id         TEXT NOT NULL,
+		state      SMALLINT NOT NULL,
+		started_at TIMESTAMPTZ,
+		stopped_at TIMESTAMPTZ,
+		PRIMARY KEY (job_id, id)
+	);
+
+	CREATE TABLE job_container (
+		id           TEXT PRIMARY KEY,
+		job_id       TEXT NOT NULL,
+		container_id TEXT NOT NULL,
+		state        SMALLINT NOT NULL,
+		spec         JSONB NOT NULL,
+		meta         JSONB NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL,
+		started_at   TIMESTAMPTZ,
+		stopped_at   TIMESTAMPTZ
+	);
+
+	CREATE INDEX job_container_job ON job_container (job_id, created_at);
+	CREATE INDEX job_container_container ON job_container (container_id);
+
+	CREATE TABLE job_log (
+		id       BIGSERIAL PRIMARY KEY,
+		job_id   TEXT NOT NULL,
+		message  TEXT NOT NULL,
+		type     SMALLINT NOT NULL,
+		stage_id TEXT NOT NULL,
+		time     TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE INDEX job_log_job ON job_log (job_id, time);
+
+	CREATE TABLE job_container_log (
+		id           BIGSERIAL PRIMARY KEY,
+		container_id TEXT NOT NULL,
+		message      TEXT NOT NULL,
+		type         SMALLINT NOT NULL,
+		time         TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE INDEX job_container_log_container ON job_container_log (container_id, time);
+
+	CREATE TABLE runner_enrollment_token (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		hash       TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL,
+		used_at    TIMESTAMPTZ,
+		revoked_at TIMESTAMPTZ
+	);
+
+	CREATE INDEX runner_enrollment_token_hash ON runner_enrollment_token (hash);
+
+	CREATE TABLE notification_delivery (
+		id          TEXT PRIMARY KEY,
+		job_id      TEXT NOT NULL,
+		url         TEXT NOT NULL,
+		attempt     INTEGER NOT NULL,
+		status_code INTEGER NOT NULL,
+		error       TEXT NOT NULL,
+		duration    BIGINT NOT NULL,
+		created_at  TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE INDEX notification_delivery_job ON notification_delivery (job_id, created_at);
+	`,
+	`
+	CREATE TABLE personal_token (
+		id           TEXT PRIMARY KEY,
+		username     TEXT NOT NULL,
+		name         TEXT NOT NULL,
+		hash         TEXT NOT NULL,
+		read_only    BOOLEAN NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL,
+		expires_at   TIMESTAMPTZ,
+		last_used_at TIMESTAMPTZ,
+		revoked_at   TIMESTAMPTZ
+	);
+
+	CREATE INDEX personal_token_hash ON personal_token (hash);
+
+	CREATE INDEX personal_token_username ON personal_token (username, created_at);
+	`,
+	`
+	CREATE TABLE scheduled_run (
+		id            TEXT PRIMARY KEY,
+		repository_id TEXT NOT NULL,
+		trigger       TEXT NOT NULL,
+		tick          TIMESTAMPTZ NOT NULL
+	);
+	`,
+}
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"database/sql"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+
+	"github.com/pkg/errors"
+)
+
+type NotificationDeliveryStore struct {
+	DB *sql.DB
+}
+
+func (r *NotificationDeliveryStore) Add(delivery store.NotificationDelivery) error {
+	_, err := r.DB.Exec(`
+		INSERT INTO notification_delivery (id, job_id, url, attempt, status_code, error, duration, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		newID(),
+		delivery.JobID,
+		delivery.URL,
+		delivery.Attempt,
+		delivery.StatusCode,
+		delivery.Error,
+		delivery.Duration,
+		delivery.CreatedAt,
+	)
+	return errors.Wrap(err, "error adding notification delivery")
+}
+
+func (r *NotificationDeliveryStore) Filter(
+	jobID shared.JobID,
+	pageIndex int64,
+	pageSize int64,
+) ([]store.NotificationDelivery, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, job_id, url, attempt, status_code, error, duration, created_at FROM notification_delivery
+		WHERE $1 = '' OR job_id = $1
+		ORDER BY created_at DESC LIMIT $2 OFFSET $3`,
+		jobID,
+		pageSize,
+		pageIndex*pageSize,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching notification deliveries")
+	}
+	defer rows.Close()
+
+	deliveries := []store.NotificationDelivery{}
+	for rows.Next() {
+		var delivery store.NotificationDelivery
+		if err := rows.Scan(
+			&delivery.ID,
+			&delivery.JobID,
+			&delivery.URL,
+			&delivery.Attempt,
+			&delivery.StatusCode,
+			&delivery.Error,
+			&delivery.Duration,
+			&delivery.CreatedAt,
+		); err != nil {
+			return nil, errors.Wrap(err, "error decoding notification delivery")
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, errors.Wrap(rows.Err(), "error reading notification deliveries")
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	// Registers the postgres driver with database/sql
+	_ "github.com/lib/pq"
+)
+
+// migrationLock is the advisory lock held while migrating, so servers starting together do not migrate twice
+const migrationLock = 7325113
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Open connects to the database at uri and migrates its schema to the latest version
+func Open(uri string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating postgres client")
+	}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "error connecting to postgres")
+	}
+
+	if err := Migrate(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate applies the migrations that have not been applied to the database yet, each in its own transaction
+func Migrate(db *sql.DB) error {
+	if _, err := db.Exec(
+		`CREATE TABLE IF NOT EXISTS schema_migration (version INTEGER PRIMARY KEY, applied_at TIMESTAMPTZ NOT NULL)`,
+	); err != nil {
+		return errors.Wrap(err, "error creating schema migration table")
+	}
+
+	for i, migration := range migrations {
+		version := i + 1
+		if err := migrate(db, version, migration); err != nil {
+			return errors.Wrapf(err, "error applying migration %d", version)
+		}
+	}
+	return nil
+}
+
+func migrate(db *sql.DB, version int, migration string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+		return err
+	}
+
+	var applied bool
+	if err := tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM schema_migration WHERE version = $1)`,
+		version,
+	).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	log.Info("applying postgres migration ", version)
+	if _, err := tx.Exec(migration); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migration (version, applied_at) VALUES ($1, now())`, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// newID returns a random identifier, formatted like the object ids of the mongo stores
+func newID() string {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// jsonValue encodes a value for a JSONB column
+func jsonValue(v interface{}) (string, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding json column")
+	}
+	return string(value), nil
+}
+
+// affected checks whether a statement changed any rows
+func affected(result sql.Result) (bool, error) {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "error reading affected rows")
+	}
+	return rows > 0, nil
+}
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"go-brunel/internal/pkg/server/store"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const repositoryColumns = `id, project, name, uri, triggers, settings, created_at, updated_at, deleted_at`
+
+type RepositoryStore struct {
+	DB *sql.DB
+}
+
+func scanRepository(row scanner) (*store.Repository, error) {
+	var repository store.Repository
+	var triggers, settings []byte
+	if err := row.Scan(
+		&repository.ID,
+		&repository.Project,
+		&repository.Name,
+		&repository.URI,
+		&triggers,
+		&settings,
+		&repository.CreatedAt,
+		&repository.UpdatedAt,
+		&repository.DeletedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(triggers, &repository.Triggers); err != nil {
+		return nil, errors.Wrap(err, "error decoding repository triggers")
+	}
+	if err := json.Unmarshal(settings, &repository.Settings); err != nil {
+		return nil, errors.Wrap(err, "error decoding repository settings")
+	}
+	return &repository, nil
+}
+
+func (r *RepositoryStore) AddOrUpdate(repository store.Repository) (*store.Repository, error) {
+	triggers, err := jsonValue(repository.Triggers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Repositories are updated when hooks are received, which do not carry triggers, so they are only replaced when
+	// new ones are given
+	now := time.Now()
+	updated, err := scanRepository(r.DB.QueryRow(`
+		INSERT INTO repository (id, project, name, uri, triggers, created_at, updated_at, deleted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $7)
+		ON CONFLICT (project, name) DO UPDATE SET
+			uri = EXCLUDED.uri,
+			triggers = CASE WHEN $8 THEN EXCLUDED.triggers ELSE repository.triggers END,
+			updated_at = EXCLUDED.updated_at,
+			deleted_at = EXCLUDED.deleted_at
+		RETURNING `+repositoryColumns,
+		newID(),
+		repository.Project,
+		repository.Name,
+		repository.URI,
+		triggers,
+		now,
+		repository.DeletedAt,
+		len(repository.Triggers) > 0,
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "error adding or updating repository")
+	}
+	return updated, nil
+}
+
+func (r *RepositoryStore) SetTriggers(id store.RepositoryID, triggers []store.RepositoryTrigger) error {
+	if triggers == nil {
+		triggers = []store.RepositoryTrigger{}
+	}
+	value, err := jsonValue(triggers)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.DB.Exec(`UPDATE repository SET triggers = $1, updated_at = $2 WHERE id = $3`, value, time.Now(), id)
+	return errors.Wrap(err, "error adding or updating repository")
+}
+
+func (r *RepositoryStore) SetSettings(id store.RepositoryID, settings store.RepositorySettings) error {
+	value, err := jsonValue(settings)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.DB.Exec(`UPDATE repository SET settings = $1, updated_at = $2 WHERE id = $3`, value, time.Now(), id)
+	if err != nil {
+		return errors.Wrap(err, "error setting repository settings")
+	}
+	if found, err := affected(result); err != nil || !found {
+		if err == nil {
+			err = store.ErrorNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *RepositoryStore) Get(id store.RepositoryID) (*store.Repository, error) {
+	repository, err := scanRepository(r.DB.QueryRow(`SELECT `+repositoryColumns+` FROM repository WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrorNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting repository")
+	}
+	return repository, nil
+}
+
+func (r *RepositoryStore) Filter(filter string) ([]store.Repository, error) {
+	rows, err := r.DB.Query(
+		`SELECT `+repositoryColumns+` FROM repository WHERE name ~* $1 OR project ~* $1 ORDER BY project, name`,
+		filter,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching repository list")
+	}
+	defer rows.Close()
+
+	repositories := []store.Repository{}
+	for rows.Next() {
+		repository, err := scanRepository(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding repository list")
+		}
+		repositories = append(repositories, *repository)
+	}
+	return repositories, errors.Wrap(rows.Err(), "error reading repository list")
+}
+
+func (r *RepositoryStore) Delete(id store.RepositoryID, hard bool) error {
+	if hard {
+		_, err := r.DB.Exec(`DELETE FROM repository WHERE id = $1`, id)
+		return errors.Wrap(err, "error deleting")
+	}
+
+	_, err := r.DB.Exec(`UPDATE repository SET deleted_at = $1 WHERE id = $2`, time.Now(), id)
+	return errors.Wrap(err, "error soft deleting")
+}
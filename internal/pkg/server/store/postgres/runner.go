@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"database/sql"
+	"go-brunel/internal/pkg/server/store"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const enrollmentTokenColumns = `id, name, hash, created_by, created_at, expires_at, used_at, revoked_at`
+
+type EnrollmentTokenStore struct {
+	DB *sql.DB
+}
+
+func scanEnrollmentToken(row scanner) (*store.EnrollmentToken, error) {
+	var token store.EnrollmentToken
+	if err := row.Scan(
+		&token.ID,
+		&token.Name,
+		&token.Hash,
+		&token.CreatedBy,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.RevokedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *EnrollmentTokenStore) Add(token store.EnrollmentToken) (*store.EnrollmentToken, error) {
+	token.ID = store.EnrollmentTokenID(newID())
+	token.CreatedAt = time.Now()
+
+	if _, err := r.DB.Exec(
+		`INSERT INTO runner_enrollment_token (`+enrollmentTokenColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		token.ID,
+		token.Name,
+		token.Hash,
+		token.CreatedBy,
+		token.CreatedAt,
+		token.ExpiresAt,
+		token.UsedAt,
+		token.RevokedAt,
+	); err != nil {
+		return nil, errors.Wrap(err, "error adding enrollment token")
+	}
+	return &token, nil
+}
+
+func (r *EnrollmentTokenStore) Filter() ([]store.EnrollmentToken, error) {
+	rows, err := r.DB.Query(`SELECT ` + enrollmentTokenColumns + ` FROM runner_enrollment_token ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching enrollment tokens")
+	}
+	defer rows.Close()
+
+	tokens := []store.EnrollmentToken{}
+	for rows.Next() {
+		token, err := scanEnrollmentToken(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding enrollment token")
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, errors.Wrap(rows.Err(), "error reading enrollment tokens")
+}
+
+func (r *EnrollmentTokenStore) Consume(hash string) (*store.EnrollmentToken, error) {
+	now := time.Now()
+	token, err := scanEnrollmentToken(r.DB.QueryRow(`
+		UPDATE runner_enrollment_token SET used_at = $1
+		WHERE hash = $2 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > $1
+		RETURNING `+enrollmentTokenColumns,
+		now,
+		hash,
+	))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrorNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error consuming enrollment token")
+	}
+	return token, nil
+}
+
+func (r *EnrollmentTokenStore) Revoke(id store.EnrollmentTokenID) error {
+	result, err := r.DB.Exec(
+		`UPDATE runner_enrollment_token SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`,
+		time.Now(),
+		id,
+	)
+	if err != nil {
+		return errors.Wrap(err, "error revoking enrollment token")
+	}
+	if found, err := affected(result); err != nil || !found {
+		if err == nil {
+			err = store.ErrorNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *EnrollmentTokenStore) Delete(id store.EnrollmentTokenID) error {
+	_, err := r.DB.Exec(`DELETE FROM runner_enrollment_token WHERE id = $1`, id)
+	return errors.Wrap(err, "error deleting")
+}
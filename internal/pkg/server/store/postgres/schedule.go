@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"database/sql"
+	"go-brunel/internal/pkg/server/store"
+
+	"github.com/pkg/errors"
+)
+
+type ScheduleStore struct {
+	DB *sql.DB
+}
+
+func (r *ScheduleStore) Claim(run store.ScheduledRun) error {
+	result, err := r.DB.Exec(`
+		INSERT INTO scheduled_run (id, repository_id, trigger, tick) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET tick = EXCLUDED.tick WHERE scheduled_run.tick < EXCLUDED.tick`,
+		run.ID(),
+		run.RepositoryID,
+		run.Trigger,
+		run.Tick,
+	)
+	if err != nil {
+		return errors.Wrap(err, "error claiming scheduled run")
+	}
+
+	claimed, err := affected(result)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return store.ErrorConflict
+	}
+	return nil
+}
+
+func (r *ScheduleStore) Release(run store.ScheduledRun) error {
+	_, err := r.DB.Exec(`DELETE FROM scheduled_run WHERE id = $1 AND tick = $2`, run.ID(), run.Tick)
+	return errors.Wrap(err, "error releasing scheduled run")
+}
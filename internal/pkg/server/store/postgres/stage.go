@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"database/sql"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+
+	"github.com/pkg/errors"
+)
+
+type StageStore struct {
+	DB *sql.DB
+}
+
+func (r *StageStore) AddOrUpdate(stage store.Stage) error {
+	_, err := r.DB.Exec(`
+		INSERT INTO job_stage (job_id, id, state, started_at, stopped_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (job_id, id) DO UPDATE SET
+			state = EXCLUDED.state,
+			started_at = COALESCE(EXCLUDED.started_at, job_stage.started_at),
+			stopped_at = COALESCE(EXCLUDED.stopped_at, job_stage.stopped_at)`,
+		stage.JobID,
+		stage.ID,
+		stage.State,
+		stage.StartedAt,
+		stage.StoppedAt,
+	)
+	return errors.Wrap(err, "error adding or updating stage")
+}
+
+func (r *StageStore) FindAllByJobID(jobID shared.JobID) ([]store.Stage, error) {
+	rows, err := r.DB.Query(
+		`SELECT id, job_id, state, started_at, stopped_at FROM job_stage WHERE job_id = $1 ORDER BY started_at NULLS LAST`,
+		jobID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching stage list")
+	}
+	defer rows.Close()
+
+	stages := []store.Stage{}
+	for rows.Next() {
+		var stage store.Stage
+		if err := rows.Scan(&stage.ID, &stage.JobID, &stage.State, &stage.StartedAt, &stage.StoppedAt); err != nil {
+			return nil, errors.Wrap(err, "error decoding stage list")
+		}
+		stages = append(stages, stage)
+	}
+	return stages, errors.Wrap(rows.Err(), "error reading stage list")
+}
@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"database/sql"
+	"go-brunel/internal/pkg/server/store"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const personalTokenColumns = `id, username, name, hash, read_only, created_at, expires_at, last_used_at, revoked_at`
+
+type TokenStore struct {
+	DB *sql.DB
+}
+
+func scanPersonalToken(row scanner) (*store.PersonalToken, error) {
+	var token store.PersonalToken
+	if err := row.Scan(
+		&token.ID,
+		&token.Username,
+		&token.Name,
+		&token.Hash,
+		&token.ReadOnly,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+		&token.RevokedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *TokenStore) Add(token store.PersonalToken) (*store.PersonalToken, error) {
+	token.ID = store.PersonalTokenID(newID())
+	token.CreatedAt = time.Now()
+
+	if _, err := r.DB.Exec(
+		`INSERT INTO personal_token (`+personalTokenColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		token.ID,
+		token.Username,
+		token.Name,
+		token.Hash,
+		token.ReadOnly,
+		token.CreatedAt,
+		token.ExpiresAt,
+		token.LastUsedAt,
+		token.RevokedAt,
+	); err != nil {
+		return nil, errors.Wrap(err, "error adding personal token")
+	}
+	return &token, nil
+}
+
+func (r *TokenStore) FilterByUsername(username string) ([]store.PersonalToken, error) {
+	rows, err := r.DB.Query(
+		`SELECT `+personalTokenColumns+` FROM personal_token WHERE username = $1 ORDER BY created_at DESC`,
+		username,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching personal tokens")
+	}
+	defer rows.Close()
+
+	tokens := []store.PersonalToken{}
+	for rows.Next() {
+		token, err := scanPersonalToken(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding personal token")
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, errors.Wrap(rows.Err(), "error reading personal tokens")
+}
+
+func (r *TokenStore) Use(hash string, t time.Time) (*store.PersonalToken, error) {
+	token, err := scanPersonalToken(r.DB.QueryRow(
+		`SELECT `+personalTokenColumns+` FROM personal_token
+		WHERE hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $2)`,
+		hash,
+		t,
+	))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrorNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error using personal token")
+	}
+	if token.RecentlyUsed(t) {
+		return token, nil
+	}
+
+	if _, err := r.DB.Exec(
+		`UPDATE personal_token SET last_used_at = $1 WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $1)`,
+		t,
+		token.ID,
+	); err != nil {
+		return nil, errors.Wrap(err, "error using personal token")
+	}
+	token.LastUsedAt = &t
+	return token, nil
+}
+
+func (r *TokenStore) Revoke(username string, id store.PersonalTokenID) error {
+	result, err := r.DB.Exec(
+		`UPDATE personal_token SET revoked_at = $1 WHERE id = $2 AND username = $3 AND revoked_at IS NULL`,
+		time.Now(),
+		id,
+		username,
+	)
+	if err != nil {
+		return errors.Wrap(err, "error revoking personal token")
+	}
+	if found, err := affected(result); err != nil || !found {
+		if err == nil {
+			err = store.ErrorNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *TokenStore) Delete(id store.PersonalTokenID) error {
+	_, err := r.DB.Exec(`DELETE FROM personal_token WHERE id = $1`, id)
+	return errors.Wrap(err, "error deleting")
+}
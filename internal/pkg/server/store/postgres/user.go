@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"go-brunel/internal/pkg/server/security"
+	"go-brunel/internal/pkg/server/store"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const userColumns = `username, email, name, avatar_url, role, notifications, created_at`
+
+type UserStore struct {
+	DB *sql.DB
+}
+
+func scanUser(row scanner) (*store.User, error) {
+	var user store.User
+	var notifications []byte
+	if err := row.Scan(
+		&user.Username,
+		&user.Email,
+		&user.Name,
+		&user.AvatarURL,
+		&user.Role,
+		&notifications,
+		&user.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(notifications, &user.Notifications); err != nil {
+		return nil, errors.Wrap(err, "error decoding notification preferences")
+	}
+	return &user, nil
+}
+
+func (r *UserStore) Filter(filter string) ([]store.UserList, error) {
+	rows, err := r.DB.Query(
+		`SELECT username, role FROM users WHERE username ~* $1 OR email ~* $1 ORDER BY username`,
+		filter,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching user list")
+	}
+	defer rows.Close()
+
+	users := []store.UserList{}
+	for rows.Next() {
+		var user store.UserList
+		if err := rows.Scan(&user.Username, &user.Role); err != nil {
+			return nil, errors.Wrap(err, "error decoding user list")
+		}
+		users = append(users, user)
+	}
+	return users, errors.Wrap(rows.Err(), "error reading user list")
+}
+
+func (r *UserStore) AddOrUpdate(user store.User) (*store.User, error) {
+	role := user.Role
+	if role == "" {
+		role = security.UserRoleReader
+	}
+
+	// Empty fields keep their stored values, so signing in never clears a role or profile details
+	updated, err := scanUser(r.DB.QueryRow(`
+		INSERT INTO users (username, email, name, avatar_url, role, created_at) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (username) DO UPDATE SET
+			email = COALESCE(NULLIF(EXCLUDED.email, ''), users.email),
+			name = COALESCE(NULLIF(EXCLUDED.name, ''), users.name),
+			avatar_url = COALESCE(NULLIF(EXCLUDED.avatar_url, ''), users.avatar_url),
+			role = CASE WHEN $7 = '' THEN users.role ELSE EXCLUDED.role END
+		RETURNING `+userColumns,
+		user.Username,
+		user.Email,
+		user.Name,
+		user.AvatarURL,
+		role,
+		time.Now(),
+		string(user.Role),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "error saving user")
+	}
+	return updated, nil
+}
+
+func (r *UserStore) GetByUsername(username string) (*store.User, error) {
+	user, err := scanUser(r.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = $1`, username))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrorNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting user")
+	}
+	return user, nil
+}
+
+func (r *UserStore) SetNotificationPreferences(username string, preferences store.NotificationPreferences) error {
+	if preferences.Watching == nil {
+		preferences.Watching = []store.RepositoryID{}
+	}
+	value, err := jsonValue(preferences)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.DB.Exec(`UPDATE users SET notifications = $1 WHERE username = $2`, value, username)
+	if err != nil {
+		return errors.Wrap(err, "error setting notification preferences")
+	}
+	if found, err := affected(result); err != nil || !found {
+		if err == nil {
+			err = store.ErrorNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *UserStore) FindWatchers(repositoryID store.RepositoryID) ([]store.User, error) {
+	rows, err := r.DB.Query(
+		`SELECT `+userColumns+` FROM users WHERE notifications -> 'Watching' ? $1 ORDER BY username`,
+		repositoryID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting repository watchers")
+	}
+	defer rows.Close()
+
+	users := []store.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding user")
+		}
+		users = append(users, *user)
+	}
+	return users, errors.Wrap(rows.Err(), "error reading repository watchers")
+}
+
+func (r *UserStore) Delete(username string, hard bool) error {
+	if hard {
+		_, err := r.DB.Exec(`DELETE FROM users WHERE username = $1`, username)
+		return errors.Wrap(err, "error deleting")
+	}
+
+	_, err := r.DB.Exec(`UPDATE users SET deleted_at = $1 WHERE username = $2`, time.Now(), username)
+	return errors.Wrap(err, "error soft deleting")
+}
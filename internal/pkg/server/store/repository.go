@@ -3,7 +3,9 @@ package store
 import (
 	"fmt"
 	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
 	"go-brunel/internal/pkg/shared"
+	"go-brunel/internal/pkg/shared/util"
 	"regexp"
 	"strings"
 	"time"
@@ -14,14 +16,117 @@ type RepositoryID string
 type RepositoryTriggerType int8
 
 const (
-	RepositoryTriggerTypeTag    RepositoryTriggerType = 0
-	RepositoryTriggerTypeBranch RepositoryTriggerType = 1
+	RepositoryTriggerTypeTag      RepositoryTriggerType = 0
+	RepositoryTriggerTypeBranch   RepositoryTriggerType = 1
+	RepositoryTriggerTypeSchedule RepositoryTriggerType = 2
+
+	// RepositoryTriggerTypePullRequest matches Pattern against the target branch of pull and merge requests
+	RepositoryTriggerTypePullRequest RepositoryTriggerType = 3
 )
 
 type RepositoryTrigger struct {
 	Type          RepositoryTriggerType
 	Pattern       string
 	EnvironmentID *shared.EnvironmentID `bson:"environment_id"`
+
+	// Schedule is a standard 5 field cron expression, used by schedule triggers along with the Branch to build
+	Schedule string `bson:"schedule,omitempty"`
+	Branch   string `bson:"branch,omitempty"`
+
+	// Paths and IgnorePaths are globs that restrict the trigger to pushes changing matching files
+	Paths       []string `bson:"paths,omitempty"`
+	IgnorePaths []string `bson:"ignore_paths,omitempty"`
+
+	// Priority is given to the jobs started by the trigger
+	Priority int `bson:"priority"`
+}
+
+// ParseSchedule parses the cron expression of a schedule trigger
+func (trigger *RepositoryTrigger) ParseSchedule() (cron.Schedule, error) {
+	return cron.ParseStandard(trigger.Schedule)
+}
+
+// ScheduleKey identifies a schedule trigger within its repository, triggers have no ids of their own
+func (trigger *RepositoryTrigger) ScheduleKey() string {
+	environment := ""
+	if trigger.EnvironmentID != nil {
+		environment = string(*trigger.EnvironmentID)
+	}
+	return fmt.Sprintf("%s@%s#%s", trigger.Schedule, trigger.Branch, environment)
+}
+
+// MatchesFiles checks the changed files of a push against the path filters of the trigger. A push must change at
+// least one file that is not ignored and, when Paths are given, one of those files must match them.
+// A nil list of files means the changes are unknown, in which case the trigger always matches.
+func (trigger *RepositoryTrigger) MatchesFiles(files []string) (bool, error) {
+	if files == nil || (len(trigger.Paths) == 0 && len(trigger.IgnorePaths) == 0) {
+		return true, nil
+	}
+
+	remaining := []string{}
+	for _, file := range files {
+		ignored, err := util.MatchAnyGlob(trigger.IgnorePaths, []string{file})
+		if err != nil {
+			return false, err
+		}
+		if !ignored {
+			remaining = append(remaining, file)
+		}
+	}
+
+	if len(trigger.Paths) == 0 {
+		return len(remaining) > 0, nil
+	}
+	return util.MatchAnyGlob(trigger.Paths, remaining)
+}
+
+type RepositorySupersedeMode int8
+
+const (
+	// RepositorySupersedeModeNone lets every queued job run
+	RepositorySupersedeModeNone RepositorySupersedeMode = 0
+	// RepositorySupersedeModeWaiting skips waiting jobs once a newer commit is queued for the same branch
+	RepositorySupersedeModeWaiting RepositorySupersedeMode = 1
+	// RepositorySupersedeModeAll cancels both waiting and running jobs once a newer commit is queued for the same branch
+	RepositorySupersedeModeAll RepositorySupersedeMode = 2
+)
+
+type RepositorySettings struct {
+	// MaxConcurrentJobs limits how many jobs of the repository are processed at once, zero is unlimited
+	MaxConcurrentJobs int                     `bson:"max_concurrent_jobs"`
+	Supersede         RepositorySupersedeMode `bson:"supersede"`
+
+	// JobTimeoutMinutes cancels jobs that have been processing for longer, zero is unlimited
+	JobTimeoutMinutes int `bson:"job_timeout_minutes"`
+	// QueueTimeoutMinutes expires jobs that have been waiting for longer, zero is unlimited
+	QueueTimeoutMinutes int `bson:"queue_timeout_minutes"`
+
+	// RetainJobs keeps the newest stopped jobs of the repository, older ones are purged. Zero keeps them all.
+	RetainJobs int `bson:"retain_jobs"`
+	// RetainDays keeps stopped jobs created within the last days, older ones are purged. Zero keeps them all. When
+	// both RetainJobs and RetainDays are set a job is kept if either keeps it.
+	RetainDays int `bson:"retain_days"`
+	// RetainPattern matches the branches of jobs that are never purged, for example '^refs/tags/' keeps tagged builds
+	RetainPattern string `bson:"retain_pattern"`
+}
+
+func (settings *RepositorySettings) IsValid() error {
+	if settings.MaxConcurrentJobs < 0 {
+		return errors.New("max concurrent jobs cannot be negative")
+	}
+	if settings.JobTimeoutMinutes < 0 || settings.QueueTimeoutMinutes < 0 {
+		return errors.New("timeouts cannot be negative")
+	}
+	if settings.RetainJobs < 0 || settings.RetainDays < 0 {
+		return errors.New("retention cannot be negative")
+	}
+	if _, e := regexp.Compile(settings.RetainPattern); e != nil {
+		return errors.Wrap(e, "invalid retain pattern")
+	}
+	if settings.Supersede < RepositorySupersedeModeNone || settings.Supersede > RepositorySupersedeModeAll {
+		return fmt.Errorf("unknown supersede mode: %d", settings.Supersede)
+	}
+	return nil
 }
 
 type Repository struct {
@@ -30,6 +135,7 @@ type Repository struct {
 	Name      string
 	URI       string
 	Triggers  []RepositoryTrigger
+	Settings  RepositorySettings
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt *time.Time
@@ -41,15 +147,34 @@ func (repository *Repository) Clean() {
 	repository.URI = strings.TrimSpace(repository.URI)
 }
 
+// IsValid checks the repository can be cloned, every repository needs a name, project and uri
 func (repository *Repository) IsValid() error {
-	if len(repository.Name) == 0 || len(repository.Project) == 0 || len(repository.URI) != 0 {
+	if len(repository.Name) == 0 || len(repository.Project) == 0 || len(repository.URI) == 0 {
 		return errors.New("repository name, project, and uri are required")
 	}
 	return nil
 }
 
 func (trigger *RepositoryTrigger) IsValid() error {
-	if trigger.Type != RepositoryTriggerTypeTag && trigger.Type != RepositoryTriggerTypeBranch {
+	for _, glob := range append(append([]string{}, trigger.Paths...), trigger.IgnorePaths...) {
+		if _, e := util.CompileGlob(glob); e != nil {
+			return errors.Wrap(e, "invalid trigger path")
+		}
+	}
+
+	if trigger.Type == RepositoryTriggerTypeSchedule {
+		if _, e := trigger.ParseSchedule(); e != nil {
+			return errors.Wrap(e, "invalid trigger schedule")
+		}
+		if len(strings.TrimSpace(trigger.Branch)) == 0 {
+			return errors.New("schedule triggers require a branch")
+		}
+		return nil
+	}
+
+	if trigger.Type != RepositoryTriggerTypeTag &&
+		trigger.Type != RepositoryTriggerTypeBranch &&
+		trigger.Type != RepositoryTriggerTypePullRequest {
 		return fmt.Errorf("unknown trigger type: %d", trigger.Type)
 	}
 
@@ -65,6 +190,8 @@ type RepositoryStore interface {
 
 	SetTriggers(id RepositoryID, triggers []RepositoryTrigger) error
 
+	SetSettings(id RepositoryID, settings RepositorySettings) error
+
 	Get(id RepositoryID) (*Repository, error)
 
 	Filter(filter string) ([]Repository, error)
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+type EnrollmentTokenID string
+
+// EnrollmentToken is a single use token a runner exchanges for its own client certificate.
+// Only a hash of the token is ever stored.
+type EnrollmentToken struct {
+	ID        EnrollmentTokenID `bson:"-"`
+	Name      string            `bson:"name"`
+	Hash      string            `bson:"hash" json:"-"`
+	CreatedBy string            `bson:"created_by"`
+	CreatedAt time.Time         `bson:"created_at"`
+	ExpiresAt time.Time         `bson:"expires_at"`
+	UsedAt    *time.Time        `bson:"used_at"`
+	RevokedAt *time.Time        `bson:"revoked_at"`
+}
+
+func (token *EnrollmentToken) Clean() {
+	token.Name = strings.TrimSpace(token.Name)
+}
+
+func (token *EnrollmentToken) IsValid() error {
+	if len(token.Name) == 0 {
+		return errors.New("runner name is required")
+	}
+	if !token.ExpiresAt.After(time.Now()) {
+		return errors.New("token expiry must be in the future")
+	}
+	return nil
+}
+
+type EnrollmentTokenStore interface {
+	Add(token EnrollmentToken) (*EnrollmentToken, error)
+
+	Filter() ([]EnrollmentToken, error)
+
+	// Consume should atomically mark the unused, unrevoked and unexpired token with the given hash as used.
+	// ErrorNotFound is returned if no such token exists.
+	Consume(hash string) (*EnrollmentToken, error)
+
+	Revoke(id EnrollmentTokenID) error
+
+	Delete(id EnrollmentTokenID) error
+}
@@ -0,0 +1,28 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// ScheduledRun is the latest tick of a repository's schedule trigger that a job was started for
+type ScheduledRun struct {
+	RepositoryID RepositoryID `bson:"repository_id"`
+	Trigger      string       `bson:"trigger"`
+	Tick         time.Time    `bson:"tick"`
+}
+
+// ID identifies the runs of the trigger, every run of a trigger replaces the one before
+func (run *ScheduledRun) ID() string {
+	return fmt.Sprintf("%s/%s", run.RepositoryID, run.Trigger)
+}
+
+type ScheduleStore interface {
+	// Claim records the run when its tick is after the last run of the trigger, returning ErrorConflict otherwise.
+	// Servers sharing a database start a job for a tick only once they claimed it.
+	Claim(run ScheduledRun) error
+
+	// Release removes the claim of the run when it is still the last run of the trigger, so the tick is claimed again
+	// when its job could not be started
+	Release(run ScheduledRun) error
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+type PersonalTokenID string
+
+// PersonalTokenUseInterval is how precisely the last use of a token is recorded, a token is only written when it
+// was last used longer ago, so tokens used on every request do not write on every request
+const PersonalTokenUseInterval = time.Minute
+
+// PersonalToken is a long lived token a user hands to scripts and other tools to call the API as them. Tokens act
+// with the current role of their user, read only tokens may only make GET requests. Only a hash of the token is
+// ever stored.
+type PersonalToken struct {
+	ID         PersonalTokenID `bson:"-"`
+	Username   string          `bson:"username"`
+	Name       string          `bson:"name"`
+	Hash       string          `bson:"hash" json:"-"`
+	ReadOnly   bool            `bson:"read_only"`
+	CreatedAt  time.Time       `bson:"created_at"`
+	ExpiresAt  *time.Time      `bson:"expires_at"`
+	LastUsedAt *time.Time      `bson:"last_used_at"`
+	RevokedAt  *time.Time      `bson:"revoked_at"`
+}
+
+// RecentlyUsed reports whether the token was last used within PersonalTokenUseInterval of the time
+func (token *PersonalToken) RecentlyUsed(t time.Time) bool {
+	return token.LastUsedAt != nil && t.Sub(*token.LastUsedAt) < PersonalTokenUseInterval
+}
+
+func (token *PersonalToken) Clean() {
+	token.Name = strings.TrimSpace(token.Name)
+}
+
+func (token *PersonalToken) IsValid() error {
+	if len(token.Name) == 0 {
+		return errors.New("token name is required")
+	}
+	if token.ExpiresAt != nil && !token.ExpiresAt.After(time.Now()) {
+		return errors.New("token expiry must be in the future")
+	}
+	return nil
+}
+
+type TokenStore interface {
+	Add(token PersonalToken) (*PersonalToken, error)
+
+	// FilterByUsername returns the tokens of the user, newest first
+	FilterByUsername(username string) ([]PersonalToken, error)
+
+	// Use should mark the unrevoked and unexpired token with the given hash as used at the time, unless it was
+	// RecentlyUsed, returning it. ErrorNotFound is returned if no such token exists.
+	Use(hash string, t time.Time) (*PersonalToken, error)
+
+	// Revoke revokes the token of the user, ErrorNotFound is returned if the user has no such unrevoked token
+	Revoke(username string, id PersonalTokenID) error
+
+	Delete(id PersonalTokenID) error
+}
@@ -1,17 +1,44 @@
 package store
 
 import (
+	"fmt"
 	"go-brunel/internal/pkg/server/security"
 	"time"
 )
 
+type EmailNotificationMode int8
+
+const (
+	// EmailNotificationModeOwn emails the user about their own builds and builds of watched repositories
+	EmailNotificationModeOwn EmailNotificationMode = 0
+	// EmailNotificationModeNever never emails the user
+	EmailNotificationModeNever EmailNotificationMode = 1
+)
+
+// NotificationPreferences decide which build emails a user receives. Emails are only sent when a build fails,
+// or when it succeeds after the previous build failed.
+type NotificationPreferences struct {
+	Email EmailNotificationMode `bson:"email"`
+
+	// Watching are repositories the user is emailed about for every build, not only their own
+	Watching []RepositoryID `bson:"watching"`
+}
+
+func (preferences *NotificationPreferences) IsValid() error {
+	if preferences.Email != EmailNotificationModeOwn && preferences.Email != EmailNotificationModeNever {
+		return fmt.Errorf("unknown email notification mode: %d", preferences.Email)
+	}
+	return nil
+}
+
 type User struct {
-	Username  string
-	Email     string
-	Name      string
-	AvatarURL string
-	Role      security.UserRole
-	CreatedAt time.Time
+	Username      string
+	Email         string
+	Name          string
+	AvatarURL     string
+	Role          security.UserRole
+	Notifications NotificationPreferences
+	CreatedAt     time.Time
 }
 
 type UserList struct {
@@ -26,5 +53,11 @@ type UserStore interface {
 
 	GetByUsername(username string) (*User, error)
 
+	// SetNotificationPreferences replaces the preferences of the user, ErrorNotFound is returned for unknown users
+	SetNotificationPreferences(username string, preferences NotificationPreferences) error
+
+	// FindWatchers returns the users watching the repository
+	FindWatchers(repositoryID RepositoryID) ([]User, error)
+
 	Delete(username string, hard bool) error
 }
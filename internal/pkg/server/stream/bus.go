@@ -0,0 +1,207 @@
+package stream
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"sync"
+)
+
+// DefaultHistory is the number of events kept for resuming subscribers when Bus.History is not set
+const DefaultHistory = 10000
+
+// subscriptionBuffer is the number of events a subscriber can fall behind by before it is dropped
+const subscriptionBuffer = 1024
+
+type EventType string
+
+const (
+	EventTypeJob          EventType = "job"
+	EventTypeStage        EventType = "stage"
+	EventTypeContainer    EventType = "container"
+	EventTypeLog          EventType = "log"
+	EventTypeContainerLog EventType = "container-log"
+
+	// EventTypeSnapshot is only sent to subscribers, it carries the state read from the stores when the subscriber
+	// could not resume from the events kept by the bus
+	EventTypeSnapshot EventType = "snapshot"
+)
+
+// Event is a change of a job published by the RPC server as it arrives from a runner. Events are numbered by a
+// sequence that increases by one with every event published on the bus, so subscribers can resume after the last
+// event they received. Only the field matching the type of the event is set.
+type Event struct {
+	Sequence    uint64
+	Type        EventType
+	JobID       shared.JobID       `json:",omitempty"`
+	ContainerID shared.ContainerID `json:",omitempty"`
+
+	JobState       *shared.JobState       `json:",omitempty"`
+	Stage          *store.Stage           `json:",omitempty"`
+	ContainerState *shared.ContainerState `json:",omitempty"`
+	Container      *store.Container       `json:",omitempty"`
+	Log            *store.Log             `json:",omitempty"`
+	ContainerLog   *store.ContainerLog    `json:",omitempty"`
+	Snapshot       interface{}            `json:",omitempty"`
+}
+
+// Filter selects the events of a job or of a container, events of a container are also events of its job
+type Filter struct {
+	JobID       shared.JobID
+	ContainerID shared.ContainerID
+}
+
+func (f Filter) matches(e Event) bool {
+	if f.ContainerID != "" {
+		return e.ContainerID == f.ContainerID
+	}
+	return e.JobID == f.JobID
+}
+
+// Subscription receives the events matching its filter. Events is closed when the subscriber falls too far behind,
+// it can then subscribe again after the last event it received.
+type Subscription struct {
+	Events chan Event
+	filter Filter
+}
+
+// Bus is an in-process publish and subscribe bus of job events. The latest events are kept so subscribers that
+// reconnect can resume without missing any. A nil bus discards everything published on it, and its subscriptions
+// never receive an event.
+type Bus struct {
+	History int
+
+	mutex         sync.Mutex
+	sequence      uint64
+	subscriptions map[*Subscription]bool
+
+	// events is a ring of the latest events, once it holds history events next is the index of the oldest, which
+	// the next event replaces
+	events []Event
+	next   int
+
+	// containerJobs holds the jobs of the containers of unfinished jobs, entries are dropped when the job finishes
+	containerJobs map[shared.ContainerID]shared.JobID
+}
+
+func (b *Bus) history() int {
+	if b.History > 0 {
+		return b.History
+	}
+	return DefaultHistory
+}
+
+// Track records the job of a container, so events published for the container without a job are delivered to the
+// subscribers of the job
+func (b *Bus) Track(containerID shared.ContainerID, jobID shared.JobID) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.containerJobs == nil {
+		b.containerJobs = map[shared.ContainerID]shared.JobID{}
+	}
+	b.containerJobs[containerID] = jobID
+}
+
+// Publish numbers the event and delivers it to the matching subscribers
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if e.ContainerID != "" {
+		if e.JobID == "" {
+			e.JobID = b.containerJobs[e.ContainerID]
+		} else if b.containerJobs[e.ContainerID] == "" {
+			if b.containerJobs == nil {
+				b.containerJobs = map[shared.ContainerID]shared.JobID{}
+			}
+			b.containerJobs[e.ContainerID] = e.JobID
+		}
+	}
+
+	if e.Type == EventTypeJob && e.JobState != nil && *e.JobState > shared.JobStateProcessing {
+		for containerID, jobID := range b.containerJobs {
+			if jobID == e.JobID {
+				delete(b.containerJobs, containerID)
+			}
+		}
+	}
+
+	b.sequence++
+	e.Sequence = b.sequence
+	if len(b.events) < b.history() {
+		b.events = append(b.events, e)
+	} else {
+		b.events[b.next] = e
+		b.next = (b.next + 1) % len(b.events)
+	}
+
+	for s := range b.subscriptions {
+		if !s.filter.matches(e) {
+			continue
+		}
+		select {
+		case s.Events <- e:
+		default:
+			close(s.Events)
+			delete(b.subscriptions, s)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events matching the filter published after the sequence, along with the
+// kept events after the sequence. Resumed is false when events after the sequence are no longer kept, or when the
+// sequence is zero, the subscriber should then read the current state from the stores instead. The sequence of the
+// bus at the time of subscribing is returned, later events are received by the subscription.
+func (b *Bus) Subscribe(filter Filter, after uint64) (s *Subscription, kept []Event, resumed bool, sequence uint64) {
+	s = &Subscription{Events: make(chan Event, subscriptionBuffer), filter: filter}
+	if b == nil {
+		return s, nil, false, 0
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subscriptions == nil {
+		b.subscriptions = map[*Subscription]bool{}
+	}
+	b.subscriptions[s] = true
+
+	oldest := b.sequence + 1
+	if len(b.events) > 0 {
+		oldest = b.events[b.next].Sequence
+	}
+	if after == 0 || after+1 < oldest || after > b.sequence {
+		return s, nil, false, b.sequence
+	}
+
+	for i := range b.events {
+		e := b.events[(b.next+i)%len(b.events)]
+		if e.Sequence > after && filter.matches(e) {
+			kept = append(kept, e)
+		}
+	}
+	return s, kept, true, b.sequence
+}
+
+// Unsubscribe stops delivering events to the subscription
+func (b *Bus) Unsubscribe(s *Subscription) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subscriptions[s] {
+		delete(b.subscriptions, s)
+		close(s.Events)
+	}
+}
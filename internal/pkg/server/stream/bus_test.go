@@ -0,0 +1,160 @@
+package stream_test
+
+import (
+	"context"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/stream"
+	"go-brunel/internal/pkg/shared"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBus_Subscribe(t *testing.T) {
+	bus := &stream.Bus{History: 3}
+	bus.Publish(stream.Event{Type: stream.EventTypeJob, JobID: "job"})
+
+	subscription, kept, resumed, sequence := bus.Subscribe(stream.Filter{JobID: "job"}, 0)
+	if resumed || len(kept) != 0 || sequence != 1 {
+		t.Errorf("expected a first subscribe to need a snapshot at sequence 1, got %v %d", resumed, sequence)
+	}
+
+	// Container events are delivered to the job once the container is tracked
+	bus.Track("container", "job")
+	bus.Publish(stream.Event{Type: stream.EventTypeContainerLog, ContainerID: "container"})
+	bus.Publish(stream.Event{Type: stream.EventTypeJob, JobID: "other"})
+	bus.Publish(stream.Event{Type: stream.EventTypeStage, JobID: "job"})
+
+	for _, expected := range []uint64{2, 4} {
+		e := <-subscription.Events
+		if e.Sequence != expected || e.JobID != "job" {
+			t.Errorf("expected event %d of the job, got %+v", expected, e)
+		}
+	}
+	bus.Unsubscribe(subscription)
+
+	// Resuming after the second event replays the kept events of the job after it
+	_, kept, resumed, _ = bus.Subscribe(stream.Filter{JobID: "job"}, 2)
+	if !resumed || len(kept) != 1 || kept[0].Sequence != 4 {
+		t.Errorf("expected to resume with event 4, got %v %+v", resumed, kept)
+	}
+
+	// Only the last three events are kept, resuming after the first event would miss the second
+	bus.Publish(stream.Event{Type: stream.EventTypeJob, JobID: "other"})
+	_, _, resumed, _ = bus.Subscribe(stream.Filter{JobID: "job"}, 1)
+	if resumed {
+		t.Errorf("expected resuming after an event no longer kept to need a snapshot")
+	}
+
+	_, kept, resumed, _ = bus.Subscribe(stream.Filter{ContainerID: "container"}, 3)
+	if !resumed || len(kept) != 0 {
+		t.Errorf("expected to resume the container with no events, got %v %+v", resumed, kept)
+	}
+}
+
+func TestBus_History(t *testing.T) {
+	bus := &stream.Bus{History: 3}
+	for i := 0; i < 7; i++ {
+		bus.Publish(stream.Event{Type: stream.EventTypeLog, JobID: "job"})
+	}
+
+	// The oldest events are replaced once the history is full, the kept events are still replayed in order
+	_, kept, resumed, sequence := bus.Subscribe(stream.Filter{JobID: "job"}, 4)
+	if !resumed || sequence != 7 || len(kept) != 3 {
+		t.Fatalf("expected to resume with the last three events, got %v %d %+v", resumed, sequence, kept)
+	}
+	for i, e := range kept {
+		if e.Sequence != uint64(5+i) {
+			t.Errorf("expected event %d, got %d", 5+i, e.Sequence)
+		}
+	}
+
+	_, _, resumed, _ = bus.Subscribe(stream.Filter{JobID: "job"}, 3)
+	if resumed {
+		t.Errorf("expected resuming after an event no longer kept to need a snapshot")
+	}
+}
+
+func TestBus_SlowSubscriber(t *testing.T) {
+	bus := &stream.Bus{}
+	subscription, _, _, _ := bus.Subscribe(stream.Filter{JobID: "job"}, 0)
+
+	for i := 0; i < 2000; i++ {
+		bus.Publish(stream.Event{Type: stream.EventTypeLog, JobID: "job"})
+	}
+
+	received := 0
+	for range subscription.Events {
+		received++
+	}
+	if received == 0 || received == 2000 {
+		t.Errorf("expected a slow subscriber to be closed after some events, got %d", received)
+	}
+	bus.Unsubscribe(subscription)
+}
+
+func TestBus_FinishedJob(t *testing.T) {
+	bus := &stream.Bus{}
+	subscription, _, _, _ := bus.Subscribe(stream.Filter{JobID: "job"}, 0)
+
+	// The containers of a finished job are forgotten, later events without a job no longer reach its subscribers
+	bus.Track("container", "job")
+	failed := shared.JobStateFailed
+	bus.Publish(stream.Event{Type: stream.EventTypeJob, JobID: "job", JobState: &failed})
+	bus.Publish(stream.Event{Type: stream.EventTypeContainerLog, ContainerID: "container"})
+
+	if e := <-subscription.Events; e.Type != stream.EventTypeJob {
+		t.Errorf("expected the job event, got %+v", e)
+	}
+	select {
+	case e := <-subscription.Events:
+		t.Errorf("expected no event for the container of the finished job, got %+v", e)
+	default:
+	}
+	bus.Unsubscribe(subscription)
+}
+
+func TestBus_Nil(t *testing.T) {
+	var bus *stream.Bus
+	bus.Publish(stream.Event{Type: stream.EventTypeJob, JobID: "job"})
+
+	subscription, kept, resumed, _ := bus.Subscribe(stream.Filter{JobID: "job"}, 0)
+	if resumed || len(kept) != 0 {
+		t.Errorf("expected a nil bus to keep no events, got %v %+v", resumed, kept)
+	}
+	bus.Unsubscribe(subscription)
+}
+
+func TestServe(t *testing.T) {
+	bus := &stream.Bus{}
+	message := "hello"
+	bus.Publish(stream.Event{Type: stream.EventTypeContainerLog, ContainerID: "c", ContainerLog: &store.ContainerLog{Message: message}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	r := httptest.NewRequest("GET", "/api/container/c/stream", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	state := shared.ContainerStateRunning
+	err := stream.Serve(w, r, bus, stream.Filter{ContainerID: "c"}, func() (interface{}, error) {
+		return state, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := w.Body.String(); !strings.HasPrefix(body, "id: 1\nevent: snapshot\ndata: ") {
+		t.Errorf("expected a snapshot at sequence 1, got %s", body)
+	}
+
+	// Resuming from the snapshot sends nothing until the next event
+	r = httptest.NewRequest("GET", "/api/container/c/stream?after=0", nil).WithContext(ctx)
+	r.Header.Set("Last-Event-ID", "1")
+	w = httptest.NewRecorder()
+	if err := stream.Serve(w, r, bus, stream.Filter{ContainerID: "c"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("expected no events after the last event id, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// KeepAlive is the interval comments are written at while no events are published, so proxies do not close idle
+// streams
+const KeepAlive = 15 * time.Second
+
+// Serve writes the events matching the filter to the response as server-sent events until the request is done, or
+// until the subscriber falls too far behind, clients then reconnect sending the id of the last event they received
+// in the Last-Event-ID header, or in the 'after' query parameter. When the events after it are no longer kept, or on
+// a first connect, the snapshot is sent before any event. Events published while the snapshot is read may be
+// received both as part of the snapshot and as events, so handling an event has to be idempotent.
+func Serve(w http.ResponseWriter, r *http.Request, bus *Bus, filter Filter, snapshot func() (interface{}, error)) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("streaming is not supported by the response writer")
+	}
+
+	after, err := lastEventID(r)
+	if err != nil {
+		return err
+	}
+
+	subscription, kept, resumed, sequence := bus.Subscribe(filter, after)
+	defer bus.Unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !resumed {
+		state, err := snapshot()
+		if err != nil {
+			return errors.Wrap(err, "error getting stream snapshot")
+		}
+		kept = []Event{{
+			Sequence:    sequence,
+			Type:        EventTypeSnapshot,
+			JobID:       filter.JobID,
+			ContainerID: filter.ContainerID,
+			Snapshot:    state,
+		}}
+	}
+
+	for _, e := range kept {
+		if err := write(w, e); err != nil {
+			return err
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(KeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return errors.Wrap(err, "error writing keep-alive")
+			}
+		case e, ok := <-subscription.Events:
+			if !ok {
+				return nil
+			}
+			if err := write(w, e); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func lastEventID(r *http.Request) (uint64, error) {
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = r.URL.Query().Get("after")
+	}
+	if id == "" {
+		return 0, nil
+	}
+
+	after, err := strconv.ParseUint(id, 10, 64)
+	return after, errors.Wrap(err, "error parsing last event id")
+}
+
+func write(w http.ResponseWriter, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "error encoding event")
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Sequence, e.Type, data)
+	return errors.Wrap(err, "error writing event")
+}
@@ -0,0 +1,100 @@
+package sweeper
+
+import (
+	"context"
+	"go-brunel/internal/pkg/server/notify"
+	"go-brunel/internal/pkg/server/store"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	// TimedOutBy is recorded as the user that cancelled jobs running longer than their repository allows
+	TimedOutBy = "timeout"
+
+	// ExpiredBy is recorded as the user that expired jobs waiting longer than their repository allows
+	ExpiredBy = "expired"
+)
+
+// Sweeper enforces the job and queue timeouts of repositories
+type Sweeper struct {
+	JobStore        store.JobStore
+	RepositoryStore store.RepositoryStore
+	Notify          notify.Notify
+}
+
+// Start will sweep for timed out jobs every interval until the context is done
+func (s *Sweeper) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := s.Run(now); err != nil {
+					log.Error("error sweeping timed out jobs: ", err)
+				}
+			}
+		}
+	}()
+}
+
+// Run cancels processing jobs that have exceeded the job timeout of their repository, the runner stops them the
+// next time it checks for cancellation. Waiting jobs that have exceeded the queue timeout are expired.
+func (s *Sweeper) Run(now time.Time) error {
+	repositories, err := s.RepositoryStore.Filter("")
+	if err != nil {
+		return errors.Wrap(err, "error getting repositories")
+	}
+
+	for _, repository := range repositories {
+		if err := s.sweep(repository, now); err != nil {
+			log.Error("error sweeping jobs for ", repository.Project, "/", repository.Name, ": ", err)
+		}
+	}
+	return nil
+}
+
+func (s *Sweeper) sweep(repository store.Repository, now time.Time) error {
+	settings := repository.Settings
+
+	if settings.JobTimeoutMinutes > 0 {
+		deadline := now.Add(-time.Duration(settings.JobTimeoutMinutes) * time.Minute)
+		jobs, err := s.JobStore.FindProcessingStartedBefore(repository.ID, deadline)
+		if err != nil {
+			return errors.Wrap(err, "error getting processing jobs")
+		}
+
+		for _, job := range jobs {
+			if err := s.JobStore.CancelByID(job.ID, TimedOutBy); err != nil {
+				return errors.Wrap(err, "error cancelling timed out job")
+			}
+			log.Info("job with id ", job.ID, " has been cancelled after running for more than ", settings.JobTimeoutMinutes, " minutes")
+
+			if err := s.Notify.Notify(job.ID); err != nil {
+				return errors.Wrap(err, "error notifying job status")
+			}
+		}
+	}
+
+	if settings.QueueTimeoutMinutes > 0 {
+		deadline := now.Add(-time.Duration(settings.QueueTimeoutMinutes) * time.Minute)
+		expired, err := s.JobStore.ExpireWaitingCreatedBefore(repository.ID, deadline, ExpiredBy)
+		if err != nil {
+			return errors.Wrap(err, "error expiring waiting jobs")
+		}
+
+		for _, id := range expired {
+			log.Info("job with id ", id, " has expired after waiting for more than ", settings.QueueTimeoutMinutes, " minutes")
+
+			if err := s.Notify.Notify(id); err != nil {
+				return errors.Wrap(err, "error notifying job status")
+			}
+		}
+	}
+	return nil
+}
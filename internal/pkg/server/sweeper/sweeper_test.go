@@ -0,0 +1,116 @@
+package sweeper_test
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/sweeper"
+	"go-brunel/internal/pkg/shared"
+	"testing"
+	"time"
+)
+
+type repositoryStore struct {
+	store.RepositoryStore
+	repositories []store.Repository
+}
+
+func (s *repositoryStore) Filter(filter string) ([]store.Repository, error) {
+	return s.repositories, nil
+}
+
+type jobStore struct {
+	store.JobStore
+	jobs []store.Job
+}
+
+func (s *jobStore) FindProcessingStartedBefore(repositoryID store.RepositoryID, t time.Time) ([]store.Job, error) {
+	var jobs []store.Job
+	for _, j := range s.jobs {
+		if j.RepositoryID == repositoryID && j.State == shared.JobStateProcessing && j.StartedAt.Before(t) {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs, nil
+}
+
+func (s *jobStore) ExpireWaitingCreatedBefore(
+	repositoryID store.RepositoryID,
+	t time.Time,
+	stoppedBy string,
+) ([]shared.JobID, error) {
+	var ids []shared.JobID
+	for i, j := range s.jobs {
+		if j.RepositoryID == repositoryID && j.State == shared.JobStateWaiting && j.CreatedAt.Before(t) {
+			s.jobs[i].State = shared.JobStateExpired
+			s.jobs[i].StoppedBy = &stoppedBy
+			ids = append(ids, j.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *jobStore) CancelByID(id shared.JobID, userID string) error {
+	for i := range s.jobs {
+		if s.jobs[i].ID == id {
+			s.jobs[i].State = shared.JobStateCancelled
+			s.jobs[i].StoppedBy = &userID
+		}
+	}
+	return nil
+}
+
+type notifier struct {
+	ids []shared.JobID
+}
+
+func (n *notifier) Notify(id shared.JobID) error {
+	n.ids = append(n.ids, id)
+	return nil
+}
+
+func TestSweeper_Run(t *testing.T) {
+	now := time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC)
+	longAgo := now.Add(-time.Hour)
+	recently := now.Add(-time.Minute)
+
+	jobs := &jobStore{jobs: []store.Job{
+		{ID: "long-running", RepositoryID: "limited", State: shared.JobStateProcessing, StartedAt: &longAgo, CreatedAt: longAgo},
+		{ID: "running", RepositoryID: "limited", State: shared.JobStateProcessing, StartedAt: &recently, CreatedAt: longAgo},
+		{ID: "long-waiting", RepositoryID: "limited", State: shared.JobStateWaiting, CreatedAt: longAgo},
+		{ID: "waiting", RepositoryID: "limited", State: shared.JobStateWaiting, CreatedAt: recently},
+		{ID: "unlimited", RepositoryID: "unlimited", State: shared.JobStateProcessing, StartedAt: &longAgo, CreatedAt: longAgo},
+	}}
+	n := &notifier{}
+	s := sweeper.Sweeper{
+		JobStore: jobs,
+		RepositoryStore: &repositoryStore{repositories: []store.Repository{
+			{ID: "limited", Settings: store.RepositorySettings{JobTimeoutMinutes: 30, QueueTimeoutMinutes: 10}},
+			{ID: "unlimited"},
+		}},
+		Notify: n,
+	}
+
+	if err := s.Run(now); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[shared.JobID]shared.JobState{
+		"long-running": shared.JobStateCancelled,
+		"running":      shared.JobStateProcessing,
+		"long-waiting": shared.JobStateExpired,
+		"waiting":      shared.JobStateWaiting,
+		"unlimited":    shared.JobStateProcessing,
+	}
+	for _, j := range jobs.jobs {
+		if j.State != expected[j.ID] {
+			t.Errorf("expected job %s to have state %d, got %d", j.ID, expected[j.ID], j.State)
+		}
+	}
+
+	if *jobs.jobs[0].StoppedBy != sweeper.TimedOutBy || *jobs.jobs[2].StoppedBy != sweeper.ExpiredBy {
+		t.Error("expected the sweeper to be recorded as stopping the jobs")
+	}
+
+	if len(n.ids) != 2 {
+		t.Errorf("expected 2 notifications, got %d", len(n.ids))
+	}
+}
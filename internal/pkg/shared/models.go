@@ -44,6 +44,7 @@ const (
 	JobStateFailed     JobState = 2
 	JobStateSuccess    JobState = 3
 	JobStateCancelled  JobState = 4
+	JobStateExpired    JobState = 5
 
 	ContainerStateStarting ContainerState = 0
 	ContainerStateRunning  ContainerState = 1
@@ -128,6 +129,14 @@ type Commit struct {
 	Revision string
 }
 
+// PullRequest is used to denote the pull or merge request a job was started for
+type PullRequest struct {
+	Number       int64
+	SourceBranch string
+	TargetBranch string
+	Author       string
+}
+
 // Job is used to denote a job that should be processed
 type Job struct {
 	ID            JobID
@@ -135,6 +144,15 @@ type Job struct {
 	Repository    Repository
 	Commit        Commit
 	State         JobState
+
+	// Parameters are ad-hoc variables supplied when the job was started, available as brunel.parameters
+	Parameters map[string]string
+
+	// PullRequest is set when the job was started for a pull or merge request
+	PullRequest *PullRequest
+
+	// ChangedFiles are the files changed by the push that started the job, nil when they are not known
+	ChangedFiles []string
 }
 
 // Repository is used to denote a single VCS repository known to the system
@@ -0,0 +1,228 @@
+package remote
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	keySize = 2048
+
+	authorityValidity   = time.Hour * 24 * 365 * 10
+	certificateValidity = time.Hour * 24 * 365
+
+	certificateBlockType = "CERTIFICATE"
+	privateKeyBlockType  = "RSA PRIVATE KEY"
+	publicKeyBlockType   = "RSA PUBLIC KEY"
+)
+
+// Authority is the certificate authority used to issue server and runner certificates
+type Authority struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+func generateSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate serial number")
+	}
+	return serialNumber, nil
+}
+
+func encodeCertificate(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: certificateBlockType, Bytes: der}))
+}
+
+func encodeKey(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: privateKeyBlockType, Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+// GenerateRunnerKey generates a key pair for a runner enrolling with the server.
+// The PEM encoded private and public keys are returned.
+func GenerateRunnerKey() (string, string, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to generate private key")
+	}
+	public := pem.EncodeToMemory(&pem.Block{Type: publicKeyBlockType, Bytes: x509.MarshalPKCS1PublicKey(&priv.PublicKey)})
+	return encodeKey(priv), string(public), nil
+}
+
+// ParsePublicKey decodes a PEM encoded public key from GenerateRunnerKey
+func ParsePublicKey(key string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil || block.Type != publicKeyBlockType {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+	k, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	return k, errors.Wrap(err, "error parsing public key")
+}
+
+// ParseCertificate decodes the first PEM encoded certificate in cert
+func ParseCertificate(cert string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(cert))
+	if block == nil || block.Type != certificateBlockType {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	return c, errors.Wrap(err, "error parsing certificate")
+}
+
+// GenerateAuthority will generate a new certificate authority for issuing server and runner certificates
+func GenerateAuthority() (*Authority, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate private key")
+	}
+
+	serialNumber, err := generateSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName: commonName + " CA",
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(authorityValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create certificate")
+	}
+
+	return &Authority{
+		Cert: encodeCertificate(b),
+		Key:  encodeKey(priv),
+	}, nil
+}
+
+func (authority *Authority) parse() (*x509.Certificate, *rsa.PrivateKey, error) {
+	cert, err := ParseCertificate(authority.Cert)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing authority certificate")
+	}
+
+	block, _ := pem.Decode([]byte(authority.Key))
+	if block == nil || block.Type != privateKeyBlockType {
+		return nil, nil, errors.New("no PEM encoded authority key found")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing authority key")
+	}
+	return cert, key, nil
+}
+
+// SignRunner will sign a certificate for the runner public key with the runner name as its common name.
+// The PEM encoded certificate is returned.
+func (authority *Authority) SignRunner(name string, key *rsa.PublicKey) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("runner name cannot be empty")
+	}
+
+	return authority.sign(key, x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+// IssueRunner will issue a new set of client credentials for the runner with the given name
+func (authority *Authority) IssueRunner(name string) (*Credentials, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate private key")
+	}
+
+	cert, err := authority.SignRunner(name, &priv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credentials{
+		CA:   authority.Cert,
+		Cert: cert,
+		Key:  encodeKey(priv),
+	}, nil
+}
+
+// IssueServer will issue a new set of server credentials valid for the given host names or IP addresses
+func (authority *Authority) IssueServer(hosts []string) (*Credentials, error) {
+	template := x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(template.IPAddresses) == 0 && len(template.DNSNames) == 0 {
+		return nil, errors.New("at least one server host must be specified")
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate private key")
+	}
+
+	cert, err := authority.sign(&priv.PublicKey, template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credentials{
+		CA:   authority.Cert,
+		Cert: cert,
+		Key:  encodeKey(priv),
+	}, nil
+}
+
+func (authority *Authority) sign(key *rsa.PublicKey, template x509.Certificate) (string, error) {
+	caCert, caKey, err := authority.parse()
+	if err != nil {
+		return "", err
+	}
+
+	serialNumber, err := generateSerialNumber()
+	if err != nil {
+		return "", err
+	}
+
+	template.SerialNumber = serialNumber
+	template.NotBefore = time.Now()
+	template.NotAfter = time.Now().Add(certificateValidity)
+	template.KeyUsage = x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+	template.BasicConstraintsValid = true
+
+	b, err := x509.CreateCertificate(rand.Reader, &template, caCert, key, caKey)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create certificate")
+	}
+	return encodeCertificate(b), nil
+}
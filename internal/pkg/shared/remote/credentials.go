@@ -1,20 +1,17 @@
 package remote
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
-	"math/big"
-	"time"
+	"net"
 
 	"github.com/pkg/errors"
 )
 
-// Credentials contain the Certificate and Key required for TLS mutual auth between servers and agents
+// Credentials contain the Certificate and Key required for TLS mutual auth between servers and agents.
+// CA is the certificate of the authority that issued Cert, it is used for verifying the other end of the connection.
 type Credentials struct {
+	CA   string `yaml:"ca"`
 	Cert string `yaml:"cert"`
 	Key  string `yaml:"key"`
 }
@@ -23,16 +20,33 @@ const (
 	commonName = "brunel"
 )
 
-// ServerConfig gets TLS configuration appropriate for a server
-func (credentials *Credentials) ServerConfig() (*tls.Config, error) {
+// certPool returns a pool containing our certificate authority. Credentials generated before the introduction of
+// a certificate authority are self signed, in which case the certificate is its own authority.
+func (credentials *Credentials) certPool() (*x509.CertPool, error) {
+	ca := credentials.CA
+	if ca == "" {
+		ca = credentials.Cert
+	}
+
+	pool := x509.NewCertPool()
+	if ok := pool.AppendCertsFromPEM([]byte(ca)); !ok {
+		return nil, errors.New("error appending certificate to pool")
+	}
+	return pool, nil
+}
+
+// ServerConfig gets TLS configuration appropriate for a server. Client certificates with a serial number in the
+// revocation list file are rejected, the file is re-read for every handshake so revocations take effect immediately.
+// An empty revocationList disables revocation checks.
+func (credentials *Credentials) ServerConfig(revocationList string) (*tls.Config, error) {
 	cert, err := tls.X509KeyPair([]byte(credentials.Cert), []byte(credentials.Key))
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating key pair from credentials")
 	}
 
-	clientCertPool := x509.NewCertPool()
-	if ok := clientCertPool.AppendCertsFromPEM([]byte(credentials.Cert)); !ok {
-		return nil, errors.New("error appending certificate to pool")
+	clientCertPool, err := credentials.certPool()
+	if err != nil {
+		return nil, err
 	}
 
 	tlsConfig := &tls.Config{
@@ -43,61 +57,73 @@ func (credentials *Credentials) ServerConfig() (*tls.Config, error) {
 		MinVersion:               tls.VersionTLS12,
 	}
 
-	tlsConfig.BuildNameToCertificate()
+	if revocationList != "" {
+		tlsConfig.VerifyPeerCertificate = func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+			list, err := LoadRevocationList(revocationList)
+			if err != nil {
+				return err
+			}
+			for _, chain := range verifiedChains {
+				if len(chain) > 0 && list.IsRevoked(chain[0].SerialNumber) {
+					return errors.New("client certificate has been revoked")
+				}
+			}
+			return nil
+		}
+	}
+
 	return tlsConfig, nil
 }
 
-// ClientConfig gets TLS configuration appropriate for an agent client
-func (credentials *Credentials) ClientConfig() (*tls.Config, error) {
-	clientCertPool := x509.NewCertPool()
-	if ok := clientCertPool.AppendCertsFromPEM([]byte(credentials.Cert)); !ok {
-		return nil, errors.New("error appending certificate to pool")
+// ClientConfig gets TLS configuration appropriate for an agent client connecting to endpoint.
+// The host of the endpoint is verified against the server certificate.
+func (credentials *Credentials) ClientConfig(endpoint string) (*tls.Config, error) {
+	tlsConfig, err := credentials.EnrollmentConfig(endpoint)
+	if err != nil {
+		return nil, err
 	}
 
 	cert, err := tls.X509KeyPair([]byte(credentials.Cert), []byte(credentials.Key))
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating key pair from credentials")
 	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
 
-	return &tls.Config{
-		ServerName:   commonName,
-		Certificates: []tls.Certificate{cert},
-		RootCAs:      clientCertPool,
-	}, nil
+	return tlsConfig, nil
 }
 
-// GenerateCredentials will generate a new set of credentials for securing agent and server
-func GenerateCredentials() (*Credentials, error) {
-	priv, err := rsa.GenerateKey(rand.Reader, 2028)
+// EnrollmentConfig gets TLS configuration for an agent that has no client certificate yet, only the
+// certificate authority is required for verifying the server.
+func (credentials *Credentials) EnrollmentConfig(endpoint string) (*tls.Config, error) {
+	clientCertPool, err := credentials.certPool()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to generate private key")
+		return nil, err
 	}
 
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to generate serial number")
+	// Self signed credentials only ever contained our common name
+	serverName := commonName
+	if credentials.CA != "" {
+		serverName = endpoint
+		if host, _, err := net.SplitHostPort(endpoint); err == nil {
+			serverName = host
+		}
 	}
 
-	template := x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			CommonName: commonName,
-		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().Add(time.Hour * 24 * 265),
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-		BasicConstraintsValid: true,
-	}
+	return &tls.Config{
+		ServerName: serverName,
+		RootCAs:    clientCertPool,
+	}, nil
+}
 
-	b, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create certificate")
+// RunnerName returns the identity of the runner on the other end of a TLS connection, this is the common name
+// of the client certificate it presented.
+func RunnerName(state tls.ConnectionState) (string, error) {
+	if len(state.PeerCertificates) == 0 {
+		return "", errors.New("no client certificate presented")
 	}
-
-	return &Credentials{
-		Cert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b})),
-		Key:  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})),
-	}, nil
+	name := state.PeerCertificates[0].Subject.CommonName
+	if name == "" {
+		return "", errors.New("client certificate has no common name")
+	}
+	return name, nil
 }
@@ -0,0 +1,147 @@
+package remote_test
+
+import (
+	"crypto/tls"
+	"go-brunel/internal/pkg/shared/remote"
+	"go-brunel/test"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// handshake connects a client using the client credentials to a server using the server credentials,
+// returning the runner name seen by the server and any client side handshake error
+func handshake(t *testing.T, server *remote.Credentials, client *remote.Credentials, revocationList string) (string, error) {
+	serverConfig, err := server.ServerConfig(revocationList)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	names := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			names <- ""
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil {
+			names <- ""
+			return
+		}
+		name, _ := remote.RunnerName(tlsConn.ConnectionState())
+		names <- name
+		_, _ = conn.Read(make([]byte, 1))
+	}()
+
+	clientConfig, err := client.ClientConfig(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), clientConfig)
+	if err == nil {
+		// TLS 1.3 client certificate failures are only reported on the first read
+		_, err = conn.Write([]byte{0})
+		if err == nil {
+			_, err = conn.Read(make([]byte, 1))
+		}
+		conn.Close()
+	}
+	return <-names, err
+}
+
+func TestAuthority_IssueRunner(t *testing.T) {
+	authority, err := remote.GenerateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := authority.IssueServer([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := authority.IssueRunner("runner-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, _ := handshake(t, server, runner, "")
+	test.ExpectString(t, "runner-1", name)
+
+	// A runner issued by a different authority should be rejected
+	other, err := remote.GenerateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, err := other.IssueRunner("runner-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger.CA = authority.Cert
+
+	if name, err := handshake(t, server, stranger, ""); err == nil || name != "" {
+		t.Errorf("expecting runner from unknown authority to be rejected")
+	}
+}
+
+func TestAuthority_IssueRunnerEmptyName(t *testing.T) {
+	authority, err := remote.GenerateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = authority.IssueRunner("  ")
+	test.ExpectErrorLike(t, errors.New("runner name cannot be empty"), err)
+}
+
+func TestRevocationList_Revoke(t *testing.T) {
+	dir, err := ioutil.TempDir("", "brunel-revocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	listFile := filepath.Join(dir, "revoked.yaml")
+
+	authority, err := remote.GenerateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := authority.IssueServer([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := authority.IssueRunner("runner-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, _ := handshake(t, server, runner, listFile)
+	test.ExpectString(t, "runner-1", name)
+
+	list, err := remote.LoadRevocationList(listFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Revoke(runner.Cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Save(listFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if name, err := handshake(t, server, runner, listFile); err == nil || name != "" {
+		t.Errorf("expecting revoked runner to be rejected")
+	}
+}
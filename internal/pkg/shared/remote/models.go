@@ -52,3 +52,14 @@ type GetNextAvailableJobResponse struct {
 
 type Empty struct {
 }
+
+type EnrollRequest struct {
+	Token     string
+	PublicKey string
+}
+
+type EnrollResponse struct {
+	Name string
+	CA   string
+	Cert string
+}
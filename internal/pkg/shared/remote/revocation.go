@@ -0,0 +1,82 @@
+package remote
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// RevokedCertificate is a single certificate that should no longer be accepted by the server
+type RevokedCertificate struct {
+	Serial    string    `yaml:"serial"`
+	Name      string    `yaml:"name"`
+	RevokedAt time.Time `yaml:"revoked-at"`
+}
+
+// RevocationList holds all certificates revoked by the certificate authority
+type RevocationList struct {
+	Revoked []RevokedCertificate `yaml:"revoked"`
+}
+
+// LoadRevocationList reads the revocation list from file, a missing file is treated as an empty list
+func LoadRevocationList(file string) (*RevocationList, error) {
+	list := RevocationList{}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &list, nil
+		}
+		return nil, errors.Wrap(err, "error reading revocation list")
+	}
+
+	if err := yaml.Unmarshal(b, &list); err != nil {
+		return nil, errors.Wrap(err, "error decoding revocation list")
+	}
+	return &list, nil
+}
+
+// Save will write the revocation list to file
+func (list *RevocationList) Save(file string) error {
+	b, err := yaml.Marshal(list)
+	if err != nil {
+		return errors.Wrap(err, "error encoding revocation list")
+	}
+	return errors.Wrap(ioutil.WriteFile(file, b, 0600), "error writing revocation list")
+}
+
+// Revoke adds the PEM encoded certificate to the revocation list
+func (list *RevocationList) Revoke(cert string) error {
+	c, err := ParseCertificate(cert)
+	if err != nil {
+		return err
+	}
+	list.RevokeSerial(c.SerialNumber, c.Subject.CommonName)
+	return nil
+}
+
+// RevokeSerial adds the certificate serial number to the revocation list
+func (list *RevocationList) RevokeSerial(serial *big.Int, name string) {
+	if list.IsRevoked(serial) {
+		return
+	}
+	list.Revoked = append(list.Revoked, RevokedCertificate{
+		Serial:    serial.Text(16),
+		Name:      name,
+		RevokedAt: time.Now(),
+	})
+}
+
+// IsRevoked checks if the certificate serial number has been revoked
+func (list *RevocationList) IsRevoked(serial *big.Int) bool {
+	s := serial.Text(16)
+	for _, r := range list.Revoked {
+		if r.Serial == s {
+			return true
+		}
+	}
+	return false
+}
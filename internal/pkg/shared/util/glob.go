@@ -0,0 +1,54 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CompileGlob converts a path glob into a regular expression. '*' matches within a single path segment,
+// '**' matches across segments and '?' matches a single character other than '/'.
+func CompileGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+
+	glob = strings.TrimPrefix(glob, "/")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			i++
+			// '**/' also matches no directories at all
+			if i+1 < len(glob) && glob[i+1] == '/' {
+				i++
+				b.WriteString("(.*/)?")
+			} else {
+				b.WriteString(".*")
+			}
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// MatchAnyGlob returns true if any of the files match any of the globs
+func MatchAnyGlob(globs []string, files []string) (bool, error) {
+	for _, glob := range globs {
+		r, err := CompileGlob(glob)
+		if err != nil {
+			return false, err
+		}
+		for _, file := range files {
+			if r.MatchString(strings.TrimPrefix(file, "/")) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,59 @@
+package util_test
+
+import (
+	"fmt"
+	"go-brunel/internal/pkg/shared/util"
+	"testing"
+)
+
+func TestCompileGlob(t *testing.T) {
+	suites := []struct {
+		glob   string
+		file   string
+		expect bool
+	}{
+		{glob: "services/api/**", file: "services/api/main.go", expect: true},
+		{glob: "services/api/**", file: "services/api/internal/handler.go", expect: true},
+		{glob: "services/api/**", file: "services/web/main.go", expect: false},
+		{glob: "*.md", file: "README.md", expect: true},
+		{glob: "*.md", file: "docs/README.md", expect: false},
+		{glob: "**/*.md", file: "README.md", expect: true},
+		{glob: "**/*.md", file: "docs/guide/README.md", expect: true},
+		{glob: "/docs/?.txt", file: "docs/a.txt", expect: true},
+		{glob: "docs/?.txt", file: "docs/ab.txt", expect: false},
+		{glob: "go.(mod)", file: "go.mod", expect: false},
+	}
+
+	for i, suite := range suites {
+		t.Run(
+			fmt.Sprintf("suites[%d]", i),
+			func(t *testing.T) {
+				r, err := util.CompileGlob(suite.glob)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r.MatchString(suite.file) != suite.expect {
+					t.Errorf("expected glob '%s' matching '%s' to be %t", suite.glob, suite.file, suite.expect)
+				}
+			},
+		)
+	}
+}
+
+func TestMatchAnyGlob(t *testing.T) {
+	match, err := util.MatchAnyGlob([]string{"docs/**", "*.md"}, []string{"main.go", "docs/index.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("expected a file to match")
+	}
+
+	match, err = util.MatchAnyGlob([]string{"docs/**"}, []string{"main.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Error("expected no file to match")
+	}
+}
@@ -0,0 +1,115 @@
+package vcs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+const (
+	// diffDepth is the number of commits of the branch fetched to compare revisions, revisions further apart than
+	// this can not be compared
+	diffDepth = 250
+
+	// diffTimeout bounds fetching the commits to compare
+	diffTimeout = time.Minute
+)
+
+// Resolver looks up the revisions of remote repositories without cloning them
+type Resolver interface {
+	// Resolve returns the revision at the head of the branch in the remote repository
+	Resolve(repositoryURL string, branch string) (string, error)
+}
+
+// Differ compares revisions of remote repositories
+type Differ interface {
+	// ChangedFiles returns the files changed between the from and to revisions of the branch
+	ChangedFiles(repositoryURL string, branch string, from string, to string) ([]string, error)
+}
+
+type GitResolver struct {
+}
+
+func (s *GitResolver) Resolve(repositoryURL string, branch string) (string, error) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating in memory repository")
+	}
+
+	remote, err := repo.CreateRemote(&config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{repositoryURL},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error creating remote")
+	}
+
+	refs, err := remote.List(&git.ListOptions{})
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("error listing references for repository %s", repositoryURL))
+	}
+
+	name := plumbing.NewBranchReferenceName(strings.TrimPrefix(branch, "refs/heads/"))
+	for _, ref := range refs {
+		if ref.Name() == name {
+			return ref.Hash().String(), nil
+		}
+	}
+	return "", fmt.Errorf("branch %s not found in repository %s", branch, repositoryURL)
+}
+
+// ChangedFiles fetches the latest commits of the branch without their work tree into memory and compares the trees of
+// the revisions, which must both be among them
+func (s *GitResolver) ChangedFiles(repositoryURL string, branch string, from string, to string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), diffTimeout)
+	defer cancel()
+
+	repo, err := git.CloneContext(ctx, memory.NewStorage(), nil, &git.CloneOptions{
+		URL:           repositoryURL,
+		ReferenceName: plumbing.ReferenceName(branch),
+		SingleBranch:  true,
+		Depth:         diffDepth,
+		Tags:          git.NoTags,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("error fetching repository %s", repositoryURL))
+	}
+
+	var trees []*object.Tree
+	for _, revision := range []string{from, to} {
+		commit, err := repo.CommitObject(plumbing.NewHash(revision))
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("error getting commit %s", revision))
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("error getting tree of commit %s", revision))
+		}
+		trees = append(trees, tree)
+	}
+
+	changes, err := object.DiffTree(trees[0], trees[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "error comparing commits")
+	}
+
+	files := []string{}
+	for _, change := range changes {
+		// Renamed files have changed at both their old and new path
+		if change.From.Name != "" {
+			files = append(files, change.From.Name)
+		}
+		if change.To.Name != "" && change.To.Name != change.From.Name {
+			files = append(files, change.To.Name)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,86 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: go-brunel/internal/pkg/shared/vcs (interfaces: Resolver,Differ)
+
+// Package vcs is a generated GoMock package.
+package vcs
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	reflect "reflect"
+)
+
+// MockResolver is a mock of Resolver interface
+type MockResolver struct {
+	ctrl     *gomock.Controller
+	recorder *MockResolverMockRecorder
+}
+
+// MockResolverMockRecorder is the mock recorder for MockResolver
+type MockResolverMockRecorder struct {
+	mock *MockResolver
+}
+
+// NewMockResolver creates a new mock instance
+func NewMockResolver(ctrl *gomock.Controller) *MockResolver {
+	mock := &MockResolver{ctrl: ctrl}
+	mock.recorder = &MockResolverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockResolver) EXPECT() *MockResolverMockRecorder {
+	return m.recorder
+}
+
+// Resolve mocks base method
+func (m *MockResolver) Resolve(arg0, arg1 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resolve", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Resolve indicates an expected call of Resolve
+func (mr *MockResolverMockRecorder) Resolve(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resolve", reflect.TypeOf((*MockResolver)(nil).Resolve), arg0, arg1)
+}
+
+// MockDiffer is a mock of Differ interface
+type MockDiffer struct {
+	ctrl     *gomock.Controller
+	recorder *MockDifferMockRecorder
+}
+
+// MockDifferMockRecorder is the mock recorder for MockDiffer
+type MockDifferMockRecorder struct {
+	mock *MockDiffer
+}
+
+// NewMockDiffer creates a new mock instance
+func NewMockDiffer(ctrl *gomock.Controller) *MockDiffer {
+	mock := &MockDiffer{ctrl: ctrl}
+	mock.recorder = &MockDifferMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockDiffer) EXPECT() *MockDifferMockRecorder {
+	return m.recorder
+}
+
+// ChangedFiles mocks base method
+func (m *MockDiffer) ChangedFiles(arg0, arg1, arg2, arg3 string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangedFiles", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChangedFiles indicates an expected call of ChangedFiles
+func (mr *MockDifferMockRecorder) ChangedFiles(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangedFiles", reflect.TypeOf((*MockDiffer)(nil).ChangedFiles), arg0, arg1, arg2, arg3)
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"testing"
+	"time"
+)
+
+func TestAddContainer(t *testing.T) {
+	suites := setup(t)
+
+	for i, containerStore := range suites.containerStores {
+		jobID, cleanup := addJob(suites, i, t)
+		defer cleanup()
+
+		createdAt := time.Now().Truncate(time.Millisecond)
+		ids := []shared.ContainerID{
+			shared.ContainerID(fmt.Sprintf("service-%d", time.Now().UnixNano())),
+			shared.ContainerID(fmt.Sprintf("step-%d", time.Now().UnixNano())),
+		}
+		for n, id := range ids {
+			if err := containerStore.Add(store.Container{
+				JobID:       jobID,
+				ContainerID: id,
+				State:       shared.ContainerStateStarting,
+				Spec:        shared.Container{Image: "alpine", Args: []string{"echo", "hello"}},
+				Meta:        shared.ContainerMeta{StageID: "build", Service: n == 0},
+				CreatedAt:   createdAt.Add(time.Duration(n) * time.Second),
+			}); err != nil {
+				t.Fatalf("could not add container: %s", err)
+			}
+		}
+
+		startedAt := createdAt.Add(time.Minute)
+		stoppedAt := startedAt.Add(time.Minute)
+		if err := containerStore.UpdateStartedAtByContainerID(ids[1], startedAt); err != nil {
+			t.Fatalf("could not set container start time: %s", err)
+		}
+		if err := containerStore.UpdateStateByContainerID(ids[1], shared.ContainerStateStopped); err != nil {
+			t.Fatalf("could not set container state: %s", err)
+		}
+		if err := containerStore.UpdateStoppedAtByContainerID(ids[1], stoppedAt); err != nil {
+			t.Fatalf("could not set container stop time: %s", err)
+		}
+
+		state, err := containerStore.GetContainerState(ids[1])
+		if err != nil || state == nil || *state != shared.ContainerStateStopped {
+			t.Errorf("expected the container to be stopped, got %v: %v", state, err)
+		}
+
+		containers, err := containerStore.FilterByJobID(jobID)
+		if err != nil {
+			t.Fatalf("could not get containers: %s", err)
+		}
+		if len(containers) != 2 || containers[0].ContainerID != ids[0] || containers[1].ContainerID != ids[1] {
+			t.Fatalf("expected the containers of the job in the order they were created, got %+v", containers)
+		}
+
+		service, step := containers[0], containers[1]
+		if service.ID == "" || service.ID == step.ID {
+			t.Errorf("expected the containers to have their own ids, got '%s' and '%s'", service.ID, step.ID)
+		}
+		if service.JobID != jobID || !service.Meta.Service || service.Meta.StageID != "build" {
+			t.Errorf("expected the service container of the build stage, got %+v", service)
+		}
+		if service.Spec.Image != "alpine" || len(service.Spec.Args) != 2 {
+			t.Errorf("expected the container spec to be kept, got %+v", service.Spec)
+		}
+		if service.State != shared.ContainerStateStarting || service.StartedAt != nil {
+			t.Errorf("expected the service container to be left starting, got %+v", service)
+		}
+		if step.State != shared.ContainerStateStopped ||
+			step.StartedAt == nil || !step.StartedAt.Equal(startedAt) ||
+			step.StoppedAt == nil || !step.StoppedAt.Equal(stoppedAt) {
+			t.Errorf("expected the step container to be updated, got %+v", step)
+		}
+	}
+}
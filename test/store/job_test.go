@@ -8,8 +8,9 @@ import (
 	"time"
 )
 
-func addRepository(suite testSuite, t *testing.T) store.RepositoryID {
-	r, e := suite.repositoryStores[0].AddOrUpdate(store.Repository{
+// addRepository adds a repository for job tests, it must be added to the repository store of the job store's backend
+func addRepository(repositoryStore store.RepositoryStore, t *testing.T) store.RepositoryID {
+	r, e := repositoryStore.AddOrUpdate(store.Repository{
 		Project:   "project",
 		Name:      "name",
 		URI:       "uri",
@@ -22,18 +23,41 @@ func addRepository(suite testSuite, t *testing.T) store.RepositoryID {
 	return r.ID
 }
 
-func removeRepository(suite testSuite, t *testing.T, id store.RepositoryID) {
-	if e := suite.repositoryStores[0].Delete(id, true); e != nil {
+func removeRepository(repositoryStore store.RepositoryStore, t *testing.T, id store.RepositoryID) {
+	if e := repositoryStore.Delete(id, true); e != nil {
 		t.Fatalf("error deleting repository")
 	}
 }
 
+// addJob adds a job, in a new repository, to the backend at index i of the suite for the stage, container and log
+// tests. The returned function deletes both.
+func addJob(suites testSuite, i int, t *testing.T) (shared.JobID, func()) {
+	repoId := addRepository(suites.repositoryStores[i], t)
+	job, err := suites.jobStores[i].Add(store.Job{
+		RepositoryID: repoId,
+		Commit:       shared.Commit{Branch: "branch", Revision: "revision"},
+		State:        shared.JobStateProcessing,
+		StartedBy:    "startedBy",
+	})
+	if err != nil {
+		t.Fatalf("could not create job: %s", err)
+	}
+
+	return job.ID, func() {
+		if e := suites.jobStores[i].Delete(job.ID); e != nil {
+			t.Fatalf("error deleting job: %s", e)
+		}
+		removeRepository(suites.repositoryStores[i], t, repoId)
+	}
+}
+
 func TestAddJob(t *testing.T) {
 	suites := setup(t)
-	repoId := addRepository(suites, t)
-	defer removeRepository(suites, t, repoId)
 
-	for _, jobStore := range suites.jobStores {
+	for i, jobStore := range suites.jobStores {
+		repoId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, repoId)
+
 		now := time.Now()
 		job, err := jobStore.Add(store.Job{
 			RepositoryID:  repoId,
@@ -75,10 +99,11 @@ func TestAddJob(t *testing.T) {
 
 func TestUpdateJobStoppedAt(t *testing.T) {
 	suites := setup(t)
-	repoId := addRepository(suites, t)
-	defer removeRepository(suites, t, repoId)
 
-	for _, jobStore := range suites.jobStores {
+	for i, jobStore := range suites.jobStores {
+		repoId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, repoId)
+
 		now := time.Now()
 		job, err := jobStore.Add(store.Job{
 			RepositoryID:  repoId,
@@ -115,10 +140,11 @@ func TestUpdateJobStoppedAt(t *testing.T) {
 
 func TestUpdateJobCancelledBy(t *testing.T) {
 	suites := setup(t)
-	repoId := addRepository(suites, t)
-	defer removeRepository(suites, t, repoId)
 
-	for _, jobStore := range suites.jobStores {
+	for i, jobStore := range suites.jobStores {
+		repoId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, repoId)
+
 		job, err := jobStore.Add(store.Job{
 			RepositoryID:  repoId,
 			EnvironmentID: nil,
@@ -152,10 +178,11 @@ func TestUpdateJobCancelledBy(t *testing.T) {
 
 func TestUpdateJobUpdateState(t *testing.T) {
 	suites := setup(t)
-	repoId := addRepository(suites, t)
-	defer removeRepository(suites, t, repoId)
 
-	for _, jobStore := range suites.jobStores {
+	for i, jobStore := range suites.jobStores {
+		repoId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, repoId)
+
 		job, err := jobStore.Add(store.Job{
 			RepositoryID:  repoId,
 			EnvironmentID: nil,
@@ -189,12 +216,394 @@ func TestUpdateJobUpdateState(t *testing.T) {
 	}
 }
 
+func TestFindLatestJob(t *testing.T) {
+	suites := setup(t)
+
+	for i, jobStore := range suites.jobStores {
+		repoId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, repoId)
+
+		if _, err := jobStore.FindLatest(repoId, "branch", nil, "schedule"); err != store.ErrorNotFound {
+			t.Fatalf("expected no latest job, got: %v", err)
+		}
+
+		var ids []shared.JobID
+		for i := 0; i < 2; i++ {
+			job, err := jobStore.Add(store.Job{
+				RepositoryID: repoId,
+				Commit: shared.Commit{
+					Branch:   "branch",
+					Revision: "revision",
+				},
+				State:     shared.JobStateWaiting,
+				StartedBy: "schedule",
+			})
+			if err != nil {
+				t.Fatalf("could not create job: %e", err)
+			}
+			ids = append(ids, job.ID)
+			time.Sleep(time.Millisecond * 5)
+		}
+
+		latest, err := jobStore.FindLatest(repoId, "branch", nil, "schedule")
+		for _, id := range ids {
+			if e := jobStore.Delete(id); e != nil {
+				t.Fatalf("error deleting job: %s", e)
+			}
+		}
+		if err != nil {
+			t.Fatalf("could not find latest job: %s", err)
+		}
+		if latest.ID != ids[1] {
+			t.Errorf("expected latest job %s, got %s", ids[1], latest.ID)
+		}
+	}
+}
+
+func TestFindActiveJobsByPullRequest(t *testing.T) {
+	suites := setup(t)
+
+	for i, jobStore := range suites.jobStores {
+		repoId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, repoId)
+
+		var ids []shared.JobID
+		for _, state := range []shared.JobState{shared.JobStateWaiting, shared.JobStateSuccess} {
+			job, err := jobStore.Add(store.Job{
+				RepositoryID: repoId,
+				Commit: shared.Commit{
+					Branch:   "feature",
+					Revision: "revision",
+				},
+				State:     state,
+				StartedBy: "startedBy",
+				PullRequest: &shared.PullRequest{
+					Number:       7,
+					SourceBranch: "feature",
+					TargetBranch: "master",
+					Author:       "author",
+				},
+			})
+			if err != nil {
+				t.Fatalf("could not create job: %e", err)
+			}
+			ids = append(ids, job.ID)
+		}
+
+		active, err := jobStore.FindActiveByPullRequest(repoId, 7)
+		for _, id := range ids {
+			if e := jobStore.Delete(id); e != nil {
+				t.Fatalf("error deleting job: %s", e)
+			}
+		}
+		if err != nil {
+			t.Fatalf("could not find pull request jobs: %s", err)
+		}
+		if len(active) != 1 || active[0].ID != ids[0] {
+			t.Errorf("expected only the waiting pull request job")
+		}
+		if active[0].PullRequest == nil || active[0].PullRequest.TargetBranch != "master" {
+			t.Errorf("expected pull request details to be stored")
+		}
+	}
+}
+
+func TestNextJobConcurrencyLimit(t *testing.T) {
+	suites := setup(t)
+
+	for i, jobStore := range suites.jobStores {
+		repoId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, repoId)
+
+		if e := suites.repositoryStores[i].SetSettings(repoId, store.RepositorySettings{MaxConcurrentJobs: 1}); e != nil {
+			t.Fatalf("error setting repository settings: %s", e)
+		}
+
+		var ids []shared.JobID
+		for i := 0; i < 2; i++ {
+			job, err := jobStore.Add(store.Job{
+				RepositoryID: repoId,
+				Commit: shared.Commit{
+					Branch:   "branch",
+					Revision: "revision",
+				},
+				State:     shared.JobStateWaiting,
+				StartedBy: "startedBy",
+			})
+			if err != nil {
+				t.Fatalf("could not create job: %e", err)
+			}
+			ids = append(ids, job.ID)
+		}
+
+		first, firstErr := jobStore.Next("runner")
+		second, secondErr := jobStore.Next("runner")
+		active, activeErr := jobStore.FindActiveByBranch(repoId, "branch")
+
+		for _, id := range ids {
+			if e := jobStore.Delete(id); e != nil {
+				t.Fatalf("error deleting job: %s", e)
+			}
+		}
+
+		if firstErr != nil || secondErr != nil || activeErr != nil {
+			t.Fatalf("error getting next jobs: %v %v %v", firstErr, secondErr, activeErr)
+		}
+		if first == nil || first.ID != ids[0] {
+			t.Errorf("expected the oldest job to be claimed first")
+		}
+		if second != nil {
+			t.Errorf("expected no job to be claimed while the repository is at its limit")
+		}
+		if len(active) != 2 {
+			t.Errorf("expected both jobs to be active, got %d", len(active))
+		}
+	}
+}
+
+func TestNextJobSkipsRepositoriesAtLimit(t *testing.T) {
+	suites := setup(t)
+
+	for i, jobStore := range suites.jobStores {
+		limitedId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, limitedId)
+
+		if e := suites.repositoryStores[i].SetSettings(limitedId, store.RepositorySettings{MaxConcurrentJobs: 1}); e != nil {
+			t.Fatalf("error setting repository settings: %s", e)
+		}
+
+		other, e := suites.repositoryStores[i].AddOrUpdate(store.Repository{
+			Project: "project",
+			Name:    "other",
+			URI:     "uri",
+		})
+		if e != nil {
+			t.Fatalf("error creating repository")
+		}
+		defer removeRepository(suites.repositoryStores[i], t, other.ID)
+
+		var ids []shared.JobID
+		add := func(repositoryID store.RepositoryID, state shared.JobState, priority int) shared.JobID {
+			job, err := jobStore.Add(store.Job{
+				RepositoryID: repositoryID,
+				Commit: shared.Commit{
+					Branch:   "branch",
+					Revision: "revision",
+				},
+				State:     state,
+				StartedBy: "startedBy",
+				Priority:  priority,
+			})
+			if err != nil {
+				t.Fatalf("could not create job: %e", err)
+			}
+			ids = append(ids, job.ID)
+			return job.ID
+		}
+
+		add(limitedId, shared.JobStateProcessing, 0)
+		add(limitedId, shared.JobStateWaiting, 10)
+		lower := add(other.ID, shared.JobStateWaiting, 0)
+
+		next, err := jobStore.Next("runner")
+
+		for _, id := range ids {
+			if e := jobStore.Delete(id); e != nil {
+				t.Fatalf("error deleting job: %s", e)
+			}
+		}
+
+		if err != nil {
+			t.Fatalf("error getting next job: %s", err)
+		}
+		if next == nil || next.ID != lower {
+			t.Errorf("expected the lower priority job of the repository below its limit to be claimed, got %+v", next)
+		}
+	}
+}
+
+func TestNextJobPriorityAndFairness(t *testing.T) {
+	suites := setup(t)
+
+	for i, jobStore := range suites.jobStores {
+		busyId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, busyId)
+
+		other, e := suites.repositoryStores[i].AddOrUpdate(store.Repository{
+			Project: "project",
+			Name:    "other",
+			URI:     "uri",
+		})
+		if e != nil {
+			t.Fatalf("error creating repository")
+		}
+		defer removeRepository(suites.repositoryStores[i], t, other.ID)
+
+		add := func(repositoryID store.RepositoryID, priority int) shared.JobID {
+			job, err := jobStore.Add(store.Job{
+				RepositoryID: repositoryID,
+				Commit: shared.Commit{
+					Branch:   "branch",
+					Revision: "revision",
+				},
+				State:     shared.JobStateWaiting,
+				StartedBy: "startedBy",
+				Priority:  priority,
+			})
+			if err != nil {
+				t.Fatalf("could not create job: %e", err)
+			}
+			return job.ID
+		}
+
+		busyFirst := add(busyId, 0)
+		add(busyId, 0)
+		otherFirst := add(other.ID, 0)
+		urgent := add(busyId, 10)
+
+		var order []shared.JobID
+		for i := 0; i < 4; i++ {
+			job, err := jobStore.Next("runner")
+			if err != nil {
+				t.Fatalf("error getting next job: %s", err)
+			}
+			if job == nil {
+				t.Fatalf("expected a waiting job")
+			}
+			order = append(order, job.ID)
+			if e := jobStore.Delete(job.ID); e != nil {
+				t.Fatalf("error deleting job: %s", e)
+			}
+		}
+
+		if order[0] != urgent {
+			t.Errorf("expected the highest priority job to be claimed first")
+		}
+		if order[1] != otherFirst {
+			t.Errorf("expected the other repository to take its turn")
+		}
+		if order[2] != busyFirst {
+			t.Errorf("expected the oldest job of the busy repository")
+		}
+	}
+}
+
+func TestExpireWaitingJobs(t *testing.T) {
+	suites := setup(t)
+
+	for i, jobStore := range suites.jobStores {
+		repoId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, repoId)
+
+		var ids []shared.JobID
+		for _, state := range []shared.JobState{shared.JobStateWaiting, shared.JobStateProcessing} {
+			job, err := jobStore.Add(store.Job{
+				RepositoryID: repoId,
+				Commit: shared.Commit{
+					Branch:   "branch",
+					Revision: "revision",
+				},
+				State:     state,
+				StartedBy: "startedBy",
+			})
+			if err != nil {
+				t.Fatalf("could not create job: %e", err)
+			}
+			ids = append(ids, job.ID)
+		}
+
+		notYet, notYetErr := jobStore.ExpireWaitingCreatedBefore(repoId, time.Now().Add(-time.Hour), "expired")
+		expired, expiredErr := jobStore.ExpireWaitingCreatedBefore(repoId, time.Now().Add(time.Minute), "expired")
+		waiting, getErr := jobStore.Get(ids[0])
+
+		for _, id := range ids {
+			if e := jobStore.Delete(id); e != nil {
+				t.Fatalf("error deleting job: %s", e)
+			}
+		}
+
+		if notYetErr != nil || expiredErr != nil || getErr != nil {
+			t.Fatalf("error expiring jobs: %v %v %v", notYetErr, expiredErr, getErr)
+		}
+		if len(notYet) != 0 {
+			t.Errorf("expected no jobs to expire before their deadline")
+		}
+		if len(expired) != 1 || expired[0] != ids[0] {
+			t.Errorf("expected only the waiting job to expire")
+		}
+		if waiting.State != shared.JobStateExpired || waiting.StoppedBy == nil || *waiting.StoppedBy != "expired" {
+			t.Errorf("expected the waiting job to be expired")
+		}
+	}
+}
+
+func TestFindStoppedJobsAndDelete(t *testing.T) {
+	suites := setup(t)
+
+	for i, jobStore := range suites.jobStores {
+		repoId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, repoId)
+
+		var ids []shared.JobID
+		for _, state := range []shared.JobState{shared.JobStateSuccess, shared.JobStateWaiting, shared.JobStateFailed} {
+			job, err := jobStore.Add(store.Job{
+				RepositoryID: repoId,
+				Commit: shared.Commit{
+					Branch:   "branch",
+					Revision: "revision",
+				},
+				State:     state,
+				StartedBy: "startedBy",
+			})
+			if err != nil {
+				t.Fatalf("could not create job: %e", err)
+			}
+			ids = append(ids, job.ID)
+		}
+
+		if e := suites.deliveryStores[i].Add(store.NotificationDelivery{
+			JobID:     ids[0],
+			URL:       "http://example.com",
+			CreatedAt: time.Now(),
+		}); e != nil {
+			t.Fatalf("could not add delivery: %s", e)
+		}
+
+		stopped, stoppedErr := jobStore.FindStoppedByRepositoryID(repoId)
+
+		for _, id := range ids {
+			if e := jobStore.Delete(id); e != nil {
+				t.Fatalf("error deleting job: %s", e)
+			}
+		}
+
+		if stoppedErr != nil {
+			t.Fatalf("error finding stopped jobs: %s", stoppedErr)
+		}
+		if len(stopped) != 2 || stopped[0].ID != ids[0] || stopped[1].ID != ids[2] {
+			t.Errorf("expected the stopped jobs oldest first, got %+v", stopped)
+		}
+
+		if _, e := jobStore.Get(ids[0]); e != store.ErrorNotFound {
+			t.Errorf("expected the deleted job to be not found, got %v", e)
+		}
+		deliveries, e := suites.deliveryStores[i].Filter(ids[0], 0, 10)
+		if e != nil {
+			t.Fatalf("could not filter deliveries: %s", e)
+		}
+		if len(deliveries) != 0 {
+			t.Errorf("expected the deliveries of the deleted job to be deleted")
+		}
+	}
+}
+
 func TestFilterJobsByRepositoryID(t *testing.T) {
 	suites := setup(t)
-	repoId := addRepository(suites, t)
-	defer removeRepository(suites, t, repoId)
 
-	for _, jobStore := range suites.jobStores {
+	for i, jobStore := range suites.jobStores {
+		repoId := addRepository(suites.repositoryStores[i], t)
+		defer removeRepository(suites.repositoryStores[i], t, repoId)
+
 		jobOne, err := jobStore.Add(store.Job{
 			RepositoryID:  repoId,
 			EnvironmentID: nil,
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/server/store/chunk"
+	"go-brunel/internal/pkg/shared"
+	"go-brunel/test"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// chunkStorages returns the storages of the chunk log stores under test, in short mode only the file storage
+func chunkStorages(t *testing.T) ([]chunk.Storage, func()) {
+	dir, err := ioutil.TempDir("", "brunel-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storages := []chunk.Storage{&chunk.FileStorage{Path: dir}}
+	if s3Endpoint != "" && !testing.Short() {
+		storages = append(storages, &chunk.S3Storage{
+			Endpoint:  s3Endpoint,
+			Bucket:    "brunel-logs",
+			Region:    "us-east-1",
+			AccessKey: "minioadmin",
+			SecretKey: "minioadmin",
+		})
+	}
+	return storages, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestFilterLogByJobIDFromTime(t *testing.T) {
+	suites := setup(t)
+
+	for i, logStore := range suites.logStores {
+		jobID, cleanup := addJob(suites, i, t)
+		defer cleanup()
+
+		// Lines are logged out of order, as they can arrive from a runner, and read back in the order of their time
+		start := time.Now().Truncate(time.Millisecond)
+		for _, n := range []int{3, 0, 4, 1, 2} {
+			if e := logStore.Log(store.Log{
+				JobID:   jobID,
+				Message: fmt.Sprintf("line %d", n),
+				LogType: shared.LogTypeStdOut,
+				StageID: "build",
+				Time:    start.Add(time.Duration(n) * time.Second),
+			}); e != nil {
+				t.Fatalf("could not log: %s", e)
+			}
+		}
+
+		logs, err := logStore.FilterLogByJobIDFromTime(jobID, start.Add(time.Second))
+		if err != nil {
+			t.Fatalf("error reading logs: %s", err)
+		}
+		if len(logs) != 4 {
+			t.Fatalf("expected the lines from line 1, got %d lines", len(logs))
+		}
+		for n, l := range logs {
+			test.ExpectString(t, fmt.Sprintf("line %d", n+1), l.Message)
+			if l.JobID != jobID || l.StageID != "build" || l.LogType != shared.LogTypeStdOut {
+				t.Errorf("expected the line of the build stage to be kept, got %+v", l)
+			}
+		}
+	}
+}
+
+func TestFilterContainerLogByContainerIDFromTime(t *testing.T) {
+	suites := setup(t)
+
+	for _, logStore := range suites.logStores {
+		id := shared.ContainerID(fmt.Sprintf("container-%d", time.Now().UnixNano()))
+
+		start := time.Now().Truncate(time.Millisecond)
+		for _, n := range []int{3, 0, 4, 1, 2} {
+			if e := logStore.ContainerLog(store.ContainerLog{
+				ContainerID: id,
+				Message:     fmt.Sprintf("line %d", n),
+				LogType:     shared.LogTypeStdErr,
+				Time:        start.Add(time.Duration(n) * time.Second),
+			}); e != nil {
+				t.Fatalf("could not log: %s", e)
+			}
+		}
+
+		logs, err := logStore.FilterContainerLogByContainerIDFromTime(id, start.Add(2*time.Second))
+		if err != nil {
+			t.Fatalf("error reading container logs: %s", err)
+		}
+		if len(logs) != 3 {
+			t.Fatalf("expected the lines from line 2, got %d lines", len(logs))
+		}
+		for n, l := range logs {
+			test.ExpectString(t, fmt.Sprintf("line %d", n+2), l.Message)
+			if l.ContainerID != id || l.LogType != shared.LogTypeStdErr {
+				t.Errorf("expected the line of the container to be kept, got %+v", l)
+			}
+		}
+	}
+}
+
+func TestChunkContainerLogs(t *testing.T) {
+	storages, cleanup := chunkStorages(t)
+	defer cleanup()
+
+	for _, storage := range storages {
+		logStore := &chunk.LogStore{Storage: storage, ChunkLines: 100, FlushAge: time.Hour}
+		id := shared.ContainerID(fmt.Sprintf("container-%d", time.Now().UnixNano()))
+
+		start := time.Now().Truncate(time.Millisecond)
+		for i := 0; i < 250; i++ {
+			if e := logStore.ContainerLog(store.ContainerLog{
+				ContainerID: id,
+				Message:     fmt.Sprintf("line %d", i),
+				LogType:     shared.LogTypeStdErr,
+				Time:        start.Add(time.Duration(i) * time.Millisecond),
+			}); e != nil {
+				t.Fatalf("could not log: %s", e)
+			}
+		}
+
+		logs, err := logStore.FilterContainerLogByContainerIDFromTime(id, start.Add(120*time.Millisecond))
+		deleteErr := logStore.DeleteContainerLog(id)
+		if err != nil || deleteErr != nil {
+			t.Fatalf("error reading container logs: %v %v", err, deleteErr)
+		}
+
+		if len(logs) != 130 || logs[0].Message != "line 120" || logs[129].Message != "line 249" {
+			t.Errorf("expected the lines from line 120, got %d lines", len(logs))
+		}
+		if logs[0].LogType != shared.LogTypeStdErr {
+			t.Errorf("expected the log type to be kept")
+		}
+
+		deleted, err := (&chunk.LogStore{Storage: storage}).FilterContainerLogByContainerIDFromTime(id, time.Time{})
+		if err != nil || len(deleted) != 0 {
+			t.Errorf("expected the deleted logs to be gone, got %d lines: %v", len(deleted), err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"go-brunel/test"
+	"testing"
+	"time"
+)
+
+func TestFilterNotificationDeliveries(t *testing.T) {
+	suite := setup(t)
+
+	for _, deliveryStore := range suite.deliveryStores {
+		jobID := shared.JobID(fmt.Sprintf("job-%d", time.Now().UnixNano()))
+		for attempt := 1; attempt <= 3; attempt++ {
+			if e := deliveryStore.Add(store.NotificationDelivery{
+				JobID:      jobID,
+				URL:        "http://example.com",
+				Attempt:    attempt,
+				StatusCode: 500,
+				CreatedAt:  time.Now().Add(time.Duration(attempt) * time.Second),
+			}); e != nil {
+				t.Fatalf("could not add delivery: %s", e)
+			}
+		}
+
+		deliveries, err := deliveryStore.Filter(jobID, 0, 2)
+		if err != nil {
+			t.Fatalf("could not filter deliveries: %s", err)
+		}
+
+		if len(deliveries) != 2 {
+			t.Fatalf("expected a page of 2 deliveries, got %d", len(deliveries))
+		}
+		test.ExpectString(t, "http://example.com", deliveries[0].URL)
+		if deliveries[0].Attempt != 3 {
+			t.Errorf("expected the newest delivery first")
+		}
+	}
+}
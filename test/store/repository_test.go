@@ -276,3 +276,47 @@ func TestSetTriggerRepository(t *testing.T) {
 		}
 	}
 }
+
+func TestSetSettingsRepository(t *testing.T) {
+	suite := setup(t)
+
+	for _, repositoryStore := range suite.repositoryStores {
+		repo, err := repositoryStore.AddOrUpdate(store.Repository{
+			Project: "project",
+			Name:    "name",
+			URI:     "http://uri.com",
+		})
+		if err != nil {
+			t.Fatalf("error saving repository: %s", err)
+		}
+
+		if e := repositoryStore.SetSettings(repo.ID, store.RepositorySettings{
+			MaxConcurrentJobs: 2,
+			Supersede:         store.RepositorySupersedeModeAll,
+		}); e != nil {
+			t.Errorf("error setting settings: %s", e)
+		}
+
+		// Hook events update repositories without settings, which should leave them untouched
+		if _, err := repositoryStore.AddOrUpdate(store.Repository{
+			Project: "project",
+			Name:    "name",
+			URI:     "http://uri.com",
+		}); err != nil {
+			t.Fatalf("error updating repository: %s", err)
+		}
+
+		getRepo, err := repositoryStore.Get(repo.ID)
+		if err != nil {
+			t.Errorf("error getting repository: %s", err)
+		}
+
+		if getRepo.Settings.MaxConcurrentJobs != 2 || getRepo.Settings.Supersede != store.RepositorySupersedeModeAll {
+			t.Errorf("repository settings do not match")
+		}
+
+		if e := repositoryStore.Delete(repo.ID, true); e != nil {
+			t.Fatalf("error deleting repository: %s", e)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/test"
+	"testing"
+	"time"
+)
+
+func TestConsumeEnrollmentToken(t *testing.T) {
+	suite := setup(t)
+
+	for _, enrollmentStore := range suite.enrollmentStores {
+		token, err := enrollmentStore.Add(store.EnrollmentToken{
+			Name:      "runner",
+			Hash:      "hash",
+			CreatedBy: "createdBy",
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("could not create enrollment token: %s", err)
+		}
+
+		consumed, err := enrollmentStore.Consume("hash")
+		if err != nil {
+			t.Errorf("could not consume enrollment token: %s", err)
+		} else {
+			test.ExpectString(t, "runner", consumed.Name)
+			if consumed.UsedAt == nil {
+				t.Errorf("consumed token should have a used at time")
+			}
+		}
+
+		// Tokens are single use
+		_, err = enrollmentStore.Consume("hash")
+		test.ExpectError(t, store.ErrorNotFound, err)
+
+		if e := enrollmentStore.Delete(token.ID); e != nil {
+			t.Fatalf("error deleting enrollment token: %s", e)
+		}
+	}
+}
+
+func TestRevokeEnrollmentToken(t *testing.T) {
+	suite := setup(t)
+
+	for _, enrollmentStore := range suite.enrollmentStores {
+		token, err := enrollmentStore.Add(store.EnrollmentToken{
+			Name:      "runner",
+			Hash:      "hash",
+			CreatedBy: "createdBy",
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("could not create enrollment token: %s", err)
+		}
+
+		if err := enrollmentStore.Revoke(token.ID); err != nil {
+			t.Errorf("could not revoke enrollment token: %s", err)
+		}
+
+		_, err = enrollmentStore.Consume("hash")
+		test.ExpectError(t, store.ErrorNotFound, err)
+
+		if e := enrollmentStore.Delete(token.ID); e != nil {
+			t.Fatalf("error deleting enrollment token: %s", e)
+		}
+	}
+}
+
+func TestConsumeExpiredEnrollmentToken(t *testing.T) {
+	suite := setup(t)
+
+	for _, enrollmentStore := range suite.enrollmentStores {
+		token, err := enrollmentStore.Add(store.EnrollmentToken{
+			Name:      "runner",
+			Hash:      "hash",
+			CreatedBy: "createdBy",
+			ExpiresAt: time.Now().Add(-time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("could not create enrollment token: %s", err)
+		}
+
+		_, err = enrollmentStore.Consume("hash")
+		test.ExpectError(t, store.ErrorNotFound, err)
+
+		if e := enrollmentStore.Delete(token.ID); e != nil {
+			t.Fatalf("error deleting enrollment token: %s", e)
+		}
+	}
+}
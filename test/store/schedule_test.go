@@ -0,0 +1,70 @@
+package store
+
+import (
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"testing"
+	"time"
+)
+
+func TestClaimScheduledRun(t *testing.T) {
+	suite := setup(t)
+
+	for _, scheduleStore := range suite.scheduleStores {
+		tick := time.Now().Truncate(time.Minute)
+		run := store.ScheduledRun{
+			RepositoryID: store.RepositoryID(fmt.Sprintf("repository-%d", time.Now().UnixNano())),
+			Trigger:      "0 * * * *@master#",
+			Tick:         tick,
+		}
+		if err := scheduleStore.Claim(run); err != nil {
+			t.Fatalf("could not claim scheduled run: %s", err)
+		}
+		if err := scheduleStore.Claim(run); err != store.ErrorConflict {
+			t.Errorf("expected a claimed tick to not be claimed again, got %v", err)
+		}
+
+		run.Tick = tick.Add(-time.Hour)
+		if err := scheduleStore.Claim(run); err != store.ErrorConflict {
+			t.Errorf("expected an earlier tick to not be claimed, got %v", err)
+		}
+
+		run.Tick = tick.Add(time.Hour)
+		if err := scheduleStore.Claim(run); err != nil {
+			t.Errorf("expected the next tick to be claimed, got %v", err)
+		}
+	}
+}
+
+func TestReleaseScheduledRun(t *testing.T) {
+	suite := setup(t)
+
+	for _, scheduleStore := range suite.scheduleStores {
+		tick := time.Now().Truncate(time.Minute)
+		run := store.ScheduledRun{
+			RepositoryID: store.RepositoryID(fmt.Sprintf("repository-%d", time.Now().UnixNano())),
+			Trigger:      "0 * * * *@master#",
+			Tick:         tick,
+		}
+		if err := scheduleStore.Claim(run); err != nil {
+			t.Fatalf("could not claim scheduled run: %s", err)
+		}
+
+		// Releasing a tick that is no longer the last run keeps the claim
+		earlier := run
+		earlier.Tick = tick.Add(-time.Hour)
+		if err := scheduleStore.Release(earlier); err != nil {
+			t.Fatalf("could not release scheduled run: %s", err)
+		}
+		if err := scheduleStore.Claim(run); err != store.ErrorConflict {
+			t.Errorf("expected the claim to be kept, got %v", err)
+		}
+
+		if err := scheduleStore.Release(run); err != nil {
+			t.Fatalf("could not release scheduled run: %s", err)
+		}
+		if err := scheduleStore.Claim(run); err != nil {
+			t.Errorf("expected a released tick to be claimed again, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/internal/pkg/shared"
+	"testing"
+	"time"
+)
+
+func TestAddOrUpdateStage(t *testing.T) {
+	suites := setup(t)
+
+	for i, stageStore := range suites.stageStores {
+		jobID, cleanup := addJob(suites, i, t)
+		defer cleanup()
+
+		startedAt := time.Now().Truncate(time.Millisecond)
+		for _, stage := range []store.Stage{
+			{ID: "build", JobID: jobID, State: shared.StageStateRunning, StartedAt: &startedAt},
+			{ID: "test", JobID: jobID, State: shared.StageStateError},
+		} {
+			if err := stageStore.AddOrUpdate(stage); err != nil {
+				t.Fatalf("could not add stage: %s", err)
+			}
+		}
+
+		// Updating the state keeps the times of the stage that are not set
+		stoppedAt := startedAt.Add(time.Second)
+		if err := stageStore.AddOrUpdate(store.Stage{
+			ID:        "build",
+			JobID:     jobID,
+			State:     shared.StageStateSuccess,
+			StoppedAt: &stoppedAt,
+		}); err != nil {
+			t.Fatalf("could not update stage: %s", err)
+		}
+
+		stages, err := stageStore.FindAllByJobID(jobID)
+		if err != nil {
+			t.Fatalf("could not get stages: %s", err)
+		}
+		if len(stages) != 2 {
+			t.Fatalf("expected 2 stages, got %d", len(stages))
+		}
+
+		for _, stage := range stages {
+			if stage.JobID != jobID {
+				t.Errorf("expected stage %s of job %s, got %s", stage.ID, jobID, stage.JobID)
+			}
+			switch stage.ID {
+			case "build":
+				if stage.State != shared.StageStateSuccess {
+					t.Errorf("expected the build stage to be updated, got state %d", stage.State)
+				}
+				if stage.StartedAt == nil || !stage.StartedAt.Equal(startedAt) {
+					t.Errorf("expected the build stage to keep its start time, got %v", stage.StartedAt)
+				}
+				if stage.StoppedAt == nil || !stage.StoppedAt.Equal(stoppedAt) {
+					t.Errorf("expected the build stage to be stopped at %s, got %v", stoppedAt, stage.StoppedAt)
+				}
+			case "test":
+				if stage.State != shared.StageStateError || stage.StartedAt != nil {
+					t.Errorf("expected the test stage to have failed without starting, got %+v", stage)
+				}
+			default:
+				t.Errorf("unexpected stage %s", stage.ID)
+			}
+		}
+
+		others, err := stageStore.FindAllByJobID(jobID + "-other")
+		if err != nil || len(others) != 0 {
+			t.Errorf("expected no stages for another job, got %d: %v", len(others), err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"fmt"
+	"go-brunel/internal/pkg/server/store"
+	"go-brunel/test"
+	"testing"
+	"time"
+)
+
+func TestUsePersonalToken(t *testing.T) {
+	suite := setup(t)
+
+	for _, tokenStore := range suite.tokenStores {
+		username := fmt.Sprintf("user-%d", time.Now().UnixNano())
+		hash := fmt.Sprintf("hash-%d", time.Now().UnixNano())
+		token, err := tokenStore.Add(store.PersonalToken{
+			Username: username,
+			Name:     "ci",
+			Hash:     hash,
+			ReadOnly: true,
+		})
+		if err != nil {
+			t.Fatalf("could not add token: %s", err)
+		}
+
+		used := time.Now().Add(time.Minute)
+		token, err = tokenStore.Use(hash, used)
+		if err != nil {
+			t.Fatalf("could not use token: %s", err)
+		}
+		test.ExpectString(t, username, token.Username)
+		if !token.ReadOnly || token.LastUsedAt == nil || used.Sub(*token.LastUsedAt) >= time.Millisecond {
+			t.Errorf("expected a read only token last used at %s, got %+v", used, token)
+		}
+
+		// Uses within the interval are not recorded, later ones are
+		token, err = tokenStore.Use(hash, used.Add(store.PersonalTokenUseInterval/2))
+		if err != nil {
+			t.Fatalf("could not use token: %s", err)
+		}
+		if token.LastUsedAt == nil || used.Sub(*token.LastUsedAt) >= time.Millisecond {
+			t.Errorf("expected a use within the interval to keep the last use at %s, got %v", used, token.LastUsedAt)
+		}
+		later := used.Add(store.PersonalTokenUseInterval * 2)
+		token, err = tokenStore.Use(hash, later)
+		if err != nil {
+			t.Fatalf("could not use token: %s", err)
+		}
+		if token.LastUsedAt == nil || later.Sub(*token.LastUsedAt) >= time.Millisecond {
+			t.Errorf("expected a later use to be recorded at %s, got %v", later, token.LastUsedAt)
+		}
+
+		tokens, err := tokenStore.FilterByUsername(username)
+		if err != nil {
+			t.Fatalf("could not filter tokens: %s", err)
+		}
+		if len(tokens) != 1 || tokens[0].LastUsedAt == nil {
+			t.Fatalf("expected the used token, got %+v", tokens)
+		}
+
+		if e := tokenStore.Revoke("someone else", token.ID); e != store.ErrorNotFound {
+			t.Errorf("expected the tokens of other users to not be revoked, got %v", e)
+		}
+		if e := tokenStore.Revoke(username, token.ID); e != nil {
+			t.Fatalf("could not revoke token: %s", e)
+		}
+		if _, e := tokenStore.Use(hash, time.Now()); e != store.ErrorNotFound {
+			t.Errorf("expected a revoked token to not be usable, got %v", e)
+		}
+		if e := tokenStore.Revoke(username, token.ID); e != store.ErrorNotFound {
+			t.Errorf("expected a revoked token to not be revoked again, got %v", e)
+		}
+	}
+}
+
+func TestUseExpiredPersonalToken(t *testing.T) {
+	suite := setup(t)
+
+	for _, tokenStore := range suite.tokenStores {
+		hash := fmt.Sprintf("hash-%d", time.Now().UnixNano())
+		expiresAt := time.Now().Add(time.Hour)
+		if _, err := tokenStore.Add(store.PersonalToken{
+			Username:  "user",
+			Name:      "ci",
+			Hash:      hash,
+			ExpiresAt: &expiresAt,
+		}); err != nil {
+			t.Fatalf("could not add token: %s", err)
+		}
+
+		if _, err := tokenStore.Use(hash, time.Now()); err != nil {
+			t.Errorf("expected an unexpired token to be usable, got %v", err)
+		}
+		if _, err := tokenStore.Use(hash, expiresAt.Add(time.Second)); err != store.ErrorNotFound {
+			t.Errorf("expected an expired token to not be usable, got %v", err)
+		}
+		if _, err := tokenStore.Use("unknown", time.Now()); err != store.ErrorNotFound {
+			t.Errorf("expected an unknown token to not be usable, got %v", err)
+		}
+	}
+}
@@ -149,3 +149,46 @@ func TestFilterUser(t *testing.T) {
 		}
 	}
 }
+
+func TestSetNotificationPreferences(t *testing.T) {
+	suite := setup(t)
+
+	for _, userStore := range suite.userStores {
+		if _, err := userStore.AddOrUpdate(store.User{Username: "username", Email: "email"}); err != nil {
+			t.Fatalf("could not create user: %s", err)
+		}
+
+		err := userStore.SetNotificationPreferences("username", store.NotificationPreferences{
+			Email:    store.EmailNotificationModeNever,
+			Watching: []store.RepositoryID{"repository"},
+		})
+		if err != nil {
+			t.Fatalf("could not set notification preferences: %s", err)
+		}
+
+		// Logging in again must not reset the preferences
+		if _, err := userStore.AddOrUpdate(store.User{Username: "username", Email: "email"}); err != nil {
+			t.Fatalf("could not update user: %s", err)
+		}
+
+		watchers, err := userStore.FindWatchers("repository")
+		if e := userStore.Delete("username", true); e != nil {
+			t.Fatalf("could not delete test user: %s", e)
+		}
+		if err != nil {
+			t.Fatalf("could not find watchers: %s", err)
+		}
+
+		if len(watchers) != 1 {
+			t.Fatalf("expected 1 watcher, got %d", len(watchers))
+		}
+		test.ExpectString(t, "username", watchers[0].Username)
+		if watchers[0].Notifications.Email != store.EmailNotificationModeNever {
+			t.Errorf("expected email notifications to be never, got %d", watchers[0].Notifications.Email)
+		}
+
+		if err := userStore.SetNotificationPreferences("missing", store.NotificationPreferences{}); err != store.ErrorNotFound {
+			t.Errorf("expected not found for a missing user, got %v", err)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import {
 
 import {RepositoryJobPage, JobState, RepositoryJob, Repository, UserRole} from '../../../services';
 import {RepositoryTriggers} from './RepositoryTriggers';
+import {RepositorySettings} from './RepositorySettings';
 import {useHasRole} from '../../layout/hooks';
 
 interface Props {
@@ -110,6 +111,10 @@ function jobStatus(classes: any, state: JobState): React.ReactNode {
 		return <Tooltip title={'Cancelled'}>
 			<Icon className={classes.cancelled}>cancel</Icon>
 		</Tooltip>;
+	case JobState.Expired:
+		return <Tooltip title={'Expired'}>
+			<Icon className={classes.cancelled}>timer_off</Icon>
+		</Tooltip>;
 	case JobState.Success:
 		return <Tooltip title={'Success'}><Icon color="primary"
 			style={{color: 'rgb(0, 100, 0)', position: 'relative', top: 3}} >
@@ -151,6 +156,7 @@ export function RepositoryJobsComponent(
 			<h1>{repository.Project}/{repository.Name}</h1>
 			<h4>{repository.URI}</h4>
 			{isAdmin && <RepositoryTriggers id={repository.ID} triggers={repository.Triggers}/>}
+			{isAdmin && <RepositorySettings id={repository.ID} settings={repository.Settings}/>}
 			<React.Fragment>
 				<TextField className={classes.search}
 					label="Search by branch, revision or user"
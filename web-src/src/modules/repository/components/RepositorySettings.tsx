@@ -0,0 +1,143 @@
+import React, {useState, useEffect} from 'react';
+import {
+	Theme,
+	makeStyles,
+	createStyles,
+	Grid,
+	Button,
+	Divider,
+	TextField,
+	Select,
+	MenuItem,
+	FormControl,
+	InputLabel,
+	ExpansionPanel,
+	ExpansionPanelActions,
+	ExpansionPanelDetails,
+	ExpansionPanelSummary,
+} from '@material-ui/core';
+import ExpandMoreIcon from '@material-ui/icons/ExpandMore';
+import {Alert} from '@material-ui/lab';
+
+import {
+	RepositorySettings as Settings,
+	RepositorySupersedeMode,
+	RepositoryService,
+} from '../../../services';
+import {useDependency} from '../../../container';
+
+const useStyles = makeStyles((theme: Theme) => createStyles({
+	'settings': {
+		marginBottom: theme.spacing(2),
+	},
+}));
+
+interface Props {
+	id: string;
+	settings?: Settings;
+}
+
+const defaultSettings: Settings = {
+	MaxConcurrentJobs: 0,
+	Supersede: RepositorySupersedeMode.None,
+	JobTimeoutMinutes: 0,
+	QueueTimeoutMinutes: 0,
+};
+
+const isCount = (value: number) => Number.isInteger(value) && value >= 0;
+
+export function RepositorySettings(props: Props) {
+	const classes = useStyles({});
+	const repositoryService = useDependency(RepositoryService);
+	const [settings, setSettings] = useState<Settings>(props.settings || defaultSettings);
+	const [error, setError] = useState<string | undefined>();
+
+	useEffect(
+		() => {
+			setSettings(props.settings || defaultSettings);
+			setError(undefined);
+		},
+		[props],
+	);
+
+	const isValid = isCount(settings.MaxConcurrentJobs) &&
+		isCount(settings.JobTimeoutMinutes) &&
+		isCount(settings.QueueTimeoutMinutes);
+
+	const onSave = (settings: Settings) => {
+		repositoryService
+			.setSettings(props.id, settings)
+			.subscribe(
+				() => {
+					setError(undefined);
+				},
+				() => {
+					setError('Failed to save repository settings.');
+				},
+			);
+	};
+
+	return <ExpansionPanel className={classes.settings}>
+		<ExpansionPanelSummary expandIcon={<ExpandMoreIcon />}>
+			<p style={{margin: 0}}>Concurrency and Timeouts</p>
+		</ExpansionPanelSummary>
+		<ExpansionPanelDetails>
+			<Grid container spacing={3}>
+				<Grid item xs={12} md={6}>
+					<TextField
+						label="Max concurrent jobs"
+						type="number"
+						value={settings.MaxConcurrentJobs}
+						fullWidth
+						error={!isCount(settings.MaxConcurrentJobs)}
+						helperText='0 is unlimited'
+						onChange={(e) => setSettings({...settings, MaxConcurrentJobs: Number(e.target.value)})} />
+				</Grid>
+				<Grid item xs={12} md={6}>
+					<FormControl fullWidth>
+						<InputLabel>Superseded jobs</InputLabel>
+						<Select
+							value={settings.Supersede}
+							onChange={(e) => setSettings({...settings, Supersede: e.target.value as number})}
+						>
+							<MenuItem value={RepositorySupersedeMode.None}>Keep</MenuItem>
+							<MenuItem value={RepositorySupersedeMode.Waiting}>Cancel waiting</MenuItem>
+							<MenuItem value={RepositorySupersedeMode.All}>Cancel waiting and running</MenuItem>
+						</Select>
+					</FormControl>
+				</Grid>
+				<Grid item xs={12} md={6}>
+					<TextField
+						label="Job timeout (minutes)"
+						type="number"
+						value={settings.JobTimeoutMinutes}
+						fullWidth
+						error={!isCount(settings.JobTimeoutMinutes)}
+						helperText='Running jobs are cancelled after this long, 0 is unlimited'
+						onChange={(e) => setSettings({...settings, JobTimeoutMinutes: Number(e.target.value)})} />
+				</Grid>
+				<Grid item xs={12} md={6}>
+					<TextField
+						label="Queue timeout (minutes)"
+						type="number"
+						value={settings.QueueTimeoutMinutes}
+						fullWidth
+						error={!isCount(settings.QueueTimeoutMinutes)}
+						helperText='Waiting jobs expire after this long, 0 is unlimited'
+						onChange={(e) => setSettings({...settings, QueueTimeoutMinutes: Number(e.target.value)})} />
+				</Grid>
+				{error && <Grid item xs={12} >
+					<Alert severity='error'>
+						{error}
+					</Alert>
+				</Grid>}
+			</Grid>
+		</ExpansionPanelDetails>
+		<Divider />
+		<ExpansionPanelActions>
+			<Button disabled={!isValid} size="small" color="primary" onClick={() => onSave(settings)}>
+				Save
+			</Button>
+		</ExpansionPanelActions>
+	</ExpansionPanel>;
+}
@@ -54,6 +54,9 @@ export function RepositoryTriggers(props: Props) {
 	);
 
 	const isTriggerValid = (trigger: RepositoryTrigger) => {
+		if (trigger && trigger.Type === RepositoryTriggerType.Schedule) {
+			return (trigger.Schedule || '').trim().length > 0 && (trigger.Branch || '').trim().length > 0;
+		}
 		return trigger && trigger.Pattern.trim().length > 0 && trigger.Pattern.trim().length < 100;
 	};
 
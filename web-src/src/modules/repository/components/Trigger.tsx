@@ -26,9 +26,16 @@ interface TriggerProps {
 	isValid: boolean;
 }
 
+const splitGlobs = (value: string) => value.split(',').map((g) => g.trim()).filter((g) => g.length > 0);
+
 export function Trigger({trigger, onRemove, onChange, isValid}: TriggerProps) {
 	const [reference, setReference] = useState(trigger.Pattern);
 	const [referenceType, setReferenceType] = useState(trigger.Type);
+	const [schedule, setSchedule] = useState(trigger.Schedule || '');
+	const [branch, setBranch] = useState(trigger.Branch || '');
+	const [paths, setPaths] = useState((trigger.Paths || []).join(', '));
+	const [ignorePaths, setIgnorePaths] = useState((trigger.IgnorePaths || []).join(', '));
+	const [priority, setPriority] = useState(trigger.Priority || 0);
 	const [environmentId, setEnvironmentId] = useState<string | undefined>(
 		trigger.EnvironmentID,
 	);
@@ -36,9 +43,25 @@ export function Trigger({trigger, onRemove, onChange, isValid}: TriggerProps) {
 	useEffect(() => {
 		setReference(trigger.Pattern);
 		setReferenceType(trigger.Type);
+		setSchedule(trigger.Schedule || '');
+		setBranch(trigger.Branch || '');
+		setPaths((trigger.Paths || []).join(', '));
+		setIgnorePaths((trigger.IgnorePaths || []).join(', '));
+		setPriority(trigger.Priority || 0);
 		setEnvironmentId(trigger.EnvironmentID);
 	}, [trigger]);
 
+	const current = (): RepositoryTrigger => ({
+		Type: referenceType,
+		Pattern: reference,
+		Schedule: schedule,
+		Branch: branch,
+		Paths: splitGlobs(paths),
+		IgnorePaths: splitGlobs(ignorePaths),
+		Priority: priority,
+		EnvironmentID: environmentId,
+	});
+
 	return <React.Fragment>
 		<Grid item xs={12} md={3}>
 			<FormControl fullWidth>
@@ -47,55 +70,113 @@ export function Trigger({trigger, onRemove, onChange, isValid}: TriggerProps) {
 					value={referenceType}
 					onChange={(e) => {
 						setReferenceType(e.target.value as number);
-						onChange({
-							Type: e.target.value as number,
-							Pattern: reference,
-							EnvironmentID: environmentId,
-						});
+						onChange({...current(), Type: e.target.value as number});
 					}}
 				>
 					<MenuItem value={RepositoryTriggerType.Branch}>Branch</MenuItem>
 					<MenuItem value={RepositoryTriggerType.Tag}>Tag</MenuItem>
+					<MenuItem value={RepositoryTriggerType.Schedule}>Schedule</MenuItem>
+					<MenuItem value={RepositoryTriggerType.PullRequest}>Pull Request</MenuItem>
 				</Select>
 			</FormControl>
 		</Grid>
-		<Grid item xs={12} md={4}>
-			<TextField
-				InputProps={{
-					startAdornment: (<InputAdornment position="end">
-						/
-					</InputAdornment>),
-					endAdornment: (<InputAdornment position="end">
-						/
-					</InputAdornment>),
-				}}
-				label="Pattern"
-				required
-				value={reference}
-				fullWidth
-				error={!isValid}
-				helperText={(!isValid) ? 'You must enter a pattern for matching branches or tags' : undefined}
-				onChange={(e) => {
-					setReference(e.target.value);
-					onChange({
-						Type: referenceType,
-						Pattern: e.target.value,
-						EnvironmentID: environmentId,
-					});
-				}} />
-		</Grid>
+		{referenceType === RepositoryTriggerType.Schedule ?
+			<React.Fragment>
+				<Grid item xs={12} md={2}>
+					<TextField
+						label="Schedule"
+						placeholder="0 2 * * *"
+						required
+						value={schedule}
+						fullWidth
+						error={!isValid}
+						helperText={(!isValid) ? 'You must enter a cron schedule and branch' : undefined}
+						onChange={(e) => {
+							setSchedule(e.target.value);
+							onChange({...current(), Schedule: e.target.value});
+						}} />
+				</Grid>
+				<Grid item xs={12} md={2}>
+					<TextField
+						label="Branch"
+						required
+						value={branch}
+						fullWidth
+						error={!isValid}
+						onChange={(e) => {
+							setBranch(e.target.value);
+							onChange({...current(), Branch: e.target.value});
+						}} />
+				</Grid>
+			</React.Fragment> :
+			<Grid item xs={12} md={4}>
+				<TextField
+					InputProps={{
+						startAdornment: (<InputAdornment position="end">
+							/
+						</InputAdornment>),
+						endAdornment: (<InputAdornment position="end">
+							/
+						</InputAdornment>),
+					}}
+					label="Pattern"
+					required
+					value={reference}
+					fullWidth
+					error={!isValid}
+					helperText={(!isValid) ? 'You must enter a pattern for matching branches or tags' : undefined}
+					onChange={(e) => {
+						setReference(e.target.value);
+						onChange({...current(), Pattern: e.target.value});
+					}} />
+			</Grid>
+		}
 		<Grid item xs={12} md={4}>
 			<RepositoryEnvironmentSelection
 				value={environmentId}
 				onChange={(e) => {
 					setEnvironmentId(e);
-					onChange({
-						Type: referenceType,
-						Pattern: reference,
-						EnvironmentID: e,
-					});
+					onChange({...current(), EnvironmentID: e});
+				}} />
+		</Grid>
+		<Grid item xs={12} md={2}>
+			<TextField
+				label="Priority"
+				type="number"
+				value={priority}
+				fullWidth
+				onChange={(e) => {
+					const value = parseInt(e.target.value, 10) || 0;
+					setPriority(value);
+					onChange({...current(), Priority: value});
 				}} />
 		</Grid>
+		{referenceType !== RepositoryTriggerType.Schedule &&
+			<React.Fragment>
+				<Grid item xs={12} md={6}>
+					<TextField
+						label="Paths"
+						placeholder="services/api/**, go.mod"
+						value={paths}
+						fullWidth
+						onChange={(e) => {
+							setPaths(e.target.value);
+							onChange({...current(), Paths: splitGlobs(e.target.value)});
+						}} />
+				</Grid>
+				<Grid item xs={12} md={6}>
+					<TextField
+						label="Ignore paths"
+						placeholder="**/*.md"
+						value={ignorePaths}
+						fullWidth
+						onChange={(e) => {
+							setIgnorePaths(e.target.value);
+							onChange({...current(), IgnorePaths: splitGlobs(e.target.value)});
+						}} />
+				</Grid>
+			</React.Fragment>
+		}
 		<Hidden mdUp>
 			<Grid item xs={12}>
 				<Button color='secondary' variant='outlined' fullWidth onClick={() => onRemove()} >
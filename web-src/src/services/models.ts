@@ -11,10 +11,21 @@ export interface Job {
 	StartedAt: string;
 	StoppedAt: string;
 	StoppedBy: string;
+	Runner: string;
 	Duration: string | number;
 	State: JobState;
 	Commit: Commit;
 	Repository: Repository;
+	Parameters?: {[name: string]: string};
+	PullRequest?: PullRequest;
+	Priority: number;
+}
+
+export interface PullRequest {
+	Number: number;
+	SourceBranch: string;
+	TargetBranch: string;
+	Author: string;
 }
 
 export interface Log {
@@ -88,7 +99,8 @@ export enum JobState {
 	Processing = 1,
 	Failed = 2,
 	Success = 3,
-	Cancelled = 4
+	Cancelled = 4,
+	Expired = 5,
 }
 
 export interface RepositoryJobPage {
@@ -116,18 +128,39 @@ export interface Repository {
 	Name: string;
 	URI: string;
 	Triggers: RepositoryTrigger[];
+	Settings: RepositorySettings;
 	CreatedAt: string;
 }
 
+export interface RepositorySettings {
+	MaxConcurrentJobs: number;
+	Supersede: RepositorySupersedeMode;
+	JobTimeoutMinutes: number;
+	QueueTimeoutMinutes: number;
+}
+
+export enum RepositorySupersedeMode {
+	None = 0,
+	Waiting = 1,
+	All = 2,
+}
+
 export interface RepositoryTrigger {
 	Type: RepositoryTriggerType;
 	Pattern: string;
 	EnvironmentID?: string;
+	Schedule?: string;
+	Branch?: string;
+	Paths?: string[];
+	IgnorePaths?: string[];
+	Priority?: number;
 }
 
 export enum RepositoryTriggerType {
 	Tag = 0,
-	Branch = 1
+	Branch = 1,
+	Schedule = 2,
+	PullRequest = 3,
 }
 
 export enum EnvironmentVariableType {
@@ -154,3 +187,11 @@ export enum UserRole {
 	Admin = 'admin',
 	Reader = 'reader',
 }
+
+export interface RunRequest {
+	Branch: string;
+	Revision?: string;
+	EnvironmentID?: string;
+	Variables?: {[name: string]: string};
+	Priority?: number;
+}
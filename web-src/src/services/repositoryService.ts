@@ -3,7 +3,7 @@ import {Observable, from, throwError} from 'rxjs';
 import {switchMap} from 'rxjs/operators';
 
 import {AuthService} from './authService';
-import {RepositoryTrigger, Repository, RepositoryJobPage} from './models';
+import {RepositoryTrigger, RepositorySettings, Repository, RepositoryJobPage, Job, RunRequest} from './models';
 import {handleResponse} from './util';
 
 @injectable()
@@ -27,6 +27,35 @@ export class RepositoryService {
 		);
 	}
 
+	setSettings(id: string, settings: RepositorySettings): Observable<{}> {
+		return from(fetch(
+			`/api/repository/${id}/settings`,
+			{
+				method: 'PUT',
+				headers: this._authService.getAuthHeaders(),
+				body: JSON.stringify(settings),
+			},
+		)).pipe(
+			switchMap((response) => response.ok ?
+				response.text() :
+				throwError(new Error(response.statusText)),
+			),
+		);
+	}
+
+	run(id: string, request: RunRequest): Observable<Job> {
+		return from(fetch(
+			`/api/repository/${id}/jobs`,
+			{
+				method: 'POST',
+				headers: this._authService.getAuthHeaders(),
+				body: JSON.stringify(request),
+			},
+		)).pipe(
+			switchMap(handleResponse),
+		);
+	}
+
 	list(filter = ''): Observable<Repository[]> {
 		const query = new URLSearchParams({
 			filter: filter.toString(),